@@ -0,0 +1,285 @@
+// auth authenticates the gRPC requests with static API keys or JWT bearer tokens.
+// The principal of an authenticated request is added to its context, so it can be logged and rate limited.
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// These are the metadata keys of the credentials.
+// The API key can be sent in its own metadata or as a bearer token.
+const (
+	AuthorizationHeader = "authorization"
+	APIKeyHeader        = "x-api-key"
+)
+
+// bearerPrefix is the prefix of the bearer tokens in the authorization metadata.
+const bearerPrefix = "bearer "
+
+// These are the ways a principal can be authenticated.
+const (
+	MethodAPIKey = "api-key"
+	MethodJWT    = "jwt"
+)
+
+// These are the log fields of the principal.
+const (
+	LogFieldPrincipal = "auth.principal"
+	LogFieldMethod    = "auth.method"
+)
+
+// These errors are returned to the clients, the reason of the failure is only logged by the server.
+var (
+	errMissingCredentials = status.Error(codes.Unauthenticated, "missing credentials")
+	errInvalidCredentials = status.Error(codes.Unauthenticated, "invalid credentials")
+)
+
+// Principal is the authenticated client of a request.
+type Principal struct {
+	// Name is the name of the API key or the subject of the token.
+	Name string
+
+	// Method is the way the principal is authenticated, one of the Method constants.
+	Method string
+}
+
+// Key returns the method and the name of the principal as "method:name",
+// so an API key and a token subject with the same name are never the same client.
+// Example: "api-key:partner"
+func (p Principal) Key() string {
+	return p.Method + ":" + p.Name
+}
+
+// ctxMarker is the context key of the principal.
+type ctxMarker struct{}
+
+// FromContext returns the principal of the given context.
+// It returns false if the request is not authenticated.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxMarker{}).(Principal)
+	return p, ok
+}
+
+// NewContext returns a new context with the given principal.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxMarker{}, p)
+}
+
+// Settings holds the settings of the authenticator.
+// At least one of the API keys and the JWT verifier is required.
+type Settings struct {
+	// APIKeys maps the API keys to their names.
+	APIKeys map[string]string
+
+	// JWT verifies the bearer tokens, it can be nil.
+	JWT *JWTVerifier
+
+	// ExemptServices are the full names of the services which do not require authentication.
+	// Example: "grpc.health.v1.Health"
+	ExemptServices []string
+
+	// OnFailure is called with the reason of every failed authentication, it can be nil.
+	OnFailure func(ctx context.Context, err error)
+}
+
+// Authenticator authenticates the requests with the API keys and the JWT verifier.
+type Authenticator struct {
+	// apiKeys maps the SHA-256 hashes of the API keys to their names,
+	// so the keys are not compared byte by byte and are not kept in memory.
+	apiKeys map[[sha256.Size]byte]string
+
+	jwt *JWTVerifier
+
+	exempt map[string]bool
+
+	onFailure func(ctx context.Context, err error)
+}
+
+// NewAuthenticator returns a new Authenticator with the given settings.
+func NewAuthenticator(settings Settings) (*Authenticator, error) {
+	if len(settings.APIKeys) == 0 && settings.JWT == nil {
+		return nil, errors.New("authentication requires API keys or a JWT verifier")
+	}
+
+	a := &Authenticator{
+		apiKeys:   make(map[[sha256.Size]byte]string, len(settings.APIKeys)),
+		jwt:       settings.JWT,
+		exempt:    make(map[string]bool),
+		onFailure: settings.OnFailure,
+	}
+	for key, name := range settings.APIKeys {
+		a.apiKeys[sha256.Sum256([]byte(key))] = name
+	}
+	for _, service := range settings.ExemptServices {
+		a.exempt[service] = true
+	}
+	return a, nil
+}
+
+// Authenticate returns the principal of the credentials in the incoming metadata of the given context.
+// A bearer token with three parts is verified as a JWT, any other bearer token is looked up as an API key.
+func (a *Authenticator) Authenticate(ctx context.Context) (Principal, error) {
+	md, _ := grpc_metadata.FromIncomingContext(ctx)
+
+	if values := md.Get(AuthorizationHeader); len(values) > 0 {
+		value := values[0]
+		if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			return Principal{}, errors.New("authorization metadata is not a bearer token")
+		}
+		token := strings.TrimSpace(value[len(bearerPrefix):])
+		if strings.Count(token, ".") == 2 {
+			return a.authenticateJWT(token)
+		}
+		return a.authenticateAPIKey(token)
+	}
+
+	if values := md.Get(APIKeyHeader); len(values) > 0 {
+		return a.authenticateAPIKey(values[0])
+	}
+	return Principal{}, errMissingCredentials
+}
+
+// authenticateJWT verifies the given token.
+func (a *Authenticator) authenticateJWT(token string) (Principal, error) {
+	if a.jwt == nil {
+		return Principal{}, errors.New("jwt authentication is disabled")
+	}
+	subject, err := a.jwt.Verify(token)
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Name: subject, Method: MethodJWT}, nil
+}
+
+// authenticateAPIKey looks up the given API key.
+func (a *Authenticator) authenticateAPIKey(key string) (Principal, error) {
+	name, ok := a.apiKeys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Principal{}, errors.New("api key is not known")
+	}
+	return Principal{Name: name, Method: MethodAPIKey}, nil
+}
+
+// authenticate authenticates the request of the given method and returns the context with its principal.
+// The principal is also added to the tags of the request, so it is logged.
+func (a *Authenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.exempt[serviceName(fullMethod)] {
+		return ctx, nil
+	}
+
+	p, err := a.Authenticate(ctx)
+	if err != nil {
+		if a.onFailure != nil {
+			a.onFailure(ctx, err)
+		}
+		if err == errMissingCredentials {
+			return nil, err
+		}
+		return nil, errInvalidCredentials
+	}
+
+	grpc_ctxtags.Extract(ctx).Set(LogFieldPrincipal, p.Name).Set(LogFieldMethod, p.Method)
+	return NewContext(ctx, p), nil
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor which rejects the unauthenticated requests.
+// A nil Authenticator returns an interceptor which does nothing.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if a == nil {
+			return handler(ctx, req)
+		}
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a new stream server interceptor which rejects the unauthenticated requests.
+// A nil Authenticator returns an interceptor which does nothing.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if a == nil {
+			return handler(srv, stream)
+		}
+		ctx, err := a.authenticate(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// serviceName returns the service name of the given full method name.
+// Example: "/grpc.health.v1.Health/Check" -> "grpc.health.v1.Health"
+func serviceName(fullMethod string) string {
+	service, _, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service
+}
+
+// authenticatedStream replaces the context of a server stream with the context which has the principal.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context which has the principal.
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// LoadAPIKeys loads the API keys from the given file and returns them mapped to their names.
+// Every line is a name and a key separated by a colon, the empty lines and the lines starting with # are skipped.
+// Example: "partner:5d2c9f0e8b7a"
+func LoadAPIKeys(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the API keys file : %v", err)
+	}
+	defer file.Close()
+
+	keys := make(map[string]string)
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, key, ok := strings.Cut(line, ":")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid API key at line %d, it must be name:key", lineNumber)
+		}
+		if _, ok := keys[key]; ok {
+			return nil, fmt.Errorf("duplicate API key at line %d", lineNumber)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("duplicate API key name at line %d : %s", lineNumber, name)
+		}
+		keys[key] = name
+		names[name] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the API keys file : %v", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("API keys file has no keys : %v", path)
+	}
+	return keys, nil
+}
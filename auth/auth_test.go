@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestAuthenticator returns an authenticator with a single API key and an HMAC verifier.
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	verifier, err := NewJWTVerifier(JWTSettings{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.now = func() time.Time { return testNow }
+
+	a, err := NewAuthenticator(Settings{
+		APIKeys: map[string]string{"secret-key": "partner"},
+		JWT:     verifier,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := newTestAuthenticator(t)
+	token := signToken(t, algorithmHS256, testSecret, validClaims())
+
+	tests := map[string]struct {
+		Metadata []string
+		Expected Principal
+		Valid    bool
+	}{
+		"api key metadata": {
+			Metadata: []string{APIKeyHeader, "secret-key"},
+			Expected: Principal{Name: "partner", Method: MethodAPIKey},
+			Valid:    true,
+		},
+		"api key bearer": {
+			Metadata: []string{AuthorizationHeader, "Bearer secret-key"},
+			Expected: Principal{Name: "partner", Method: MethodAPIKey},
+			Valid:    true,
+		},
+		"jwt bearer": {
+			Metadata: []string{AuthorizationHeader, "bearer " + token},
+			Expected: Principal{Name: "partner", Method: MethodJWT},
+			Valid:    true,
+		},
+		"unknown api key": {
+			Metadata: []string{APIKeyHeader, "other-key"},
+			Valid:    false,
+		},
+		"basic authorization": {
+			Metadata: []string{AuthorizationHeader, "Basic c2VjcmV0LWtleQ=="},
+			Valid:    false,
+		},
+		"invalid jwt": {
+			Metadata: []string{AuthorizationHeader, "Bearer " + token + "x"},
+			Valid:    false,
+		},
+		"no credentials": {
+			Metadata: []string{},
+			Valid:    false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := grpc_metadata.NewIncomingContext(context.Background(), grpc_metadata.Pairs(test.Metadata...))
+			p, err := a.Authenticate(ctx)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if p != test.Expected {
+				t.Errorf("principal = %v; want %v", p, test.Expected)
+			}
+		})
+	}
+}
+
+// principalHealthServer records the principals and the tags of the requests.
+type principalHealthServer struct {
+	*health.Server
+	principals chan Principal
+	tags       chan interface{}
+}
+
+// Check records the principal and its tag of the request.
+func (s *principalHealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	p, _ := FromContext(ctx)
+	s.principals <- p
+	s.tags <- grpc_ctxtags.Extract(ctx).Values()[LogFieldPrincipal]
+	return s.Server.Check(ctx, req)
+}
+
+// Watch records the principal and its tag of the request.
+func (s *principalHealthServer) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	p, _ := FromContext(stream.Context())
+	s.principals <- p
+	s.tags <- grpc_ctxtags.Extract(stream.Context()).Values()[LogFieldPrincipal]
+	return s.Server.Watch(req, stream)
+}
+
+// newAuthenticatedHealthClient starts a health server behind the given authenticator and returns its client.
+func newAuthenticatedHealthClient(t *testing.T, a *Authenticator) (grpc_health_v1.HealthClient, *principalHealthServer) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc_middleware.WithUnaryServerChain(grpc_ctxtags.UnaryServerInterceptor(), a.UnaryServerInterceptor()),
+		grpc_middleware.WithStreamServerChain(grpc_ctxtags.StreamServerInterceptor(), a.StreamServerInterceptor()),
+	)
+	healthServer := &principalHealthServer{Server: health.NewServer(), principals: make(chan Principal, 10), tags: make(chan interface{}, 10)}
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn), healthServer
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	var failures int
+	a := newTestAuthenticator(t)
+	a.onFailure = func(context.Context, error) { failures++ }
+	client, server := newAuthenticatedHealthClient(t, a)
+
+	tests := map[string]struct {
+		Metadata     []string
+		ExpectedCode codes.Code
+	}{
+		"authenticated":  {Metadata: []string{APIKeyHeader, "secret-key"}, ExpectedCode: codes.OK},
+		"no credentials": {Metadata: []string{}, ExpectedCode: codes.Unauthenticated},
+		"wrong key":      {Metadata: []string{APIKeyHeader, "wrong"}, ExpectedCode: codes.Unauthenticated},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := grpc_metadata.AppendToOutgoingContext(context.Background(), test.Metadata...)
+			_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+			if got := status.Code(err); got != test.ExpectedCode {
+				t.Fatalf("code = %v; want %v", got, test.ExpectedCode)
+			}
+			if test.ExpectedCode != codes.OK {
+				return
+			}
+			p, tag := <-server.principals, <-server.tags
+			if p.Name != "partner" || tag != "partner" {
+				t.Errorf("principal %v and its tag %v should be set", p, tag)
+			}
+		})
+	}
+
+	if failures != 2 {
+		t.Errorf("want 2 failures; got %d", failures)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	client, server := newAuthenticatedHealthClient(t, newTestAuthenticator(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watch, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch returned an error : %v", err)
+	}
+	if _, err := watch.Recv(); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("want Unauthenticated; got %v", err)
+	}
+
+	ctx = grpc_metadata.AppendToOutgoingContext(ctx, AuthorizationHeader, "Bearer secret-key")
+	watch, err = client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch returned an error : %v", err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if p := <-server.principals; p.Name != "partner" || p.Method != MethodAPIKey {
+		t.Errorf("principal is not correct %v", p)
+	}
+}
+
+func TestExemptServices(t *testing.T) {
+	a, err := NewAuthenticator(Settings{
+		APIKeys:        map[string]string{"secret-key": "partner"},
+		ExemptServices: []string{grpc_health_v1.Health_ServiceDesc.ServiceName},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := newAuthenticatedHealthClient(t, a)
+
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("exempt service should not require credentials %v", err)
+	}
+	if p := <-server.principals; p != (Principal{}) {
+		t.Errorf("exempt request should not have a principal %v", p)
+	}
+}
+
+func TestNilAuthenticator(t *testing.T) {
+	var a *Authenticator
+	client, _ := newAuthenticatedHealthClient(t, a)
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Errorf("nil authenticator should not reject the requests %v", err)
+	}
+}
+
+func TestNewAuthenticatorWithoutCredentials(t *testing.T) {
+	if _, err := NewAuthenticator(Settings{}); err == nil {
+		t.Errorf("error supposed to be returned")
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	tests := map[string]struct {
+		Content  string
+		Expected map[string]string
+		Valid    bool
+	}{
+		"keys with comments": {
+			Content:  "# partners\npartner:5d2c9f0e8b7a\n\n internal : 9a8b7c6d \n",
+			Expected: map[string]string{"5d2c9f0e8b7a": "partner", "9a8b7c6d": "internal"},
+			Valid:    true,
+		},
+		"key with colon": {
+			Content:  "partner:a:b",
+			Expected: map[string]string{"a:b": "partner"},
+			Valid:    true,
+		},
+		"missing key": {
+			Content: "partner:",
+			Valid:   false,
+		},
+		"missing separator": {
+			Content: "partner",
+			Valid:   false,
+		},
+		"duplicate key": {
+			Content: "partner:a\ninternal:a",
+			Valid:   false,
+		},
+		"duplicate name": {
+			Content: "partner:a\npartner:b",
+			Valid:   false,
+		},
+		"empty": {
+			Content: "# no keys yet\n",
+			Valid:   false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "api_keys")
+			if err := ioutil.WriteFile(path, []byte(test.Content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			keys, err := LoadAPIKeys(path)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if len(keys) != len(test.Expected) {
+				t.Fatalf("keys = %v; want %v", keys, test.Expected)
+			}
+			for key, name := range test.Expected {
+				if keys[key] != name {
+					t.Errorf("keys = %v; want %v", keys, test.Expected)
+				}
+			}
+		})
+	}
+}
+
+func TestPrincipalKey(t *testing.T) {
+	apiKey := Principal{Name: "partner", Method: MethodAPIKey}
+	token := Principal{Name: "partner", Method: MethodJWT}
+	if apiKey.Key() != "api-key:partner" || token.Key() != "jwt:partner" {
+		t.Errorf("keys = %q %q; want api-key:partner jwt:partner", apiKey.Key(), token.Key())
+	}
+}
@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// These are the signing algorithms of the tokens which can be verified.
+const (
+	algorithmHS256 = "HS256"
+	algorithmRS256 = "RS256"
+)
+
+// JWTSettings holds the settings of the token verification.
+// At least one of the HMAC secret and the RSA public key is required.
+type JWTSettings struct {
+	// HMACSecret verifies the HS256 tokens.
+	HMACSecret []byte
+
+	// RSAPublicKey verifies the RS256 tokens.
+	RSAPublicKey *rsa.PublicKey
+
+	// Issuer and Audience are compared with the iss and aud claims if they are not empty.
+	Issuer   string
+	Audience string
+
+	// Leeway is the allowed clock difference when the exp and nbf claims are checked.
+	Leeway time.Duration
+}
+
+// JWTVerifier verifies the signature and the claims of the JWT bearer tokens.
+type JWTVerifier struct {
+	settings JWTSettings
+
+	// now returns the current time, it is replaced in the tests.
+	now func() time.Time
+}
+
+// jwtHeader is the decoded header of a token.
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+}
+
+// jwtClaims are the decoded claims of a token which are checked.
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+}
+
+// audience is the aud claim, it can be a single string or an array of strings.
+type audience []string
+
+// UnmarshalJSON decodes a string or an array of strings.
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings : %v", err)
+	}
+	*a = many
+	return nil
+}
+
+// contains returns true if the audience contains the given value.
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NewJWTVerifier returns a new JWTVerifier with the given settings.
+func NewJWTVerifier(settings JWTSettings) (*JWTVerifier, error) {
+	if len(settings.HMACSecret) == 0 && settings.RSAPublicKey == nil {
+		return nil, errors.New("jwt verification requires an HMAC secret or an RSA public key")
+	}
+	return &JWTVerifier{settings: settings, now: time.Now}, nil
+}
+
+// Verify checks the signature, the expiry and the issuer and audience of the given token and returns its subject.
+// The algorithm of the token must match a configured key, so an HS256 token can never be verified with the RSA public key.
+func (v *JWTVerifier) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("token must have three parts")
+	}
+
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("invalid token header : %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid token signature : %v", err)
+	}
+	if err := v.verifySignature(header.Algorithm, parts[0]+"."+parts[1], signature); err != nil {
+		return "", err
+	}
+
+	claims := jwtClaims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("invalid token claims : %v", err)
+	}
+	if err := v.verifyClaims(claims); err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// verifySignature verifies the signature of the signed part of a token with the key of the given algorithm.
+func (v *JWTVerifier) verifySignature(algorithm, signed string, signature []byte) error {
+	switch algorithm {
+	case algorithmHS256:
+		if len(v.settings.HMACSecret) == 0 {
+			return fmt.Errorf("token algorithm is not accepted : %s", algorithm)
+		}
+		mac := hmac.New(sha256.New, v.settings.HMACSecret)
+		mac.Write([]byte(signed))
+		if subtle.ConstantTimeCompare(mac.Sum(nil), signature) != 1 {
+			return errors.New("token signature is not valid")
+		}
+		return nil
+	case algorithmRS256:
+		if v.settings.RSAPublicKey == nil {
+			return fmt.Errorf("token algorithm is not accepted : %s", algorithm)
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(v.settings.RSAPublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("token signature is not valid")
+		}
+		return nil
+	default:
+		return fmt.Errorf("token algorithm is not accepted : %s", algorithm)
+	}
+}
+
+// verifyClaims checks the expiry, the issuer, the audience and the subject of a token.
+// The exp claim is required, so a leaked token can not be used forever.
+func (v *JWTVerifier) verifyClaims(claims jwtClaims) error {
+	now := v.now()
+	if claims.ExpiresAt == nil {
+		return errors.New("token has no exp claim")
+	}
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(v.settings.Leeway)) {
+		return errors.New("token is expired")
+	}
+	if claims.NotBefore != nil && now.Add(v.settings.Leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if v.settings.Issuer != "" && claims.Issuer != v.settings.Issuer {
+		return fmt.Errorf("token issuer is not accepted : %q", claims.Issuer)
+	}
+	if v.settings.Audience != "" && !claims.Audience.contains(v.settings.Audience) {
+		return fmt.Errorf("token audience is not accepted : %q", claims.Audience)
+	}
+	if claims.Subject == "" {
+		return errors.New("token has no sub claim")
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token.
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// LoadRSAPublicKey loads a PEM encoded RSA public key from the given file.
+// Both the PKIX ("PUBLIC KEY") and the PKCS #1 ("RSA PUBLIC KEY") encodings are accepted.
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the public key : %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key file has no PEM block : %v", path)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the public key : %v", err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is not an RSA key : %T", key)
+		}
+		return rsaKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the public key : %v", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unknown public key type : %s", block.Type)
+	}
+}
+
+// LoadHMACSecret loads the HMAC secret from the given file.
+// The surrounding white space is removed, so the file can end with a new line.
+func LoadHMACSecret(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the HMAC secret : %v", err)
+	}
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("HMAC secret file is empty : %v", path)
+	}
+	return secret, nil
+}
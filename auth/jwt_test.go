@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSecret is the HMAC secret of the test tokens.
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// testNow is the current time of the verifiers in the tests.
+var testNow = time.Unix(1700000000, 0)
+
+// signToken returns a token with the given claims signed with the given algorithm.
+// The key is an HMAC secret for HS256 and an RSA private key for RS256, any other algorithm is not signed.
+func signToken(t *testing.T, algorithm string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch algorithm {
+	case algorithmHS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case algorithmRS256:
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// validClaims returns the claims of a token which is valid at testNow.
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub": "partner",
+		"iss": "dog-ceo-auth",
+		"aud": "dog-ceo",
+		"exp": testNow.Add(time.Hour).Unix(),
+		"nbf": testNow.Add(-time.Hour).Unix(),
+	}
+}
+
+// withClaim returns the valid claims with the given claim replaced, a nil value removes the claim.
+func withClaim(name string, value interface{}) map[string]interface{} {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := NewJWTVerifier(JWTSettings{
+		HMACSecret:   testSecret,
+		RSAPublicKey: &rsaKey.PublicKey,
+		Issuer:       "dog-ceo-auth",
+		Audience:     "dog-ceo",
+		Leeway:       time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.now = func() time.Time { return testNow }
+
+	hmacOnly, err := NewJWTVerifier(JWTSettings{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacOnly.now = verifier.now
+
+	tests := map[string]struct {
+		Verifier *JWTVerifier
+		Token    string
+		Valid    bool
+	}{
+		"hs256": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, validClaims()),
+			Valid:    true,
+		},
+		"rs256": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmRS256, rsaKey, validClaims()),
+			Valid:    true,
+		},
+		"audience array": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("aud", []string{"other", "dog-ceo"})),
+			Valid:    true,
+		},
+		"expired within leeway": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("exp", testNow.Add(-time.Second*30).Unix())),
+			Valid:    true,
+		},
+		"expired": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("exp", testNow.Add(-time.Hour).Unix())),
+			Valid:    false,
+		},
+		"no exp": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("exp", nil)),
+			Valid:    false,
+		},
+		"not valid yet": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("nbf", testNow.Add(time.Hour).Unix())),
+			Valid:    false,
+		},
+		"wrong issuer": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("iss", "someone")),
+			Valid:    false,
+		},
+		"wrong audience": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("aud", "other")),
+			Valid:    false,
+		},
+		"no subject": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, testSecret, withClaim("sub", nil)),
+			Valid:    false,
+		},
+		"wrong hmac secret": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmHS256, []byte("another secret"), validClaims()),
+			Valid:    false,
+		},
+		"wrong rsa key": {
+			Verifier: verifier,
+			Token:    signToken(t, algorithmRS256, otherRSAKey, validClaims()),
+			Valid:    false,
+		},
+		"rs256 without public key": {
+			Verifier: hmacOnly,
+			Token:    signToken(t, algorithmRS256, rsaKey, validClaims()),
+			Valid:    false,
+		},
+		"none algorithm": {
+			Verifier: verifier,
+			Token:    signToken(t, "none", nil, validClaims()),
+			Valid:    false,
+		},
+		"tampered claims": {
+			Verifier: verifier,
+			Token: func() string {
+				parts := strings.Split(signToken(t, algorithmHS256, testSecret, validClaims()), ".")
+				other := strings.Split(signToken(t, algorithmHS256, testSecret, withClaim("sub", "admin")), ".")
+				return parts[0] + "." + other[1] + "." + parts[2]
+			}(),
+			Valid: false,
+		},
+		"malformed": {
+			Verifier: verifier,
+			Token:    "a.b",
+			Valid:    false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			subject, err := test.Verifier.Verify(test.Token)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if subject != "partner" {
+				t.Errorf("subject = %q; want partner", subject)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifierWithoutKeys(t *testing.T) {
+	if _, err := NewJWTVerifier(JWTSettings{Issuer: "dog-ceo-auth"}); err == nil {
+		t.Errorf("error supposed to be returned")
+	}
+}
+
+func TestLoadRSAPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"pkix.pem":    pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}),
+		"pkcs1.pem":   pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}),
+		"private.pem": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		"empty.pem":   []byte("not a key"),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		File  string
+		Valid bool
+	}{
+		"pkix":        {File: "pkix.pem", Valid: true},
+		"pkcs1":       {File: "pkcs1.pem", Valid: true},
+		"private key": {File: "private.pem", Valid: false},
+		"no pem":      {File: "empty.pem", Valid: false},
+		"missing":     {File: "missing.pem", Valid: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			loaded, err := LoadRSAPublicKey(filepath.Join(dir, test.File))
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if !loaded.Equal(&key.PublicKey) {
+				t.Errorf("loaded key is not the same")
+			}
+		})
+	}
+}
+
+func TestLoadHMACSecret(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(path, append(testSecret, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := LoadHMACSecret(path)
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if string(secret) != string(testSecret) {
+		t.Errorf("secret = %q; want %q", secret, testSecret)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := ioutil.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHMACSecret(empty); err == nil {
+		t.Errorf("error supposed to be returned for an empty secret")
+	}
+}
@@ -0,0 +1,129 @@
+// breed_catalog keeps an in-memory copy of the available breeds and sub-breeds.
+// It is used to reject unknown breeds without going to the upstream API.
+package breed_catalog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// refreshTimeout is the maximum duration of a single refresh.
+const refreshTimeout = time.Second * 10
+
+// Loader loads the breeds mapped to their sub-breeds.
+type Loader func(ctx context.Context) (map[string][]string, error)
+
+// Catalog holds the breeds and sub-breeds in a map so the lookups are O(1).
+type Catalog struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for breeds
+	mu sync.RWMutex
+
+	// breeds maps every breed to the set of its sub-breeds.
+	breeds map[string]map[string]struct{}
+
+	// lastRefresh is the time of the last successful refresh.
+	lastRefresh time.Time
+
+	// loader is used to fetch the breed list.
+	loader Loader
+
+	// quit is used to stop the refresher.
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCatalog returns a new empty Catalog instance which uses the given loader.
+func NewCatalog(loader Loader) *Catalog {
+	return &Catalog{
+		loader: loader,
+		quit:   make(chan struct{}),
+	}
+}
+
+// Refresh loads the breed list and replaces the catalog with it.
+// If loading fails, the previous breed list is kept.
+func (c *Catalog) Refresh(ctx context.Context) error {
+	breeds, err := c.loader(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load breed list : %v", err)
+	}
+
+	set := make(map[string]map[string]struct{}, len(breeds))
+	for breed, subBreeds := range breeds {
+		set[breed] = make(map[string]struct{}, len(subBreeds))
+		for _, subBreed := range subBreeds {
+			set[breed][subBreed] = struct{}{}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breeds = set
+	c.lastRefresh = time.Now()
+	return nil
+}
+
+// StartRefresher refreshes the catalog every given interval in the background.
+// Refresh errors are reported to the given error handler, it can be nil.
+func (c *Catalog) StartRefresher(interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	go tickerToRefresh(ticker, c.quit, c, onError)
+}
+
+// Stop stops the refresher. It is safe to call Stop more than once.
+func (c *Catalog) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+	})
+}
+
+// IsLoaded returns true if the catalog has been loaded at least once.
+func (c *Catalog) IsLoaded() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.breeds != nil
+}
+
+// LastRefresh returns the time of the last successful refresh.
+// It returns the zero time if the catalog has never been loaded.
+func (c *Catalog) LastRefresh() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastRefresh
+}
+
+// Exists returns true if the given breed and sub-breed pair exists.
+// If the sub-breed is empty, it only checks the breed.
+func (c *Catalog) Exists(breed, subBreed string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	subBreeds, ok := c.breeds[breed]
+	if !ok {
+		return false
+	}
+	if subBreed == "" {
+		return true
+	}
+	_, ok = subBreeds[subBreed]
+	return ok
+}
+
+// tickerToRefresh refreshes the catalog every given ticker.
+func tickerToRefresh(ticker *time.Ticker, quit chan struct{}, c *Catalog, onError func(error)) {
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+			if err := c.Refresh(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+			cancel()
+		case <-quit:
+			ticker.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package breed_catalog
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func staticLoader(breeds map[string][]string) Loader {
+	return func(ctx context.Context) (map[string][]string, error) {
+		return breeds, nil
+	}
+}
+
+func TestNewCatalog(t *testing.T) {
+	c := NewCatalog(staticLoader(nil))
+	if c.IsLoaded() {
+		t.Errorf("new catalog supposed to be empty")
+	}
+	if !c.LastRefresh().IsZero() {
+		t.Errorf("new catalog supposed to have zero last refresh time")
+	}
+}
+
+func TestExists(t *testing.T) {
+	tests := map[string]struct {
+		Breed    string
+		SubBreed string
+		Exists   bool
+	}{
+		"breed without sub-breeds": {
+			Breed:    "husky",
+			SubBreed: "",
+			Exists:   true,
+		},
+		"breed with sub-breeds and empty sub-breed": {
+			Breed:    "australian",
+			SubBreed: "",
+			Exists:   true,
+		},
+		"breed and sub-breed": {
+			Breed:    "australian",
+			SubBreed: "shepherd",
+			Exists:   true,
+		},
+		"unknown breed": {
+			Breed:    "INVALID",
+			SubBreed: "",
+			Exists:   false,
+		},
+		"unknown sub-breed": {
+			Breed:    "australian",
+			SubBreed: "INVALID",
+			Exists:   false,
+		},
+		"sub-breed of another breed": {
+			Breed:    "husky",
+			SubBreed: "shepherd",
+			Exists:   false,
+		},
+		"empty breed": {
+			Breed:    "",
+			SubBreed: "",
+			Exists:   false,
+		},
+	}
+
+	c := NewCatalog(staticLoader(map[string][]string{"australian": {"shepherd"}, "husky": {}}))
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := c.Exists(test.Breed, test.SubBreed); got != test.Exists {
+				t.Fatalf("want %t; got %t", test.Exists, got)
+			}
+		})
+	}
+}
+
+func TestRefreshKeepsPreviousListOnError(t *testing.T) {
+	fail := false
+	c := NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+		if fail {
+			return nil, errors.New("upstream is down")
+		}
+		return map[string][]string{"husky": {}}, nil
+	})
+
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	lastRefresh := c.LastRefresh()
+
+	fail = true
+	if err := c.Refresh(context.Background()); err == nil {
+		t.Fatalf("error supposed to be returned")
+	}
+
+	if !c.Exists("husky", "") {
+		t.Errorf("previous breed list supposed to be kept")
+	}
+	if !c.LastRefresh().Equal(lastRefresh) {
+		t.Errorf("last refresh time supposed to be kept")
+	}
+}
+
+func TestStartRefresher(t *testing.T) {
+	var calls int32
+	c := NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string][]string{"husky": {}}, nil
+	})
+
+	c.StartRefresher(time.Millisecond*10, nil)
+	time.Sleep(time.Millisecond * 100)
+	c.Stop()
+	c.Stop()
+
+	if !c.IsLoaded() {
+		t.Fatalf("catalog supposed to be loaded by the refresher")
+	}
+
+	// wait for the in-flight refresh, if any
+	time.Sleep(time.Millisecond * 20)
+	stoppedAt := atomic.LoadInt32(&calls)
+	time.Sleep(time.Millisecond * 50)
+	if got := atomic.LoadInt32(&calls); got != stoppedAt {
+		t.Errorf("refresher supposed to be stopped; calls went from %d to %d", stoppedAt, got)
+	}
+}
+
+func TestStartRefresherReportsErrors(t *testing.T) {
+	errChan := make(chan error, 1)
+	c := NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+		return nil, errors.New("upstream is down")
+	})
+
+	c.StartRefresher(time.Millisecond*10, func(err error) {
+		select {
+		case errChan <- err:
+		default:
+		}
+	})
+	defer c.Stop()
+
+	select {
+	case err := <-errChan:
+		if err == nil {
+			t.Errorf("error supposed to be reported")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("error is not reported")
+	}
+}
@@ -5,40 +5,219 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 
 	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// statusNotFoundErrorText is the error text for the status code 404
-var errStatusNotFound = errors.New("image is not found on the server! Please check the url or search again")
+// instrumentationName is the name of the tracer of the cache lookups.
+const instrumentationName = "github.com/canbo-x/dog-ceo/breed_image_service"
+
+// ErrImageNotFound is returned for the status code 404
+var ErrImageNotFound = errors.New("image is not found on the server! Please check the url or search again")
+
+// ErrBreedNotFound is returned for the status code 404 while listing sub-breeds
+var ErrBreedNotFound = errors.New("breed is not found on the server! Please check the breed name")
+
+// MaxImageCount is the maximum number of images which can be fetched in one call.
+// The upstream API returns at most 50 images.
+const MaxImageCount = 50
+
+// Image is an image with the URL it is downloaded from.
+type Image struct {
+	URL  string
+	Data []byte
+}
+
+// StatusError is returned when the upstream API responds with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+}
+
+// Error returns the error text with the status code.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server responded with : %d", e.StatusCode)
+}
+
+// ImageCache is the cache of the downloaded images keyed by their URLs.
+type ImageCache interface {
+	// Get returns the image of the given URL and true if it is in the cache.
+	Get(imageURL string) ([]byte, bool)
+
+	// Set adds the image of the given URL to the cache.
+	Set(imageURL string, image []byte)
+}
 
 // GetImage fetch the image from the given url and returns the image bytes and an error if any
-func GetImage(ctx context.Context, client *http.Client, imageURL string) ([]byte, error) {
-	image, statusCode, err := data_service.GetImage(ctx, client, imageURL)
+// If the cache is not nil, the image is served from the cache when it is there and added to the cache when it is downloaded.
+func GetImage(ctx context.Context, ds data_service.DataSource, cache ImageCache, imageURL string) ([]byte, error) {
+	if cache != nil {
+		if image, ok := getCachedImage(ctx, cache, imageURL); ok {
+			return image, nil
+		}
+	}
+
+	image, statusCode, err := ds.GetImage(ctx, imageURL)
 	if err != nil {
 		return nil, err
 	}
 	if statusCode == http.StatusNotFound {
-		return nil, errStatusNotFound
+		return nil, ErrImageNotFound
 	}
 	if statusCode != http.StatusOK {
-		return nil, fmt.Errorf("server responded with : %d", statusCode)
+		return nil, &StatusError{StatusCode: statusCode}
+	}
+
+	if cache != nil {
+		cache.Set(imageURL, image)
 	}
 	return image, nil
 }
 
+// getCachedImage looks up the image of the given URL in the cache with a span of its own.
+func getCachedImage(ctx context.Context, cache ImageCache, imageURL string) ([]byte, bool) {
+	_, span := otel.Tracer(instrumentationName).Start(ctx, "image_cache.Get", trace.WithAttributes(semconv.HTTPURLKey.String(imageURL)))
+	defer span.End()
+
+	image, ok := cache.Get(imageURL)
+	span.SetAttributes(attribute.Bool("dogceo.cache_hit", ok))
+	if ok {
+		span.SetAttributes(attribute.Int("dogceo.image_bytes", len(image)))
+	}
+	ctxlogrus.Extract(ctx).WithFields(logrus.Fields{"image_url": imageURL, "cache_hit": ok}).Debug("Image cache is checked")
+	return image, ok
+}
+
+// OpenImage opens the image from the given url to read it as a stream and returns an error if any.
+// The caller must close the body of the stream.
+func OpenImage(ctx context.Context, ds data_service.DataSource, imageURL string) (*data_service.ImageStream, error) {
+	stream, statusCode, err := ds.OpenImage(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, ErrImageNotFound
+	}
+	if statusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: statusCode}
+	}
+	return stream, nil
+}
+
 // GetURL returns the image URL as a string and an error if any.
 // It throws an error if the status code is not 200.
-func GetURL(ctx context.Context, client *http.Client, breed string, subBreed string) (string, error) {
-	imageURL, statusCode, err := data_service.GetBreedImageURL(ctx, client, breed, subBreed)
+func GetURL(ctx context.Context, ds data_service.DataSource, breed string, subBreed string) (string, error) {
+	imageURL, statusCode, err := ds.GetRandomImageURL(ctx, breed, subBreed)
 	if err != nil {
 		return imageURL, err
 	}
 	if statusCode == http.StatusNotFound {
-		return imageURL, errStatusNotFound
+		return imageURL, ErrImageNotFound
 	}
 	if statusCode != http.StatusOK {
-		return imageURL, fmt.Errorf("server responded with : %d", statusCode)
+		return imageURL, &StatusError{StatusCode: statusCode}
 	}
 	return imageURL, err
 }
+
+// GetURLs returns up to the given number of image URLs and an error if any.
+// It throws an error if the status code is not 200.
+func GetURLs(ctx context.Context, ds data_service.DataSource, breed string, subBreed string, count int) ([]string, error) {
+	imageURLs, statusCode, err := ds.GetRandomImageURLs(ctx, breed, subBreed, count)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, ErrImageNotFound
+	}
+	if statusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: statusCode}
+	}
+	return imageURLs, nil
+}
+
+// GetImages downloads the images from the given URLs with at most the given number of concurrent workers.
+// The images are returned in the order of the URLs and the failed ones are skipped.
+// It returns the first error only if none of the images could be downloaded.
+// The cache is optional, it can be nil.
+func GetImages(ctx context.Context, ds data_service.DataSource, cache ImageCache, imageURLs []string, workers int) ([]Image, error) {
+	if len(imageURLs) == 0 {
+		return nil, nil
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(imageURLs) {
+		workers = len(imageURLs)
+	}
+
+	images := make([][]byte, len(imageURLs))
+	errs := make([]error, len(imageURLs))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				images[index], errs[index] = GetImage(ctx, ds, cache, imageURLs[index])
+			}
+		}()
+	}
+
+	for index := range imageURLs {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	logger := ctxlogrus.Extract(ctx)
+	result := make([]Image, 0, len(imageURLs))
+	for index, imageURL := range imageURLs {
+		if errs[index] != nil {
+			logger.WithError(errs[index]).WithField("image_url", imageURL).Warn("Failed to get an image, it is skipped")
+			continue
+		}
+		result = append(result, Image{URL: imageURL, Data: images[index]})
+	}
+	if len(result) == 0 {
+		return nil, errs[0]
+	}
+	return result, nil
+}
+
+// ListBreeds returns all the breeds mapped to their sub-breeds and an error if any.
+// It throws an error if the status code is not 200.
+func ListBreeds(ctx context.Context, ds data_service.DataSource) (map[string][]string, error) {
+	breeds, statusCode, err := ds.ListBreeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: statusCode}
+	}
+	return breeds, nil
+}
+
+// ListSubBreeds returns the sub-breeds of the given breed and an error if any.
+// It throws an error if the status code is not 200.
+func ListSubBreeds(ctx context.Context, ds data_service.DataSource, breed string) ([]string, error) {
+	subBreeds, statusCode, err := ds.ListSubBreeds(ctx, breed)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode == http.StatusNotFound {
+		return nil, ErrBreedNotFound
+	}
+	if statusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: statusCode}
+	}
+	return subBreeds, nil
+}
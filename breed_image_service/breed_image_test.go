@@ -2,12 +2,31 @@ package breed_image_service
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/fakedogceo"
+	"github.com/canbo-x/dog-ceo/image_cache"
 )
 
+// newDataSource returns a data source which uses a fake dog.ceo API and the URL of the fake server.
+// The fake server is closed when the test finishes.
+func newDataSource(t *testing.T) (data_service.DataSource, string) {
+	ts := httptest.NewServer(fakedogceo.New(fakedogceo.Options{}))
+	t.Cleanup(ts.Close)
+	return data_service.NewHttpDataSource(&http.Client{}, ts.URL+fakedogceo.APIPath), ts.URL
+}
+
 func TestGetImage(t *testing.T) {
-	image, err := GetImage(context.Background(), &http.Client{}, "https://images.dog.ceo/breeds/husky/n02110185_5030.jpg")
+	ds, serverURL := newDataSource(t)
+	image, err := GetImage(context.Background(), ds, nil, serverURL+"/breeds/husky/n02110185_5030.jpg")
 	if err != nil {
 		t.Error(err)
 	}
@@ -16,15 +35,86 @@ func TestGetImage(t *testing.T) {
 	}
 }
 
+func TestOpenImage(t *testing.T) {
+	ds, serverURL := newDataSource(t)
+	stream, err := OpenImage(context.Background(), ds, serverURL+"/breeds/husky/n02110185_5030.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	image, err := ioutil.ReadAll(stream.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(image) == 0 {
+		t.Error("image is empty")
+	}
+
+	if _, err := OpenImage(context.Background(), ds, serverURL+"/breeds/INVALID/no.jpg"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("want ErrImageNotFound; got %v", err)
+	}
+}
+
+// countingDataSource is a DataSource which counts the GetImage calls.
+type countingDataSource struct {
+	mockDataSource
+	calls int32
+}
+
+func (c *countingDataSource) GetImage(ctx context.Context, imageURL string) ([]byte, int, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.mockDataSource.GetImage(ctx, imageURL)
+}
+
+func TestGetImageWithCache(t *testing.T) {
+	cache, err := image_cache.NewCache(image_cache.Settings{MaxBytes: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := &countingDataSource{mockDataSource: mockDataSource{statusCode: http.StatusOK}}
+	imageURL := "https://images.dog.ceo/breeds/husky/mock.jpg"
+
+	for i := 0; i < 3; i++ {
+		image, err := GetImage(context.Background(), ds, cache, imageURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(image) != "image" {
+			t.Fatalf("want image; got %s", image)
+		}
+	}
+
+	if calls := atomic.LoadInt32(&ds.calls); calls != 1 {
+		t.Fatalf("want 1 upstream call; got %d", calls)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("stats are not correct %v", stats)
+	}
+
+	// failed downloads are not cached
+	failing := &countingDataSource{mockDataSource: mockDataSource{statusCode: http.StatusNotFound}}
+	for i := 0; i < 2; i++ {
+		if _, err := GetImage(context.Background(), failing, cache, "https://images.dog.ceo/breeds/husky/missing.jpg"); !errors.Is(err, ErrImageNotFound) {
+			t.Fatalf("want ErrImageNotFound; got %v", err)
+		}
+	}
+	if calls := atomic.LoadInt32(&failing.calls); calls != 2 {
+		t.Fatalf("want 2 upstream calls; got %d", calls)
+	}
+}
+
 func TestGetImageNotFound(t *testing.T) {
-	_, err := GetImage(context.Background(), &http.Client{}, "broken_link")
+	ds, _ := newDataSource(t)
+	_, err := GetImage(context.Background(), ds, nil, "broken_link")
 	if err == nil {
 		t.Error("image is not found")
 	}
 }
 
 func TestGetURL(t *testing.T) {
-	url, err := GetURL(context.Background(), &http.Client{}, "husky", "")
+	ds, _ := newDataSource(t)
+	url, err := GetURL(context.Background(), ds, "husky", "")
 	if err != nil {
 		t.Error(err)
 	}
@@ -34,15 +124,236 @@ func TestGetURL(t *testing.T) {
 }
 
 func TestGetURLNotFound(t *testing.T) {
-	_, err := GetURL(context.Background(), &http.Client{}, "husky", "not-found")
+	ds, _ := newDataSource(t)
+	_, err := GetURL(context.Background(), ds, "husky", "not-found")
 	if err == nil {
 		t.Error("url is not found")
 	}
 }
 
 func TestGetURLInvalid(t *testing.T) {
-	_, err := GetURL(context.Background(), &http.Client{}, "", "")
+	ds, _ := newDataSource(t)
+	_, err := GetURL(context.Background(), ds, "", "")
 	if err == nil {
 		t.Error("url is invalid")
 	}
 }
+
+func TestGetURLs(t *testing.T) {
+	ds, _ := newDataSource(t)
+	urls, err := GetURLs(context.Background(), ds, "husky", "", 2)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(urls) != 2 {
+		t.Errorf("want 2 urls; got %d", len(urls))
+	}
+
+	if _, err := GetURLs(context.Background(), ds, "INVALID", "", 2); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("want ErrImageNotFound; got %v", err)
+	}
+}
+
+func TestGetImages(t *testing.T) {
+	ds, serverURL := newDataSource(t)
+	urls := []string{
+		serverURL + "/breeds/husky/n02110185_5030.jpg",
+		serverURL + "/breeds/INVALID/no.jpg",
+		serverURL + "/breeds/husky/n02110185_12678.jpg",
+	}
+
+	images, err := GetImages(context.Background(), ds, nil, urls, 2)
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("want 2 images; got %d", len(images))
+	}
+	if images[0].URL != urls[0] || images[1].URL != urls[2] {
+		t.Fatalf("images are not in the order of the urls got %v %v", images[0].URL, images[1].URL)
+	}
+	for _, image := range images {
+		if len(image.Data) == 0 {
+			t.Fatalf("image is empty %v", image.URL)
+		}
+	}
+
+	if _, err := GetImages(context.Background(), ds, nil, urls[1:2], 2); !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("want ErrImageNotFound; got %v", err)
+	}
+}
+
+// concurrencyDataSource is a DataSource which records the maximum number of concurrent GetImage calls.
+type concurrencyDataSource struct {
+	mockDataSource
+	current int32
+	max     int32
+}
+
+func (c *concurrencyDataSource) GetImage(ctx context.Context, imageURL string) ([]byte, int, error) {
+	current := atomic.AddInt32(&c.current, 1)
+	defer atomic.AddInt32(&c.current, -1)
+	for {
+		max := atomic.LoadInt32(&c.max)
+		if current <= max || atomic.CompareAndSwapInt32(&c.max, max, current) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond * 10)
+	return []byte("image"), http.StatusOK, nil
+}
+
+func TestGetImagesWorkerPool(t *testing.T) {
+	ds := &concurrencyDataSource{}
+	urls := make([]string, 20)
+	for i := range urls {
+		urls[i] = "https://images.dog.ceo/breeds/husky/mock.jpg"
+	}
+
+	images, err := GetImages(context.Background(), ds, nil, urls, 3)
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if len(images) != len(urls) {
+		t.Fatalf("want %d images; got %d", len(urls), len(images))
+	}
+	if max := atomic.LoadInt32(&ds.max); max > 3 || max < 2 {
+		t.Fatalf("want at most 3 concurrent downloads; got %d", max)
+	}
+}
+
+func TestListBreeds(t *testing.T) {
+	ds, _ := newDataSource(t)
+	breeds, err := ListBreeds(context.Background(), ds)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, ok := breeds["husky"]; !ok {
+		t.Error("husky is not in the breed list")
+	}
+}
+
+func TestListSubBreeds(t *testing.T) {
+	ds, _ := newDataSource(t)
+	subBreeds, err := ListSubBreeds(context.Background(), ds, "australian")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(subBreeds) == 0 {
+		t.Error("sub-breed list is empty")
+	}
+}
+
+func TestListSubBreedsNotFound(t *testing.T) {
+	ds, _ := newDataSource(t)
+	_, err := ListSubBreeds(context.Background(), ds, "not-found")
+	if err == nil {
+		t.Error("breed is not found")
+	}
+}
+
+// mockDataSource is a DataSource which returns the given status code and error for every call.
+type mockDataSource struct {
+	statusCode int
+	err        error
+}
+
+func (m *mockDataSource) GetRandomImageURL(ctx context.Context, breed, subBreed string) (string, int, error) {
+	return "https://images.dog.ceo/breeds/husky/mock.jpg", m.statusCode, m.err
+}
+
+func (m *mockDataSource) GetRandomImageURLs(ctx context.Context, breed, subBreed string, count int) ([]string, int, error) {
+	return []string{"https://images.dog.ceo/breeds/husky/mock.jpg"}, m.statusCode, m.err
+}
+
+func (m *mockDataSource) GetImage(ctx context.Context, imageURL string) ([]byte, int, error) {
+	return []byte("image"), m.statusCode, m.err
+}
+
+func (m *mockDataSource) OpenImage(ctx context.Context, imageURL string) (*data_service.ImageStream, int, error) {
+	if m.statusCode != http.StatusOK || m.err != nil {
+		return nil, m.statusCode, m.err
+	}
+	return &data_service.ImageStream{Body: ioutil.NopCloser(strings.NewReader("image")), ContentType: "image/jpeg", Size: 5}, m.statusCode, m.err
+}
+
+func (m *mockDataSource) ListBreeds(ctx context.Context) (map[string][]string, int, error) {
+	return map[string][]string{"husky": {}}, m.statusCode, m.err
+}
+
+func (m *mockDataSource) ListSubBreeds(ctx context.Context, breed string) ([]string, int, error) {
+	return []string{"shepherd"}, m.statusCode, m.err
+}
+
+func TestStatusCodeHandling(t *testing.T) {
+	tests := map[string]struct {
+		StatusCode int
+		Err        error
+		Valid      bool
+	}{
+		"ok": {
+			StatusCode: http.StatusOK,
+			Valid:      true,
+		},
+		"not found": {
+			StatusCode: http.StatusNotFound,
+			Valid:      false,
+		},
+		"server error": {
+			StatusCode: http.StatusInternalServerError,
+			Valid:      false,
+		},
+		"transport error": {
+			StatusCode: http.StatusInternalServerError,
+			Err:        errors.New("connection refused"),
+			Valid:      false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ds := &mockDataSource{statusCode: test.StatusCode, err: test.Err}
+			ctx := context.Background()
+
+			if _, err := GetURL(ctx, ds, "husky", ""); (err == nil) != test.Valid {
+				t.Errorf("GetURL: want err == nil => %t; got err %v", test.Valid, err)
+			}
+			if _, err := GetImage(ctx, ds, nil, "https://images.dog.ceo/breeds/husky/mock.jpg"); (err == nil) != test.Valid {
+				t.Errorf("GetImage: want err == nil => %t; got err %v", test.Valid, err)
+			}
+			if stream, err := OpenImage(ctx, ds, "https://images.dog.ceo/breeds/husky/mock.jpg"); (err == nil) != test.Valid {
+				t.Errorf("OpenImage: want err == nil => %t; got err %v", test.Valid, err)
+			} else if err == nil {
+				stream.Body.Close()
+			}
+			if _, err := ListBreeds(ctx, ds); (err == nil) != test.Valid {
+				t.Errorf("ListBreeds: want err == nil => %t; got err %v", test.Valid, err)
+			}
+			if _, err := ListSubBreeds(ctx, ds, "australian"); (err == nil) != test.Valid {
+				t.Errorf("ListSubBreeds: want err == nil => %t; got err %v", test.Valid, err)
+			}
+		})
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := GetURL(ctx, &mockDataSource{statusCode: http.StatusNotFound}, "husky", "")
+	if !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("GetURL: want ErrImageNotFound; got %v", err)
+	}
+
+	_, err = ListSubBreeds(ctx, &mockDataSource{statusCode: http.StatusNotFound}, "INVALID")
+	if !errors.Is(err, ErrBreedNotFound) {
+		t.Errorf("ListSubBreeds: want ErrBreedNotFound; got %v", err)
+	}
+
+	var statusErr *StatusError
+	_, err = GetImage(ctx, &mockDataSource{statusCode: http.StatusBadGateway}, nil, "https://images.dog.ceo/breeds/husky/mock.jpg")
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("GetImage: want StatusError with %d; got %v", http.StatusBadGateway, err)
+	}
+}
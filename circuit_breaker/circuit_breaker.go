@@ -0,0 +1,231 @@
+// circuit_breaker is a thread safe circuit breaker.
+// It is used to fail fast while the upstream API is down instead of waiting for every request to time out.
+package circuit_breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is the error for the requests which are not allowed by the breaker.
+// Allow returns an *OpenError which matches it with errors.Is.
+var ErrOpen = errors.New("circuit breaker is open, upstream is unavailable")
+
+// OpenError is returned when the breaker does not allow the request.
+type OpenError struct {
+	// RetryAfter is the remaining cool-down of the open breaker.
+	// It is zero when the breaker is half-open and all the probes are in flight.
+	RetryAfter time.Duration
+}
+
+// Error returns the text of ErrOpen.
+func (e *OpenError) Error() string {
+	return ErrOpen.Error()
+}
+
+// Is reports whether the target is ErrOpen.
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// State is the state of the breaker.
+type State int
+
+const (
+	// Closed lets all the requests through and counts the consecutive failures.
+	Closed State = iota
+
+	// Open rejects all the requests until the cool-down is over.
+	Open
+
+	// HalfOpen lets a limited number of probe requests through to check if the upstream is back.
+	HalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is the result of a request which is reported to the breaker.
+type Result int
+
+const (
+	// Success means the upstream handled the request.
+	Success Result = iota
+
+	// Failure means the upstream failed to handle the request.
+	Failure
+
+	// Ignored means the result says nothing about the upstream, e.g. the caller canceled the request.
+	Ignored
+)
+
+// Settings holds the settings of the breaker.
+type Settings struct {
+	// FailureThreshold is the number of consecutive failures which opens the breaker.
+	FailureThreshold int
+
+	// CoolDown is the duration the breaker stays open before letting the probe requests through.
+	CoolDown time.Duration
+
+	// HalfOpenMaxRequests is the number of probe requests in the half-open state.
+	// The breaker is closed again after this many successful probes.
+	HalfOpenMaxRequests int
+
+	// OnStateChange is called when the state changes, it can be nil.
+	// It is called while holding the lock of the breaker, so it must not call the breaker.
+	OnStateChange func(from, to State)
+}
+
+// Breaker holds the required variables to compose a circuit breaker.
+type Breaker struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the state and the counters
+	mu sync.Mutex
+
+	settings Settings
+
+	state State
+
+	// failures is the number of consecutive failures in the closed state.
+	failures int
+
+	// probes is the number of the probe requests in flight in the half-open state.
+	probes int
+
+	// successes is the number of successful probes in the half-open state.
+	successes int
+
+	// openedAt is the time the breaker was opened.
+	openedAt time.Time
+
+	// generation is increased on every state change,
+	// so the results of the requests allowed in an earlier state are not counted in the new one.
+	generation uint64
+
+	// now returns the current time, it is replaced in the tests.
+	now func() time.Time
+}
+
+// NewBreaker returns a new closed Breaker with the given settings.
+// The failure threshold and the half-open requests are at least 1.
+func NewBreaker(settings Settings) *Breaker {
+	if settings.FailureThreshold < 1 {
+		settings.FailureThreshold = 1
+	}
+	if settings.HalfOpenMaxRequests < 1 {
+		settings.HalfOpenMaxRequests = 1
+	}
+	return &Breaker{
+		settings: settings,
+		state:    Closed,
+		now:      time.Now,
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkCoolDown()
+	return b.state
+}
+
+// Allow returns an *OpenError if the request is not allowed.
+// If the request is allowed, it returns the function which reports the result of the request,
+// the caller must call it once when the request is completed.
+// The result is ignored if the state of the breaker changed since the request was allowed.
+func (b *Breaker) Allow() (func(result Result), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkCoolDown()
+
+	switch b.state {
+	case Open:
+		return nil, &OpenError{RetryAfter: b.openedAt.Add(b.settings.CoolDown).Sub(b.now())}
+	case HalfOpen:
+		if b.probes+b.successes >= b.settings.HalfOpenMaxRequests {
+			return nil, &OpenError{}
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(result Result) {
+		b.done(generation, result)
+	}, nil
+}
+
+// done counts the result of a request which was allowed in the given generation.
+// The results of the earlier generations are ignored,
+// e.g. a request allowed while closed does not count as a probe of the half-open state.
+func (b *Breaker) done(generation uint64, result Result) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case Closed:
+		switch result {
+		case Success:
+			b.failures = 0
+		case Failure:
+			b.failures++
+			if b.failures >= b.settings.FailureThreshold {
+				b.setState(Open)
+			}
+		}
+	case HalfOpen:
+		if b.probes > 0 {
+			b.probes--
+		}
+		switch result {
+		case Success:
+			b.successes++
+			if b.successes >= b.settings.HalfOpenMaxRequests {
+				b.setState(Closed)
+			}
+		case Failure:
+			b.setState(Open)
+		}
+	}
+}
+
+// checkCoolDown moves the breaker to the half-open state if the cool-down is over.
+// The caller must hold the lock.
+func (b *Breaker) checkCoolDown() {
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.settings.CoolDown)) {
+		b.setState(HalfOpen)
+	}
+}
+
+// setState moves the breaker to the given state, resets the counters and starts a new generation.
+// The caller must hold the lock.
+func (b *Breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+	if state == Open {
+		b.openedAt = b.now()
+	}
+	if b.settings.OnStateChange != nil && from != state {
+		b.settings.OnStateChange(from, state)
+	}
+}
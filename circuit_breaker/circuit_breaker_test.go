@@ -0,0 +1,241 @@
+package circuit_breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestBreaker returns a breaker with a manual clock and the pointer of its current time.
+func newTestBreaker(settings Settings) (*Breaker, *time.Time) {
+	now := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBreaker(settings)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+// call lets a request through the breaker and reports the given result.
+func call(t *testing.T, b *Breaker, result Result) {
+	t.Helper()
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("request supposed to be allowed got %v", err)
+	}
+	done(result)
+}
+
+func TestNewBreaker(t *testing.T) {
+	b := NewBreaker(Settings{})
+	if b.State() != Closed {
+		t.Errorf("new breaker supposed to be closed but it is %v", b.State())
+	}
+	if b.settings.FailureThreshold != 1 || b.settings.HalfOpenMaxRequests != 1 {
+		t.Errorf("settings supposed to be at least 1 got %+v", b.settings)
+	}
+}
+
+func TestStateString(t *testing.T) {
+	tests := map[State]string{
+		Closed:    "closed",
+		Open:      "open",
+		HalfOpen:  "half-open",
+		State(42): "unknown",
+	}
+	for state, expected := range tests {
+		if got := state.String(); got != expected {
+			t.Errorf("want %s; got %s", expected, got)
+		}
+	}
+}
+
+func TestOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(Settings{FailureThreshold: 3, CoolDown: time.Second})
+
+	for i := 0; i < 2; i++ {
+		call(t, b, Failure)
+	}
+
+	// a success resets the consecutive failures
+	call(t, b, Success)
+
+	for i := 0; i < 2; i++ {
+		call(t, b, Failure)
+	}
+	if b.State() != Closed {
+		t.Fatalf("breaker supposed to be closed but it is %v", b.State())
+	}
+
+	// ignored results are not counted
+	call(t, b, Ignored)
+	if b.State() != Closed {
+		t.Fatalf("breaker supposed to be closed but it is %v", b.State())
+	}
+
+	call(t, b, Failure)
+	if b.State() != Open {
+		t.Fatalf("breaker supposed to be open but it is %v", b.State())
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("want ErrOpen; got %v", err)
+	}
+}
+
+func TestOpenErrorRetryAfter(t *testing.T) {
+	b, now := newTestBreaker(Settings{FailureThreshold: 1, CoolDown: time.Second})
+	call(t, b, Failure)
+
+	*now = now.Add(time.Millisecond * 400)
+
+	var openErr *OpenError
+	if _, err := b.Allow(); !errors.As(err, &openErr) {
+		t.Fatalf("want *OpenError; got %v", err)
+	}
+	if openErr.RetryAfter != time.Millisecond*600 {
+		t.Fatalf("want retry after %v; got %v", time.Millisecond*600, openErr.RetryAfter)
+	}
+}
+
+func TestHalfOpen(t *testing.T) {
+	tests := map[string]struct {
+		ProbeResults  []Result
+		ExpectedState State
+	}{
+		"probes succeed": {
+			ProbeResults:  []Result{Success, Success},
+			ExpectedState: Closed,
+		},
+		"probe fails": {
+			ProbeResults:  []Result{Success, Failure},
+			ExpectedState: Open,
+		},
+		"probe is ignored": {
+			ProbeResults:  []Result{Ignored},
+			ExpectedState: HalfOpen,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b, now := newTestBreaker(Settings{FailureThreshold: 1, CoolDown: time.Second, HalfOpenMaxRequests: 2})
+			call(t, b, Failure)
+
+			*now = now.Add(time.Millisecond * 999)
+			if b.State() != Open {
+				t.Fatalf("breaker supposed to be open during the cool-down but it is %v", b.State())
+			}
+
+			*now = now.Add(time.Millisecond)
+			if b.State() != HalfOpen {
+				t.Fatalf("breaker supposed to be half-open after the cool-down but it is %v", b.State())
+			}
+
+			for _, result := range test.ProbeResults {
+				call(t, b, result)
+			}
+
+			if b.State() != test.ExpectedState {
+				t.Fatalf("want state %v; got %v", test.ExpectedState, b.State())
+			}
+		})
+	}
+}
+
+func TestHalfOpenLimitsProbes(t *testing.T) {
+	b, now := newTestBreaker(Settings{FailureThreshold: 1, CoolDown: time.Second, HalfOpenMaxRequests: 1})
+	call(t, b, Failure)
+	*now = now.Add(time.Second)
+
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("first probe supposed to be allowed got %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("second probe supposed to be rejected got %v", err)
+	}
+
+	done(Success)
+	if b.State() != Closed {
+		t.Fatalf("breaker supposed to be closed but it is %v", b.State())
+	}
+}
+
+func TestOnStateChange(t *testing.T) {
+	var changes []string
+	b, now := newTestBreaker(Settings{
+		FailureThreshold: 1,
+		CoolDown:         time.Second,
+		OnStateChange: func(from, to State) {
+			changes = append(changes, from.String()+"->"+to.String())
+		},
+	})
+
+	call(t, b, Failure)
+	*now = now.Add(time.Second)
+	call(t, b, Success)
+
+	expected := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(expected) {
+		t.Fatalf("want changes %v; got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("want changes %v; got %v", expected, changes)
+		}
+	}
+}
+
+func TestStaleResultsAreIgnored(t *testing.T) {
+	tests := map[string]struct {
+		StaleResult   Result
+		ExpectedState State
+	}{
+		"stale success does not close": {
+			StaleResult:   Success,
+			ExpectedState: HalfOpen,
+		},
+		"stale failure does not reopen": {
+			StaleResult:   Failure,
+			ExpectedState: HalfOpen,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			b, now := newTestBreaker(Settings{FailureThreshold: 1, CoolDown: time.Second, HalfOpenMaxRequests: 1})
+
+			// the slow request is allowed while closed and completes after the breaker is half-open
+			slowDone, err := b.Allow()
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			call(t, b, Failure)
+			*now = now.Add(time.Second)
+			if b.State() != HalfOpen {
+				t.Fatalf("breaker supposed to be half-open but it is %v", b.State())
+			}
+
+			probeDone, err := b.Allow()
+			if err != nil {
+				t.Fatalf("probe supposed to be allowed got %v", err)
+			}
+			slowDone(test.StaleResult)
+			if b.State() != test.ExpectedState {
+				t.Fatalf("want state %v after the stale result; got %v", test.ExpectedState, b.State())
+			}
+
+			// the stale result does not free the slot of the probe
+			if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+				t.Fatalf("second probe supposed to be rejected got %v", err)
+			}
+
+			probeDone(Success)
+			if b.State() != Closed {
+				t.Fatalf("breaker supposed to be closed by the probe but it is %v", b.State())
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/canbo-x/dog-ceo/fakedogceo"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	// This port is used to serve the fake dog.ceo API.
+	port := flag.Int("port", 8080, "The fake dog.ceo API port.")
+
+	// These knobs are used to simulate a slow or failing upstream.
+	latency := flag.Duration("latency", 0, "The latency which is added to every response.")
+	errorRate := flag.Float64("error-rate", 0, "The probability of responding with 500 between 0 and 1.")
+	notFoundRate := flag.Float64("not-found-rate", 0, "The probability of responding with 404 between 0 and 1.")
+	seed := flag.Int64("seed", 0, "The seed of the random source. 0 uses the current time.")
+
+	// Parse the command line flags
+	flag.Parse()
+
+	logger := logrus.New()
+
+	if *errorRate < 0 || *errorRate > 1 || *notFoundRate < 0 || *notFoundRate > 1 {
+		logger.Fatalf("error-rate and not-found-rate must be between 0 and 1")
+	}
+
+	server := &http.Server{
+		Addr: fmt.Sprintf(":%d", *port),
+		Handler: fakedogceo.New(fakedogceo.Options{
+			Latency:      *latency,
+			ErrorRate:    *errorRate,
+			NotFoundRate: *notFoundRate,
+			Seed:         *seed,
+		}),
+	}
+
+	logger.Infof("Fake dog.ceo API is listening on port %d, base URL is http://localhost:%d%s", *port, *port, fakedogceo.APIPath)
+
+	errChan := make(chan error, 1)
+
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, syscall.SIGTERM, syscall.SIGINT)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errChan <- err
+		}
+	}()
+
+	select {
+	case err := <-errChan:
+		logger.Fatalf("Fatal error: %v\n", err)
+	case <-stopChan:
+		logger.Info("Stopping the fake dog.ceo API...")
+		server.Close()
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/canbo-x/dog-ceo/proto/admin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeAdminServer returns the given response or error for every reload.
+type fakeAdminServer struct {
+	admin.UnimplementedAdminServiceServer
+
+	resp *admin.ReloadConfigResponse
+	err  error
+}
+
+// ReloadConfig returns the response or the error of the fake server.
+func (s *fakeAdminServer) ReloadConfig(context.Context, *admin.ReloadConfigRequest) (*admin.ReloadConfigResponse, error) {
+	return s.resp, s.err
+}
+
+func TestReloadConfigCommand(t *testing.T) {
+	tests := map[string]struct {
+		Server   *fakeAdminServer
+		ExitCode int
+	}{
+		"reloaded": {
+			Server:   &fakeAdminServer{resp: &admin.ReloadConfigResponse{Applied: []string{"rate_limit.rate"}, RestartRequired: []string{"listener.port"}}},
+			ExitCode: exitOK,
+		},
+		"nothing changed": {
+			Server:   &fakeAdminServer{resp: &admin.ReloadConfigResponse{}},
+			ExitCode: exitOK,
+		},
+		"invalid configuration": {
+			Server:   &fakeAdminServer{err: status.Error(codes.FailedPrecondition, "failed to reload the configuration")},
+			ExitCode: exitFailure,
+		},
+		"admin service is disabled": {
+			Server:   nil,
+			ExitCode: exitFailure,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			listener := bufconn.Listen(1024 * 1024)
+			server := grpc.NewServer()
+			if test.Server != nil {
+				admin.RegisterAdminServiceServer(server, test.Server)
+			}
+			go server.Serve(listener)
+			defer server.Stop()
+
+			conn, err := grpc.Dial("bufnet",
+				grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			err = reloadConfigCommand(context.Background(), admin.NewAdminServiceClient(conn))
+			if got := exitCode(err); got != test.ExitCode {
+				t.Fatalf("want exit code %d; got %d (%v)", test.ExitCode, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"github.com/canbo-x/dog-ceo/auth"
+	"google.golang.org/grpc/credentials"
+)
+
+// tokenCredentials sends the given token as a bearer token with every request.
+// The token can be an API key or a JWT.
+type tokenCredentials struct {
+	token string
+
+	// secure is true if the connection uses TLS.
+	secure bool
+}
+
+// GetRequestMetadata returns the authorization metadata of the token.
+func (c tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{auth.AuthorizationHeader: "Bearer " + c.token}, nil
+}
+
+// RequireTransportSecurity returns true if the connection uses TLS, so the token is never sent in plaintext by mistake
+// when TLS is expected. The plaintext connections can still send the token, e.g. to a server on the same host.
+func (c tokenCredentials) RequireTransportSecurity() bool {
+	return c.secure
+}
+
+// newTokenCredentials returns the credentials of the given token.
+// If the token is empty, it returns nil and no credentials are sent.
+func newTokenCredentials(token string, secure bool) credentials.PerRPCCredentials {
+	if token == "" {
+		return nil
+	}
+	return tokenCredentials{token: token, secure: secure}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/canbo-x/dog-ceo/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestTokenCredentials(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator(auth.Settings{APIKeys: map[string]string{"secret-key": "partner"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.UnaryInterceptor(authenticator.UnaryServerInterceptor()))
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	defer server.Stop()
+
+	tests := map[string]struct {
+		Token    string
+		ExitCode int
+	}{
+		"valid token":   {Token: "secret-key", ExitCode: exitOK},
+		"invalid token": {Token: "wrong-key", ExitCode: exitUnauthenticated},
+		"no token":      {Token: "", ExitCode: exitUnauthenticated},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			options := []grpc.DialOption{
+				grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			}
+			if creds := newTokenCredentials(test.Token, false); creds != nil {
+				options = append(options, grpc.WithPerRPCCredentials(creds))
+			}
+			conn, err := grpc.Dial("bufnet", options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			err = healthCommand(context.Background(), grpc_health_v1.NewHealthClient(conn), []string{})
+			if got := exitCode(err); got != test.ExitCode {
+				t.Fatalf("want exit code %d; got %d (%v)", test.ExitCode, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// These exit codes are used to tell the shell what kind of error happened.
+const (
+	exitOK                = 0
+	exitFailure           = 1
+	exitInvalidArgument   = 2
+	exitNotFound          = 3
+	exitDeadlineExceeded  = 4
+	exitUnavailable       = 5
+	exitResourceExhausted = 6
+	exitUnauthenticated   = 7
+	exitPermissionDenied  = 8
+)
+
+// exitCode returns the exit code of the given error.
+// Errors which do not come from the server return exitFailure.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return exitFailure
+	}
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return exitInvalidArgument
+	case codes.NotFound:
+		return exitNotFound
+	case codes.DeadlineExceeded:
+		return exitDeadlineExceeded
+	case codes.Unavailable:
+		return exitUnavailable
+	case codes.ResourceExhausted:
+		return exitResourceExhausted
+	case codes.Unauthenticated:
+		return exitUnauthenticated
+	case codes.PermissionDenied:
+		return exitPermissionDenied
+	default:
+		return exitFailure
+	}
+}
+
+// describeError returns a human readable message of the given error.
+// It uses the BadRequest and RetryInfo details of the status if there are any.
+func describeError(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err.Error()
+	}
+
+	var violations []string
+	retryHint := ""
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, violation := range d.GetFieldViolations() {
+				violations = append(violations, fmt.Sprintf("%s %s", violation.GetField(), violation.GetDescription()))
+			}
+		case *errdetails.RetryInfo:
+			retryHint = fmt.Sprintf(", please try again in %v", d.GetRetryDelay().AsDuration())
+		}
+	}
+
+	switch st.Code() {
+	case codes.InvalidArgument:
+		if len(violations) > 0 {
+			return fmt.Sprintf("invalid request: %s", strings.Join(violations, "; "))
+		}
+		return fmt.Sprintf("invalid request: %s", st.Message())
+	case codes.NotFound:
+		return fmt.Sprintf("not found: %s", st.Message())
+	case codes.DeadlineExceeded:
+		return fmt.Sprintf("request timed out: %s", st.Message())
+	case codes.Unavailable:
+		if retryHint == "" {
+			retryHint = ", please try again later"
+		}
+		return fmt.Sprintf("service is unavailable%s: %s", retryHint, st.Message())
+	case codes.ResourceExhausted:
+		if retryHint == "" {
+			retryHint = ", please slow down"
+		}
+		return fmt.Sprintf("too many requests%s: %s", retryHint, st.Message())
+	case codes.Unauthenticated:
+		return fmt.Sprintf("authentication failed, please check the token: %s", st.Message())
+	case codes.PermissionDenied:
+		return fmt.Sprintf("permission denied: %s", st.Message())
+	default:
+		return fmt.Sprintf("server error (%v): %s", st.Code(), st.Message())
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// statusWithDetails returns a status error with the given details.
+func statusWithDetails(t *testing.T, code codes.Code, message string, details ...*errdetails.RetryInfo) error {
+	st := status.New(code, message)
+	for _, detail := range details {
+		var err error
+		st, err = st.WithDetails(detail)
+		if err != nil {
+			t.Fatalf("failed to add details %v", err)
+		}
+	}
+	return st.Err()
+}
+
+func TestExitCodeAndDescribeError(t *testing.T) {
+	badRequest, err := status.New(codes.InvalidArgument, "invalid breed").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "breed", Description: "it can only contain english latin letters"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to add details %v", err)
+	}
+
+	tests := map[string]struct {
+		Err              error
+		ExpectedExitCode int
+		ExpectedMessage  string
+	}{
+		"no error": {
+			Err:              nil,
+			ExpectedExitCode: exitOK,
+		},
+		"local error": {
+			Err:              errors.New("failed to save image to disk"),
+			ExpectedExitCode: exitFailure,
+			ExpectedMessage:  "failed to save image to disk",
+		},
+		"invalid argument": {
+			Err:              badRequest.Err(),
+			ExpectedExitCode: exitInvalidArgument,
+			ExpectedMessage:  "invalid request: breed it can only contain english latin letters",
+		},
+		"not found": {
+			Err:              status.Error(codes.NotFound, "breed is not found"),
+			ExpectedExitCode: exitNotFound,
+			ExpectedMessage:  "not found: breed is not found",
+		},
+		"deadline exceeded": {
+			Err:              status.Error(codes.DeadlineExceeded, "context deadline exceeded"),
+			ExpectedExitCode: exitDeadlineExceeded,
+			ExpectedMessage:  "request timed out",
+		},
+		"unavailable with retry info": {
+			Err:              statusWithDetails(t, codes.Unavailable, "circuit breaker is open", &errdetails.RetryInfo{RetryDelay: durationpb.New(time.Second * 3)}),
+			ExpectedExitCode: exitUnavailable,
+			ExpectedMessage:  "service is unavailable, please try again in 3s",
+		},
+		"resource exhausted": {
+			Err:              status.Error(codes.ResourceExhausted, "rate limited"),
+			ExpectedExitCode: exitResourceExhausted,
+			ExpectedMessage:  "too many requests, please slow down",
+		},
+		"unauthenticated": {
+			Err:              status.Error(codes.Unauthenticated, "invalid credentials"),
+			ExpectedExitCode: exitUnauthenticated,
+			ExpectedMessage:  "authentication failed, please check the token",
+		},
+		"permission denied": {
+			Err:              status.Error(codes.PermissionDenied, "admin service requires an admin principal"),
+			ExpectedExitCode: exitPermissionDenied,
+			ExpectedMessage:  "permission denied: admin service requires an admin principal",
+		},
+		"internal": {
+			Err:              status.Error(codes.Internal, "unexpected"),
+			ExpectedExitCode: exitFailure,
+			ExpectedMessage:  "server error (Internal): unexpected",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := exitCode(test.Err); got != test.ExpectedExitCode {
+				t.Fatalf("want exit code %d; got %d", test.ExpectedExitCode, got)
+			}
+			if test.Err == nil {
+				return
+			}
+			if got := describeError(test.Err); !strings.HasPrefix(got, test.ExpectedMessage) {
+				t.Fatalf("want message starts with %q; got %q", test.ExpectedMessage, got)
+			}
+		})
+	}
+}
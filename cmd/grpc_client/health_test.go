@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestHealthCommand(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("dog.ceo", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	tests := map[string]struct {
+		Args     []string
+		ExitCode int
+	}{
+		"whole server": {
+			Args:     []string{},
+			ExitCode: exitOK,
+		},
+		"not serving dependency": {
+			Args:     []string{"-service", "dog.ceo"},
+			ExitCode: exitUnavailable,
+		},
+		"unknown service": {
+			Args:     []string{"-service", "unknown"},
+			ExitCode: exitNotFound,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			err := healthCommand(context.Background(), client, test.Args)
+			if got := exitCode(err); got != test.ExitCode {
+				t.Fatalf("want exit code %d; got %d (%v)", test.ExitCode, got, err)
+			}
+		})
+	}
+}
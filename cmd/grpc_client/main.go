@@ -2,31 +2,81 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/canbo-x/dog-ceo/proto/admin"
 	"github.com/canbo-x/dog-ceo/proto/breed_image"
+	"github.com/canbo-x/dog-ceo/tls_config"
+	"github.com/canbo-x/dog-ceo/tracing"
 	"github.com/canbo-x/dog-ceo/utils"
+	otel_codes "go.opentelemetry.io/otel/codes"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
 	help := flag.Bool("help", false, "flag to show help")
+
+	// These flags are used to connect to the server over TLS, their defaults are read from the environment variables.
+	useTLS := flag.Bool("tls", getEnv("CLIENT_TLS", "") == "true", "connect to the server over TLS")
+	tlsCA := flag.String("tls-ca", getEnv("CLIENT_TLS_CA", ""), "PEM encoded certificate authorities which verify the server certificate")
+	tlsCert := flag.String("tls-cert", getEnv("CLIENT_TLS_CERT", ""), "PEM encoded client certificate for mutual TLS")
+	tlsKey := flag.String("tls-key", getEnv("CLIENT_TLS_KEY", ""), "PEM encoded private key of the client certificate")
+	tlsServerName := flag.String("tls-server-name", getEnv("CLIENT_TLS_SERVER_NAME", ""), "host name which is verified against the server certificate")
+	token := flag.String("token", getEnv("CLIENT_TOKEN", ""), "API key or JWT which is sent as a bearer token")
+	timeout := flag.Duration("timeout", time.Second, "timeout of every attempt of a request, a retried request gets a new one")
+	maxRetryWait := flag.Duration("max-retry-wait", time.Second*10, "longest wait before retrying a rate limited request")
 	flag.Parse()
 
 	if *help {
 		helpCommand()
 	}
+	if *timeout <= 0 {
+		log.Fatalf("timeout must be positive: %v", *timeout)
+	}
+	calls := callSettings{Timeout: *timeout, MaxRetryWait: *maxRetryWait}
+
+	// Set up the tracing, the trace context of every command is sent to the server.
+	tracerProvider, err := newTracerProvider()
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	creds, err := newTransportCredentials(tlsSettings{
+		Enabled:    *useTLS,
+		Files:      tls_config.Files{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA},
+		ServerName: *tlsServerName,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up TLS: %v", err)
+	}
 
 	// Set up a connection to the server.
-	conn, err := grpc.Dial(getAddr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	// The request ID of a failed request is printed with the error, so it can be found in the logs of the server.
+	requestIDs := &requestIDRecorder{}
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor(tracerProvider), rateLimitRetryInterceptor(calls), requestIDs.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(tracing.StreamClientInterceptor(tracerProvider), requestIDs.StreamClientInterceptor()),
+	}
+	if tokenCreds := newTokenCredentials(*token, creds.Info().SecurityProtocol == "tls"); tokenCreds != nil {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(tokenCreds))
+	}
+	conn, err := grpc.Dial(getAddr(), dialOptions...)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -36,94 +86,389 @@ func main() {
 	c := breed_image.NewBreedImageServiceClient(conn)
 
 	// Contact the server and print out its response.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	// Every attempt of a request has its own timeout, so the wait before a retry is not limited by it.
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if len(os.Args) < 2 {
+	// the global flags are parsed, the rest of the arguments are the command and its flags
+	args := flag.Args()
+	if len(args) < 1 {
 		log.Println("expected a command please run `<executable> help` for more information")
-		os.Exit(1)
+		os.Exit(exitFailure)
 	}
 
-	switch os.Args[1] {
+	ctx, span := tracerProvider.Tracer(traceServiceName).Start(ctx, args[0])
+
+	switch args[0] {
 	case "search":
-		searchCommand(ctx, c, os.Args[2:])
+		err = searchCommand(ctx, c, calls, args[1:])
+	case "list":
+		err = listCommand(ctx, c, args[1:])
+	case "health":
+		err = healthCommand(ctx, grpc_health_v1.NewHealthClient(conn), args[1:])
+	case "reload-config":
+		err = reloadConfigCommand(ctx, admin.NewAdminServiceClient(conn))
 	default:
 		log.Println("expected a valid command please run `<executable> help` for more information")
-		os.Exit(1)
+		os.Exit(exitFailure)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otel_codes.Error, err.Error())
+	}
+	span.End()
+	if err := tracing.Shutdown(tracerProvider, traceShutdownTimeout); err != nil {
+		log.Printf("failed to export the traces: %v", err)
+	}
+
+	if err != nil {
+		log.Println(describeError(err))
+		if id := requestIDs.ID(); id != "" {
+			log.Printf("request id: %s\n", id)
+		}
+		cancel()
+		conn.Close()
+		os.Exit(exitCode(err))
 	}
 }
 
 // searchCommand searches for the breed image.
 // Breed is required.
-// Sub-breed, save, path and file-name are optional.
+// Sub-breed, count, save, path and file-name are optional.
 // If the sub-breed is provided, it searches for the sub-breed image.
+// If the count is more than 1, it searches for that many images at once.
 // If the save flag is provided, it saves the image to the path.
 // If the path is not provided, it saves the image to the default directory [images/].
 // If the file name is not provided, it gets the file name from the image URL.
+// If the file name is provided with a count more than 1, the images are numbered e.g. lovelyDog_1.jpg.
 // If save flag is provided, it prints the full path of the image.
 // If save flag is not provided, it prints the image URL only.
-func searchCommand(ctx context.Context, c breed_image.BreedImageServiceClient, args []string) {
+// If the stream flag is provided, it streams the image and writes it to disk as the chunks arrive.
+// It returns an error if the search or saving the image fails.
+func searchCommand(ctx context.Context, c breed_image.BreedImageServiceClient, calls callSettings, args []string) error {
 	searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
 	breed := searchCmd.String("breed", "", "Enter a breed name to search")
 	subBreed := searchCmd.String("sub-breed", "", "Enter a sub-breed name to search")
+	count := searchCmd.Int("count", 1, "number of images to search between 1 and 50")
 	save := searchCmd.Bool("save", false, "flag to save the image to disk")
 	givenPath := searchCmd.String("path", "images/", "path to save the image to")
 	givenFileName := searchCmd.String("file-name", "", "file name to save the image to")
+	stream := searchCmd.Bool("stream", false, "flag to stream the image to disk chunk by chunk")
 
 	searchCmd.Parse(args)
 
 	log.Println("searching...")
 
-	resp, err := c.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: *breed, SubBreed: *subBreed})
-	if err != nil {
-		log.Printf("could not search: %v", err)
-		return
+	if *stream {
+		if *count != 1 {
+			return fmt.Errorf("stream flag can only be used with a single image")
+		}
+		return streamSearch(ctx, c, calls, *breed, *subBreed, *givenFileName, *givenPath)
 	}
 
-	if resp.ImageURL == "" || resp.Image == nil {
-		log.Println("server response is not valid")
-		return
+	var images []*breed_image.BreedImage
+	if *count == 1 {
+		resp, err := c.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: *breed, SubBreed: *subBreed})
+		if err != nil {
+			return err
+		}
+		images = append(images, &breed_image.BreedImage{ImageURL: resp.ImageURL, Image: resp.Image})
+	} else {
+		resp, err := c.SearchMany(ctx, &breed_image.SearchManyRequest{Breed: *breed, SubBreed: *subBreed, Count: int32(*count)})
+		if err != nil {
+			return err
+		}
+		images = resp.Images
+	}
+
+	if len(images) == 0 {
+		return fmt.Errorf("server response is not valid")
+	}
+	for _, image := range images {
+		if image.ImageURL == "" || image.Image == nil {
+			return fmt.Errorf("server response is not valid")
+		}
 	}
 
 	if !*save {
-		log.Printf("an image has been found here is the URL: \n%s\nplease add -save true flag in order to save", resp.ImageURL)
-		return
+		for _, image := range images {
+			log.Printf("an image has been found here is the URL: \n%s\n", image.ImageURL)
+		}
+		log.Println("please add -save true flag in order to save")
+		return nil
+	}
+
+	log.Printf("%d image(s) have been found now saving to disk...\n", len(images))
+
+	for i, image := range images {
+		name := *givenFileName
+		if name != "" && len(images) > 1 {
+			name = fmt.Sprintf("%s_%d", name, i+1)
+		}
+
+		str, err := saveImage(image, name, *givenPath)
+		if err != nil {
+			return err
+		}
+		log.Println("image saved to disk at : ", str)
+	}
+	return nil
+}
+
+// streamSearch streams a random image of the given breed and sub-breed and writes the chunks to disk as they arrive.
+// The image is written to a temporary file first and it is renamed when the size and the hash are verified.
+// If the name is empty, it gets the file name from the image URL.
+// The stream has the timeout of the given settings.
+func streamSearch(ctx context.Context, c breed_image.BreedImageServiceClient, calls callSettings, breed, subBreed, name, givenPath string) error {
+	stream, resp, cancel, err := openStreamSearch(ctx, c, calls, &breed_image.BreedImageSearchRequest{Breed: breed, SubBreed: subBreed})
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	metadata := resp.GetMetadata()
+	if metadata == nil || metadata.ImageURL == "" {
+		return fmt.Errorf("server response is not valid")
+	}
+
+	log.Printf("an image has been found now streaming it to disk... URL : %s\n", metadata.ImageURL)
+
+	fileName, err := handleFileName(name, metadata.ImageURL)
+	if err != nil {
+		return fmt.Errorf("could not handle file name: %v", err)
+	}
+
+	if err := os.MkdirAll(givenPath, 0777); err != nil {
+		return fmt.Errorf("failed to create directory : %v", err)
+	}
+	file, err := os.CreateTemp(givenPath, fileName+".*.part")
+	if err != nil {
+		return fmt.Errorf("failed to create file : %v", err)
+	}
+	// the temporary file is already renamed if the image is saved
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+	w := io.MultiWriter(file, hash)
+	var size int64
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return err
+		}
+		n, err := w.Write(resp.GetChunk())
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write file : %v", err)
+		}
+		size += int64(n)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write file : %v", err)
+	}
+
+	if metadata.Size >= 0 && size != metadata.Size {
+		return fmt.Errorf("image is incomplete, received %d of %d bytes", size, metadata.Size)
+	}
+	if expected := stream.Trailer().Get("image-sha256"); len(expected) > 0 && expected[0] != hex.EncodeToString(hash.Sum(nil)) {
+		return fmt.Errorf("image is corrupted, hash does not match")
+	}
+
+	fullPath := filepath.Join(givenPath, fileName)
+	if err := os.Rename(file.Name(), fullPath); err != nil {
+		return fmt.Errorf("failed to save image to disk : %v", err)
 	}
 
-	log.Printf("an image has been found now saving it to disk...\n")
+	str, err := filepath.Abs(fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	log.Printf("image saved to disk at : %s (%d bytes)\n", str, size)
+	return nil
+}
+
+// openStreamSearch starts a stream search and receives its first message.
+// A stream rejects a rate limited request with its first message,
+// so it is retried once here after the wait the server asked for.
+// Every attempt has the timeout of the given settings, the returned function cancels the stream.
+func openStreamSearch(ctx context.Context, c breed_image.BreedImageServiceClient, calls callSettings, req *breed_image.BreedImageSearchRequest) (breed_image.BreedImageService_StreamSearchClient, *breed_image.StreamSearchResponse, context.CancelFunc, error) {
+	for retried := false; ; retried = true {
+		attemptCtx, cancel := context.WithTimeout(ctx, calls.Timeout)
+		stream, err := c.StreamSearch(attemptCtx, req)
+		if err != nil {
+			cancel()
+			return nil, nil, nil, err
+		}
+		resp, err := stream.Recv()
+		if err == nil {
+			return stream, resp, cancel, nil
+		}
+		trailer := stream.Trailer()
+		cancel()
+		if retried || !waitForRetry(ctx, err, trailer, calls.MaxRetryWait) {
+			return nil, nil, nil, err
+		}
+	}
+}
 
-	fileName, err := handleFileName(*givenFileName, resp.ImageURL)
+// saveImage saves the given image to the given path and returns its absolute path.
+// If the name is empty, it gets the file name from the image URL.
+func saveImage(image *breed_image.BreedImage, name, givenPath string) (string, error) {
+	fileName, err := handleFileName(name, image.ImageURL)
 	if err != nil {
-		log.Printf("could not handle file name: %v", err)
-		return
+		return "", fmt.Errorf("could not handle file name: %v", err)
 	}
 
-	fullPath, err := utils.SaveToDisk(resp.Image, fileName, *givenPath)
+	fullPath, err := utils.SaveToDisk(image.Image, fileName, givenPath)
 	if err != nil {
-		log.Printf("failed to save image to disk : %v", err)
-		return
+		return "", fmt.Errorf("failed to save image to disk : %v", err)
 	}
 
 	str, err := filepath.Abs(fullPath)
 	if err != nil {
-		log.Printf("failed to get absolute path: %v", err)
-		return
+		return "", fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	return str, nil
+}
+
+// listCommand lists the available breeds.
+// Breed is optional.
+// If the breed is provided, it lists the sub-breeds of the given breed only.
+// If the breed is not provided, it lists all the breeds with their sub-breeds.
+// It returns an error if the listing fails.
+func listCommand(ctx context.Context, c breed_image.BreedImageServiceClient, args []string) error {
+	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
+	breed := listCmd.String("breed", "", "Enter a breed name to list its sub-breeds")
+
+	listCmd.Parse(args)
+
+	log.Println("listing...")
+
+	if *breed != "" {
+		resp, err := c.ListSubBreeds(ctx, &breed_image.ListSubBreedsRequest{Breed: *breed})
+		if err != nil {
+			return err
+		}
+		fmt.Print(formatBreedList(map[string][]string{resp.Breed: resp.SubBreeds}))
+		return nil
+	}
+
+	resp, err := c.ListBreeds(ctx, &breed_image.ListBreedsRequest{})
+	if err != nil {
+		return err
+	}
+
+	breeds := make(map[string][]string, len(resp.Breeds))
+	for breed, subBreeds := range resp.Breeds {
+		breeds[breed] = subBreeds.GetSubBreeds()
+	}
+	fmt.Print(formatBreedList(breeds))
+	return nil
+}
+
+// healthCommand checks the health of the server.
+// Service is optional, the empty service is the whole server.
+// The server also reports its dependencies as services, e.g. dog.ceo and breed-catalog.
+// It returns an Unavailable error if the service is not serving, so the exit code tells the status.
+func healthCommand(ctx context.Context, c grpc_health_v1.HealthClient, args []string) error {
+	healthCmd := flag.NewFlagSet("health", flag.ExitOnError)
+	service := healthCmd.String("service", "", "Enter a service name to check, empty checks the whole server")
+
+	healthCmd.Parse(args)
+
+	resp, err := c.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: *service})
+	if err != nil {
+		return err
+	}
+
+	name := *service
+	if name == "" {
+		name = "server"
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return status.Errorf(codes.Unavailable, "%s is %v", name, resp.Status)
+	}
+	log.Printf("%s is %v\n", name, resp.Status)
+	return nil
+}
+
+// reloadConfigCommand asks the server to reload its configuration file.
+// The admin service must be enabled on the server.
+// It prints the applied settings and the settings which are applied after the next restart of the server.
+func reloadConfigCommand(ctx context.Context, c admin.AdminServiceClient) error {
+	resp, err := c.ReloadConfig(ctx, &admin.ReloadConfigRequest{})
+	if err != nil {
+		return err
 	}
 
-	log.Println("image saved to disk at : ", str)
+	if len(resp.Applied) == 0 && len(resp.RestartRequired) == 0 {
+		log.Println("Configuration is reloaded, nothing is changed")
+		return nil
+	}
+	if len(resp.Applied) > 0 {
+		log.Printf("Applied settings : %s\n", strings.Join(resp.Applied, ", "))
+	}
+	if len(resp.RestartRequired) > 0 {
+		log.Printf("Settings which require a restart : %s\n", strings.Join(resp.RestartRequired, ", "))
+	}
+	return nil
+}
 
+// formatBreedList returns the breeds and their sub-breeds as a human readable text.
+// Breeds are sorted alphabetically and each breed is printed on its own line.
+// Example:
+// australian : shepherd
+// husky
+func formatBreedList(breeds map[string][]string) string {
+	names := make([]string, 0, len(breeds))
+	for breed := range breeds {
+		names = append(names, breed)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, breed := range names {
+		sb.WriteString(breed)
+		if len(breeds[breed]) > 0 {
+			sb.WriteString(" : ")
+			sb.WriteString(strings.Join(breeds[breed], ", "))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
 }
 
 // helpCommand prints the help message.
 func helpCommand() {
-	fmt.Println("Usage: executable [command] [flags]")
+	fmt.Println("Usage: executable [global flags] [command] [flags]")
+	fmt.Println("Global flags:")
+	fmt.Println("  -tls \t\t\t\t[optional]")
+	fmt.Println("  -tls-ca <file> \t\t[optional]")
+	fmt.Println("  -tls-cert <file> \t\t[optional]")
+	fmt.Println("  -tls-key <file> \t\t[optional]")
+	fmt.Println("  -tls-server-name <name> \t[optional]")
+	fmt.Println("  -token <token> \t\t[optional]")
+	fmt.Println("  -timeout <duration> \t\t[optional]")
+	fmt.Println("  -max-retry-wait <duration> \t[optional]")
 	fmt.Println("Commands:")
 	fmt.Println("  search")
 	fmt.Println("    -breed <breed> \t\t[required]")
 	fmt.Println("    -sub-breed <sub-breed> \t[optional]")
+	fmt.Println("    -count <count> \t\t[optional]")
 	fmt.Println("    -save \t\t\t[optional]")
 	fmt.Println("    -path <path> \t\t[optional]")
 	fmt.Println("    -file-name <file-name> \t[optional]")
+	fmt.Println("    -stream \t\t\t[optional]")
+	fmt.Println("  list")
+	fmt.Println("    -breed <breed> \t\t[optional]")
+	fmt.Println("  health")
+	fmt.Println("    -service <service> \t\t[optional]")
+	fmt.Println("  reload-config")
 	fmt.Println("  help")
 	os.Exit(1)
 }
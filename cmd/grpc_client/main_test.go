@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/canbo-x/dog-ceo/breed_image_service"
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/fakedogceo"
 	"github.com/canbo-x/dog-ceo/proto/breed_image"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	grpc_metadata "google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/test/bufconn"
 )
 
@@ -20,12 +30,75 @@ func (*mockServer) Search(ctx context.Context, req *breed_image.BreedImageSearch
 	return &breed_image.BreedImageSearchResponse{ImageURL: "test_url", Image: []byte("test")}, nil
 }
 
-func dialer() func(context.Context, string) (net.Conn, error) {
+func (*mockServer) SearchMany(ctx context.Context, req *breed_image.SearchManyRequest) (*breed_image.SearchManyResponse, error) {
+	resp := &breed_image.SearchManyResponse{}
+	for i := 0; i < int(req.Count); i++ {
+		resp.Images = append(resp.Images, &breed_image.BreedImage{ImageURL: fmt.Sprintf("test_url_%d.jpg", i), Image: []byte("test")})
+	}
+	return resp, nil
+}
+
+// StreamSearch streams "test image" in chunks.
+// If the breed is "corrupted", the hash in the trailer does not match the image.
+func (*mockServer) StreamSearch(req *breed_image.BreedImageSearchRequest, stream breed_image.BreedImageService_StreamSearchServer) error {
+	image := []byte("test image")
+	metadata := &breed_image.ImageMetadata{ImageURL: "test_url.jpg", ContentType: "image/jpeg", Size: int64(len(image))}
+	if err := stream.Send(&breed_image.StreamSearchResponse{Data: &breed_image.StreamSearchResponse_Metadata{Metadata: metadata}}); err != nil {
+		return err
+	}
+	for i := 0; i < len(image); i += 4 {
+		end := i + 4
+		if end > len(image) {
+			end = len(image)
+		}
+		if err := stream.Send(&breed_image.StreamSearchResponse{Data: &breed_image.StreamSearchResponse_Chunk{Chunk: image[i:end]}}); err != nil {
+			return err
+		}
+	}
+
+	hash := sha256.Sum256(image)
+	if req.Breed == "corrupted" {
+		hash = sha256.Sum256([]byte("another image"))
+	}
+	stream.SetTrailer(grpc_metadata.Pairs("image-sha256", hex.EncodeToString(hash[:])))
+	return nil
+}
+
+func (*mockServer) ListBreeds(ctx context.Context, req *breed_image.ListBreedsRequest) (*breed_image.ListBreedsResponse, error) {
+	return &breed_image.ListBreedsResponse{Breeds: map[string]*breed_image.SubBreedList{
+		"australian": {SubBreeds: []string{"shepherd"}},
+		"husky":      {},
+	}}, nil
+}
+
+func (*mockServer) ListSubBreeds(ctx context.Context, req *breed_image.ListSubBreedsRequest) (*breed_image.ListSubBreedsResponse, error) {
+	return &breed_image.ListSubBreedsResponse{Breed: req.Breed, SubBreeds: []string{"shepherd"}}, nil
+}
+
+// fakeUpstreamServer serves the requests from the fake dog.ceo API.
+type fakeUpstreamServer struct {
+	breed_image.UnimplementedBreedImageServiceServer
+	source data_service.DataSource
+}
+
+func (s *fakeUpstreamServer) Search(ctx context.Context, req *breed_image.BreedImageSearchRequest) (*breed_image.BreedImageSearchResponse, error) {
+	imageURL, err := breed_image_service.GetURL(ctx, s.source, req.Breed, req.SubBreed)
+	if err != nil {
+		return nil, err
+	}
+	image, err := breed_image_service.GetImage(ctx, s.source, nil, imageURL)
+	if err != nil {
+		return nil, err
+	}
+	return &breed_image.BreedImageSearchResponse{ImageURL: imageURL, Image: image}, nil
+}
+
+func dialer(srv breed_image.BreedImageServiceServer) func(context.Context, string) (net.Conn, error) {
 	listener := bufconn.Listen(1024 * 1024)
 
 	server := grpc.NewServer()
 
-	breed_image.RegisterBreedImageServiceServer(server, &mockServer{})
+	breed_image.RegisterBreedImageServiceServer(server, srv)
 
 	go func() {
 		if err := server.Serve(listener); err != nil {
@@ -40,16 +113,20 @@ func dialer() func(context.Context, string) (net.Conn, error) {
 
 func getMockCoon() (context.Context, *grpc.ClientConn) {
 	ctx := context.Background()
-	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer()), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer(&mockServer{})), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
 	return ctx, conn
 }
 
-func getRealCoon() (context.Context, *grpc.ClientConn) {
+func getFakeUpstreamCoon(t *testing.T) (context.Context, *grpc.ClientConn) {
+	ts := httptest.NewServer(fakedogceo.New(fakedogceo.Options{}))
+	t.Cleanup(ts.Close)
+	srv := &fakeUpstreamServer{source: data_service.NewHttpDataSource(data_service.NewHttpClient(), ts.URL+fakedogceo.APIPath)}
+
 	ctx := context.Background()
-	conn, err := grpc.DialContext(ctx, getAddr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer(srv)), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -90,7 +167,125 @@ func TestClientWithMockServer(t *testing.T) {
 	}
 }
 
-func TestClientWithRealServer(t *testing.T) {
+func TestSearchCommandWithCount(t *testing.T) {
+	tests := map[string]struct {
+		Args          []string
+		ExpectedFiles []string
+	}{
+		"single image with file name": {
+			Args:          []string{"-breed", "husky", "-save", "-file-name", "dog"},
+			ExpectedFiles: []string{"dog.jpg"},
+		},
+		"many images with file name": {
+			Args:          []string{"-breed", "husky", "-count", "3", "-save", "-file-name", "dog"},
+			ExpectedFiles: []string{"dog_1.jpg", "dog_2.jpg", "dog_3.jpg"},
+		},
+		"many images without file name": {
+			Args:          []string{"-breed", "husky", "-count", "2", "-save"},
+			ExpectedFiles: []string{"test_url_0.jpg", "test_url_1.jpg"},
+		},
+	}
+
+	ctx, conn := getMockCoon()
+	defer conn.Close()
+
+	client := breed_image.NewBreedImageServiceClient(conn)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := searchCommand(ctx, client, testCalls, append(test.Args, "-path", dir)); err != nil {
+				t.Fatalf("error: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if len(entries) != len(test.ExpectedFiles) {
+				t.Fatalf("want %d files; got %d", len(test.ExpectedFiles), len(entries))
+			}
+			for _, file := range test.ExpectedFiles {
+				if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+					t.Fatalf("file is not saved: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamSearchWithMockServer(t *testing.T) {
+	tests := map[string]struct {
+		Breed string
+		Valid bool
+	}{
+		"valid image": {
+			Breed: "husky",
+			Valid: true,
+		},
+		"corrupted image": {
+			Breed: "corrupted",
+			Valid: false,
+		},
+	}
+
+	ctx, conn := getMockCoon()
+	defer conn.Close()
+
+	client := breed_image.NewBreedImageServiceClient(conn)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := searchCommand(ctx, client, testCalls, []string{"-breed", test.Breed, "-stream", "-file-name", "dog", "-path", dir})
+			if (err == nil) != test.Valid {
+				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
+			}
+
+			image, err := os.ReadFile(filepath.Join(dir, "dog.jpg"))
+			if !test.Valid {
+				entries, _ := os.ReadDir(dir)
+				if len(entries) != 0 {
+					t.Fatalf("corrupted image supposed to be removed got %v", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if string(image) != "test image" {
+				t.Fatalf("want image %q; got %q", "test image", image)
+			}
+		})
+	}
+}
+
+func TestListWithMockServer(t *testing.T) {
+	ctx, conn := getMockCoon()
+	defer conn.Close()
+
+	client := breed_image.NewBreedImageServiceClient(conn)
+
+	resp, err := client.ListBreeds(ctx, &breed_image.ListBreedsRequest{})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if len(resp.Breeds) != 2 {
+		t.Fatalf("want 2 breeds; got %d", len(resp.Breeds))
+	}
+
+	subResp, err := client.ListSubBreeds(ctx, &breed_image.ListSubBreedsRequest{Breed: "australian"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if subResp.Breed != "australian" || len(subResp.SubBreeds) != 1 {
+		t.Fatalf("sub-breed response is not correct: %v", subResp)
+	}
+}
+
+func TestClientWithFakeUpstream(t *testing.T) {
 	tests := map[string]struct {
 		Breed           string
 		SubBreed        string
@@ -163,7 +358,7 @@ func TestClientWithRealServer(t *testing.T) {
 		},
 	}
 
-	ctx, conn := getRealCoon()
+	ctx, conn := getFakeUpstreamCoon(t)
 	defer conn.Close()
 
 	client := breed_image.NewBreedImageServiceClient(conn)
@@ -280,3 +475,34 @@ func TestHandleFileName(t *testing.T) {
 	}
 
 }
+
+func TestFormatBreedList(t *testing.T) {
+	tests := map[string]struct {
+		Breeds   map[string][]string
+		Expected string
+	}{
+		"empty list": {
+			Breeds:   map[string][]string{},
+			Expected: "",
+		},
+		"breed without sub-breeds": {
+			Breeds:   map[string][]string{"husky": {}},
+			Expected: "husky\n",
+		},
+		"sorted breeds with sub-breeds": {
+			Breeds:   map[string][]string{"husky": nil, "australian": {"shepherd"}, "hound": {"afghan", "basset"}},
+			Expected: "australian : shepherd\nhound : afghan, basset\nhusky\n",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := formatBreedList(test.Breeds)
+			if got != test.Expected {
+				t.Fatalf("want %q; got %q", test.Expected, got)
+			}
+		})
+	}
+}
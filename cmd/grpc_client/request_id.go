@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/canbo-x/dog-ceo/request_id"
+	"google.golang.org/grpc"
+	grpc_metadata "google.golang.org/grpc/metadata"
+)
+
+// requestIDRecorder keeps the request ID of the last failed RPC,
+// so it can be printed with the error and looked up in the logs of the server.
+type requestIDRecorder struct {
+	mu sync.Mutex
+	id string
+}
+
+// ID returns the request ID of the last failed RPC.
+func (r *requestIDRecorder) ID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.id
+}
+
+// record keeps the request ID of the given response metadata.
+// The trailer is checked first because the server sends the ID in the trailer when the RPC fails.
+func (r *requestIDRecorder) record(mds ...grpc_metadata.MD) {
+	for _, md := range mds {
+		if values := md.Get(request_id.Header); len(values) > 0 {
+			r.mu.Lock()
+			r.id = values[0]
+			r.mu.Unlock()
+			return
+		}
+	}
+}
+
+// UnaryClientInterceptor returns a new unary client interceptor which records the request ID of the failed RPCs.
+func (r *requestIDRecorder) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var header, trailer grpc_metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header), grpc.Trailer(&trailer))...)
+		if err != nil {
+			r.record(trailer, header)
+		}
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a new stream client interceptor which records the request ID of the failed RPCs.
+func (r *requestIDRecorder) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &requestIDStream{ClientStream: stream, recorder: r}, nil
+	}
+}
+
+// requestIDStream records the request ID when receiving a message fails.
+type requestIDStream struct {
+	grpc.ClientStream
+	recorder *requestIDRecorder
+}
+
+// RecvMsg receives a message and records the request ID if the stream failed.
+func (s *requestIDStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		// the trailer is ready once RecvMsg returns an error
+		header, _ := s.ClientStream.Header()
+		s.recorder.record(s.ClientStream.Trailer(), header)
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/canbo-x/dog-ceo/request_id"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRequestIDRecorder(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc_middleware.WithUnaryServerChain(grpc_ctxtags.UnaryServerInterceptor(), request_id.UnaryServerInterceptor()),
+		grpc_middleware.WithStreamServerChain(grpc_ctxtags.StreamServerInterceptor(), request_id.StreamServerInterceptor()),
+	)
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	defer server.Stop()
+
+	recorder := &requestIDRecorder{}
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(recorder.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(recorder.StreamClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	// a successful request does not record its ID
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if id := recorder.ID(); id != "" {
+		t.Fatalf("request id of a successful request should not be recorded %q", id)
+	}
+
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "unknown"}); err == nil {
+		t.Fatalf("error supposed to be returned")
+	}
+	unaryID := recorder.ID()
+	if len(unaryID) != 32 {
+		t.Fatalf("request id of the failed unary request is not recorded %q", unaryID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	server.Stop()
+	if _, err := watch.Recv(); err == nil {
+		t.Fatalf("error supposed to be returned")
+	}
+	if id := recorder.ID(); id == unaryID || len(id) != 32 {
+		t.Errorf("request id of the failed stream is not recorded %q", id)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/rate_limiter"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// rateLimitDelay returns the wait the server asked for before retrying a rate limited request.
+// It uses the RetryInfo detail of the error, or the retry-after metadata if there is no detail.
+// It returns false if the error is not a rate limit rejection or the server did not tell when to retry.
+func rateLimitDelay(err error, trailer grpc_metadata.MD) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+
+	if values := trailer.Get(rate_limiter.RetryAfterHeader); len(values) > 0 {
+		ms, err := strconv.ParseInt(values[0], 10, 64)
+		if err == nil && ms >= 0 {
+			return time.Duration(ms) * time.Millisecond, true
+		}
+	}
+	return 0, false
+}
+
+// callSettings holds the timeouts of the calls to the server.
+type callSettings struct {
+	// Timeout is the deadline of every attempt of a call, a retried call gets a new one,
+	// so the wait before the retry does not use up the time of the retried call.
+	Timeout time.Duration
+
+	// MaxRetryWait is the longest wait before retrying a rate limited call.
+	// The call is not retried if the server asks for a longer wait.
+	MaxRetryWait time.Duration
+}
+
+// waitForRetry waits before retrying a rate limited request and returns true if the request should be retried.
+// It does not wait if the error is not a rate limit rejection, the wait is longer than the given maximum
+// or the wait would outlive the deadline of the context.
+func waitForRetry(ctx context.Context, err error, trailer grpc_metadata.MD, maxWait time.Duration) bool {
+	delay, ok := rateLimitDelay(err, trailer)
+	if !ok || delay > maxWait {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		return false
+	}
+
+	log.Printf("too many requests, retrying in %v\n", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// rateLimitRetryInterceptor returns a unary client interceptor which gives every attempt the timeout of the settings
+// and retries a rate limited request once, after the wait the server asked for.
+func rateLimitRetryInterceptor(settings callSettings) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		invoke := func(opts ...grpc.CallOption) error {
+			attemptCtx, cancel := context.WithTimeout(ctx, settings.Timeout)
+			defer cancel()
+			return invoker(attemptCtx, method, req, reply, cc, opts...)
+		}
+
+		var trailer grpc_metadata.MD
+		// the options are copied, so the trailer option is not written into the array of the caller
+		err := invoke(append(opts[:len(opts):len(opts)], grpc.Trailer(&trailer))...)
+		if err == nil || !waitForRetry(ctx, err, trailer, settings.MaxRetryWait) {
+			return err
+		}
+		return invoke(opts...)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/proto/breed_image"
+	"github.com/canbo-x/dog-ceo/rate_limiter"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// testCalls are the call settings of the rate limit tests, they are the defaults of the client.
+var testCalls = callSettings{Timeout: time.Second, MaxRetryWait: time.Second * 10}
+
+// getRateLimitedCoon returns a connection to the mock server behind a token bucket with the given settings.
+// The connection retries the rate limited requests like the client does.
+func getRateLimitedCoon(t *testing.T, settings rate_limiter.Settings) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	take := rate_limiter.Global(rate_limiter.NewTokenBucket(settings))
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(rate_limiter.UnaryServerInterceptor(take)),
+		grpc.StreamInterceptor(rate_limiter.StreamServerInterceptor(take)),
+	)
+	breed_image.RegisterBreedImageServiceServer(server, &mockServer{})
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(rateLimitRetryInterceptor(testCalls)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestRateLimitRetry(t *testing.T) {
+	conn := getRateLimitedCoon(t, rate_limiter.Settings{Rate: 20, Burst: 1})
+	c := breed_image.NewBreedImageServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"}); err != nil {
+			t.Fatalf("search %d supposed to succeed after the retry got %v", i+1, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := streamSearch(ctx, c, testCalls, "husky", "", "", t.TempDir()); err != nil {
+			t.Fatalf("stream search %d supposed to succeed after the retry got %v", i+1, err)
+		}
+	}
+}
+
+func TestRateLimitRetryAfterTimeout(t *testing.T) {
+	// the server asks for a 2s wait, it is longer than the 1s timeout of an attempt
+	tests := map[string]func(ctx context.Context, c breed_image.BreedImageServiceClient) error{
+		"search": func(ctx context.Context, c breed_image.BreedImageServiceClient) error {
+			_, err := c.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"})
+			return err
+		},
+		"stream search": func(ctx context.Context, c breed_image.BreedImageServiceClient) error {
+			return streamSearch(ctx, c, testCalls, "husky", "", "", t.TempDir())
+		},
+	}
+
+	for name, search := range tests {
+		search := search
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			conn := getRateLimitedCoon(t, rate_limiter.Settings{Rate: 0.5, Burst: 1})
+			c := breed_image.NewBreedImageServiceClient(conn)
+
+			if err := search(context.Background(), c); err != nil {
+				t.Fatalf("first search supposed to succeed got %v", err)
+			}
+			start := time.Now()
+			if err := search(context.Background(), c); err != nil {
+				t.Fatalf("second search supposed to succeed after the retry got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < time.Second {
+				t.Fatalf("client supposed to wait for the retry, waited %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetryOverMaxWait(t *testing.T) {
+	conn := getRateLimitedCoon(t, rate_limiter.Settings{Rate: 0.05, Burst: 1})
+	c := breed_image.NewBreedImageServiceClient(conn)
+
+	if _, err := c.Search(context.Background(), &breed_image.BreedImageSearchRequest{Breed: "husky"}); err != nil {
+		t.Fatalf("first search supposed to succeed got %v", err)
+	}
+
+	start := time.Now()
+	_, err := c.Search(context.Background(), &breed_image.BreedImageSearchRequest{Breed: "husky"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("client supposed to give up without waiting, waited %v", elapsed)
+	}
+}
+
+func TestRateLimitRetryOutlivesDeadline(t *testing.T) {
+	conn := getRateLimitedCoon(t, rate_limiter.Settings{Rate: 0.1, Burst: 1})
+	c := breed_image.NewBreedImageServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := c.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"}); err != nil {
+		t.Fatalf("first search supposed to succeed got %v", err)
+	}
+
+	start := time.Now()
+	_, err := c.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("client supposed to give up without waiting, waited %v", elapsed)
+	}
+
+	err = streamSearch(ctx, c, testCalls, "husky", "", "", t.TempDir())
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted for the stream; got %v", err)
+	}
+}
+
+func TestRateLimitRetryKeepsCallerOptions(t *testing.T) {
+	// the options have spare capacity, so an append would write into the array of the caller
+	opts := make([]grpc.CallOption, 1, 2)
+	opts[0] = grpc.WaitForReady(true)
+	spare := opts[:2]
+	spare[1] = grpc.WaitForReady(false)
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+	if err := rateLimitRetryInterceptor(testCalls)(context.Background(), "/test", nil, nil, nil, invoker, opts...); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if _, ok := spare[1].(grpc.FailFastCallOption); !ok {
+		t.Errorf("options of the caller are changed %T", spare[1])
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	withRetryInfo, _ := status.New(codes.ResourceExhausted, "slow down").WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Millisecond * 300)})
+	tests := map[string]struct {
+		Err      error
+		Trailer  grpc_metadata.MD
+		Expected time.Duration
+		Valid    bool
+	}{
+		"retry info": {
+			Err:      withRetryInfo.Err(),
+			Expected: time.Millisecond * 300,
+			Valid:    true,
+		},
+		"retry info wins over the trailer": {
+			Err:      withRetryInfo.Err(),
+			Trailer:  grpc_metadata.Pairs(rate_limiter.RetryAfterHeader, "900"),
+			Expected: time.Millisecond * 300,
+			Valid:    true,
+		},
+		"trailer": {
+			Err:      status.Error(codes.ResourceExhausted, "slow down"),
+			Trailer:  grpc_metadata.Pairs(rate_limiter.RetryAfterHeader, "900"),
+			Expected: time.Millisecond * 900,
+			Valid:    true,
+		},
+		"invalid trailer": {
+			Err:     status.Error(codes.ResourceExhausted, "slow down"),
+			Trailer: grpc_metadata.Pairs(rate_limiter.RetryAfterHeader, "soon"),
+			Valid:   false,
+		},
+		"no hint": {
+			Err:   status.Error(codes.ResourceExhausted, "slow down"),
+			Valid: false,
+		},
+		"another code": {
+			Err:     status.Error(codes.Unavailable, "down"),
+			Trailer: grpc_metadata.Pairs(rate_limiter.RetryAfterHeader, "900"),
+			Valid:   false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			delay, ok := rateLimitDelay(test.Err, test.Trailer)
+			if ok != test.Valid || delay != test.Expected {
+				t.Fatalf("want %v %t; got %v %t", test.Expected, test.Valid, delay, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/canbo-x/dog-ceo/tls_config"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// tlsSettings holds the TLS settings of the client.
+type tlsSettings struct {
+	// Enabled connects to the server over TLS. It is implied by the CA and certificate files.
+	Enabled bool
+
+	Files tls_config.Files
+
+	// ServerName overrides the host name which is verified against the server certificate.
+	ServerName string
+}
+
+// newTransportCredentials returns the transport credentials of the given settings.
+// If TLS is not enabled and there are no files, the client connects in plaintext.
+// The certificate files are only used for mutual TLS, the server certificate is verified with the CA file
+// or with the system certificate authorities if there is no CA file.
+func newTransportCredentials(settings tlsSettings) (credentials.TransportCredentials, error) {
+	files := settings.Files
+	if !settings.Enabled && files.CAFile == "" && files.CertFile == "" && files.KeyFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	reloader, err := tls_config.NewReloader(files)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(reloader.ClientConfig(settings.ServerName)), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/canbo-x/dog-ceo/tls_config"
+)
+
+func TestNewTransportCredentials(t *testing.T) {
+	tests := map[string]struct {
+		Settings         tlsSettings
+		ExpectedProtocol string
+		Valid            bool
+	}{
+		"plaintext": {
+			Settings:         tlsSettings{},
+			ExpectedProtocol: "insecure",
+			Valid:            true,
+		},
+		"tls with the system certificate authorities": {
+			Settings:         tlsSettings{Enabled: true, ServerName: "dog-ceo.example.com"},
+			ExpectedProtocol: "tls",
+			Valid:            true,
+		},
+		"missing CA file": {
+			Settings: tlsSettings{Files: tls_config.Files{CAFile: "missing.pem"}},
+			Valid:    false,
+		},
+		"certificate without key": {
+			Settings: tlsSettings{Enabled: true, Files: tls_config.Files{CertFile: "client.pem"}},
+			Valid:    false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			creds, err := newTransportCredentials(test.Settings)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if got := creds.Info().SecurityProtocol; got != test.ExpectedProtocol {
+				t.Errorf("security protocol = %q; want %q", got, test.ExpectedProtocol)
+			}
+		})
+	}
+}
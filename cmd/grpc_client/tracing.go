@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// traceServiceName is the service name of the spans of the client.
+const traceServiceName = "grpc_client"
+
+// traceShutdownTimeout is the time the tracer provider is given to export the spans before the client exits.
+const traceShutdownTimeout = time.Second * 5
+
+// newTracerProvider returns the tracer provider of the client which is configured by the environment variables.
+// The spans are not exported by default, but the trace context is still sent to the server.
+func newTracerProvider() (*sdktrace.TracerProvider, error) {
+	return tracing.NewProvider(tracing.Settings{
+		ServiceName: traceServiceName,
+		Exporter:    getEnv("CLIENT_TRACE_EXPORTER", tracing.ExporterNone),
+		Endpoint:    getEnv("CLIENT_TRACE_ENDPOINT", tracing.DefaultOTLPEndpoint),
+		File:        getEnv("CLIENT_TRACE_FILE", "client_traces.json"),
+		SampleRatio: 1,
+	})
+}
+
+// getEnv returns the value of the given environment variable.
+// If it is not set, it returns the given default value.
+func getEnv(key, defaultValue string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/auth"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// jwtLeeway is the allowed clock difference between the server and the token issuer.
+const jwtLeeway = time.Minute
+
+// authSettings holds the settings of the authentication of the incoming requests.
+type authSettings struct {
+	// APIKeysFile holds the API keys as name:key lines.
+	APIKeysFile string
+
+	// JWTSecretFile holds the HMAC secret of the HS256 tokens.
+	JWTSecretFile string
+
+	// JWTPublicKeyFile holds the RSA public key of the RS256 tokens.
+	JWTPublicKeyFile string
+
+	// JWTIssuer and JWTAudience are compared with the claims of the tokens if they are not empty.
+	JWTIssuer   string
+	JWTAudience string
+}
+
+// newAuthenticator creates the authenticator of the given settings.
+// If there are no API keys and no JWT keys, it returns nil and every request is accepted.
+// The health service never requires authentication, so the load balancers can check the server.
+func newAuthenticator(settings authSettings, logger *logrus.Logger) (*auth.Authenticator, error) {
+	if settings.APIKeysFile == "" && settings.JWTSecretFile == "" && settings.JWTPublicKeyFile == "" {
+		logger.Info("Authentication is disabled")
+		return nil, nil
+	}
+
+	authenticatorSettings := auth.Settings{
+		ExemptServices: []string{grpc_health_v1.Health_ServiceDesc.ServiceName},
+		OnFailure: func(ctx context.Context, err error) {
+			ctxlogrus.Extract(ctx).WithError(err).Info("Request is not authenticated")
+		},
+	}
+
+	if settings.APIKeysFile != "" {
+		keys, err := auth.LoadAPIKeys(settings.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticatorSettings.APIKeys = keys
+		logger.Infof("API key authentication is enabled with %d keys", len(keys))
+	}
+
+	if settings.JWTSecretFile != "" || settings.JWTPublicKeyFile != "" {
+		jwtSettings := auth.JWTSettings{Issuer: settings.JWTIssuer, Audience: settings.JWTAudience, Leeway: jwtLeeway}
+		if settings.JWTSecretFile != "" {
+			secret, err := auth.LoadHMACSecret(settings.JWTSecretFile)
+			if err != nil {
+				return nil, err
+			}
+			jwtSettings.HMACSecret = secret
+		}
+		if settings.JWTPublicKeyFile != "" {
+			key, err := auth.LoadRSAPublicKey(settings.JWTPublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			jwtSettings.RSAPublicKey = key
+		}
+		verifier, err := auth.NewJWTVerifier(jwtSettings)
+		if err != nil {
+			return nil, err
+		}
+		authenticatorSettings.JWT = verifier
+		logger.Infof("JWT authentication is enabled with HS256 %v and RS256 %v", jwtSettings.HMACSecret != nil, jwtSettings.RSAPublicKey != nil)
+	}
+
+	return auth.NewAuthenticator(authenticatorSettings)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"api_keys":   "partner:5d2c9f0e8b7a\n",
+		"jwt_secret": "0123456789abcdef0123456789abcdef\n",
+		"invalid":    "not a key",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		Settings authSettings
+		Enabled  bool
+		Valid    bool
+	}{
+		"disabled": {
+			Settings: authSettings{},
+			Enabled:  false,
+			Valid:    true,
+		},
+		"api keys": {
+			Settings: authSettings{APIKeysFile: filepath.Join(dir, "api_keys")},
+			Enabled:  true,
+			Valid:    true,
+		},
+		"api keys and jwt": {
+			Settings: authSettings{APIKeysFile: filepath.Join(dir, "api_keys"), JWTSecretFile: filepath.Join(dir, "jwt_secret"), JWTIssuer: "dog-ceo-auth"},
+			Enabled:  true,
+			Valid:    true,
+		},
+		"missing api keys file": {
+			Settings: authSettings{APIKeysFile: filepath.Join(dir, "missing")},
+			Valid:    false,
+		},
+		"invalid api keys file": {
+			Settings: authSettings{APIKeysFile: filepath.Join(dir, "invalid")},
+			Valid:    false,
+		},
+		"invalid public key": {
+			Settings: authSettings{JWTPublicKeyFile: filepath.Join(dir, "invalid")},
+			Valid:    false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			authenticator, err := newAuthenticator(test.Settings, logrus.New())
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if (authenticator != nil) != test.Enabled {
+				t.Errorf("authenticator should be returned only if the authentication is enabled")
+			}
+		})
+	}
+}
@@ -0,0 +1,780 @@
+package main
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/image_cache"
+	"github.com/canbo-x/dog-ceo/rate_limiter"
+	"github.com/canbo-x/dog-ceo/tracing"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables which override the configuration.
+// Example: DOGCEO_RATE_LIMIT_RATE overrides rate_limit.rate
+const envPrefix = "DOGCEO_"
+
+// duration is a time.Duration which is written as a string like "1m30s" in the configuration file.
+type duration time.Duration
+
+// MarshalText returns the duration as a string.
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses a duration string like "1m30s".
+func (d *duration) UnmarshalText(text []byte) error {
+	value, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = duration(value)
+	return nil
+}
+
+// String returns the duration as a string, it is used by the flag package.
+func (d *duration) String() string {
+	if d == nil {
+		return "0s"
+	}
+	return time.Duration(*d).String()
+}
+
+// Set parses a duration string, it is used by the flag package.
+func (d *duration) Set(value string) error {
+	return d.UnmarshalText([]byte(value))
+}
+
+// rateLimitTier holds the limits of a client with its own tier.
+type rateLimitTier struct {
+	Rate  float64 `yaml:"rate" json:"rate"`
+	Burst int     `yaml:"burst" json:"burst"`
+}
+
+// rateLimitTiers holds the limits of the clients with their own tiers by their keys.
+// It is a map in the configuration file, the flag and the environment variable use the "key=rate:burst" form.
+type rateLimitTiers map[string]rateLimitTier
+
+// String returns the tiers as comma separated "key=rate:burst" sorted by the keys, it is used by the flag package.
+func (t *rateLimitTiers) String() string {
+	if t == nil {
+		return ""
+	}
+	keys := make([]string, 0, len(*t))
+	for key := range *t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		tier := (*t)[key]
+		fields = append(fields, fmt.Sprintf("%s=%s:%d", key, strconv.FormatFloat(tier.Rate, 'g', -1, 64), tier.Burst))
+	}
+	return strings.Join(fields, ",")
+}
+
+// Set parses the comma separated "key=rate:burst" tiers and replaces the tiers with them, it is used by the flag package.
+// Example: "partner=100:200,10.0.0.1=1:1"
+func (t *rateLimitTiers) Set(value string) error {
+	parsed, err := parseRateLimitTiers(value)
+	if err != nil {
+		return err
+	}
+	var tiers rateLimitTiers
+	for key, settings := range parsed {
+		if tiers == nil {
+			tiers = make(rateLimitTiers, len(parsed))
+		}
+		tiers[key] = rateLimitTier{Rate: settings.Rate, Burst: settings.Burst}
+	}
+	*t = tiers
+	return nil
+}
+
+// config holds all the settings of the server.
+// The settings are read from the defaults, the configuration file, the environment variables and the flags in this order,
+// so a flag overrides an environment variable which overrides the configuration file.
+type config struct {
+	Listener  listenerConfig  `yaml:"listener" json:"listener"`
+	Logging   loggingConfig   `yaml:"logging" json:"logging"`
+	RateLimit rateLimitConfig `yaml:"rate_limit" json:"rate_limit"`
+	Upstream  upstreamConfig  `yaml:"upstream" json:"upstream"`
+	Breaker   breakerConfig   `yaml:"breaker" json:"breaker"`
+	Catalog   catalogConfig   `yaml:"catalog" json:"catalog"`
+	Cache     cacheConfig     `yaml:"cache" json:"cache"`
+	Search    searchConfig    `yaml:"search" json:"search"`
+	Health    healthConfig    `yaml:"health" json:"health"`
+	Metrics   metricsConfig   `yaml:"metrics" json:"metrics"`
+	Tracing   tracingConfig   `yaml:"tracing" json:"tracing"`
+	TLS       tlsConfig       `yaml:"tls" json:"tls"`
+	Auth      authConfig      `yaml:"auth" json:"auth"`
+	Admin     adminConfig     `yaml:"admin" json:"admin"`
+	Shutdown  shutdownConfig  `yaml:"shutdown" json:"shutdown"`
+}
+
+// listenerConfig holds the settings of the gRPC listener.
+type listenerConfig struct {
+	Port int `yaml:"port" json:"port"`
+}
+
+// loggingConfig holds the settings of the logs.
+type loggingConfig struct {
+	Level  string `yaml:"level" json:"level"`
+	Format string `yaml:"format" json:"format"`
+}
+
+// rateLimitConfig holds the settings of the rate limiting of the incoming requests.
+type rateLimitConfig struct {
+	Limiter string         `yaml:"limiter" json:"limiter"`
+	Rate    float64        `yaml:"rate" json:"rate"`
+	Burst   int            `yaml:"burst" json:"burst"`
+	Key     string         `yaml:"key" json:"key"`
+	Header  string         `yaml:"header" json:"header"`
+	MaxKeys int            `yaml:"max_keys" json:"max_keys"`
+	Idle    duration       `yaml:"idle" json:"idle"`
+	Tiers   rateLimitTiers `yaml:"tiers,omitempty" json:"tiers,omitempty"`
+}
+
+// upstreamConfig holds the settings of the dog.ceo API calls.
+type upstreamConfig struct {
+	URL                 string   `yaml:"url" json:"url"`
+	Timeout             duration `yaml:"timeout" json:"timeout"`
+	MaxIdleConns        int      `yaml:"max_idle_conns" json:"max_idle_conns"`
+	MaxIdleConnsPerHost int      `yaml:"max_idle_conns_per_host" json:"max_idle_conns_per_host"`
+	KeepAlive           duration `yaml:"keep_alive" json:"keep_alive"`
+	MaxAttempts         int      `yaml:"max_attempts" json:"max_attempts"`
+	BackoffBase         duration `yaml:"backoff_base" json:"backoff_base"`
+	BackoffMax          duration `yaml:"backoff_max" json:"backoff_max"`
+	BackoffJitter       float64  `yaml:"backoff_jitter" json:"backoff_jitter"`
+	RetryStatus         string   `yaml:"retry_status" json:"retry_status"`
+	RateLimit           float64  `yaml:"rate_limit" json:"rate_limit"`
+	RateLimitBurst      int      `yaml:"rate_limit_burst" json:"rate_limit_burst"`
+	MaxConcurrent       int      `yaml:"max_concurrent" json:"max_concurrent"`
+}
+
+// breakerConfig holds the settings of the circuit breaker of the upstream API.
+type breakerConfig struct {
+	FailureThreshold int      `yaml:"failure_threshold" json:"failure_threshold"`
+	CoolDown         duration `yaml:"cool_down" json:"cool_down"`
+	HalfOpenRequests int      `yaml:"half_open_requests" json:"half_open_requests"`
+}
+
+// catalogConfig holds the settings of the breed catalog.
+type catalogConfig struct {
+	Refresh duration `yaml:"refresh" json:"refresh"`
+}
+
+// cacheConfig holds the settings of the image cache.
+type cacheConfig struct {
+	SizeMB     int64    `yaml:"size_mb" json:"size_mb"`
+	TTL        duration `yaml:"ttl" json:"ttl"`
+	Dir        string   `yaml:"dir" json:"dir"`
+	DiskSizeMB int64    `yaml:"disk_size_mb" json:"disk_size_mb"`
+}
+
+// searchConfig holds the settings of the searches.
+type searchConfig struct {
+	ImageWorkers int `yaml:"image_workers" json:"image_workers"`
+}
+
+// healthConfig holds the settings of the health checks.
+type healthConfig struct {
+	Interval duration `yaml:"interval" json:"interval"`
+	Timeout  duration `yaml:"timeout" json:"timeout"`
+}
+
+// metricsConfig holds the settings of the metrics.
+type metricsConfig struct {
+	Addr string `yaml:"addr" json:"addr"`
+}
+
+// tracingConfig holds the settings of the tracing.
+type tracingConfig struct {
+	Exporter    string  `yaml:"exporter" json:"exporter"`
+	Endpoint    string  `yaml:"endpoint" json:"endpoint"`
+	File        string  `yaml:"file" json:"file"`
+	SampleRatio float64 `yaml:"sample_ratio" json:"sample_ratio"`
+}
+
+// tlsConfig holds the settings of TLS.
+type tlsConfig struct {
+	Cert           string   `yaml:"cert" json:"cert"`
+	Key            string   `yaml:"key" json:"key"`
+	CA             string   `yaml:"ca" json:"ca"`
+	ClientAuth     bool     `yaml:"client_auth" json:"client_auth"`
+	ReloadInterval duration `yaml:"reload_interval" json:"reload_interval"`
+}
+
+// authConfig holds the settings of the authentication.
+type authConfig struct {
+	APIKeys      string `yaml:"api_keys" json:"api_keys"`
+	JWTSecret    string `yaml:"jwt_secret_file" json:"jwt_secret_file"`
+	JWTPublicKey string `yaml:"jwt_public_key" json:"jwt_public_key"`
+	JWTIssuer    string `yaml:"jwt_issuer" json:"jwt_issuer"`
+	JWTAudience  string `yaml:"jwt_audience" json:"jwt_audience"`
+}
+
+// adminConfig holds the settings of the admin service.
+type adminConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+
+	// Principals are the comma separated authenticated clients which can call the admin service
+	// with their authentication method, e.g. "api-key:ops,jwt:alice".
+	Principals string `yaml:"principals" json:"principals"`
+}
+
+// shutdownConfig holds the settings of the shutdown of the server.
+type shutdownConfig struct {
+	Drain   duration `yaml:"drain" json:"drain"`
+	Timeout duration `yaml:"timeout" json:"timeout"`
+}
+
+// defaultConfig returns the default settings of the server.
+func defaultConfig() config {
+	return config{
+		Listener: listenerConfig{Port: 22626},
+		Logging:  loggingConfig{Level: "info", Format: logFormatText},
+		RateLimit: rateLimitConfig{
+			Limiter: rateLimiterTokenBucket,
+			Rate:    10,
+			Burst:   10,
+			Key:     rateLimitKeyGlobal,
+			Header:  "x-client-id",
+			MaxKeys: 10000,
+			Idle:    duration(time.Minute * 10),
+		},
+		Upstream: upstreamConfig{
+			URL:            data_service.DefaultBaseURL,
+			Timeout:        duration(time.Second * 5),
+			MaxIdleConns:   100,
+			KeepAlive:      duration(time.Second * 30),
+			MaxAttempts:    3,
+			BackoffBase:    duration(time.Millisecond * 100),
+			BackoffMax:     duration(time.Second * 2),
+			BackoffJitter:  0.2,
+			RetryStatus:    "429,500,502,503,504",
+			RateLimit:      20,
+			RateLimitBurst: 20,
+			MaxConcurrent:  16,
+		},
+		Breaker: breakerConfig{
+			FailureThreshold: 5,
+			CoolDown:         duration(time.Second * 30),
+			HalfOpenRequests: 1,
+		},
+		Catalog: catalogConfig{Refresh: duration(time.Hour)},
+		Cache: cacheConfig{
+			SizeMB:     64,
+			TTL:        duration(time.Hour),
+			DiskSizeMB: 512,
+		},
+		Search: searchConfig{ImageWorkers: defaultImageWorkers},
+		Health: healthConfig{
+			Interval: duration(time.Second * 10),
+			Timeout:  duration(time.Second * 3),
+		},
+		Tracing: tracingConfig{
+			Exporter:    tracing.ExporterNone,
+			Endpoint:    tracing.DefaultOTLPEndpoint,
+			File:        "traces.json",
+			SampleRatio: 1,
+		},
+		TLS: tlsConfig{ReloadInterval: duration(time.Second * 10)},
+		Shutdown: shutdownConfig{
+			Drain:   duration(time.Second * 5),
+			Timeout: duration(time.Second * 15),
+		},
+	}
+}
+
+// bindFlags defines the flags of the settings on the given flag set.
+// The current values of the given config are the defaults of the flags.
+func bindFlags(fs *flag.FlagSet, c *config) {
+	// This port is used to serve the breed image service.
+	fs.IntVar(&c.Listener.Port, "port", c.Listener.Port, "The gRPC-server port.")
+
+	// These settings are used to set the log level and to format the log lines.
+	fs.StringVar(&c.Logging.Level, "log-level", c.Logging.Level, "The log level of the gRPC-server.")
+	fs.StringVar(&c.Logging.Format, "log-format", c.Logging.Format, "The log format of the gRPC-server: text or json.")
+
+	// This interval is used to refresh the breed catalog. Zero disables the catalog.
+	fs.Var(&c.Catalog.Refresh, "catalog-refresh", "The refresh interval of the breed catalog. 0 disables the catalog.")
+
+	// These settings are used to tune the shared upstream http client.
+	fs.Var(&c.Upstream.Timeout, "upstream-timeout", "The timeout of a single upstream request.")
+	fs.IntVar(&c.Upstream.MaxIdleConns, "upstream-max-idle-conns", c.Upstream.MaxIdleConns, "The maximum number of idle upstream connections.")
+	fs.IntVar(&c.Upstream.MaxIdleConnsPerHost, "upstream-max-idle-conns-per-host", c.Upstream.MaxIdleConnsPerHost, "The maximum number of idle upstream connections to a single host. 0 uses upstream-max-idle-conns.")
+	fs.Var(&c.Upstream.KeepAlive, "upstream-keep-alive", "The keep-alive interval of the upstream connections.")
+
+	// This URL is used as the base URL of the upstream API.
+	fs.StringVar(&c.Upstream.URL, "upstream-url", c.Upstream.URL, "The base URL of the upstream dog.ceo API.")
+
+	// These settings are used to retry the failed upstream requests.
+	fs.IntVar(&c.Upstream.MaxAttempts, "upstream-max-attempts", c.Upstream.MaxAttempts, "The maximum number of attempts of an upstream request. 1 disables the retries.")
+	fs.Var(&c.Upstream.BackoffBase, "upstream-backoff-base", "The wait before the first retry, it doubles after every retry.")
+	fs.Var(&c.Upstream.BackoffMax, "upstream-backoff-max", "The maximum wait between two attempts.")
+	fs.Float64Var(&c.Upstream.BackoffJitter, "upstream-backoff-jitter", c.Upstream.BackoffJitter, "The randomized fraction of the wait between 0 and 1.")
+	fs.StringVar(&c.Upstream.RetryStatus, "upstream-retry-status", c.Upstream.RetryStatus, "The comma separated upstream status codes which are retried.")
+
+	// These settings are used to protect the upstream API from our bursts.
+	fs.Float64Var(&c.Upstream.RateLimit, "upstream-rate-limit", c.Upstream.RateLimit, "The maximum number of the upstream requests started every second. 0 disables the upstream rate limit.")
+	fs.IntVar(&c.Upstream.RateLimitBurst, "upstream-rate-limit-burst", c.Upstream.RateLimitBurst, "The maximum number of the upstream requests started at once.")
+	fs.IntVar(&c.Upstream.MaxConcurrent, "upstream-max-concurrent", c.Upstream.MaxConcurrent, "The maximum number of the upstream requests in flight. 0 disables the upstream concurrency limit.")
+
+	// These settings are used to fail fast while the upstream API is down.
+	fs.IntVar(&c.Breaker.FailureThreshold, "breaker-failure-threshold", c.Breaker.FailureThreshold, "The number of consecutive upstream failures which opens the circuit breaker. 0 disables the circuit breaker.")
+	fs.Var(&c.Breaker.CoolDown, "breaker-cool-down", "The duration the circuit breaker stays open before probing the upstream API again.")
+	fs.IntVar(&c.Breaker.HalfOpenRequests, "breaker-half-open-requests", c.Breaker.HalfOpenRequests, "The number of successful probe requests which closes the circuit breaker again.")
+
+	// This is the maximum number of concurrent image downloads of a SearchMany request.
+	fs.IntVar(&c.Search.ImageWorkers, "image-workers", c.Search.ImageWorkers, "The maximum number of concurrent image downloads of a multi-image search.")
+
+	// These settings are used to cache the downloaded images.
+	fs.Int64Var(&c.Cache.SizeMB, "image-cache-size", c.Cache.SizeMB, "The memory budget of the image cache in megabytes. 0 disables the image cache.")
+	fs.Var(&c.Cache.TTL, "image-cache-ttl", "The time an image is kept in the image cache. 0 keeps the images until they are evicted.")
+	fs.StringVar(&c.Cache.Dir, "image-cache-dir", c.Cache.Dir, "The directory of the on-disk image cache. Empty disables the on-disk image cache.")
+	fs.Int64Var(&c.Cache.DiskSizeMB, "image-cache-disk-size", c.Cache.DiskSizeMB, "The disk budget of the on-disk image cache in megabytes.")
+
+	// These settings are used to limit the rate of the incoming requests.
+	fs.StringVar(&c.RateLimit.Limiter, "rate-limiter", c.RateLimit.Limiter, "The rate limiter of the incoming requests: token-bucket, dummy or none.")
+	fs.Float64Var(&c.RateLimit.Rate, "rate-limit", c.RateLimit.Rate, "The number of the requests allowed per second by the token bucket rate limiter.")
+	fs.IntVar(&c.RateLimit.Burst, "rate-limit-burst", c.RateLimit.Burst, "The maximum number of the requests allowed at once by the token bucket rate limiter.")
+	fs.StringVar(&c.RateLimit.Key, "rate-limit-key", c.RateLimit.Key, "The key of the token buckets: global, peer, api-key, header or principal.")
+	fs.StringVar(&c.RateLimit.Header, "rate-limit-header", c.RateLimit.Header, "The metadata key of the clients when the rate-limit-key is header.")
+	fs.IntVar(&c.RateLimit.MaxKeys, "rate-limit-max-keys", c.RateLimit.MaxKeys, "The maximum number of the per-client token buckets.")
+	fs.Var(&c.RateLimit.Idle, "rate-limit-idle", "The time a per-client token bucket is kept after the last request of its client.")
+	fs.Var(&c.RateLimit.Tiers, "rate-limit-tiers", "The comma separated per-client limits as key=rate:burst, e.g. partner=100:200.")
+
+	// These settings are used to check the dependencies for the health service.
+	fs.Var(&c.Health.Interval, "health-interval", "The interval of the health checks of the dependencies. 0 disables the health checks.")
+	fs.Var(&c.Health.Timeout, "health-timeout", "The time limit of a single health check.")
+
+	// These settings are used to expose the metrics of the server.
+	fs.StringVar(&c.Metrics.Addr, "metrics-addr", c.Metrics.Addr, "The HTTP address of the Prometheus metrics, e.g. :9090. Empty disables the metrics.")
+
+	// These settings are used to trace the requests.
+	fs.StringVar(&c.Tracing.Exporter, "trace-exporter", c.Tracing.Exporter, "The exporter of the spans: none, stdout, file or otlp.")
+	fs.StringVar(&c.Tracing.Endpoint, "trace-endpoint", c.Tracing.Endpoint, "The traces endpoint of the OTLP collector over HTTP.")
+	fs.StringVar(&c.Tracing.File, "trace-file", c.Tracing.File, "The file the spans are appended to with the file exporter.")
+	fs.Float64Var(&c.Tracing.SampleRatio, "trace-sample-ratio", c.Tracing.SampleRatio, "The fraction of the new traces which are sampled between 0 and 1.")
+
+	// These files are used to serve the gRPC-server over TLS.
+	fs.StringVar(&c.TLS.Cert, "tls-cert", c.TLS.Cert, "The PEM encoded certificate of the server. Empty serves plaintext.")
+	fs.StringVar(&c.TLS.Key, "tls-key", c.TLS.Key, "The PEM encoded private key of the server certificate.")
+	fs.StringVar(&c.TLS.CA, "tls-ca", c.TLS.CA, "The PEM encoded certificate authorities which verify the client certificates.")
+	fs.BoolVar(&c.TLS.ClientAuth, "tls-client-auth", c.TLS.ClientAuth, "Require the clients to send a certificate signed by the tls-ca certificate authorities.")
+	fs.Var(&c.TLS.ReloadInterval, "tls-reload-interval", "The interval the certificate files are checked for changes. 0 disables the reloading.")
+
+	// These files are used to authenticate the requests with API keys or JWT bearer tokens.
+	fs.StringVar(&c.Auth.APIKeys, "auth-api-keys", c.Auth.APIKeys, "The file of the API keys as name:key lines. Empty disables the API key authentication.")
+	fs.StringVar(&c.Auth.JWTSecret, "auth-jwt-secret-file", c.Auth.JWTSecret, "The file of the HMAC secret of the HS256 tokens.")
+	fs.StringVar(&c.Auth.JWTPublicKey, "auth-jwt-public-key", c.Auth.JWTPublicKey, "The PEM encoded RSA public key of the RS256 tokens.")
+	fs.StringVar(&c.Auth.JWTIssuer, "auth-jwt-issuer", c.Auth.JWTIssuer, "The required iss claim of the tokens. Empty accepts any issuer.")
+	fs.StringVar(&c.Auth.JWTAudience, "auth-jwt-audience", c.Auth.JWTAudience, "The required aud claim of the tokens. Empty accepts any audience.")
+
+	// This setting is used to serve the admin service which reloads the configuration.
+	fs.BoolVar(&c.Admin.Enabled, "admin", c.Admin.Enabled, "Serve the admin service which reloads the configuration file.")
+	fs.StringVar(&c.Admin.Principals, "admin-principals", c.Admin.Principals, "The comma separated authenticated clients which can call the admin service, e.g. api-key:ops,jwt:alice.")
+
+	// These settings are used to stop the server without dropping the requests.
+	fs.Var(&c.Shutdown.Drain, "shutdown-drain", "The wait after the health status is NOT_SERVING before the server stops accepting requests.")
+	fs.Var(&c.Shutdown.Timeout, "shutdown-timeout", "The maximum wait for the requests in flight, the remaining ones are aborted after it.")
+}
+
+// loadConfig returns the effective settings of the server.
+// It starts from the defaults, then applies the configuration file if the path is not empty, the environment variables
+// and the flags which are set on the command line. The parsed flag set must have been bound with bindFlags.
+// The returned config is not validated.
+func loadConfig(path string, lookupEnv func(string) (string, bool), parsed *flag.FlagSet) (config, error) {
+	c := defaultConfig()
+	if path != "" {
+		if err := loadConfigFile(path, &c); err != nil {
+			return c, err
+		}
+	}
+	if err := applyEnv(&c, lookupEnv); err != nil {
+		return c, err
+	}
+
+	// the set flags are applied to a flag set bound to the loaded config, so they override the file and the environment
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	bindFlags(fs, &c)
+	var err error
+	parsed.Visit(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, f.Value.String()); setErr != nil {
+			err = fmt.Errorf("invalid value of the %s flag : %v", f.Name, setErr)
+		}
+	})
+	return c, err
+}
+
+// loadConfigFile reads the configuration file into the given config.
+// The format is selected by the extension, .yaml and .yml files are read as YAML and .json files as JSON.
+// The settings which are not in the file keep their values, and the unknown settings are rejected to catch the typos.
+func loadConfigFile(path string, c *config) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the config file : %v", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		err = decoder.Decode(c)
+	case ".json":
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	default:
+		return fmt.Errorf("unknown config file extension, it must be .yaml, .yml or .json : %v", path)
+	}
+
+	// an empty file has no settings
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse the config file : %v", err)
+	}
+	return nil
+}
+
+// applyEnv overrides the settings with the environment variables.
+// The name of a variable is the prefix and the path of the setting in upper case.
+// Example: DOGCEO_UPSTREAM_MAX_ATTEMPTS overrides upstream.max_attempts
+// All the invalid values are reported at once.
+func applyEnv(c *config, lookupEnv func(string) (string, bool)) error {
+	var errs configErrors
+	walkConfig(c, func(path string, field reflect.Value) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+		value, ok := lookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := setValue(field, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s is not valid : %v", name, err))
+		}
+	})
+	return errs.err()
+}
+
+// walkConfig calls the given function with the path and the field of every setting of the given config.
+// The path is the section and the setting names in the configuration file, e.g. "rate_limit.rate".
+func walkConfig(c *config, fn func(path string, field reflect.Value)) {
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := yamlName(sections.Type().Field(i))
+		for j := 0; j < section.NumField(); j++ {
+			fn(sectionName+"."+yamlName(section.Type().Field(j)), section.Field(j))
+		}
+	}
+}
+
+// changedSettings returns the paths of the settings which are different in the given configs.
+func changedSettings(old, new config) []string {
+	oldValues := make(map[string]interface{})
+	walkConfig(&old, func(path string, field reflect.Value) {
+		oldValues[path] = field.Interface()
+	})
+
+	var changed []string
+	walkConfig(&new, func(path string, field reflect.Value) {
+		if !reflect.DeepEqual(oldValues[path], field.Interface()) {
+			changed = append(changed, path)
+		}
+	})
+	return changed
+}
+
+// copySettings copies the settings of the given paths from the source config to the destination config.
+func copySettings(dst *config, src config, paths []string) {
+	copied := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		copied[path] = true
+	}
+
+	srcValues := make(map[string]reflect.Value)
+	walkConfig(&src, func(path string, field reflect.Value) {
+		srcValues[path] = field
+	})
+	walkConfig(dst, func(path string, field reflect.Value) {
+		if copied[path] {
+			field.Set(srcValues[path])
+		}
+	})
+}
+
+// yamlName returns the name of the given field in the configuration file.
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
+
+// setValue parses the given string into the given field.
+func setValue(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	if v, ok := field.Addr().Interface().(flag.Value); ok {
+		return v.Set(value)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(v)
+	case reflect.Float64:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(v)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(v)
+	default:
+		return fmt.Errorf("unsupported setting type : %v", field.Kind())
+	}
+	return nil
+}
+
+// configErrors holds all the problems of a configuration, so they can be fixed at once.
+type configErrors []string
+
+// Error returns the problems one per line.
+func (e configErrors) Error() string {
+	return "invalid configuration :\n  - " + strings.Join(e, "\n  - ")
+}
+
+// err returns nil if there are no problems.
+func (e configErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// validate checks all the settings and returns all the problems at once.
+func (c config) validate() error {
+	var errs configErrors
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Listener.Port > 0 && c.Listener.Port <= 65535, "listener.port must be between 1 and 65535 : %d", c.Listener.Port)
+
+	check(checkAndSetLogLevel(logrus.New(), c.Logging.Level) == nil, "logging.level is not known : %q", c.Logging.Level)
+	check(c.Logging.Format == logFormatText || c.Logging.Format == logFormatJSON, "logging.format must be text or json : %q", c.Logging.Format)
+
+	rl := c.RateLimit
+	switch rl.Limiter {
+	case rateLimiterTokenBucket:
+		check(rl.Rate > 0, "rate_limit.rate must be positive : %v", rl.Rate)
+		check(rl.Burst >= 1, "rate_limit.burst must be at least 1 : %d", rl.Burst)
+	case rateLimiterDummy, rateLimiterNone:
+		check(rl.Key == rateLimitKeyGlobal, "rate_limit.key %s requires the %s limiter", rl.Key, rateLimiterTokenBucket)
+	default:
+		errs = append(errs, fmt.Sprintf("rate_limit.limiter is not known : %q", rl.Limiter))
+	}
+	switch rl.Key {
+	case rateLimitKeyGlobal, rateLimitKeyPeer, rateLimitKeyAPIKey, rateLimitKeyPrincipal:
+	case rateLimitKeyHeader:
+		check(strings.TrimSpace(rl.Header) != "", "rate_limit.header must not be empty when the key is header")
+	default:
+		errs = append(errs, fmt.Sprintf("rate_limit.key is not known : %q", rl.Key))
+	}
+	check(rl.MaxKeys >= 1, "rate_limit.max_keys must be at least 1 : %d", rl.MaxKeys)
+	check(rl.Idle >= 0, "rate_limit.idle must not be negative : %v", &rl.Idle)
+	if _, err := rl.Tiers.settings(); err != nil {
+		errs = append(errs, fmt.Sprintf("rate_limit.tiers is not valid : %v", err))
+	}
+
+	up := c.Upstream
+	if u, err := url.Parse(up.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("upstream.url must be an http or https URL : %q", up.URL))
+	}
+	check(up.Timeout > 0, "upstream.timeout must be positive : %v", &up.Timeout)
+	check(up.MaxIdleConns >= 0, "upstream.max_idle_conns must not be negative : %d", up.MaxIdleConns)
+	check(up.MaxIdleConnsPerHost >= 0, "upstream.max_idle_conns_per_host must not be negative : %d", up.MaxIdleConnsPerHost)
+	check(up.KeepAlive >= 0, "upstream.keep_alive must not be negative : %v", &up.KeepAlive)
+	check(up.MaxAttempts >= 1, "upstream.max_attempts must be at least 1 : %d", up.MaxAttempts)
+	check(up.BackoffBase >= 0, "upstream.backoff_base must not be negative : %v", &up.BackoffBase)
+	check(up.BackoffMax >= up.BackoffBase, "upstream.backoff_max must not be less than upstream.backoff_base : %v", &up.BackoffMax)
+	check(up.BackoffJitter >= 0 && up.BackoffJitter <= 1, "upstream.backoff_jitter must be between 0 and 1 : %v", up.BackoffJitter)
+	if _, err := parseStatusCodes(up.RetryStatus); err != nil {
+		errs = append(errs, fmt.Sprintf("upstream.retry_status is not valid : %v", err))
+	}
+	check(up.RateLimit >= 0, "upstream.rate_limit must not be negative : %v", up.RateLimit)
+	check(up.RateLimit == 0 || up.RateLimitBurst >= 1, "upstream.rate_limit_burst must be at least 1 : %d", up.RateLimitBurst)
+	check(up.MaxConcurrent >= 0, "upstream.max_concurrent must not be negative : %d", up.MaxConcurrent)
+
+	check(c.Breaker.FailureThreshold >= 0, "breaker.failure_threshold must not be negative : %d", c.Breaker.FailureThreshold)
+	if c.Breaker.FailureThreshold > 0 {
+		check(c.Breaker.CoolDown > 0, "breaker.cool_down must be positive : %v", &c.Breaker.CoolDown)
+		check(c.Breaker.HalfOpenRequests >= 1, "breaker.half_open_requests must be at least 1 : %d", c.Breaker.HalfOpenRequests)
+	}
+
+	check(c.Catalog.Refresh >= 0, "catalog.refresh must not be negative : %v", &c.Catalog.Refresh)
+
+	check(c.Cache.SizeMB >= 0, "cache.size_mb must not be negative : %d", c.Cache.SizeMB)
+	check(c.Cache.TTL >= 0, "cache.ttl must not be negative : %v", &c.Cache.TTL)
+	check(c.Cache.Dir == "" || c.Cache.DiskSizeMB > 0, "cache.disk_size_mb must be positive with a cache.dir : %d", c.Cache.DiskSizeMB)
+
+	check(c.Search.ImageWorkers >= 1, "search.image_workers must be at least 1 : %d", c.Search.ImageWorkers)
+
+	check(c.Health.Interval >= 0, "health.interval must not be negative : %v", &c.Health.Interval)
+	check(c.Health.Interval == 0 || c.Health.Timeout > 0, "health.timeout must be positive : %v", &c.Health.Timeout)
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "tracing.file must not be empty with the file exporter")
+	case tracing.ExporterOTLP:
+		check(c.Tracing.Endpoint != "", "tracing.endpoint must not be empty with the otlp exporter")
+	default:
+		errs = append(errs, fmt.Sprintf("tracing.exporter is not known : %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1 : %v", c.Tracing.SampleRatio)
+
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls.cert and tls.key must be given together")
+	check(c.TLS.CA == "" || c.TLS.Cert != "", "tls.ca requires tls.cert and tls.key")
+	check(!c.TLS.ClientAuth || c.TLS.CA != "", "tls.client_auth requires tls.ca")
+	check(c.TLS.ReloadInterval >= 0, "tls.reload_interval must not be negative : %v", &c.TLS.ReloadInterval)
+
+	jwt := c.Auth.JWTSecret != "" || c.Auth.JWTPublicKey != ""
+	check(rl.Key != rateLimitKeyAPIKey || c.Auth.APIKeys != "", "rate_limit.key api-key requires auth.api_keys")
+	check(rl.Key != rateLimitKeyPrincipal || c.Auth.APIKeys != "" || jwt, "rate_limit.key principal requires auth.api_keys, auth.jwt_secret_file or auth.jwt_public_key")
+	check(jwt || c.Auth.JWTIssuer == "", "auth.jwt_issuer requires auth.jwt_secret_file or auth.jwt_public_key")
+	check(jwt || c.Auth.JWTAudience == "", "auth.jwt_audience requires auth.jwt_secret_file or auth.jwt_public_key")
+
+	// the admin service changes the running server, so it is only served to the authenticated admins
+	check(!c.Admin.Enabled || c.Auth.APIKeys != "" || jwt, "admin.enabled requires auth.api_keys, auth.jwt_secret_file or auth.jwt_public_key")
+	if principals, err := parsePrincipals(c.Admin.Principals); err != nil {
+		errs = append(errs, fmt.Sprintf("admin.principals is not valid : %v", err))
+	} else {
+		check(!c.Admin.Enabled || len(principals) > 0, "admin.enabled requires admin.principals")
+	}
+
+	check(c.Shutdown.Drain >= 0, "shutdown.drain must not be negative : %v", &c.Shutdown.Drain)
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout must be positive : %v", &c.Shutdown.Timeout)
+
+	return errs.err()
+}
+
+// printConfig writes the given config as YAML, so it can be used as a configuration file.
+func printConfig(w io.Writer, c config) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// settings returns the settings of the rate limiter without the OnReject function.
+func (rl rateLimitConfig) settings() (rateLimitSettings, error) {
+	tiers, err := rl.Tiers.settings()
+	if err != nil {
+		return rateLimitSettings{}, fmt.Errorf("failed to parse the rate limit tiers : %v", err)
+	}
+	return rateLimitSettings{
+		Kind:        rl.Limiter,
+		Rate:        rl.Rate,
+		Burst:       rl.Burst,
+		Key:         rl.Key,
+		Header:      rl.Header,
+		MaxKeys:     rl.MaxKeys,
+		IdleTimeout: time.Duration(rl.Idle),
+		Tiers:       tiers,
+	}, nil
+}
+
+// settings returns the limits of the tiers by their keys.
+// It returns an error if a tier has no positive rate or no burst.
+func (t rateLimitTiers) settings() (map[string]rate_limiter.Settings, error) {
+	tiers := make(map[string]rate_limiter.Settings, len(t))
+	for key, tier := range t {
+		if tier.Rate <= 0 || tier.Burst < 1 {
+			return nil, fmt.Errorf("tier %s must have a positive rate and a burst of at least 1 : %v:%d", key, tier.Rate, tier.Burst)
+		}
+		tiers[key] = rate_limiter.Settings{Rate: tier.Rate, Burst: tier.Burst}
+	}
+	return tiers, nil
+}
+
+// clientConfig returns the settings of the upstream http client.
+// All the upstream requests go to the same host, so the idle connections per host
+// are as many as the idle connections unless they are given.
+func (up upstreamConfig) clientConfig() data_service.ClientConfig {
+	clientCfg := data_service.DefaultClientConfig()
+	clientCfg.Timeout = time.Duration(up.Timeout)
+	clientCfg.MaxIdleConns = up.MaxIdleConns
+	clientCfg.MaxIdleConnsPerHost = up.MaxIdleConnsPerHost
+	if clientCfg.MaxIdleConnsPerHost == 0 {
+		clientCfg.MaxIdleConnsPerHost = up.MaxIdleConns
+	}
+	clientCfg.KeepAlive = time.Duration(up.KeepAlive)
+	return clientCfg
+}
+
+// retryPolicy returns the retry policy of the upstream requests.
+func (up upstreamConfig) retryPolicy() (data_service.RetryPolicy, error) {
+	retryStatusCodes, err := parseStatusCodes(up.RetryStatus)
+	if err != nil {
+		return data_service.RetryPolicy{}, fmt.Errorf("failed to parse the retryable status codes : %v", err)
+	}
+	return data_service.RetryPolicy{
+		MaxAttempts:          up.MaxAttempts,
+		BaseBackoff:          time.Duration(up.BackoffBase),
+		MaxBackoff:           time.Duration(up.BackoffMax),
+		Jitter:               up.BackoffJitter,
+		RetryableStatusCodes: retryStatusCodes,
+	}, nil
+}
+
+// outboundLimit returns the limits of the upstream requests.
+func (up upstreamConfig) outboundLimit() data_service.OutboundLimit {
+	return data_service.OutboundLimit{
+		Rate:          up.RateLimit,
+		Burst:         up.RateLimitBurst,
+		MaxConcurrent: up.MaxConcurrent,
+	}
+}
+
+// settings returns the settings of the image cache with the budgets in bytes.
+func (c cacheConfig) settings() image_cache.Settings {
+	return image_cache.Settings{
+		MaxBytes:     c.SizeMB << 20,
+		TTL:          time.Duration(c.TTL),
+		Dir:          c.Dir,
+		MaxDiskBytes: c.DiskSizeMB << 20,
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/tracing"
+)
+
+// mapEnv returns a lookup function of the given environment variables.
+func mapEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+// parseFlags returns a flag set which has parsed the given arguments.
+func parseFlags(t *testing.T, args ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagConfig := defaultConfig()
+	bindFlags(fs, &flagConfig)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := map[string]struct {
+		File     string
+		Content  string
+		Env      map[string]string
+		Args     []string
+		Expected func(c *config)
+		Valid    bool
+	}{
+		"defaults": {
+			Expected: func(c *config) {},
+			Valid:    true,
+		},
+		"yaml file": {
+			File:    "config.yaml",
+			Content: "listener:\n  port: 8080\nrate_limit:\n  rate: 50\n  tiers:\n    partner:\n      rate: 100\n      burst: 200\nupstream:\n  timeout: 10s\n",
+			Expected: func(c *config) {
+				c.Listener.Port = 8080
+				c.RateLimit.Rate = 50
+				c.RateLimit.Tiers = rateLimitTiers{"partner": {Rate: 100, Burst: 200}}
+				c.Upstream.Timeout = duration(time.Second * 10)
+			},
+			Valid: true,
+		},
+		"json file": {
+			File:    "config.json",
+			Content: `{"logging": {"level": "debug", "format": "json"}, "rate_limit": {"tiers": {"partner": {"rate": 100, "burst": 200}}}, "cache": {"size_mb": 0}}`,
+			Expected: func(c *config) {
+				c.Logging.Level = "debug"
+				c.Logging.Format = logFormatJSON
+				c.RateLimit.Tiers = rateLimitTiers{"partner": {Rate: 100, Burst: 200}}
+				c.Cache.SizeMB = 0
+			},
+			Valid: true,
+		},
+		"empty yaml file": {
+			File:     "config.yml",
+			Content:  "",
+			Expected: func(c *config) {},
+			Valid:    true,
+		},
+		"env overrides file": {
+			File:    "config.yaml",
+			Content: "listener:\n  port: 8080\ntls:\n  client_auth: false\n",
+			Env: map[string]string{
+				"DOGCEO_LISTENER_PORT": "9090", "DOGCEO_TLS_CLIENT_AUTH": "true", "DOGCEO_RATE_LIMIT_IDLE": "1m",
+				"DOGCEO_RATE_LIMIT_TIERS": "partner=100:200,internal=1000:1000",
+			},
+			Expected: func(c *config) {
+				c.Listener.Port = 9090
+				c.TLS.ClientAuth = true
+				c.RateLimit.Idle = duration(time.Minute)
+				c.RateLimit.Tiers = rateLimitTiers{"partner": {Rate: 100, Burst: 200}, "internal": {Rate: 1000, Burst: 1000}}
+			},
+			Valid: true,
+		},
+		"flag overrides env and file": {
+			File:    "config.yaml",
+			Content: "listener:\n  port: 8080\nupstream:\n  max_attempts: 5\n",
+			Env:     map[string]string{"DOGCEO_LISTENER_PORT": "9090"},
+			Args:    []string{"-port", "7070", "-upstream-backoff-max", "5s"},
+			Expected: func(c *config) {
+				c.Listener.Port = 7070
+				c.Upstream.MaxAttempts = 5
+				c.Upstream.BackoffMax = duration(time.Second * 5)
+			},
+			Valid: true,
+		},
+		"tiers flag replaces the file tiers": {
+			File:    "config.yaml",
+			Content: "rate_limit:\n  tiers:\n    partner:\n      rate: 100\n      burst: 200\n",
+			Args:    []string{"-rate-limit-tiers", "internal=0.5:1"},
+			Expected: func(c *config) {
+				c.RateLimit.Tiers = rateLimitTiers{"internal": {Rate: 0.5, Burst: 1}}
+			},
+			Valid: true,
+		},
+		"tiers as a string in the file": {
+			File:    "config.yaml",
+			Content: "rate_limit:\n  tiers: partner=100:200\n",
+			Valid:   false,
+		},
+		"invalid tiers env": {
+			Env:   map[string]string{"DOGCEO_RATE_LIMIT_TIERS": "partner=fast"},
+			Valid: false,
+		},
+		"flag with default value overrides file": {
+			File:    "config.yaml",
+			Content: "logging:\n  level: debug\n",
+			Args:    []string{"-log-level", "info"},
+			Expected: func(c *config) {
+				c.Logging.Level = "info"
+			},
+			Valid: true,
+		},
+		"unknown yaml setting": {
+			File:    "config.yaml",
+			Content: "listener:\n  prot: 8080\n",
+			Valid:   false,
+		},
+		"unknown json setting": {
+			File:    "config.json",
+			Content: `{"listener": {"prot": 8080}}`,
+			Valid:   false,
+		},
+		"invalid duration": {
+			File:    "config.yaml",
+			Content: "upstream:\n  timeout: soon\n",
+			Valid:   false,
+		},
+		"unknown extension": {
+			File:    "config.toml",
+			Content: "",
+			Valid:   false,
+		},
+		"missing file": {
+			File:  "missing.yaml",
+			Valid: false,
+		},
+		"invalid env": {
+			Env:   map[string]string{"DOGCEO_LISTENER_PORT": "http", "DOGCEO_UPSTREAM_TIMEOUT": "soon"},
+			Valid: false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := ""
+			if test.File != "" {
+				dir := t.TempDir()
+				path = filepath.Join(dir, test.File)
+				if test.File != "missing.yaml" {
+					if err := ioutil.WriteFile(path, []byte(test.Content), 0600); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			c, err := loadConfig(path, mapEnv(test.Env), parseFlags(t, test.Args...))
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+
+			expected := defaultConfig()
+			test.Expected(&expected)
+			if !reflect.DeepEqual(c, expected) {
+				t.Errorf("config = %+v; want %+v", c, expected)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := map[string]struct {
+		Change func(c *config)
+		Valid  bool
+	}{
+		"defaults":             {Change: func(c *config) {}, Valid: true},
+		"port out of range":    {Change: func(c *config) { c.Listener.Port = 70000 }, Valid: false},
+		"unknown log level":    {Change: func(c *config) { c.Logging.Level = "verbose" }, Valid: false},
+		"unknown log format":   {Change: func(c *config) { c.Logging.Format = "xml" }, Valid: false},
+		"unknown rate limiter": {Change: func(c *config) { c.RateLimit.Limiter = "leaky-bucket" }, Valid: false},
+		"zero rate":            {Change: func(c *config) { c.RateLimit.Rate = 0 }, Valid: false},
+		"zero rate without limiter": {
+			Change: func(c *config) { c.RateLimit.Limiter = rateLimiterNone; c.RateLimit.Rate = 0 },
+			Valid:  true,
+		},
+		"per client key with dummy limiter": {
+			Change: func(c *config) { c.RateLimit.Limiter = rateLimiterDummy; c.RateLimit.Key = rateLimitKeyPeer },
+			Valid:  false,
+		},
+		"empty rate limit header": {
+			Change: func(c *config) { c.RateLimit.Key = rateLimitKeyHeader; c.RateLimit.Header = " " },
+			Valid:  false,
+		},
+		"api key without auth": {
+			Change: func(c *config) { c.RateLimit.Key = rateLimitKeyAPIKey },
+			Valid:  false,
+		},
+		"api key with auth": {
+			Change: func(c *config) { c.RateLimit.Key = rateLimitKeyAPIKey; c.Auth.APIKeys = "api_keys.txt" },
+			Valid:  true,
+		},
+		"principal without auth": {
+			Change: func(c *config) { c.RateLimit.Key = rateLimitKeyPrincipal },
+			Valid:  false,
+		},
+		"principal with jwt": {
+			Change: func(c *config) { c.RateLimit.Key = rateLimitKeyPrincipal; c.Auth.JWTSecret = "jwt_secret" },
+			Valid:  true,
+		},
+		"tier without rate": {
+			Change: func(c *config) { c.RateLimit.Tiers = rateLimitTiers{"partner": {Burst: 200}} },
+			Valid:  false,
+		},
+		"tier without burst": {
+			Change: func(c *config) { c.RateLimit.Tiers = rateLimitTiers{"partner": {Rate: 100}} },
+			Valid:  false,
+		},
+		"upstream url scheme":    {Change: func(c *config) { c.Upstream.URL = "ftp://dog.ceo/api" }, Valid: false},
+		"zero upstream timeout":  {Change: func(c *config) { c.Upstream.Timeout = 0 }, Valid: false},
+		"zero upstream attempts": {Change: func(c *config) { c.Upstream.MaxAttempts = 0 }, Valid: false},
+		"backoff max below base": {
+			Change: func(c *config) { c.Upstream.BackoffMax = duration(time.Millisecond) },
+			Valid:  false,
+		},
+		"jitter above one":             {Change: func(c *config) { c.Upstream.BackoffJitter = 1.5 }, Valid: false},
+		"invalid retry status":         {Change: func(c *config) { c.Upstream.RetryStatus = "500,700" }, Valid: false},
+		"negative max concurrent":      {Change: func(c *config) { c.Upstream.MaxConcurrent = -1 }, Valid: false},
+		"negative idle conns per host": {Change: func(c *config) { c.Upstream.MaxIdleConnsPerHost = -1 }, Valid: false},
+		"breaker without cool down": {
+			Change: func(c *config) { c.Breaker.CoolDown = 0 },
+			Valid:  false,
+		},
+		"disabled breaker without cool down": {
+			Change: func(c *config) { c.Breaker.FailureThreshold = 0; c.Breaker.CoolDown = 0 },
+			Valid:  true,
+		},
+		"disk cache without disk size": {
+			Change: func(c *config) { c.Cache.Dir = "/tmp/images"; c.Cache.DiskSizeMB = 0 },
+			Valid:  false,
+		},
+		"admin without auth": {
+			Change: func(c *config) { c.Admin.Enabled = true; c.Admin.Principals = "api-key:ops" },
+			Valid:  false,
+		},
+		"admin without principals": {
+			Change: func(c *config) { c.Admin.Enabled = true; c.Auth.APIKeys = "api_keys.txt"; c.Admin.Principals = " , " },
+			Valid:  false,
+		},
+		"admin principal without method": {
+			Change: func(c *config) { c.Admin.Enabled = true; c.Auth.APIKeys = "api_keys.txt"; c.Admin.Principals = "ops" },
+			Valid:  false,
+		},
+		"admin with auth and principals": {
+			Change: func(c *config) {
+				c.Admin.Enabled = true
+				c.Auth.APIKeys = "api_keys.txt"
+				c.Admin.Principals = "api-key:ops"
+			},
+			Valid: true,
+		},
+		"zero image workers":     {Change: func(c *config) { c.Search.ImageWorkers = 0 }, Valid: false},
+		"unknown trace exporter": {Change: func(c *config) { c.Tracing.Exporter = "jaeger" }, Valid: false},
+		"file exporter without file": {
+			Change: func(c *config) { c.Tracing.Exporter = tracing.ExporterFile; c.Tracing.File = "" },
+			Valid:  false,
+		},
+		"sample ratio above one": {Change: func(c *config) { c.Tracing.SampleRatio = 2 }, Valid: false},
+		"tls cert without key":   {Change: func(c *config) { c.TLS.Cert = "server.pem" }, Valid: false},
+		"tls client auth without ca": {
+			Change: func(c *config) { c.TLS.Cert = "server.pem"; c.TLS.Key = "server.key"; c.TLS.ClientAuth = true },
+			Valid:  false,
+		},
+		"mutual tls": {
+			Change: func(c *config) {
+				c.TLS.Cert, c.TLS.Key, c.TLS.CA, c.TLS.ClientAuth = "server.pem", "server.key", "ca.pem", true
+			},
+			Valid: true,
+		},
+		"jwt issuer without key":  {Change: func(c *config) { c.Auth.JWTIssuer = "dog-ceo-auth" }, Valid: false},
+		"negative shutdown drain": {Change: func(c *config) { c.Shutdown.Drain = -1 }, Valid: false},
+		"zero shutdown drain":     {Change: func(c *config) { c.Shutdown.Drain = 0 }, Valid: true},
+		"zero shutdown timeout":   {Change: func(c *config) { c.Shutdown.Timeout = 0 }, Valid: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := defaultConfig()
+			test.Change(&c)
+			err := c.validate()
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateConfigReportsAllErrors(t *testing.T) {
+	c := defaultConfig()
+	c.Listener.Port = 0
+	c.Logging.Format = "xml"
+	c.Upstream.MaxAttempts = 0
+
+	err := c.validate()
+	errs, ok := err.(configErrors)
+	if !ok {
+		t.Fatalf("want configErrors; got %T %v", err, err)
+	}
+	if len(errs) != 3 {
+		t.Fatalf("want 3 errors; got %d : %v", len(errs), err)
+	}
+	for _, setting := range []string{"listener.port", "logging.format", "upstream.max_attempts"} {
+		if !strings.Contains(err.Error(), setting) {
+			t.Errorf("error should mention %s : %v", setting, err)
+		}
+	}
+}
+
+func TestUpstreamClientConfig(t *testing.T) {
+	tests := map[string]struct {
+		MaxIdleConns        int
+		MaxIdleConnsPerHost int
+		Expected            int
+	}{
+		"per host follows the total": {MaxIdleConns: 200, MaxIdleConnsPerHost: 0, Expected: 200},
+		"per host is given":          {MaxIdleConns: 200, MaxIdleConnsPerHost: 50, Expected: 50},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			up := defaultConfig().Upstream
+			up.MaxIdleConns = test.MaxIdleConns
+			up.MaxIdleConnsPerHost = test.MaxIdleConnsPerHost
+
+			clientCfg := up.clientConfig()
+			if clientCfg.MaxIdleConns != test.MaxIdleConns {
+				t.Errorf("max idle conns = %d; want %d", clientCfg.MaxIdleConns, test.MaxIdleConns)
+			}
+			if clientCfg.MaxIdleConnsPerHost != test.Expected {
+				t.Errorf("max idle conns per host = %d; want %d", clientCfg.MaxIdleConnsPerHost, test.Expected)
+			}
+			if clientCfg.Timeout != time.Duration(up.Timeout) || clientCfg.KeepAlive != time.Duration(up.KeepAlive) {
+				t.Errorf("timeouts are not set %+v", clientCfg)
+			}
+		})
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	c := defaultConfig()
+	c.Listener.Port = 8080
+	c.RateLimit.Idle = duration(time.Minute * 90)
+	c.RateLimit.Tiers = rateLimitTiers{"partner": {Rate: 100, Burst: 200}}
+	c.TLS.ClientAuth = true
+
+	var buf bytes.Buffer
+	if err := printConfig(&buf, c); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if !strings.Contains(buf.String(), "idle: 1h30m0s") {
+		t.Errorf("durations should be printed as strings :\n%s", buf.String())
+	}
+
+	// the printed config can be loaded again
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded := defaultConfig()
+	if err := loadConfigFile(path, &loaded); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if !reflect.DeepEqual(loaded, c) {
+		t.Errorf("loaded config = %+v; want %+v", loaded, c)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/breed_image_service"
+	"github.com/canbo-x/dog-ceo/circuit_breaker"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// upstreamRetryDelay is the wait suggested to the client when the upstream API is overloaded or failing.
+const upstreamRetryDelay = time.Second
+
+// invalidArgumentError returns an InvalidArgument status with a BadRequest field violation for the given field.
+func invalidArgumentError(field, description string) error {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("invalid %s : %s", field, description))
+	detailed, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: field, Description: description},
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// toStatusError converts an error of breed_image_service to a gRPC status error.
+// The message is prepended to the error text.
+// Example:
+// - context deadline                  => DeadlineExceeded
+// - open circuit breaker              => Unavailable with RetryInfo
+// - 404 from the upstream API         => NotFound
+// - 429 from the upstream API         => ResourceExhausted with RetryInfo
+// - 5xx or network error              => Unavailable with RetryInfo
+// - anything else                     => Internal
+func toStatusError(ctx context.Context, message string, err error) error {
+	text := fmt.Sprintf("%s : %v", message, err)
+
+	var openErr *circuit_breaker.OpenError
+	var statusErr *breed_image_service.StatusError
+	var urlErr *url.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, text)
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return status.Error(codes.Canceled, text)
+	case errors.As(err, &openErr):
+		return withRetryInfo(codes.Unavailable, text, openErr.RetryAfter)
+	case errors.Is(err, breed_image_service.ErrImageNotFound), errors.Is(err, breed_image_service.ErrBreedNotFound):
+		return status.Error(codes.NotFound, text)
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			return withRetryInfo(codes.ResourceExhausted, text, upstreamRetryDelay)
+		}
+		if statusErr.StatusCode >= http.StatusInternalServerError {
+			return withRetryInfo(codes.Unavailable, text, upstreamRetryDelay)
+		}
+		return status.Error(codes.Internal, text)
+	case errors.As(err, &urlErr):
+		if urlErr.Timeout() {
+			return status.Error(codes.DeadlineExceeded, text)
+		}
+		return withRetryInfo(codes.Unavailable, text, upstreamRetryDelay)
+	default:
+		return status.Error(codes.Internal, text)
+	}
+}
+
+// withRetryInfo returns a status error with a RetryInfo detail.
+// If the delay is not positive, the detail is omitted.
+func withRetryInfo(code codes.Code, text string, delay time.Duration) error {
+	st := status.New(code, text)
+	if delay <= 0 {
+		return st.Err()
+	}
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/breed_image_service"
+	"github.com/canbo-x/dog-ceo/circuit_breaker"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// timeoutError is a net.Error which reports a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestToStatusError(t *testing.T) {
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := map[string]struct {
+		Ctx                context.Context
+		Err                error
+		ExpectedCode       codes.Code
+		ExpectedRetryDelay time.Duration
+	}{
+		"deadline exceeded": {
+			Ctx:          context.Background(),
+			Err:          context.DeadlineExceeded,
+			ExpectedCode: codes.DeadlineExceeded,
+		},
+		"expired request context": {
+			Ctx:          expiredCtx,
+			Err:          &breed_image_service.StatusError{StatusCode: 503},
+			ExpectedCode: codes.DeadlineExceeded,
+		},
+		"canceled": {
+			Ctx:          context.Background(),
+			Err:          context.Canceled,
+			ExpectedCode: codes.Canceled,
+		},
+		"open circuit breaker": {
+			Ctx:                context.Background(),
+			Err:                &circuit_breaker.OpenError{RetryAfter: time.Second * 3},
+			ExpectedCode:       codes.Unavailable,
+			ExpectedRetryDelay: time.Second * 3,
+		},
+		"image not found": {
+			Ctx:          context.Background(),
+			Err:          breed_image_service.ErrImageNotFound,
+			ExpectedCode: codes.NotFound,
+		},
+		"breed not found": {
+			Ctx:          context.Background(),
+			Err:          breed_image_service.ErrBreedNotFound,
+			ExpectedCode: codes.NotFound,
+		},
+		"upstream rate limit": {
+			Ctx:                context.Background(),
+			Err:                &breed_image_service.StatusError{StatusCode: 429},
+			ExpectedCode:       codes.ResourceExhausted,
+			ExpectedRetryDelay: upstreamRetryDelay,
+		},
+		"upstream server error": {
+			Ctx:                context.Background(),
+			Err:                &breed_image_service.StatusError{StatusCode: 502},
+			ExpectedCode:       codes.Unavailable,
+			ExpectedRetryDelay: upstreamRetryDelay,
+		},
+		"unexpected upstream status": {
+			Ctx:          context.Background(),
+			Err:          &breed_image_service.StatusError{StatusCode: 403},
+			ExpectedCode: codes.Internal,
+		},
+		"network error": {
+			Ctx:                context.Background(),
+			Err:                &url.Error{Op: "Get", URL: "https://dog.ceo/api", Err: errors.New("connection refused")},
+			ExpectedCode:       codes.Unavailable,
+			ExpectedRetryDelay: upstreamRetryDelay,
+		},
+		"network timeout": {
+			Ctx:          context.Background(),
+			Err:          &url.Error{Op: "Get", URL: "https://dog.ceo/api", Err: timeoutError{}},
+			ExpectedCode: codes.DeadlineExceeded,
+		},
+		"unknown error": {
+			Ctx:          context.Background(),
+			Err:          errors.New("invalid character"),
+			ExpectedCode: codes.Internal,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			st := status.Convert(toStatusError(test.Ctx, "failed", test.Err))
+			if st.Code() != test.ExpectedCode {
+				t.Fatalf("want code %v; got %v", test.ExpectedCode, st.Code())
+			}
+
+			var retryDelay time.Duration
+			for _, detail := range st.Details() {
+				if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+					retryDelay = retryInfo.GetRetryDelay().AsDuration()
+				}
+			}
+			if retryDelay != test.ExpectedRetryDelay {
+				t.Fatalf("want retry delay %v; got %v", test.ExpectedRetryDelay, retryDelay)
+			}
+		})
+	}
+}
+
+func TestInvalidArgumentError(t *testing.T) {
+	st := status.Convert(invalidArgumentError("breed", "it can only contain english latin letters"))
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("want code %v; got %v", codes.InvalidArgument, st.Code())
+	}
+	if len(st.Details()) != 1 {
+		t.Fatalf("want 1 detail; got %v", st.Details())
+	}
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	if !ok {
+		t.Fatalf("want BadRequest detail; got %T", st.Details()[0])
+	}
+	if violations := badRequest.GetFieldViolations(); len(violations) != 1 || violations[0].GetField() != "breed" {
+		t.Fatalf("want a field violation for breed; got %v", violations)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/breed_catalog"
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/health_prober"
+	"github.com/canbo-x/dog-ceo/proto/breed_image"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// These are the names of the health checks.
+// Every check is reported as a service of its own, so the failing dependency can be seen with the health command.
+const (
+	healthCheckUpstream = "dog.ceo"
+	healthCheckCatalog  = "breed-catalog"
+)
+
+// catalogMaxAgeRefreshes is the number of the missed catalog refreshes after which the catalog is stale.
+const catalogMaxAgeRefreshes = 3
+
+// servedServices are the services whose status depends on all the health checks.
+// The empty name is the status of the whole server.
+var servedServices = []string{"", breed_image.BreedImageService_ServiceDesc.ServiceName}
+
+// newHealthProber creates the health prober of the upstream API and the breed catalog,
+// probes once and starts probing every given interval. The results are reported to the given health server.
+// If the interval is zero, it returns nil and the health server always reports SERVING.
+func newHealthProber(source data_service.DataSource, catalog *breed_catalog.Catalog, catalogRefresh, interval, timeout time.Duration, healthServer *health.Server, logger *logrus.Logger) *health_prober.Prober {
+	if interval <= 0 {
+		logger.Info("Health prober is disabled")
+		setHealthStatus(healthServer, nil)
+		return nil
+	}
+
+	prober := health_prober.NewProber(health_prober.Settings{
+		Interval: interval,
+		Timeout:  timeout,
+		OnChange: func(name string, err error) {
+			if err != nil {
+				logger.Warnf("Health check %s is failing : %v", name, err)
+			} else {
+				logger.Infof("Health check %s is passing", name)
+			}
+		},
+		OnProbe: func(results map[string]error) {
+			setHealthStatus(healthServer, results)
+		},
+	})
+	prober.AddCheck(healthCheckUpstream, upstreamCheck(source))
+	if catalog != nil {
+		prober.AddCheck(healthCheckCatalog, catalogCheck(catalog, catalogRefresh*catalogMaxAgeRefreshes))
+	}
+
+	setHealthStatus(healthServer, prober.Results())
+	prober.Probe(context.Background())
+	prober.Start()
+	return prober
+}
+
+// setHealthStatus reports the given results of the health checks to the health server.
+// The served services are SERVING only if all the checks pass.
+func setHealthStatus(healthServer *health.Server, results map[string]error) {
+	for name, err := range results {
+		healthServer.SetServingStatus(name, servingStatus(err == nil))
+	}
+	serving := health_prober.Healthy(results)
+	for _, service := range servedServices {
+		healthServer.SetServingStatus(service, servingStatus(serving))
+	}
+}
+
+// servingStatus returns the health status of the given result.
+func servingStatus(serving bool) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	if serving {
+		return grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+}
+
+// upstreamCheck returns a health check which fails if the upstream API can not list the breeds.
+func upstreamCheck(source data_service.DataSource) health_prober.Check {
+	return func(ctx context.Context) error {
+		_, statusCode, err := source.ListBreeds(ctx)
+		if err != nil {
+			return err
+		}
+		if statusCode != http.StatusOK {
+			return fmt.Errorf("upstream responded with : %d", statusCode)
+		}
+		return nil
+	}
+}
+
+// catalogCheck returns a health check which fails if the breed catalog is not loaded or it is older than the given age.
+func catalogCheck(catalog *breed_catalog.Catalog, maxAge time.Duration) health_prober.Check {
+	return func(ctx context.Context) error {
+		if !catalog.IsLoaded() {
+			return fmt.Errorf("breed catalog is not loaded")
+		}
+		if age := time.Since(catalog.LastRefresh()); age > maxAge {
+			return fmt.Errorf("breed catalog is stale, it was refreshed %v ago", age.Round(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/breed_catalog"
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/fakedogceo"
+	"github.com/canbo-x/dog-ceo/proto/breed_image"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthStatus returns the status of the given service in the health server.
+func healthStatus(t *testing.T, healthServer *health.Server, service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	resp, err := healthServer.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("health check of %q failed : %v", service, err)
+	}
+	return resp.Status
+}
+
+func TestHealthProber(t *testing.T) {
+	serving := grpc_health_v1.HealthCheckResponse_SERVING
+	notServing := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+
+	tests := map[string]struct {
+		UpstreamDown  bool
+		CatalogLoaded bool
+		Expected      map[string]grpc_health_v1.HealthCheckResponse_ServingStatus
+	}{
+		"all healthy": {
+			CatalogLoaded: true,
+			Expected: map[string]grpc_health_v1.HealthCheckResponse_ServingStatus{
+				"": serving,
+				breed_image.BreedImageService_ServiceDesc.ServiceName: serving,
+				healthCheckUpstream: serving,
+				healthCheckCatalog:  serving,
+			},
+		},
+		"upstream is down": {
+			UpstreamDown:  true,
+			CatalogLoaded: true,
+			Expected: map[string]grpc_health_v1.HealthCheckResponse_ServingStatus{
+				"": notServing,
+				breed_image.BreedImageService_ServiceDesc.ServiceName: notServing,
+				healthCheckUpstream: notServing,
+				healthCheckCatalog:  serving,
+			},
+		},
+		"catalog is not loaded": {
+			CatalogLoaded: false,
+			Expected: map[string]grpc_health_v1.HealthCheckResponse_ServingStatus{
+				"": notServing,
+				breed_image.BreedImageService_ServiceDesc.ServiceName: notServing,
+				healthCheckUpstream: serving,
+				healthCheckCatalog:  notServing,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			options := fakedogceo.Options{}
+			if test.UpstreamDown {
+				options.ErrorRate = 1
+			}
+			upstream := httptest.NewServer(fakedogceo.New(options))
+			defer upstream.Close()
+			source := data_service.NewHttpDataSource(data_service.NewHttpClient(), upstream.URL+fakedogceo.APIPath)
+
+			catalog := breed_catalog.NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+				return nil, errors.New("not loaded")
+			})
+			if test.CatalogLoaded {
+				catalog = breed_catalog.NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+					return map[string][]string{"husky": {}}, nil
+				})
+				if err := catalog.Refresh(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			healthServer := health.NewServer()
+			prober := newHealthProber(source, catalog, time.Hour, time.Hour, time.Second, healthServer, logrus.New())
+			defer prober.Stop()
+
+			for service, expected := range test.Expected {
+				if got := healthStatus(t, healthServer, service); got != expected {
+					t.Errorf("want %v for %q; got %v", expected, service, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthProberDisabled(t *testing.T) {
+	healthServer := health.NewServer()
+	if prober := newHealthProber(newFakeDataSource(), nil, time.Hour, 0, time.Second, healthServer, logrus.New()); prober != nil {
+		t.Fatalf("health prober supposed to be disabled")
+	}
+	for _, service := range servedServices {
+		if got := healthStatus(t, healthServer, service); got != grpc_health_v1.HealthCheckResponse_SERVING {
+			t.Errorf("want SERVING for %q; got %v", service, got)
+		}
+	}
+}
+
+func TestCatalogCheckStale(t *testing.T) {
+	catalog := breed_catalog.NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+		return map[string][]string{"husky": {}}, nil
+	})
+	if err := catalog.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := catalogCheck(catalog, time.Hour)(context.Background()); err != nil {
+		t.Fatalf("fresh catalog supposed to pass got %v", err)
+	}
+	time.Sleep(time.Millisecond * 5)
+	if err := catalogCheck(catalog, time.Millisecond)(context.Background()); err == nil {
+		t.Fatalf("stale catalog supposed to fail")
+	}
+}
@@ -2,25 +2,43 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/canbo-x/dog-ceo/breed_catalog"
 	"github.com/canbo-x/dog-ceo/breed_image_service"
+	"github.com/canbo-x/dog-ceo/circuit_breaker"
 	"github.com/canbo-x/dog-ceo/data_service"
-	"github.com/canbo-x/dog-ceo/dummy_rate_limiter"
+	"github.com/canbo-x/dog-ceo/image_cache"
+	"github.com/canbo-x/dog-ceo/metrics"
+	"github.com/canbo-x/dog-ceo/proto/admin"
 	"github.com/canbo-x/dog-ceo/proto/breed_image"
+	"github.com/canbo-x/dog-ceo/request_id"
+	"github.com/canbo-x/dog-ceo/tls_config"
+	"github.com/canbo-x/dog-ceo/tracing"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_logrus "github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus"
-	"github.com/grpc-ecosystem/go-grpc-middleware/ratelimit"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var isValidString = regexp.MustCompile(`^[A-Za-z]+$`).MatchString
@@ -28,51 +46,234 @@ var isValidString = regexp.MustCompile(`^[A-Za-z]+$`).MatchString
 // Implement the breed image server.
 type breedImageServer struct {
 	breed_image.UnimplementedBreedImageServiceServer
+
+	// source is used for all the upstream calls.
+	source data_service.DataSource
+
+	// catalog is used to reject unknown breeds without going to the upstream API.
+	// If it is nil or not loaded yet, every request goes to the upstream API.
+	catalog *breed_catalog.Catalog
+
+	// cache is used to serve the repeated image URLs without going to the upstream API.
+	// If it is nil, every image is downloaded.
+	cache breed_image_service.ImageCache
+
+	// imageWorkers is the maximum number of concurrent image downloads of a SearchMany request.
+	imageWorkers int
+
+	// metrics records the image bytes sent to the clients.
+	// If it is nil, nothing is recorded.
+	metrics *metrics.Metrics
 }
 
+// imageChunkSize is the size of the image chunks of a StreamSearch response.
+const imageChunkSize = 32 * 1024
+
+// imageHashTrailer is the trailer key of the hex encoded SHA-256 hash of a streamed image.
+const imageHashTrailer = "image-sha256"
+
+// defaultImageWorkers is the default maximum number of concurrent image downloads of a SearchMany request.
+const defaultImageWorkers = 4
+
 func main() {
-	// This port is used to serve the breed image service.
-	port := flag.Int("port", 22626, "The gRPC-server port.")
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the server and serves until it is stopped by a signal or a serving error.
+// The components are stopped by the deferred calls, so run returns the errors instead of exiting.
+// It returns the setup or the serving error after the started components are stopped.
+func run() error {
+	// This file is used to load the settings, the environment variables and the flags override it.
+	configFile := flag.String("config", "", "The YAML or JSON configuration file. Empty uses the defaults.")
 
-	// This log level is used to set the log level.
-	logLevel := flag.String("log-level", "info", "The log level of the gRPC-server.")
+	// This mode prints the effective settings and exits.
+	printEffectiveConfig := flag.Bool("print-config", false, "Print the effective configuration as YAML and exit.")
+
+	flagConfig := defaultConfig()
+	bindFlags(flag.CommandLine, &flagConfig)
 
 	// Parse the command line flags
 	flag.Parse()
 
+	cfg, err := loadConfig(*configFile, os.LookupEnv, flag.CommandLine)
+	if err != nil {
+		return fmt.Errorf("failed to load the configuration : %v", err)
+	}
+	validationErr := cfg.validate()
+
+	if *printEffectiveConfig {
+		if err := printConfig(os.Stdout, cfg); err != nil {
+			return fmt.Errorf("failed to print the configuration : %v", err)
+		}
+		return validationErr
+	}
+	if validationErr != nil {
+		return validationErr
+	}
+
 	logrusLogger := logrus.New()
-	if err := checkAndSetLogLevel(*logLevel); err != nil {
-		logrusLogger.Fatalf("Failed to set log level : %v", err)
+	if err := checkAndSetLogLevel(logrusLogger, cfg.Logging.Level); err != nil {
+		return fmt.Errorf("failed to set log level : %v", err)
+	}
+	if err := setLogFormat(logrusLogger, cfg.Logging.Format); err != nil {
+		return fmt.Errorf("failed to set log format : %v", err)
+	}
+
+	logrusEntry := logrus.NewEntry(logrusLogger)
+	grpc_logrus.ReplaceGrpcLogger(logrusEntry)
+
+	serverMetrics := newMetrics(cfg.Metrics.Addr, logrusLogger)
+
+	tracerProvider, err := newTracerProvider(tracing.Settings{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		File:        cfg.Tracing.File,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}, logrusLogger)
+	if err != nil {
+		return fmt.Errorf("failed to create the tracer provider : %v", err)
+	}
+	defer shutdownTracerProvider(tracerProvider, logrusLogger)
+
+	authenticator, err := newAuthenticator(authSettings{
+		APIKeysFile:      cfg.Auth.APIKeys,
+		JWTSecretFile:    cfg.Auth.JWTSecret,
+		JWTPublicKeyFile: cfg.Auth.JWTPublicKey,
+		JWTIssuer:        cfg.Auth.JWTIssuer,
+		JWTAudience:      cfg.Auth.JWTAudience,
+	}, logrusLogger)
+	if err != nil {
+		return fmt.Errorf("failed to set up the authentication : %v", err)
+	}
+
+	rateLimitSettings, err := cfg.RateLimit.settings()
+	if err != nil {
+		return fmt.Errorf("failed to create the rate limiter : %v", err)
+	}
+	rateLimitSettings.OnReject = func() { serverMetrics.RateLimited(cfg.RateLimit.Limiter) }
+	limit, err := newRateLimit(rateLimitSettings, logrusLogger)
+	if err != nil {
+		return fmt.Errorf("failed to create the rate limiter : %v", err)
+	}
+	defer limit.stop()
+
+	retryPolicy, err := cfg.Upstream.retryPolicy()
+	if err != nil {
+		return fmt.Errorf("failed to create the upstream retry policy : %v", err)
+	}
+
+	httpSource := data_service.NewHttpDataSource(
+		data_service.NewHttpClientWithConfig(cfg.Upstream.clientConfig()),
+		cfg.Upstream.URL,
+		data_service.WithRetryPolicy(retryPolicy),
+		data_service.WithOutboundLimit(cfg.Upstream.outboundLimit()),
+		data_service.WithRequestObserver(serverMetrics.ObserveUpstream),
+		data_service.WithQueueObserver(serverMetrics.ObserveQueueWait),
+		data_service.WithLogger(logrusEntry),
+	)
+	logrusLogger.Infof("Upstream API base URL is %s", cfg.Upstream.URL)
+
+	source := newBreakerDataSource(httpSource, cfg.Breaker.FailureThreshold, time.Duration(cfg.Breaker.CoolDown), cfg.Breaker.HalfOpenRequests, logrusLogger)
+
+	catalog := newBreedCatalog(source, time.Duration(cfg.Catalog.Refresh), logrusLogger)
+	if catalog != nil {
+		defer catalog.Stop()
 	}
 
-	dummyRL := dummy_rate_limiter.NewLimitCounter()
-	dummyRL.StartLimiter()
+	imageCache, err := newImageCache(cfg.Cache.SizeMB, time.Duration(cfg.Cache.TTL), cfg.Cache.Dir, cfg.Cache.DiskSizeMB, logrusLogger)
+	if err != nil {
+		return fmt.Errorf("failed to create the image cache : %v", err)
+	}
+
+	registerStatsMetrics(serverMetrics, httpSource, imageCache)
+	if serverMetrics != nil {
+		stopMetrics, err := serveMetrics(cfg.Metrics.Addr, serverMetrics, logrusLogger)
+		if err != nil {
+			return fmt.Errorf("failed to serve the metrics : %v", err)
+		}
+		defer stopMetrics()
+	}
 
 	// Listen on the port
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Listener.Port))
 	if err != nil {
-		logrusLogger.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen : %v", err)
 	}
 
-	logrusEntry := logrus.NewEntry(logrusLogger)
-	grpc_logrus.ReplaceGrpcLogger(logrusEntry)
+	creds, tlsReloader, err := newServerCredentials(tlsSettings{
+		Files:          tls_config.Files{CertFile: cfg.TLS.Cert, KeyFile: cfg.TLS.Key, CAFile: cfg.TLS.CA},
+		ClientAuth:     cfg.TLS.ClientAuth,
+		ReloadInterval: time.Duration(cfg.TLS.ReloadInterval),
+	}, logrusLogger)
+	if err != nil {
+		return fmt.Errorf("failed to set up TLS : %v", err)
+	}
+	if tlsReloader != nil {
+		defer tlsReloader.Stop()
+	}
+
+	// requests are counted to report the ones aborted by the shutdown,
+	// connections are counted to skip the drain when there are none
+	requests := newInFlightRequests()
 
-	server := grpc.NewServer(
+	serverOptions := []grpc.ServerOption{
 		grpc_middleware.WithUnaryServerChain(
+			requests.unary,
+			serverMetrics.UnaryServerInterceptor(),
+			tracing.UnaryServerInterceptor(tracerProvider),
 			grpc_ctxtags.UnaryServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+			request_id.UnaryServerInterceptor(),
 			grpc_logrus.UnaryServerInterceptor(logrusEntry),
-			ratelimit.UnaryServerInterceptor(dummyRL),
+			authenticator.UnaryServerInterceptor(),
+			limit.unary,
 		),
 		grpc_middleware.WithStreamServerChain(
+			requests.stream,
+			serverMetrics.StreamServerInterceptor(),
+			tracing.StreamServerInterceptor(tracerProvider),
 			grpc_ctxtags.StreamServerInterceptor(grpc_ctxtags.WithFieldExtractor(grpc_ctxtags.CodeGenRequestFieldExtractor)),
+			request_id.StreamServerInterceptor(),
 			grpc_logrus.StreamServerInterceptor(logrusEntry),
-			ratelimit.StreamServerInterceptor(dummyRL),
+			authenticator.StreamServerInterceptor(),
+			limit.stream,
 		),
-	)
+		grpc.StatsHandler(requests),
+	}
+	if creds != nil {
+		serverOptions = append(serverOptions, creds)
+	}
+	server := grpc.NewServer(serverOptions...)
 
 	// Register the breed image server
-	breed_image.RegisterBreedImageServiceServer(server, &breedImageServer{})
-	logrusLogger.Infof("gRPC server is listening on port %d", *port)
+	bis := newBreedImageServer(source, catalog)
+	bis.imageWorkers = cfg.Search.ImageWorkers
+	bis.metrics = serverMetrics
+	if imageCache != nil {
+		bis.cache = imageCache
+	}
+	breed_image.RegisterBreedImageServiceServer(server, bis)
+
+	// Register the health service
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	prober := newHealthProber(httpSource, catalog, time.Duration(cfg.Catalog.Refresh), time.Duration(cfg.Health.Interval), time.Duration(cfg.Health.Timeout), healthServer, logrusLogger)
+
+	// Register the admin service
+	configReloader := newReloader(*configFile, cfg, logrusLogger, limit, httpSource, imageCache)
+	if cfg.Admin.Enabled {
+		adminService, err := newAdminServer(configReloader, cfg.Admin.Principals)
+		if err != nil {
+			return fmt.Errorf("failed to create the admin service : %v", err)
+		}
+		admin.RegisterAdminServiceServer(server, adminService)
+		logrusLogger.Infof("Admin service is enabled for %s", cfg.Admin.Principals)
+	} else {
+		logrusLogger.Info("Admin service is disabled")
+	}
+
+	logrusLogger.Infof("gRPC server is listening on port %d", cfg.Listener.Port)
 
 	errChan := make(chan error)
 
@@ -81,74 +282,377 @@ func main() {
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGTERM, syscall.SIGINT)
 
+	// SIGHUP reloads the configuration file
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
 	go func() {
 		if err := server.Serve(lis); err != nil {
 			errChan <- err
 		}
 	}()
 
-	defer func() {
-		server.GracefulStop()
-	}()
+	var serveErr error
+wait:
+	for {
+		select {
+		case serveErr = <-errChan:
+			logrusLogger.Errorf("Failed to serve, stopping the server : %v", serveErr)
+			serveErr = fmt.Errorf("failed to serve : %v", serveErr)
+			break wait
+		case <-reloadChan:
+			logrusLogger.Info("Reloading the configuration...")
+			if _, err := configReloader.reload(); err != nil {
+				logrusLogger.Warnf("Failed to reload the configuration, the running one is kept : %v", err)
+			}
+		case <-stopChan:
+			logrusLogger.Info("Stopping the server...")
+			break wait
+		}
+	}
 
-	select {
-	case err := <-errChan:
-		logrusLogger.Fatalf("Fatal error: %v\n", err)
-	case <-stopChan:
-		logrusLogger.Info("Stopping the server...")
+	// the prober is stopped first, so it does not probe the upstream API while the server is draining
+	if prober != nil {
+		prober.Stop()
 	}
+	shutdownServer(server, healthServer, requests, shutdownSettings{
+		Drain:     time.Duration(cfg.Shutdown.Drain),
+		Timeout:   time.Duration(cfg.Shutdown.Timeout),
+		SkipDrain: serveErr != nil,
+	}, logrusLogger)
+
+	logrusLogger.Infof("Upstream requests were retried %d times", httpSource.Retries())
+	logrusLogger.Infof("Upstream requests were coalesced %d times", httpSource.Coalesced())
+	logrusLogger.Infof("Upstream queue stats : %v", httpSource.QueueStats())
+	if imageCache != nil {
+		logrusLogger.Infof("Image cache stats : %v", imageCache.Stats())
+	}
+	return serveErr
+}
+
+// newBreedImageServer returns a new breed image server which uses the given data source for the upstream calls.
+// The catalog is optional, it can be nil.
+func newBreedImageServer(source data_service.DataSource, catalog *breed_catalog.Catalog) *breedImageServer {
+	return &breedImageServer{source: source, catalog: catalog, imageWorkers: defaultImageWorkers}
 }
 
 // Search checks for the image of the given breed and sub-breed.
 func (bis *breedImageServer) Search(ctx context.Context, bi *breed_image.BreedImageSearchRequest) (*breed_image.BreedImageSearchResponse, error) {
-	log.Printf("Received a request to search. Breed : %v Sub Breed : %v\n", bi.Breed, bi.SubBreed)
+	logger := ctxlogrus.Extract(ctx).WithFields(logrus.Fields{"breed": bi.Breed, "sub_breed": bi.SubBreed})
+	logger.Debug("Received a request to search")
 
-	if !isValidString(bi.Breed) {
-		log.Println("Invalid breed name. Request is rejected.")
-		return nil, fmt.Errorf("invalid breed name it can only contains english latin letters : %v", bi.Breed)
+	if err := bis.validateSearch(ctx, bi.Breed, bi.SubBreed); err != nil {
+		return nil, err
 	}
 
-	if bi.SubBreed != "" && !isValidString(bi.SubBreed) {
-		log.Println("Invalid sub-breed name. Request is rejected.")
-		return nil, fmt.Errorf("invalid sub-breed name it can only contains english latin letters : %v", bi.SubBreed)
+	imageURL, err := breed_image_service.GetURL(ctx, bis.source, bi.Breed, bi.SubBreed)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get the image url")
+		return nil, toStatusError(ctx, "failed to get image url", err)
 	}
+	logger = logger.WithField("image_url", imageURL)
 
-	imageURL, err := breed_image_service.GetURL(ctx, data_service.NewHttpClient(), bi.Breed, bi.SubBreed)
+	image, err := breed_image_service.GetImage(ctx, bis.source, bis.cache, imageURL)
 	if err != nil {
-		log.Printf("Error while getting image url : %v\n", err)
+		logger.WithError(err).Warn("Failed to get the image")
+		return nil, toStatusError(ctx, "failed to get image", err)
+	}
+
+	bis.metrics.AddImageBytes("Search", len(image))
+	logger.WithField("image_bytes", len(image)).Info("Image is fetched and served to the client")
+	return &breed_image.BreedImageSearchResponse{ImageURL: imageURL, Image: image}, nil
+}
+
+// SearchMany checks for up to the given number of images of the given breed and sub-breed.
+// The images are downloaded concurrently with a bounded number of workers.
+func (bis *breedImageServer) SearchMany(ctx context.Context, req *breed_image.SearchManyRequest) (*breed_image.SearchManyResponse, error) {
+	logger := ctxlogrus.Extract(ctx).WithFields(logrus.Fields{"breed": req.Breed, "sub_breed": req.SubBreed, "count": req.Count})
+	logger.Debug("Received a request to search many")
+
+	if err := bis.validateSearch(ctx, req.Breed, req.SubBreed); err != nil {
 		return nil, err
 	}
 
-	image, err := breed_image_service.GetImage(ctx, data_service.NewHttpClient(), imageURL)
+	if req.Count < 1 || req.Count > breed_image_service.MaxImageCount {
+		logger.Info("Invalid image count, request is rejected")
+		return nil, invalidArgumentError("count", fmt.Sprintf("it must be between 1 and %d : %d", breed_image_service.MaxImageCount, req.Count))
+	}
+
+	imageURLs, err := breed_image_service.GetURLs(ctx, bis.source, req.Breed, req.SubBreed, int(req.Count))
 	if err != nil {
-		log.Printf("Error while getting image : %v\n", err)
-		return nil, fmt.Errorf("failed to get image : %v", err)
+		logger.WithError(err).Warn("Failed to get the image urls")
+		return nil, toStatusError(ctx, "failed to get image urls", err)
 	}
 
-	log.Printf("Image is fetched and served to the client. Image URL : %v\n", imageURL)
-	return &breed_image.BreedImageSearchResponse{ImageURL: imageURL, Image: image}, nil
+	images, err := breed_image_service.GetImages(ctx, bis.source, bis.cache, imageURLs, bis.imageWorkers)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get the images")
+		return nil, toStatusError(ctx, "failed to get images", err)
+	}
+
+	resp := &breed_image.SearchManyResponse{Images: make([]*breed_image.BreedImage, 0, len(images))}
+	for _, image := range images {
+		resp.Images = append(resp.Images, &breed_image.BreedImage{ImageURL: image.URL, Image: image.Data})
+		bis.metrics.AddImageBytes("SearchMany", len(image.Data))
+	}
+
+	logger.WithField("image_count", len(images)).Info("Images are fetched and served to the client")
+	return resp, nil
+}
+
+// StreamSearch streams a random image of the given breed and sub-breed.
+// It sends the metadata of the image first and then the image in chunks while reading it from the upstream API.
+// The SHA-256 hash of the image is sent in the trailer when all the chunks are sent.
+func (bis *breedImageServer) StreamSearch(bi *breed_image.BreedImageSearchRequest, stream breed_image.BreedImageService_StreamSearchServer) error {
+	ctx := stream.Context()
+	logger := ctxlogrus.Extract(ctx).WithFields(logrus.Fields{"breed": bi.Breed, "sub_breed": bi.SubBreed})
+	logger.Debug("Received a request to stream search")
+
+	if err := bis.validateSearch(ctx, bi.Breed, bi.SubBreed); err != nil {
+		return err
+	}
+
+	imageURL, err := breed_image_service.GetURL(ctx, bis.source, bi.Breed, bi.SubBreed)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get the image url")
+		return toStatusError(ctx, "failed to get image url", err)
+	}
+	logger = logger.WithField("image_url", imageURL)
+
+	image, err := breed_image_service.OpenImage(ctx, bis.source, imageURL)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to open the image")
+		return toStatusError(ctx, "failed to open image", err)
+	}
+	defer image.Body.Close()
+
+	metadata := &breed_image.ImageMetadata{ImageURL: imageURL, ContentType: image.ContentType, Size: image.Size}
+	if err := stream.Send(&breed_image.StreamSearchResponse{Data: &breed_image.StreamSearchResponse_Metadata{Metadata: metadata}}); err != nil {
+		logger.WithError(err).Warn("Failed to send the image metadata")
+		return err
+	}
+
+	hash := sha256.New()
+	body := io.TeeReader(image.Body, hash)
+	chunk := make([]byte, imageChunkSize)
+	sent := 0
+	for {
+		n, err := io.ReadFull(body, chunk)
+		if n > 0 {
+			// the chunk is marshaled before Send returns, so the buffer can be reused
+			if err := stream.Send(&breed_image.StreamSearchResponse{Data: &breed_image.StreamSearchResponse_Chunk{Chunk: chunk[:n]}}); err != nil {
+				logger.WithError(err).Warn("Failed to send an image chunk")
+				return err
+			}
+			sent += n
+			bis.metrics.AddImageBytes("StreamSearch", n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			logger.WithError(err).Warn("Failed to read the image")
+			return toStatusError(ctx, "failed to read image", err)
+		}
+	}
+
+	stream.SetTrailer(grpc_metadata.Pairs(imageHashTrailer, hex.EncodeToString(hash.Sum(nil))))
+
+	logger.WithField("image_bytes", sent).Info("Image is streamed to the client")
+	return nil
+}
+
+// validateSearch checks the given breed and sub-breed names.
+// If the catalog is loaded, it also rejects the unknown breeds and sub-breeds.
+func (bis *breedImageServer) validateSearch(ctx context.Context, breed, subBreed string) error {
+	logger := ctxlogrus.Extract(ctx)
+	if !isValidString(breed) {
+		logger.Info("Invalid breed name, request is rejected")
+		return invalidArgumentError("breed", fmt.Sprintf("it can only contain english latin letters : %q", breed))
+	}
+
+	if subBreed != "" && !isValidString(subBreed) {
+		logger.Info("Invalid sub-breed name, request is rejected")
+		return invalidArgumentError("sub_breed", fmt.Sprintf("it can only contain english latin letters : %q", subBreed))
+	}
+
+	if bis.catalog != nil && bis.catalog.IsLoaded() && !bis.catalog.Exists(breed, subBreed) {
+		logger.Info("Unknown breed or sub-breed, request is rejected")
+		return status.Errorf(codes.NotFound, "breed or sub-breed is not found : %v %v", breed, subBreed)
+	}
+	return nil
+}
+
+// ListBreeds returns all the breeds with their sub-breeds.
+func (bis *breedImageServer) ListBreeds(ctx context.Context, _ *breed_image.ListBreedsRequest) (*breed_image.ListBreedsResponse, error) {
+	logger := ctxlogrus.Extract(ctx)
+	logger.Debug("Received a request to list the breeds")
+
+	breeds, err := breed_image_service.ListBreeds(ctx, bis.source)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to list the breeds")
+		return nil, toStatusError(ctx, "failed to list breeds", err)
+	}
+
+	resp := &breed_image.ListBreedsResponse{Breeds: make(map[string]*breed_image.SubBreedList, len(breeds))}
+	for breed, subBreeds := range breeds {
+		resp.Breeds[breed] = &breed_image.SubBreedList{SubBreeds: subBreeds}
+	}
+
+	logger.WithField("breed_count", len(breeds)).Info("Breed list is fetched and served to the client")
+	return resp, nil
 }
 
-// checkAndSetLogLevel checks the log level and sets it.
+// ListSubBreeds returns the sub-breeds of the given breed.
+func (bis *breedImageServer) ListSubBreeds(ctx context.Context, req *breed_image.ListSubBreedsRequest) (*breed_image.ListSubBreedsResponse, error) {
+	logger := ctxlogrus.Extract(ctx).WithField("breed", req.Breed)
+	logger.Debug("Received a request to list the sub-breeds")
+
+	if !isValidString(req.Breed) {
+		logger.Info("Invalid breed name, request is rejected")
+		return nil, invalidArgumentError("breed", fmt.Sprintf("it can only contain english latin letters : %q", req.Breed))
+	}
+
+	subBreeds, err := breed_image_service.ListSubBreeds(ctx, bis.source, req.Breed)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to list the sub-breeds")
+		return nil, toStatusError(ctx, "failed to list sub-breeds", err)
+	}
+
+	logger.WithField("sub_breed_count", len(subBreeds)).Info("Sub-breed list is fetched and served to the client")
+	return &breed_image.ListSubBreedsResponse{Breed: req.Breed, SubBreeds: subBreeds}, nil
+}
+
+// newBreedCatalog creates the breed catalog, loads it and starts refreshing it every given interval.
+// If the interval is zero, it returns nil which means the catalog is disabled.
+// If the first load fails, the server still starts and the refresher tries again later.
+func newBreedCatalog(source data_service.DataSource, interval time.Duration, logger *logrus.Logger) *breed_catalog.Catalog {
+	if interval <= 0 {
+		logger.Info("Breed catalog is disabled")
+		return nil
+	}
+
+	catalog := breed_catalog.NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+		return breed_image_service.ListBreeds(ctx, source)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	if err := catalog.Refresh(ctx); err != nil {
+		logger.Warnf("Failed to warm up the breed catalog : %v", err)
+	} else {
+		logger.Info("Breed catalog is loaded")
+	}
+
+	catalog.StartRefresher(interval, func(err error) {
+		logger.Warnf("Failed to refresh the breed catalog : %v", err)
+	})
+	return catalog
+}
+
+// newImageCache creates the image cache with the given budgets in megabytes.
+// If the memory budget is zero, it returns nil which means the image cache is disabled.
+func newImageCache(sizeMB int64, ttl time.Duration, dir string, diskSizeMB int64, logger *logrus.Logger) (*image_cache.Cache, error) {
+	if sizeMB <= 0 {
+		logger.Info("Image cache is disabled")
+		return nil, nil
+	}
+
+	cache, err := image_cache.NewCache(image_cache.Settings{
+		MaxBytes:     sizeMB << 20,
+		TTL:          ttl,
+		Dir:          dir,
+		MaxDiskBytes: diskSizeMB << 20,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		logger.Infof("Image cache is enabled with %d MB memory and %d MB disk in %s", sizeMB, diskSizeMB, dir)
+	} else {
+		logger.Infof("Image cache is enabled with %d MB memory", sizeMB)
+	}
+	return cache, nil
+}
+
+// newBreakerDataSource puts a circuit breaker in front of the given source and logs its state changes.
+// If the failure threshold is zero, it returns the source as is which means the circuit breaker is disabled.
+func newBreakerDataSource(source data_service.DataSource, failureThreshold int, coolDown time.Duration, halfOpenRequests int, logger *logrus.Logger) data_service.DataSource {
+	if failureThreshold <= 0 {
+		logger.Info("Circuit breaker is disabled")
+		return source
+	}
+
+	breaker := circuit_breaker.NewBreaker(circuit_breaker.Settings{
+		FailureThreshold:    failureThreshold,
+		CoolDown:            coolDown,
+		HalfOpenMaxRequests: halfOpenRequests,
+		OnStateChange: func(from, to circuit_breaker.State) {
+			logger.Warnf("Circuit breaker state changed from %v to %v", from, to)
+		},
+	})
+	return data_service.NewBreakerDataSource(source, breaker)
+}
+
+// parseStatusCodes parses the comma separated status codes.
+// Example: "500,502,503"
+func parseStatusCodes(value string) (map[int]bool, error) {
+	statusCodes := make(map[int]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		statusCode, err := strconv.Atoi(field)
+		if err != nil || statusCode < 100 || statusCode > 599 {
+			return nil, fmt.Errorf("invalid status code : %v", field)
+		}
+		statusCodes[statusCode] = true
+	}
+	return statusCodes, nil
+}
+
+// checkAndSetLogLevel checks the log level and sets it on the given logger.
 // If the log level is invalid, it returns an error.
-func checkAndSetLogLevel(logLevel string) error {
+func checkAndSetLogLevel(logger *logrus.Logger, logLevel string) error {
 	switch logLevel {
 	case "debug":
-		logrus.SetLevel(logrus.DebugLevel)
+		logger.SetLevel(logrus.DebugLevel)
 	case "info":
-		logrus.SetLevel(logrus.InfoLevel)
+		logger.SetLevel(logrus.InfoLevel)
 	case "warn":
-		logrus.SetLevel(logrus.WarnLevel)
+		logger.SetLevel(logrus.WarnLevel)
 	case "error":
-		logrus.SetLevel(logrus.ErrorLevel)
+		logger.SetLevel(logrus.ErrorLevel)
 	case "fatal":
-		logrus.SetLevel(logrus.FatalLevel)
+		logger.SetLevel(logrus.FatalLevel)
 	case "panic":
-		logrus.SetLevel(logrus.PanicLevel)
+		logger.SetLevel(logrus.PanicLevel)
 	case "trace":
-		logrus.SetLevel(logrus.TraceLevel)
+		logger.SetLevel(logrus.TraceLevel)
 	default:
 		return fmt.Errorf("invalid log level : %v", logLevel)
 	}
 	return nil
 }
+
+// These are the log formats which can be selected with the log-format flag.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// setLogFormat checks the log format and sets it on the given logger.
+// If the log format is invalid, it returns an error.
+func setLogFormat(logger *logrus.Logger, logFormat string) error {
+	switch logFormat {
+	case logFormatText:
+		logger.SetFormatter(&logrus.TextFormatter{})
+	case logFormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("invalid log format : %v", logFormat)
+	}
+	return nil
+}
@@ -1,25 +1,62 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/canbo-x/dog-ceo/dummy_rate_limiter"
+	"github.com/canbo-x/dog-ceo/breed_catalog"
+	"github.com/canbo-x/dog-ceo/circuit_breaker"
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/fakedogceo"
 	"github.com/canbo-x/dog-ceo/proto/breed_image"
+	"github.com/canbo-x/dog-ceo/rate_limiter"
+	"github.com/canbo-x/dog-ceo/request_id"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_logrus "github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus"
 	"github.com/grpc-ecosystem/go-grpc-middleware/ratelimit"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"github.com/sirupsen/logrus"
+	logrus_test "github.com/sirupsen/logrus/hooks/test"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	grpc_metadata "google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 )
 
-func dialer(shouldLimit bool) func(context.Context, string) (net.Conn, error) {
+// fakeUpstream is the fake dog.ceo API which is used by all the tests in this package.
+var fakeUpstream *httptest.Server
+
+func TestMain(m *testing.M) {
+	fakeUpstream = httptest.NewServer(fakedogceo.New(fakedogceo.Options{}))
+	code := m.Run()
+	fakeUpstream.Close()
+	os.Exit(code)
+}
+
+// newFakeDataSource returns a data source which uses the fake dog.ceo API.
+func newFakeDataSource() data_service.DataSource {
+	return data_service.NewHttpDataSource(data_service.NewHttpClient(), fakeUpstream.URL+fakedogceo.APIPath)
+}
+
+func dialer(shouldLimit bool, bis *breedImageServer) func(context.Context, string) (net.Conn, error) {
 	listener := bufconn.Listen(1024 * 1024)
 
 	server := grpcServer()
@@ -27,7 +64,7 @@ func dialer(shouldLimit bool) func(context.Context, string) (net.Conn, error) {
 		server = grpcServerWithRateLimit()
 	}
 
-	breed_image.RegisterBreedImageServiceServer(server, &breedImageServer{})
+	breed_image.RegisterBreedImageServiceServer(server, bis)
 
 	go func() {
 		if err := server.Serve(listener); err != nil {
@@ -45,18 +82,21 @@ func grpcServer() *grpc.Server {
 }
 
 func grpcServerWithRateLimit() *grpc.Server {
-	dummyRL := dummy_rate_limiter.NewLimitCounter()
-	dummyRL.StartLimiter()
+	limiter := rate_limiter.NewTokenBucket(rate_limiter.Settings{Rate: 1, Burst: 10})
 	return grpc.NewServer(
 		grpc_middleware.WithUnaryServerChain(
-			ratelimit.UnaryServerInterceptor(dummyRL),
+			ratelimit.UnaryServerInterceptor(limiter),
 		),
 	)
 }
 
 func getCoon(shouldLimit bool) (context.Context, *grpc.ClientConn) {
+	return getCoonWithServer(shouldLimit, newBreedImageServer(newFakeDataSource(), nil))
+}
+
+func getCoonWithServer(shouldLimit bool, bis *breedImageServer) (context.Context, *grpc.ClientConn) {
 	ctx := context.Background()
-	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer(shouldLimit)), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(dialer(shouldLimit, bis)), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -72,23 +112,24 @@ func TestServerAndSearch(t *testing.T) {
 		SubBreed string
 		URL      string
 		Valid    bool
+		Code     codes.Code
 	}{
 		"valid breed and subbreed": {
 			Breed:    "australian",
 			SubBreed: "shepherd",
-			URL:      "https://images.dog.ceo/breeds/australian-shepherd/",
+			URL:      "/breeds/australian-shepherd/",
 			Valid:    true,
 		},
 		"valid breed and empty subbreed - dog does not have subbreed": {
 			Breed:    "husky",
 			SubBreed: "",
-			URL:      "https://images.dog.ceo/breeds/husky/",
+			URL:      "/breeds/husky/",
 			Valid:    true,
 		},
 		"valid breed and empty subbreed - dog have subbreed ": {
 			Breed:    "australian",
 			SubBreed: "",
-			URL:      "https://images.dog.ceo/breeds/australian-shepherd/",
+			URL:      "/breeds/australian-shepherd/",
 			Valid:    true,
 		},
 		"invalid breed": {
@@ -96,42 +137,49 @@ func TestServerAndSearch(t *testing.T) {
 			SubBreed: "",
 			URL:      "",
 			Valid:    false,
+			Code:     codes.NotFound,
 		},
 		"invalid subbreed": {
 			Breed:    "husky",
 			SubBreed: "INVALID",
 			URL:      "",
 			Valid:    false,
+			Code:     codes.NotFound,
 		},
 		"empty breed": {
 			Breed:    "",
 			SubBreed: "",
 			URL:      "",
 			Valid:    false,
+			Code:     codes.InvalidArgument,
 		},
 		"breed regex not match": {
 			Breed:    "INVALID_REGEX",
 			SubBreed: "",
 			URL:      "",
 			Valid:    false,
+			Code:     codes.InvalidArgument,
 		},
 		"subbreed regex not match": {
 			Breed:    "australian",
 			SubBreed: "INVALID_REGEX",
 			URL:      "",
 			Valid:    false,
+			Code:     codes.InvalidArgument,
 		},
 		"whitespace breed": {
 			Breed:    " ",
 			SubBreed: "",
 			URL:      "",
 			Valid:    false,
+			Code:     codes.InvalidArgument,
 		},
 		"whitespace subbreed": {
 			Breed:    "australian",
 			SubBreed: " ",
 			URL:      "",
 			Valid:    false,
+			Code:     codes.InvalidArgument,
 		},
 	}
 
@@ -149,6 +197,9 @@ func TestServerAndSearch(t *testing.T) {
 				if (err == nil) != test.Valid {
 					t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
 				}
+				if status.Code(err) != test.Code {
+					t.Fatalf("want code %v; got err %v", test.Code, err)
+				}
 
 				if !resp.ProtoReflect().IsValid() {
 					if err == nil {
@@ -173,6 +224,368 @@ func TestServerAndSearch(t *testing.T) {
 	}
 }
 
+func TestSearchMany(t *testing.T) {
+	tests := map[string]struct {
+		Breed         string
+		SubBreed      string
+		Count         int32
+		ExpectedCount int
+		URL           string
+		Code          codes.Code
+	}{
+		"breed": {
+			Breed:         "husky",
+			Count:         2,
+			ExpectedCount: 2,
+			URL:           "/breeds/husky/",
+		},
+		"breed and subbreed": {
+			Breed:         "hound",
+			SubBreed:      "afghan",
+			Count:         2,
+			ExpectedCount: 2,
+			URL:           "/breeds/hound-afghan/",
+		},
+		"more than available": {
+			Breed:         "pug",
+			Count:         10,
+			ExpectedCount: 2,
+			URL:           "/breeds/pug/",
+		},
+		"zero count": {
+			Breed: "husky",
+			Count: 0,
+			Code:  codes.InvalidArgument,
+		},
+		"too many": {
+			Breed: "husky",
+			Count: 51,
+			Code:  codes.InvalidArgument,
+		},
+		"invalid breed": {
+			Breed: "INVALID_REGEX",
+			Count: 2,
+			Code:  codes.InvalidArgument,
+		},
+		"unknown breed": {
+			Breed: "INVALID",
+			Count: 2,
+			Code:  codes.NotFound,
+		},
+	}
+
+	ctx, conn := getCoon(false)
+	defer conn.Close()
+	client := getClient(conn)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.SearchMany(ctx, &breed_image.SearchManyRequest{Breed: test.Breed, SubBreed: test.SubBreed, Count: test.Count})
+			if status.Code(err) != test.Code {
+				t.Fatalf("want code %v; got err %v", test.Code, err)
+			}
+			if err != nil {
+				return
+			}
+			if len(resp.Images) != test.ExpectedCount {
+				t.Fatalf("want %d images; got %d", test.ExpectedCount, len(resp.Images))
+			}
+			for _, image := range resp.Images {
+				if !strings.Contains(image.ImageURL, test.URL) {
+					t.Fatalf("want url contains %v; got %v", test.URL, image.ImageURL)
+				}
+				if len(image.Image) == 0 {
+					t.Fatalf("image is empty %v", image.ImageURL)
+				}
+			}
+		})
+	}
+}
+
+// bigImageUpstream returns a fake upstream API which serves a single big image for every breed.
+func bigImageUpstream(t *testing.T, image []byte) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/big.jpg") {
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+			w.Write(image)
+			return
+		}
+		fmt.Fprintf(w, `{"message": "http://%s/big.jpg", "status": "success"}`, r.Host)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestStreamSearch(t *testing.T) {
+	image := make([]byte, imageChunkSize*3+100)
+	rand.New(rand.NewSource(1)).Read(image)
+	upstream := bigImageUpstream(t, image)
+
+	source := data_service.NewHttpDataSource(data_service.NewHttpClient(), upstream.URL)
+	ctx, conn := getCoonWithServer(false, newBreedImageServer(source, nil))
+	defer conn.Close()
+	client := getClient(conn)
+
+	stream, err := client.StreamSearch(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"})
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	metadata := resp.GetMetadata()
+	if metadata == nil {
+		t.Fatalf("first message supposed to be the metadata got %v", resp)
+	}
+	if !strings.HasSuffix(metadata.ImageURL, "/big.jpg") || metadata.ContentType != "image/jpeg" || metadata.Size != int64(len(image)) {
+		t.Fatalf("metadata is not correct %v", metadata)
+	}
+
+	var received []byte
+	chunks := 0
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error is not nil %v", err)
+		}
+		if len(resp.GetChunk()) > imageChunkSize {
+			t.Fatalf("chunk is bigger than %d bytes", imageChunkSize)
+		}
+		received = append(received, resp.GetChunk()...)
+		chunks++
+	}
+
+	if !bytes.Equal(received, image) {
+		t.Fatalf("received image is not the same as the upstream image")
+	}
+	if chunks != 4 {
+		t.Fatalf("want 4 chunks; got %d", chunks)
+	}
+
+	hash := sha256.Sum256(image)
+	if got := stream.Trailer().Get(imageHashTrailer); len(got) != 1 || got[0] != hex.EncodeToString(hash[:]) {
+		t.Fatalf("want hash trailer %x; got %v", hash, got)
+	}
+}
+
+func TestSearchWithImageCache(t *testing.T) {
+	var imageHits int32
+	image := []byte("image")
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/big.jpg") {
+			atomic.AddInt32(&imageHits, 1)
+			w.Write(image)
+			return
+		}
+		fmt.Fprintf(w, `{"message": "http://%s/big.jpg", "status": "success"}`, r.Host)
+	}))
+	defer upstream.Close()
+
+	cache, err := newImageCache(1, time.Hour, "", 0, logrus.New())
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	bis := newBreedImageServer(data_service.NewHttpDataSource(data_service.NewHttpClient(), upstream.URL), nil)
+	bis.cache = cache
+
+	ctx, conn := getCoonWithServer(false, bis)
+	defer conn.Close()
+	client := getClient(conn)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"})
+		if err != nil {
+			t.Fatalf("error is not nil %v", err)
+		}
+		if !bytes.Equal(resp.Image, image) {
+			t.Fatalf("image is not correct %s", resp.Image)
+		}
+	}
+
+	if hits := atomic.LoadInt32(&imageHits); hits != 1 {
+		t.Fatalf("want 1 image download; got %d", hits)
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("stats are not correct %v", stats)
+	}
+}
+
+func TestNewImageCache(t *testing.T) {
+	cache, err := newImageCache(0, time.Hour, "", 0, logrus.New())
+	if err != nil || cache != nil {
+		t.Fatalf("image cache supposed to be disabled got %v %v", cache, err)
+	}
+
+	cache, err = newImageCache(1, time.Hour, t.TempDir(), 1, logrus.New())
+	if err != nil || cache == nil {
+		t.Fatalf("image cache supposed to be enabled got %v %v", cache, err)
+	}
+}
+
+func TestStreamSearchErrors(t *testing.T) {
+	tests := map[string]struct {
+		Breed    string
+		SubBreed string
+		Code     codes.Code
+	}{
+		"invalid breed": {
+			Breed: "INVALID_REGEX",
+			Code:  codes.InvalidArgument,
+		},
+		"unknown breed": {
+			Breed: "INVALID",
+			Code:  codes.NotFound,
+		},
+	}
+
+	ctx, conn := getCoon(false)
+	defer conn.Close()
+	client := getClient(conn)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			stream, err := client.StreamSearch(ctx, &breed_image.BreedImageSearchRequest{Breed: test.Breed, SubBreed: test.SubBreed})
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if _, err := stream.Recv(); status.Code(err) != test.Code {
+				t.Fatalf("want code %v; got err %v", test.Code, err)
+			}
+		})
+	}
+}
+
+func TestSearchWithCatalog(t *testing.T) {
+	tests := map[string]struct {
+		Breed    string
+		SubBreed string
+	}{
+		"unknown breed": {
+			Breed:    "INVALID",
+			SubBreed: "",
+		},
+		"unknown subbreed": {
+			Breed:    "husky",
+			SubBreed: "INVALID",
+		},
+	}
+
+	catalog := breed_catalog.NewCatalog(func(ctx context.Context) (map[string][]string, error) {
+		return map[string][]string{"australian": {"shepherd"}, "husky": {}}, nil
+	})
+	if err := catalog.Refresh(context.Background()); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	ctx, conn := getCoonWithServer(false, newBreedImageServer(newFakeDataSource(), catalog))
+	defer conn.Close()
+	client := getClient(conn)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			_, err := client.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: test.Breed, SubBreed: test.SubBreed})
+			if status.Code(err) != codes.NotFound {
+				t.Fatalf("want code %v; got err %v", codes.NotFound, err)
+			}
+		})
+	}
+}
+
+func TestListBreeds(t *testing.T) {
+	ctx, conn := getCoon(false)
+	defer conn.Close()
+	client := getClient(conn)
+
+	resp, err := client.ListBreeds(ctx, &breed_image.ListBreedsRequest{})
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if _, ok := resp.Breeds["husky"]; !ok {
+		t.Fatalf("husky is not in the breed list")
+	}
+}
+
+func TestListSubBreeds(t *testing.T) {
+	tests := map[string]struct {
+		Breed string
+		Valid bool
+	}{
+		"breed with sub-breeds": {
+			Breed: "australian",
+			Valid: true,
+		},
+		"invalid breed": {
+			Breed: "INVALID",
+			Valid: false,
+		},
+		"breed regex not match": {
+			Breed: "INVALID_REGEX",
+			Valid: false,
+		},
+		"empty breed": {
+			Breed: "",
+			Valid: false,
+		},
+	}
+
+	ctx, conn := getCoon(false)
+	defer conn.Close()
+	client := getClient(conn)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			_, err := client.ListSubBreeds(ctx, &breed_image.ListSubBreedsRequest{Breed: test.Breed})
+			if (err == nil) != test.Valid {
+				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
+			}
+		})
+	}
+}
+
+func TestSearchWithOpenBreaker(t *testing.T) {
+	failingUpstream := httptest.NewServer(fakedogceo.New(fakedogceo.Options{ErrorRate: 1}))
+	defer failingUpstream.Close()
+
+	breaker := circuit_breaker.NewBreaker(circuit_breaker.Settings{FailureThreshold: 1, CoolDown: time.Minute})
+	source := data_service.NewBreakerDataSource(
+		data_service.NewHttpDataSource(data_service.NewHttpClient(), failingUpstream.URL+fakedogceo.APIPath),
+		breaker,
+	)
+
+	ctx, conn := getCoonWithServer(false, newBreedImageServer(source, nil))
+	defer conn.Close()
+	client := getClient(conn)
+
+	// the first request fails on the upstream and opens the breaker
+	_, err := client.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("want code %v; got err %v", codes.Unavailable, err)
+	}
+	if breaker.State() != circuit_breaker.Open {
+		t.Fatalf("breaker supposed to be open but it is %v", breaker.State())
+	}
+
+	_, err = client.Search(ctx, &breed_image.BreedImageSearchRequest{Breed: "husky"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("want code %v; got err %v", codes.Unavailable, err)
+	}
+
+	_, err = client.ListBreeds(ctx, &breed_image.ListBreedsRequest{})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("want code %v; got err %v", codes.Unavailable, err)
+	}
+}
+
 func TestRateLimiting(t *testing.T) {
 	ctx, conn := getCoon(true)
 	defer conn.Close()
@@ -192,3 +605,175 @@ func TestRateLimiting(t *testing.T) {
 	}
 
 }
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := map[string]struct {
+		Value    string
+		Expected map[int]bool
+		Valid    bool
+	}{
+		"single status code": {
+			Value:    "503",
+			Expected: map[int]bool{503: true},
+			Valid:    true,
+		},
+		"multiple status codes with spaces": {
+			Value:    "500, 502 ,503",
+			Expected: map[int]bool{500: true, 502: true, 503: true},
+			Valid:    true,
+		},
+		"empty value": {
+			Value:    "",
+			Expected: map[int]bool{},
+			Valid:    true,
+		},
+		"not a number": {
+			Value:    "500,abc",
+			Expected: nil,
+			Valid:    false,
+		},
+		"out of range": {
+			Value:    "700",
+			Expected: nil,
+			Valid:    false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseStatusCodes(test.Value)
+			if (err == nil) != test.Valid {
+				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
+			}
+			if !reflect.DeepEqual(got, test.Expected) {
+				t.Fatalf("want %v; got %v", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckAndSetLogLevel(t *testing.T) {
+	tests := map[string]struct {
+		Level    string
+		Expected logrus.Level
+		Valid    bool
+	}{
+		"debug":   {Level: "debug", Expected: logrus.DebugLevel, Valid: true},
+		"warn":    {Level: "warn", Expected: logrus.WarnLevel, Valid: true},
+		"trace":   {Level: "trace", Expected: logrus.TraceLevel, Valid: true},
+		"invalid": {Level: "verbose", Valid: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			logger := logrus.New()
+			err := checkAndSetLogLevel(logger, test.Level)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if logger.GetLevel() != test.Expected {
+				t.Errorf("level = %v; want %v", logger.GetLevel(), test.Expected)
+			}
+		})
+	}
+
+	// the level of the standard logger must not change
+	if logrus.GetLevel() != logrus.InfoLevel {
+		t.Errorf("standard logger level changed to %v", logrus.GetLevel())
+	}
+}
+
+func TestSetLogFormat(t *testing.T) {
+	tests := map[string]struct {
+		Format string
+		JSON   bool
+		Valid  bool
+	}{
+		"text":    {Format: logFormatText, JSON: false, Valid: true},
+		"json":    {Format: logFormatJSON, JSON: true, Valid: true},
+		"invalid": {Format: "xml", Valid: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			logger := logrus.New()
+			err := setLogFormat(logger, test.Format)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if _, ok := logger.Formatter.(*logrus.JSONFormatter); ok != test.JSON {
+				t.Errorf("formatter = %T", logger.Formatter)
+			}
+		})
+	}
+}
+
+func TestRequestScopedLogging(t *testing.T) {
+	logger, hook := logrus_test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	entry := logrus.NewEntry(logger)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc_middleware.WithUnaryServerChain(
+			grpc_ctxtags.UnaryServerInterceptor(),
+			request_id.UnaryServerInterceptor(),
+			grpc_logrus.UnaryServerInterceptor(entry),
+		),
+	)
+	breed_image.RegisterBreedImageServiceServer(server, newBreedImageServer(newFakeDataSource(), nil))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var header, trailer grpc_metadata.MD
+	_, err = getClient(conn).Search(context.Background(), &breed_image.BreedImageSearchRequest{Breed: "123"}, grpc.Header(&header), grpc.Trailer(&trailer))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("want InvalidArgument; got %v", err)
+	}
+
+	ids := trailer.Get(request_id.Header)
+	if len(ids) != 1 {
+		t.Fatalf("request id is not returned %v %v", header, trailer)
+	}
+
+	var found bool
+	for _, e := range hook.AllEntries() {
+		if e.Message != "Invalid breed name, request is rejected" {
+			continue
+		}
+		found = true
+		if e.Data[request_id.LogField] != ids[0] || e.Data["grpc.method"] != "Search" {
+			t.Errorf("log line should have the request fields %v", e.Data)
+		}
+	}
+	if !found {
+		t.Errorf("rejected request is not logged")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/image_cache"
+	"github.com/canbo-x/dog-ceo/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// metricsPath is the HTTP path of the metrics.
+const metricsPath = "/metrics"
+
+// metricsShutdownTimeout is the time the metrics listener is given to finish its requests when the server stops.
+const metricsShutdownTimeout = time.Second * 5
+
+// newMetrics creates the metrics of the server.
+// If the address is empty, it returns nil and nothing is recorded.
+func newMetrics(addr string, logger *logrus.Logger) *metrics.Metrics {
+	if addr == "" {
+		logger.Info("Metrics are disabled")
+		return nil
+	}
+	return metrics.New()
+}
+
+// registerStatsMetrics exposes the statistics which are already kept by the data source and the image cache.
+// The image cache is optional, it can be nil.
+func registerStatsMetrics(m *metrics.Metrics, source *data_service.HttpDataSource, cache *image_cache.Cache) {
+	if m == nil {
+		return
+	}
+
+	m.AddCounterFunc("upstream_retries_total", "Total number of the retried upstream attempts.", func() float64 {
+		return float64(source.Retries())
+	})
+	m.AddCounterFunc("upstream_coalesced_total", "Total number of the upstream requests which shared the result of another request.", func() float64 {
+		return float64(source.Coalesced())
+	})
+	m.AddCounterFunc("upstream_queued_total", "Total number of the upstream requests which waited for the outbound limits.", func() float64 {
+		return float64(source.QueueStats().Queued)
+	})
+	m.AddGaugeFunc("upstream_in_flight", "Number of the upstream requests in flight.", func() float64 {
+		return float64(source.QueueStats().InFlight)
+	})
+
+	if cache == nil {
+		return
+	}
+	m.AddCounterFunc("image_cache_hits_total", "Total number of the images served from the image cache.", func() float64 {
+		return float64(cache.Stats().Hits)
+	})
+	m.AddCounterFunc("image_cache_disk_hits_total", "Total number of the images served from the disk tier of the image cache.", func() float64 {
+		return float64(cache.Stats().DiskHits)
+	})
+	m.AddCounterFunc("image_cache_misses_total", "Total number of the images which are not in the image cache.", func() float64 {
+		return float64(cache.Stats().Misses)
+	})
+	m.AddCounterFunc("image_cache_evictions_total", "Total number of the images removed from the image cache.", func() float64 {
+		return float64(cache.Stats().Evictions)
+	})
+	m.AddGaugeFunc("image_cache_hit_ratio", "Fraction of the image lookups served from the image cache.", func() float64 {
+		return cache.Stats().HitRatio()
+	})
+	m.AddGaugeFunc("image_cache_entries", "Number of the images in the memory of the image cache.", func() float64 {
+		return float64(cache.Stats().Entries)
+	})
+	m.AddGaugeFunc("image_cache_bytes", "Total size of the images in the memory of the image cache.", func() float64 {
+		return float64(cache.Stats().Bytes)
+	})
+}
+
+// serveMetrics starts serving the metrics on the given address.
+// It returns a function which shuts the listener down.
+func serveMetrics(addr string, m *metrics.Metrics, logger *logrus.Logger) (func(), error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, m.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: time.Second * 5}
+
+	go func() {
+		if err := server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Metrics listener failed : %v", err)
+		}
+	}()
+	logger.Infof("Metrics are served on http://%s%s", lis.Addr(), metricsPath)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warnf("Failed to stop the metrics listener : %v", err)
+		}
+	}, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/auth"
+	"github.com/canbo-x/dog-ceo/dummy_rate_limiter"
+	"github.com/canbo-x/dog-ceo/rate_limiter"
+	"github.com/grpc-ecosystem/go-grpc-middleware/ratelimit"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// These are the rate limiters which can be selected with the rate-limiter flag.
+const (
+	rateLimiterTokenBucket = "token-bucket"
+	rateLimiterDummy       = "dummy"
+	rateLimiterNone        = "none"
+)
+
+// These are the keys of the token buckets which can be selected with the rate-limit-key flag.
+const (
+	rateLimitKeyGlobal    = "global"
+	rateLimitKeyPeer      = "peer"
+	rateLimitKeyAPIKey    = "api-key"
+	rateLimitKeyHeader    = "header"
+	rateLimitKeyPrincipal = "principal"
+)
+
+// rateLimitSettings holds the settings of the rate limiting of the incoming requests.
+type rateLimitSettings struct {
+	// Kind is the rate limiter, one of the rateLimiter constants.
+	Kind string
+
+	// Rate and Burst are the settings of the token buckets.
+	Rate  float64
+	Burst int
+
+	// Key is the key of the token buckets, one of the rateLimitKey constants.
+	// Global shares a single bucket between all the clients.
+	Key string
+
+	// Header is the metadata key of the clients when the key is header.
+	Header string
+
+	// MaxKeys and IdleTimeout bound the per-client buckets.
+	MaxKeys     int
+	IdleTimeout time.Duration
+
+	// Tiers holds the limits of the given clients, the others use the rate and the burst.
+	Tiers map[string]rate_limiter.Settings
+
+	// OnReject is called for every rejected request, it is optional.
+	OnReject func()
+}
+
+// rateLimit holds the interceptors of the rate limiting and the functions which stop and update its limiter.
+type rateLimit struct {
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+	stop   func()
+
+	// update applies the rate, the burst, the tiers and the bucket bounds of the given settings.
+	// It is nil if the limiter has no settings to update.
+	update func(settings rateLimitSettings)
+}
+
+// newRateLimit creates the rate limiter with the given settings and its interceptors.
+// Only the token bucket rate limiter can limit per client and tell the clients when to retry.
+func newRateLimit(settings rateLimitSettings, logger *logrus.Logger) (*rateLimit, error) {
+	switch settings.Kind {
+	case rateLimiterTokenBucket:
+	case rateLimiterDummy, rateLimiterNone:
+		if settings.Key != rateLimitKeyGlobal {
+			return nil, fmt.Errorf("rate limit key %s requires the %s rate limiter", settings.Key, rateLimiterTokenBucket)
+		}
+		var limiter rate_limiter.Limiter = noLimiter{}
+		if settings.Kind == rateLimiterDummy {
+			logger.Info("Dummy rate limiter is enabled")
+			lc := dummy_rate_limiter.NewLimitCounter()
+			lc.StartLimiter()
+			limiter = lc
+		} else {
+			logger.Info("Rate limiter is disabled")
+		}
+		limiter = observedLimiter{Limiter: limiter, onReject: settings.OnReject}
+		return &rateLimit{
+			unary:  ratelimit.UnaryServerInterceptor(limiter),
+			stream: ratelimit.StreamServerInterceptor(limiter),
+			stop:   limiter.Stop,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiter : %s", settings.Kind)
+	}
+
+	if settings.Rate <= 0 {
+		return nil, fmt.Errorf("rate limit must be positive : %v", settings.Rate)
+	}
+	if settings.Burst < 1 {
+		return nil, fmt.Errorf("rate limit burst must be at least 1 : %d", settings.Burst)
+	}
+	defaults := rate_limiter.Settings{Rate: settings.Rate, Burst: settings.Burst}
+
+	// limiter is created after the key is known, the header key asks it for the tiers
+	var limiter *rate_limiter.KeyedLimiter
+	var keyFunc rate_limiter.KeyFunc
+	switch settings.Key {
+	case rateLimitKeyGlobal:
+		bucket := rate_limiter.NewTokenBucket(defaults)
+		logger.Infof("Token bucket rate limiter is enabled with %v requests per second and %d burst", settings.Rate, settings.Burst)
+		take := observeTake(rate_limiter.Global(bucket), settings.OnReject)
+		return &rateLimit{
+			unary:  rate_limiter.UnaryServerInterceptor(take),
+			stream: rate_limiter.StreamServerInterceptor(take),
+			stop:   bucket.Stop,
+			update: func(settings rateLimitSettings) {
+				bucket.SetSettings(rate_limiter.Settings{Rate: settings.Rate, Burst: settings.Burst})
+			},
+		}, nil
+	case rateLimitKeyPeer:
+		keyFunc = rate_limiter.PeerKey
+	case rateLimitKeyAPIKey:
+		keyFunc = apiKeyNameKey
+	case rateLimitKeyHeader:
+		header := strings.ToLower(strings.TrimSpace(settings.Header))
+		if header == "" {
+			return nil, fmt.Errorf("rate limit header must not be empty")
+		}
+		// only the clients of the tiers get their own bucket, so the header can not be used to get new ones
+		keyFunc = rate_limiter.MetadataKey(header, func(value string) bool { return limiter.HasTier(value) })
+	case rateLimitKeyPrincipal:
+		keyFunc = principalKey
+	default:
+		return nil, fmt.Errorf("unknown rate limit key : %s", settings.Key)
+	}
+
+	limiter = rate_limiter.NewKeyedLimiter(keyedSettings(settings))
+	logger.Infof("Token bucket rate limiter is enabled per %s with %v requests per second, %d burst and %d tiers", settings.Key, settings.Rate, settings.Burst, len(settings.Tiers))
+	take := observeTake(rate_limiter.Keyed(limiter, keyFunc), settings.OnReject)
+	return &rateLimit{
+		unary:  rate_limiter.UnaryServerInterceptor(take),
+		stream: rate_limiter.StreamServerInterceptor(take),
+		stop:   limiter.Stop,
+		update: func(settings rateLimitSettings) {
+			limiter.SetSettings(keyedSettings(settings))
+		},
+	}, nil
+}
+
+// keyedSettings returns the settings of the per-client token buckets.
+func keyedSettings(settings rateLimitSettings) rate_limiter.KeyedSettings {
+	return rate_limiter.KeyedSettings{
+		Default:     rate_limiter.Settings{Rate: settings.Rate, Burst: settings.Burst},
+		Tiers:       settings.Tiers,
+		MaxKeys:     settings.MaxKeys,
+		IdleTimeout: settings.IdleTimeout,
+	}
+}
+
+// noLimiter is a rate limiter which never limits, it is used when the rate limiting is disabled.
+type noLimiter struct{}
+
+// Limit always returns false.
+func (noLimiter) Limit() bool { return false }
+
+// Stop does nothing.
+func (noLimiter) Stop() {}
+
+// observedLimiter calls onReject for every request limited by its limiter.
+type observedLimiter struct {
+	rate_limiter.Limiter
+	onReject func()
+}
+
+// Limit returns the decision of the limiter and calls onReject if the request is limited.
+func (ol observedLimiter) Limit() bool {
+	limited := ol.Limiter.Limit()
+	if limited && ol.onReject != nil {
+		ol.onReject()
+	}
+	return limited
+}
+
+// observeTake returns a TakeFunc which calls onReject for every request limited by the given TakeFunc.
+// A nil onReject returns the given TakeFunc.
+func observeTake(take rate_limiter.TakeFunc, onReject func()) rate_limiter.TakeFunc {
+	if onReject == nil {
+		return take
+	}
+	return func(ctx context.Context) rate_limiter.Decision {
+		decision := take(ctx)
+		if decision.Limited {
+			onReject()
+		}
+		return decision
+	}
+}
+
+// principalKey returns the method and the name of the authenticated client of the request, e.g. "jwt:partner".
+// The requests without a principal are keyed by their peer address with the "peer:" prefix,
+// so they never share a bucket with an authenticated client.
+func principalKey(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.Key()
+	}
+	return "peer:" + rate_limiter.PeerKey(ctx)
+}
+
+// apiKeyNameKey returns the name of the API key which authenticated the request.
+// The API keys are validated by the authentication, so a client can not get a new bucket with an unknown key.
+// The other requests are keyed by their peer address with the "peer:" prefix.
+func apiKeyNameKey(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok && p.Method == auth.MethodAPIKey {
+		return p.Name
+	}
+	return "peer:" + rate_limiter.PeerKey(ctx)
+}
+
+// parseRateLimitTiers parses the comma separated per-client limits.
+// Example: "partner=100:200,10.0.0.1=1:1"
+func parseRateLimitTiers(value string) (map[string]rate_limiter.Settings, error) {
+	tiers := make(map[string]rate_limiter.Settings)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		// the key can contain ":" such as an IPv6 address, so it is split by the last "="
+		i := strings.LastIndex(field, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid rate limit tier : %v", field)
+		}
+		key, limit := field[:i], field[i+1:]
+
+		rateValue, burstValue, ok := strings.Cut(limit, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit tier : %v", field)
+		}
+		rate, err := strconv.ParseFloat(rateValue, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate limit tier rate : %v", field)
+		}
+		burst, err := strconv.Atoi(burstValue)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid rate limit tier burst : %v", field)
+		}
+		tiers[key] = rate_limiter.Settings{Rate: rate, Burst: burst}
+	}
+	return tiers, nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/auth"
+	"github.com/canbo-x/dog-ceo/rate_limiter"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewRateLimit(t *testing.T) {
+	valid := rateLimitSettings{
+		Kind:        rateLimiterTokenBucket,
+		Rate:        10,
+		Burst:       1,
+		Key:         rateLimitKeyPeer,
+		Header:      "x-client-id",
+		MaxKeys:     100,
+		IdleTimeout: time.Minute,
+	}
+
+	tests := map[string]struct {
+		Update func(s *rateLimitSettings)
+		Valid  bool
+	}{
+		"global": {
+			Update: func(s *rateLimitSettings) { s.Key = rateLimitKeyGlobal },
+			Valid:  true,
+		},
+		"global zero rate": {
+			Update: func(s *rateLimitSettings) { s.Key, s.Rate = rateLimitKeyGlobal, 0 },
+			Valid:  false,
+		},
+		"global dummy": {
+			Update: func(s *rateLimitSettings) { s.Key, s.Kind = rateLimitKeyGlobal, rateLimiterDummy },
+			Valid:  true,
+		},
+		"global none": {
+			Update: func(s *rateLimitSettings) { s.Key, s.Kind = rateLimitKeyGlobal, rateLimiterNone },
+			Valid:  true,
+		},
+		"unknown rate limiter": {
+			Update: func(s *rateLimitSettings) { s.Key, s.Kind = rateLimitKeyGlobal, "leaky-bucket" },
+			Valid:  false,
+		},
+		"peer": {
+			Update: func(s *rateLimitSettings) {},
+			Valid:  true,
+		},
+		"api key": {
+			Update: func(s *rateLimitSettings) { s.Key = rateLimitKeyAPIKey },
+			Valid:  true,
+		},
+		"header": {
+			Update: func(s *rateLimitSettings) { s.Key = rateLimitKeyHeader },
+			Valid:  true,
+		},
+		"principal": {
+			Update: func(s *rateLimitSettings) { s.Key = rateLimitKeyPrincipal },
+			Valid:  true,
+		},
+		"empty header": {
+			Update: func(s *rateLimitSettings) { s.Key, s.Header = rateLimitKeyHeader, " " },
+			Valid:  false,
+		},
+		"unknown key": {
+			Update: func(s *rateLimitSettings) { s.Key = "user" },
+			Valid:  false,
+		},
+		"per client dummy": {
+			Update: func(s *rateLimitSettings) { s.Kind = rateLimiterDummy },
+			Valid:  false,
+		},
+		"per client zero rate": {
+			Update: func(s *rateLimitSettings) { s.Rate = 0 },
+			Valid:  false,
+		},
+		"per client zero burst": {
+			Update: func(s *rateLimitSettings) { s.Burst = 0 },
+			Valid:  false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			settings := valid
+			test.Update(&settings)
+			limit, err := newRateLimit(settings, logrus.New())
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if limit.unary == nil || limit.stream == nil || limit.stop == nil {
+				t.Fatalf("interceptors and stop supposed to be set")
+			}
+			limit.stop()
+		})
+	}
+}
+
+func TestRateLimitOnReject(t *testing.T) {
+	tests := map[string]struct {
+		Kind     string
+		Key      string
+		Rejected int
+	}{
+		"global":   {Kind: rateLimiterTokenBucket, Key: rateLimitKeyGlobal, Rejected: 2},
+		"per peer": {Kind: rateLimiterTokenBucket, Key: rateLimitKeyPeer, Rejected: 2},
+		"none":     {Kind: rateLimiterNone, Key: rateLimitKeyGlobal, Rejected: 0},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var rejected int32
+			limit, err := newRateLimit(rateLimitSettings{
+				Kind:        test.Kind,
+				Rate:        0.001,
+				Burst:       1,
+				Key:         test.Key,
+				MaxKeys:     10,
+				IdleTimeout: time.Minute,
+				OnReject:    func() { atomic.AddInt32(&rejected, 1) },
+			}, logrus.New())
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			defer limit.stop()
+
+			info := &grpc.UnaryServerInfo{FullMethod: "/breed_image.BreedImageService/Search"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+			for i := 0; i < 3; i++ {
+				limit.unary(context.Background(), nil, info, handler)
+			}
+
+			if got := atomic.LoadInt32(&rejected); int(got) != test.Rejected {
+				t.Errorf("rejected = %d, want %d", got, test.Rejected)
+			}
+		})
+	}
+}
+
+func TestRateLimitUpdate(t *testing.T) {
+	tests := map[string]struct {
+		Kind      string
+		Key       string
+		Updatable bool
+	}{
+		"global":   {Kind: rateLimiterTokenBucket, Key: rateLimitKeyGlobal, Updatable: true},
+		"per peer": {Kind: rateLimiterTokenBucket, Key: rateLimitKeyPeer, Updatable: true},
+		"none":     {Kind: rateLimiterNone, Key: rateLimitKeyGlobal, Updatable: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			settings := rateLimitSettings{Kind: test.Kind, Rate: 0.001, Burst: 1, Key: test.Key, MaxKeys: 10}
+			limit, err := newRateLimit(settings, logrus.New())
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			defer limit.stop()
+			if !test.Updatable {
+				if limit.update != nil {
+					t.Fatalf("update supposed to be nil")
+				}
+				return
+			}
+
+			info := &grpc.UnaryServerInfo{FullMethod: "/breed_image.BreedImageService/Search"}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+			limit.unary(context.Background(), nil, info, handler)
+			if _, err := limit.unary(context.Background(), nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("want ResourceExhausted before the update; got %v", err)
+			}
+
+			settings.Rate, settings.Burst = 1000000, 3
+			limit.update(settings)
+			time.Sleep(time.Millisecond)
+			for i := 0; i < 3; i++ {
+				if _, err := limit.unary(context.Background(), nil, info, handler); err != nil {
+					t.Fatalf("request %d supposed to pass after the update %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPrincipalKey(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+	if got := principalKey(ctx); got != "peer:10.0.0.1" {
+		t.Errorf("unauthenticated key = %q; want peer:10.0.0.1", got)
+	}
+
+	tokenCtx := auth.NewContext(ctx, auth.Principal{Name: "partner", Method: auth.MethodJWT})
+	if got := principalKey(tokenCtx); got != "jwt:partner" {
+		t.Errorf("token key = %q; want jwt:partner", got)
+	}
+
+	apiKeyCtx := auth.NewContext(ctx, auth.Principal{Name: "partner", Method: auth.MethodAPIKey})
+	if got := principalKey(apiKeyCtx); got != "api-key:partner" {
+		t.Errorf("api key = %q; want api-key:partner", got)
+	}
+
+	// a token subject can not take the bucket of a peer
+	peerCtx := auth.NewContext(ctx, auth.Principal{Name: "peer:10.0.0.1", Method: auth.MethodJWT})
+	if got := principalKey(peerCtx); got != "jwt:peer:10.0.0.1" {
+		t.Errorf("token key = %q; want jwt:peer:10.0.0.1", got)
+	}
+}
+
+func TestAPIKeyNameKey(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+	// the raw metadata is not trusted, only the name of an authenticated API key is used
+	ctx = grpc_metadata.NewIncomingContext(ctx, grpc_metadata.Pairs(rate_limiter.APIKeyHeader, "rotated-1"))
+	if got := apiKeyNameKey(ctx); got != "peer:10.0.0.1" {
+		t.Errorf("unauthenticated key = %q; want peer:10.0.0.1", got)
+	}
+
+	jwtCtx := auth.NewContext(ctx, auth.Principal{Name: "partner", Method: auth.MethodJWT})
+	if got := apiKeyNameKey(jwtCtx); got != "peer:10.0.0.1" {
+		t.Errorf("token key = %q; want peer:10.0.0.1", got)
+	}
+
+	apiKeyCtx := auth.NewContext(ctx, auth.Principal{Name: "partner", Method: auth.MethodAPIKey})
+	if got := apiKeyNameKey(apiKeyCtx); got != "partner" {
+		t.Errorf("api key = %q; want partner", got)
+	}
+}
+
+func TestParseRateLimitTiers(t *testing.T) {
+	tests := map[string]struct {
+		Value    string
+		Expected map[string]rate_limiter.Settings
+		Valid    bool
+	}{
+		"empty": {
+			Value:    "",
+			Expected: map[string]rate_limiter.Settings{},
+			Valid:    true,
+		},
+		"multiple tiers": {
+			Value: "partner=100:200, 10.0.0.1=0.5:1",
+			Expected: map[string]rate_limiter.Settings{
+				"partner":  {Rate: 100, Burst: 200},
+				"10.0.0.1": {Rate: 0.5, Burst: 1},
+			},
+			Valid: true,
+		},
+		"ipv6 key": {
+			Value: "::1=1:2",
+			Expected: map[string]rate_limiter.Settings{
+				"::1": {Rate: 1, Burst: 2},
+			},
+			Valid: true,
+		},
+		"missing key": {
+			Value: "=1:2",
+			Valid: false,
+		},
+		"missing burst": {
+			Value: "partner=100",
+			Valid: false,
+		},
+		"invalid rate": {
+			Value: "partner=fast:2",
+			Valid: false,
+		},
+		"zero burst": {
+			Value: "partner=1:0",
+			Valid: false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tiers, err := parseRateLimitTiers(test.Value)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if len(tiers) != len(test.Expected) {
+				t.Fatalf("want %d tiers; got %d", len(test.Expected), len(tiers))
+			}
+			for key, expected := range test.Expected {
+				if got := tiers[key]; got.Rate != expected.Rate || got.Burst != expected.Burst {
+					t.Fatalf("want %v for %s; got %v", expected, key, got)
+				}
+			}
+		})
+	}
+}
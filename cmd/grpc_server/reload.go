@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/canbo-x/dog-ceo/auth"
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/image_cache"
+	"github.com/canbo-x/dog-ceo/proto/admin"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// reloadResult holds the changed settings of a reload.
+type reloadResult struct {
+	// Applied are the changed settings which are applied without a restart.
+	Applied []string
+
+	// RestartRequired are the changed settings which are applied after the next restart.
+	RestartRequired []string
+}
+
+// reloader reloads the configuration file and applies the changed settings to the running components.
+// The settings which can not be changed at runtime keep their running values until the next restart.
+type reloader struct {
+	// Mutex is used for handling the concurrent reloads
+	mu sync.Mutex
+
+	// path is the configuration file, it is empty if the server was started without one.
+	path string
+
+	// lookupEnv and flags are used to apply the environment variables and the flags over the file like at the start.
+	lookupEnv func(string) (string, bool)
+	flags     *flag.FlagSet
+
+	// current is the running configuration.
+	current config
+
+	logger *logrus.Logger
+
+	// The components are optional, their settings are restart required if they are nil.
+	limit  *rateLimit
+	source *data_service.HttpDataSource
+	cache  *image_cache.Cache
+}
+
+// newReloader returns a new reloader of the given configuration file and the running components.
+// The environment variables and the command line flags override the reloaded file.
+func newReloader(path string, current config, logger *logrus.Logger, limit *rateLimit, source *data_service.HttpDataSource, cache *image_cache.Cache) *reloader {
+	return &reloader{
+		path:      path,
+		lookupEnv: os.LookupEnv,
+		flags:     flag.CommandLine,
+		current:   current,
+		logger:    logger,
+		limit:     limit,
+		source:    source,
+		cache:     cache,
+	}
+}
+
+// reload loads and validates the configuration file and applies the changed settings.
+// If the configuration is not valid, nothing is applied and the running configuration is kept.
+// The requests in flight are not dropped, they complete with the settings they started with.
+func (r *reloader) reload() (reloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path == "" {
+		return reloadResult{}, errors.New("server was started without a configuration file")
+	}
+
+	loaded, err := loadConfig(r.path, r.lookupEnv, r.flags)
+	if err != nil {
+		return reloadResult{}, err
+	}
+	if err := loaded.validate(); err != nil {
+		return reloadResult{}, err
+	}
+
+	var result reloadResult
+	for _, path := range changedSettings(r.current, loaded) {
+		if r.reloadable(path, loaded) {
+			result.Applied = append(result.Applied, path)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, path)
+		}
+	}
+
+	next := r.current
+	copySettings(&next, loaded, result.Applied)
+	if err := r.apply(next); err != nil {
+		return reloadResult{}, err
+	}
+	r.current = next
+
+	r.logResult(result)
+	return result, nil
+}
+
+// reloadable returns true if the setting of the given path can be changed without a restart.
+func (r *reloader) reloadable(path string, loaded config) bool {
+	switch path {
+	case "logging.level", "logging.format":
+		return true
+	case "rate_limit.rate", "rate_limit.burst", "rate_limit.max_keys", "rate_limit.idle", "rate_limit.tiers":
+		return r.limit != nil && r.limit.update != nil
+	case "upstream.max_attempts", "upstream.backoff_base", "upstream.backoff_max", "upstream.backoff_jitter",
+		"upstream.retry_status", "upstream.rate_limit", "upstream.rate_limit_burst", "upstream.max_concurrent":
+		return r.source != nil
+	case "cache.size_mb":
+		// the cache can not be enabled or disabled at runtime
+		return r.cache != nil && loaded.Cache.SizeMB > 0
+	case "cache.ttl", "cache.disk_size_mb":
+		return r.cache != nil
+	}
+	return false
+}
+
+// apply sets the reloadable settings of the given configuration on the running components.
+// Every setting is parsed and checked before anything is changed, so a failed apply changes nothing.
+func (r *reloader) apply(c config) error {
+	rateLimitSettings, err := c.RateLimit.settings()
+	if err != nil {
+		return err
+	}
+	retryPolicy, err := c.Upstream.retryPolicy()
+	if err != nil {
+		return err
+	}
+	// the log level and format are set on a new logger first, they are copied when everything is checked
+	checked := logrus.New()
+	if err := checkAndSetLogLevel(checked, c.Logging.Level); err != nil {
+		return err
+	}
+	if err := setLogFormat(checked, c.Logging.Format); err != nil {
+		return err
+	}
+
+	// the cache is updated first, it changes nothing if it fails
+	if r.cache != nil {
+		if err := r.cache.Update(c.Cache.settings()); err != nil {
+			return fmt.Errorf("failed to update the image cache : %v", err)
+		}
+	}
+	r.logger.SetLevel(checked.GetLevel())
+	r.logger.SetFormatter(checked.Formatter)
+	if r.limit != nil && r.limit.update != nil {
+		r.limit.update(rateLimitSettings)
+	}
+	if r.source != nil {
+		r.source.SetRetryPolicy(retryPolicy)
+		r.source.SetOutboundLimit(c.Upstream.outboundLimit())
+	}
+	return nil
+}
+
+// logResult logs the applied and the restart required settings of a reload.
+func (r *reloader) logResult(result reloadResult) {
+	if len(result.Applied) == 0 && len(result.RestartRequired) == 0 {
+		r.logger.Info("Configuration is reloaded, nothing is changed")
+		return
+	}
+	if len(result.Applied) > 0 {
+		r.logger.Infof("Configuration is reloaded, applied settings : %v", result.Applied)
+	}
+	if len(result.RestartRequired) > 0 {
+		r.logger.Warnf("Configuration is reloaded, these settings require a restart : %v", result.RestartRequired)
+	}
+}
+
+// Implement the admin server.
+type adminServer struct {
+	admin.UnimplementedAdminServiceServer
+
+	reloader *reloader
+
+	// principals are the keys of the authenticated clients which can call the admin service, e.g. "api-key:ops".
+	principals map[string]bool
+}
+
+// newAdminServer returns a new adminServer which reloads with the given reloader
+// and serves only the given comma separated principals.
+func newAdminServer(reloader *reloader, principals string) (*adminServer, error) {
+	parsed, err := parsePrincipals(principals)
+	if err != nil {
+		return nil, err
+	}
+	return &adminServer{reloader: reloader, principals: parsed}, nil
+}
+
+// parsePrincipals returns the set of the given comma separated principals.
+// Every principal is given with its authentication method, so a token subject can not act as an API key.
+// Example: "api-key:ops,jwt:alice"
+func parsePrincipals(value string) (map[string]bool, error) {
+	principals := make(map[string]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		method, name, ok := strings.Cut(field, ":")
+		if !ok || (method != auth.MethodAPIKey && method != auth.MethodJWT) || name == "" {
+			return nil, fmt.Errorf("principal must be api-key:<name> or jwt:<subject> : %v", field)
+		}
+		principals[field] = true
+	}
+	return principals, nil
+}
+
+// authorize returns an error if the request is not made by an admin principal.
+// Both the method and the name of the principal must match.
+func (as *adminServer) authorize(ctx context.Context) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok || !as.principals[p.Key()] {
+		return status.Error(codes.PermissionDenied, "admin service requires an admin principal")
+	}
+	return nil
+}
+
+// ReloadConfig reloads the configuration file and returns the applied and the restart required settings.
+// Only the admin principals can reload the configuration.
+func (as *adminServer) ReloadConfig(ctx context.Context, _ *admin.ReloadConfigRequest) (*admin.ReloadConfigResponse, error) {
+	logger := ctxlogrus.Extract(ctx)
+	if err := as.authorize(ctx); err != nil {
+		logger.Warn("Rejected a request to reload the configuration from a client which is not an admin")
+		return nil, err
+	}
+	logger.Info("Received a request to reload the configuration")
+
+	result, err := as.reloader.reload()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to reload the configuration, the running one is kept")
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to reload the configuration : %v", err)
+	}
+	return &admin.ReloadConfigResponse{Applied: result.Applied, RestartRequired: result.RestartRequired}, nil
+}
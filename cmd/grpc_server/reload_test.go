@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/auth"
+	"github.com/canbo-x/dog-ceo/data_service"
+	"github.com/canbo-x/dog-ceo/proto/admin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestReloader returns a reloader of the given configuration file with the components of the given configuration.
+func newTestReloader(t *testing.T, path string, current config) *reloader {
+	logger := logrus.New()
+	rateLimitSettings, err := current.RateLimit.settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit, err := newRateLimit(rateLimitSettings, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(limit.stop)
+
+	cache, err := newImageCache(current.Cache.SizeMB, time.Duration(current.Cache.TTL), current.Cache.Dir, current.Cache.DiskSizeMB, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := data_service.NewHttpDataSource(http.DefaultClient, "http://localhost")
+
+	r := newReloader(path, current, logger, limit, source, cache)
+	r.lookupEnv = mapEnv(nil)
+	r.flags = parseFlags(t)
+	return r
+}
+
+func TestReload(t *testing.T) {
+	tests := map[string]struct {
+		Initial         func(c *config)
+		Content         string
+		Applied         []string
+		RestartRequired []string
+		Valid           bool
+	}{
+		"nothing changed": {
+			Content: "",
+			Valid:   true,
+		},
+		"reloadable settings": {
+			Content: "logging:\n  level: debug\nrate_limit:\n  rate: 50\n  burst: 20\nupstream:\n  max_attempts: 5\n  max_concurrent: 4\ncache:\n  size_mb: 32\n  ttl: 10m\n",
+			Applied: []string{
+				"logging.level", "rate_limit.rate", "rate_limit.burst",
+				"upstream.max_attempts", "upstream.max_concurrent", "cache.size_mb", "cache.ttl",
+			},
+			Valid: true,
+		},
+		"restart required settings": {
+			Content:         "listener:\n  port: 8080\nlogging:\n  format: json\nupstream:\n  url: http://localhost:8081/api\n",
+			Applied:         []string{"logging.format"},
+			RestartRequired: []string{"listener.port", "upstream.url"},
+			Valid:           true,
+		},
+		"rate limit of the dummy limiter": {
+			Initial:         func(c *config) { c.RateLimit.Limiter = rateLimiterDummy },
+			Content:         "rate_limit:\n  limiter: dummy\n  rate: 50\n",
+			RestartRequired: []string{"rate_limit.rate"},
+			Valid:           true,
+		},
+		"disabled cache": {
+			Initial:         func(c *config) { c.Cache.SizeMB = 0 },
+			Content:         "cache:\n  size_mb: 32\n",
+			RestartRequired: []string{"cache.size_mb"},
+			Valid:           true,
+		},
+		"disabling the cache": {
+			Content:         "cache:\n  size_mb: 0\n  ttl: 10m\n",
+			Applied:         []string{"cache.ttl"},
+			RestartRequired: []string{"cache.size_mb"},
+			Valid:           true,
+		},
+		"invalid configuration": {
+			Content: "logging:\n  level: debug\nupstream:\n  max_attempts: 0\n",
+			Valid:   false,
+		},
+		"unknown setting": {
+			Content: "logging:\n  levle: debug\n",
+			Valid:   false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			initial := defaultConfig()
+			if test.Initial != nil {
+				test.Initial(&initial)
+			}
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := ioutil.WriteFile(path, []byte(test.Content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			r := newTestReloader(t, path, initial)
+			result, err := r.reload()
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				if !reflect.DeepEqual(r.current, initial) {
+					t.Errorf("running config supposed to be kept %+v", r.current)
+				}
+				if r.logger.GetLevel() != logrus.InfoLevel {
+					t.Errorf("log level supposed to be kept; got %v", r.logger.GetLevel())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+
+			if !reflect.DeepEqual(result.Applied, test.Applied) {
+				t.Errorf("applied = %v; want %v", result.Applied, test.Applied)
+			}
+			if !reflect.DeepEqual(result.RestartRequired, test.RestartRequired) {
+				t.Errorf("restart required = %v; want %v", result.RestartRequired, test.RestartRequired)
+			}
+
+			// only the applied settings are running, so the restart required ones are reported again
+			again, err := r.reload()
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if len(again.Applied) != 0 || !reflect.DeepEqual(again.RestartRequired, test.RestartRequired) {
+				t.Errorf("second reload = %+v; want only %v restart required", again, test.RestartRequired)
+			}
+		})
+	}
+}
+
+func TestReloadAppliesSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "logging:\n  level: debug\n  format: json\ncache:\n  size_mb: 1\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestReloader(t, path, defaultConfig())
+	r.cache.Set("https://images.dog.ceo/breeds/hound/1.jpg", make([]byte, 800<<10))
+	r.cache.Set("https://images.dog.ceo/breeds/hound/2.jpg", make([]byte, 800<<10))
+
+	if _, err := r.reload(); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	if r.logger.GetLevel() != logrus.DebugLevel {
+		t.Errorf("log level = %v; want debug", r.logger.GetLevel())
+	}
+	if _, ok := r.logger.Formatter.(*logrus.JSONFormatter); !ok {
+		t.Errorf("log format = %T; want json", r.logger.Formatter)
+	}
+	if stats := r.cache.Stats(); stats.Entries != 1 || stats.Evictions != 1 {
+		t.Errorf("cache supposed to be resized to 1 MB %+v", stats)
+	}
+	if r.current.Cache.SizeMB != 1 || r.current.Logging.Level != "debug" {
+		t.Errorf("running config supposed to be updated %+v", r.current)
+	}
+}
+
+func TestReloadFailedApply(t *testing.T) {
+	tests := map[string]struct {
+		Change func(c *config)
+	}{
+		"unknown log format": {
+			Change: func(c *config) { c.Logging.Format = "xml" },
+		},
+		"cache directory": {
+			Change: func(c *config) { c.Cache.Dir = t.TempDir() },
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r := newTestReloader(t, "", defaultConfig())
+			r.cache.Set("https://images.dog.ceo/breeds/hound/1.jpg", make([]byte, 800<<10))
+			r.cache.Set("https://images.dog.ceo/breeds/hound/2.jpg", make([]byte, 800<<10))
+
+			next := r.current
+			next.Logging.Level = "debug"
+			next.Cache.SizeMB = 1
+			test.Change(&next)
+			if err := r.apply(next); err == nil {
+				t.Fatalf("error supposed to be returned")
+			}
+
+			// nothing supposed to be changed by a failed apply
+			if r.logger.GetLevel() != logrus.InfoLevel {
+				t.Errorf("log level supposed to be kept; got %v", r.logger.GetLevel())
+			}
+			if stats := r.cache.Stats(); stats.Entries != 2 {
+				t.Errorf("cache size supposed to be kept %+v", stats)
+			}
+		})
+	}
+}
+
+func TestReloadWithoutConfigFile(t *testing.T) {
+	r := newTestReloader(t, "", defaultConfig())
+	if _, err := r.reload(); err == nil {
+		t.Fatalf("error supposed to be returned")
+	}
+}
+
+func TestAdminReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("listener:\n  port: 8080\nrate_limit:\n  rate: 50\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		Path      string
+		Principal *auth.Principal
+		Expected  *admin.ReloadConfigResponse
+		Code      codes.Code
+	}{
+		"reloaded": {
+			Path:      path,
+			Principal: &auth.Principal{Name: "ops", Method: auth.MethodAPIKey},
+			Expected:  &admin.ReloadConfigResponse{Applied: []string{"rate_limit.rate"}, RestartRequired: []string{"listener.port"}},
+			Code:      codes.OK,
+		},
+		"no config file": {
+			Path:      "",
+			Principal: &auth.Principal{Name: "ops", Method: auth.MethodAPIKey},
+			Code:      codes.FailedPrecondition,
+		},
+		"not an admin": {
+			Path:      path,
+			Principal: &auth.Principal{Name: "mobile", Method: auth.MethodAPIKey},
+			Code:      codes.PermissionDenied,
+		},
+		"token with the name of an admin api key": {
+			Path:      path,
+			Principal: &auth.Principal{Name: "ops", Method: auth.MethodJWT},
+			Code:      codes.PermissionDenied,
+		},
+		"not authenticated": {
+			Path: path,
+			Code: codes.PermissionDenied,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			listener := bufconn.Listen(1024 * 1024)
+			// the principal is set like the auth interceptor of the server does
+			server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if test.Principal != nil {
+					ctx = auth.NewContext(ctx, *test.Principal)
+				}
+				return handler(ctx, req)
+			}))
+			adminService, err := newAdminServer(newTestReloader(t, test.Path, defaultConfig()), "api-key:ops, jwt:alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			admin.RegisterAdminServiceServer(server, adminService)
+			go server.Serve(listener)
+			defer server.Stop()
+
+			conn, err := grpc.Dial("bufnet",
+				grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			resp, err := admin.NewAdminServiceClient(conn).ReloadConfig(context.Background(), &admin.ReloadConfigRequest{})
+			if status.Code(err) != test.Code {
+				t.Fatalf("want %v; got %v", test.Code, err)
+			}
+			if test.Code != codes.OK {
+				return
+			}
+			if !reflect.DeepEqual(resp.Applied, test.Expected.Applied) || !reflect.DeepEqual(resp.RestartRequired, test.Expected.RestartRequired) {
+				t.Errorf("response = %v; want %v", resp, test.Expected)
+			}
+		})
+	}
+}
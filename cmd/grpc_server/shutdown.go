@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/stats"
+)
+
+// shutdownSettings holds the settings of the shutdown of the server.
+type shutdownSettings struct {
+	// Drain is the wait after the health status is NOT_SERVING,
+	// so the load balancers stop sending new requests before the server stops accepting them.
+	Drain time.Duration
+
+	// Timeout is the maximum wait for the requests in flight, the remaining ones are aborted after it.
+	Timeout time.Duration
+
+	// SkipDrain is set when the server failed to serve, so there are no new requests to drain.
+	SkipDrain bool
+}
+
+// grpcStopper is the part of the gRPC server which is used to stop it.
+type grpcStopper interface {
+	GracefulStop()
+	Stop()
+}
+
+// inFlightRequests counts the requests in flight by their methods,
+// so the requests aborted by the shutdown can be reported.
+// It also counts the live connections as a stats handler of the server, so the drain is skipped without them.
+type inFlightRequests struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the counts
+	mu sync.Mutex
+
+	methods     map[string]int
+	connections int
+}
+
+// newInFlightRequests returns a new inFlightRequests without any request.
+func newInFlightRequests() *inFlightRequests {
+	return &inFlightRequests{methods: make(map[string]int)}
+}
+
+// unary counts the unary request until its handler returns.
+func (r *inFlightRequests) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	r.add(info.FullMethod)
+	defer r.done(info.FullMethod)
+	return handler(ctx, req)
+}
+
+// stream counts the stream until its handler returns.
+func (r *inFlightRequests) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	r.add(info.FullMethod)
+	defer r.done(info.FullMethod)
+	return handler(srv, ss)
+}
+
+// add counts a started request of the given method.
+func (r *inFlightRequests) add(method string) {
+	r.mu.Lock()
+	r.methods[method]++
+	r.mu.Unlock()
+}
+
+// done counts a completed request of the given method.
+func (r *inFlightRequests) done(method string) {
+	r.mu.Lock()
+	r.methods[method]--
+	if r.methods[method] == 0 {
+		delete(r.methods, method)
+	}
+	r.mu.Unlock()
+}
+
+// TagRPC returns the given context, the requests are counted by the interceptors.
+func (r *inFlightRequests) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+// HandleRPC does nothing.
+func (r *inFlightRequests) HandleRPC(context.Context, stats.RPCStats) {}
+
+// TagConn returns the given context.
+func (r *inFlightRequests) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn counts the opened and the closed connections.
+func (r *inFlightRequests) HandleConn(_ context.Context, s stats.ConnStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch s.(type) {
+	case *stats.ConnBegin:
+		r.connections++
+	case *stats.ConnEnd:
+		r.connections--
+	}
+}
+
+// liveConnections returns the number of the open connections.
+func (r *inFlightRequests) liveConnections() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.connections
+}
+
+// snapshot returns the number of the requests in flight by their methods.
+func (r *inFlightRequests) snapshot() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	methods := make(map[string]int, len(r.methods))
+	for method, count := range r.methods {
+		methods[method] = count
+	}
+	return methods
+}
+
+// shutdownServer stops the server in order.
+// It reports NOT_SERVING for every service first and waits for the drain period,
+// unless the server failed to serve or there are no live connections, then it stops accepting new requests and waits for the requests in flight until the timeout.
+// The requests still in flight after the timeout are aborted and logged.
+// It returns true if all the requests in flight were completed.
+func shutdownServer(server grpcStopper, healthServer *health.Server, requests *inFlightRequests, settings shutdownSettings, logger *logrus.Logger) bool {
+	// the health status does not change after it, so the prober can not report SERVING again
+	healthServer.Shutdown()
+	switch {
+	case settings.Drain <= 0:
+	case settings.SkipDrain:
+		logger.Info("Health status is NOT_SERVING, skipping the drain because the server failed to serve")
+	case requests.liveConnections() == 0:
+		logger.Info("Health status is NOT_SERVING, skipping the drain because there are no connections")
+	default:
+		logger.Infof("Health status is NOT_SERVING, draining for %v", settings.Drain)
+		time.Sleep(settings.Drain)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(settings.Timeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+		logger.Info("All the requests in flight are completed")
+		return true
+	case <-timer.C:
+	}
+
+	aborted := requests.snapshot()
+	logger.Warnf("Requests in flight are not completed in %v, %d requests are aborted : %s",
+		settings.Timeout, countRequests(aborted), formatRequests(aborted))
+	server.Stop()
+	<-stopped
+	return false
+}
+
+// countRequests returns the total number of the given requests.
+func countRequests(methods map[string]int) int {
+	total := 0
+	for _, count := range methods {
+		total += count
+	}
+	return total
+}
+
+// formatRequests returns the number of the requests by their methods as a human readable text.
+// Example: /breed_image.BreedImageService/Search=1, /breed_image.BreedImageService/StreamSearch=2
+func formatRequests(methods map[string]int) string {
+	names := make([]string, 0, len(methods))
+	for method := range methods {
+		names = append(names, method)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, method := range names {
+		parts = append(parts, fmt.Sprintf("%s=%d", method, methods[method]))
+	}
+	return strings.Join(parts, ", ")
+}
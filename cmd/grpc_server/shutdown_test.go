@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/sirupsen/logrus"
+	logrus_test "github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newShutdownTestServer returns a running server with a health service whose requests are counted
+// and a client connection to it.
+func newShutdownTestServer(t *testing.T) (*grpc.Server, *health.Server, *inFlightRequests, grpc_health_v1.HealthClient) {
+	requests := newInFlightRequests()
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc_middleware.WithUnaryServerChain(requests.unary),
+		grpc_middleware.WithStreamServerChain(requests.stream),
+		grpc.StatsHandler(requests),
+	)
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return server, healthServer, requests, grpc_health_v1.NewHealthClient(conn)
+}
+
+func TestInFlightRequests(t *testing.T) {
+	requests := newInFlightRequests()
+	info := &grpc.UnaryServerInfo{FullMethod: "/breed_image.BreedImageService/Search"}
+
+	var during map[string]int
+	requests.unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		during = requests.snapshot()
+		return nil, nil
+	})
+
+	if expected := map[string]int{info.FullMethod: 1}; !reflect.DeepEqual(during, expected) {
+		t.Errorf("requests during the handler = %v; want %v", during, expected)
+	}
+	if after := requests.snapshot(); len(after) != 0 {
+		t.Errorf("requests after the handler = %v; want none", after)
+	}
+}
+
+func TestShutdownServer(t *testing.T) {
+	tests := map[string]struct {
+		// Connect opens a connection to the server with a health check.
+		Connect bool
+
+		// Watch opens a health watch stream, it is never completed by the server.
+		Watch     bool
+		SkipDrain bool
+		Drained   bool
+		Completed bool
+	}{
+		"no connections": {
+			Drained:   false,
+			Completed: true,
+		},
+		"no requests in flight": {
+			Connect:   true,
+			Drained:   true,
+			Completed: true,
+		},
+		"slow stream is aborted": {
+			Watch:     true,
+			Drained:   true,
+			Completed: false,
+		},
+		"serve error": {
+			Connect:   true,
+			SkipDrain: true,
+			Drained:   false,
+			Completed: true,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			server, healthServer, requests, client := newShutdownTestServer(t)
+			logger, hook := logrus_test.NewNullLogger()
+
+			if test.Connect {
+				if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var watch grpc_health_v1.Health_WatchClient
+			if test.Watch {
+				var err error
+				watch, err = client.Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp, err := watch.Recv(); err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+					t.Fatalf("want SERVING before the shutdown; got %v %v", resp, err)
+				}
+			}
+
+			settings := shutdownSettings{Drain: time.Millisecond * 50, Timeout: time.Millisecond * 100, SkipDrain: test.SkipDrain}
+			start := time.Now()
+			completed := shutdownServer(server, healthServer, requests, settings, logger)
+			if completed != test.Completed {
+				t.Fatalf("completed = %v; want %v", completed, test.Completed)
+			}
+			if elapsed := time.Since(start); test.Drained && elapsed < settings.Drain {
+				t.Errorf("shutdown supposed to wait for the drain; it took %v", elapsed)
+			}
+			var drained bool
+			for _, e := range hook.AllEntries() {
+				if strings.Contains(e.Message, "draining for") {
+					drained = true
+				}
+			}
+			if drained != test.Drained {
+				t.Errorf("drained = %v; want %v", drained, test.Drained)
+			}
+
+			resp, err := healthServer.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+			if err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+				t.Errorf("want NOT_SERVING after the shutdown; got %v %v", resp, err)
+			}
+
+			if !test.Watch {
+				return
+			}
+			// the watcher is told about the drain before the stream is aborted
+			if resp, err := watch.Recv(); err != nil || resp.Status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+				t.Errorf("want NOT_SERVING while draining; got %v %v", resp, err)
+			}
+			if _, err := watch.Recv(); err == nil {
+				t.Errorf("stream supposed to be aborted")
+			}
+
+			var logged bool
+			for _, e := range hook.AllEntries() {
+				if e.Level == logrus.WarnLevel && strings.Contains(e.Message, "1 requests are aborted : /grpc.health.v1.Health/Watch=1") {
+					logged = true
+				}
+			}
+			if !logged {
+				t.Errorf("aborted requests are not logged")
+			}
+		})
+	}
+}
+
+func TestLiveConnections(t *testing.T) {
+	requests := newInFlightRequests()
+	requests.HandleConn(context.Background(), &stats.ConnBegin{})
+	requests.HandleConn(context.Background(), &stats.ConnBegin{})
+	requests.HandleConn(context.Background(), &stats.ConnEnd{})
+
+	if got := requests.liveConnections(); got != 1 {
+		t.Errorf("liveConnections = %d; want 1", got)
+	}
+}
+
+func TestFormatRequests(t *testing.T) {
+	methods := map[string]int{
+		"/breed_image.BreedImageService/StreamSearch": 2,
+		"/breed_image.BreedImageService/Search":       1,
+	}
+	expected := "/breed_image.BreedImageService/Search=1, /breed_image.BreedImageService/StreamSearch=2"
+	if got := formatRequests(methods); got != expected {
+		t.Errorf("formatRequests = %q; want %q", got, expected)
+	}
+	if got := countRequests(methods); got != 3 {
+		t.Errorf("countRequests = %d; want 3", got)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/tls_config"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// tlsSettings holds the TLS settings of the server.
+type tlsSettings struct {
+	Files tls_config.Files
+
+	// ClientAuth requires the clients to send a certificate signed by the certificate authorities of the CA file.
+	ClientAuth bool
+
+	// ReloadInterval is the interval the certificate files are checked for changes. Zero disables the reloading.
+	ReloadInterval time.Duration
+}
+
+// newServerCredentials creates the TLS credentials of the server and starts watching the certificate files.
+// If there is no certificate file, it returns a nil reloader and the server accepts plaintext connections.
+func newServerCredentials(settings tlsSettings, logger *logrus.Logger) (grpc.ServerOption, *tls_config.Reloader, error) {
+	if settings.Files.CertFile == "" && settings.Files.KeyFile == "" {
+		if settings.ClientAuth || settings.Files.CAFile != "" {
+			return nil, nil, errors.New("client certificate verification requires the certificate and key files")
+		}
+		logger.Info("TLS is disabled")
+		return nil, nil, nil
+	}
+
+	reloader, err := tls_config.NewReloader(settings.Files)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := reloader.ServerConfig(settings.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if settings.ReloadInterval > 0 {
+		reloader.StartWatcher(settings.ReloadInterval,
+			func() { logger.Info("TLS certificates are reloaded") },
+			func(err error) {
+				logger.Warnf("Failed to reload the TLS certificates, the previous ones are kept : %v", err)
+			},
+		)
+	}
+
+	if settings.ClientAuth {
+		logger.Info("TLS is enabled, client certificates are required")
+	} else {
+		logger.Info("TLS is enabled")
+	}
+	return grpc.Creds(credentials.NewTLS(cfg)), reloader, nil
+}
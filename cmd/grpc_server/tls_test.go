@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/canbo-x/dog-ceo/tls_config"
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewServerCredentials(t *testing.T) {
+	tests := map[string]struct {
+		Settings tlsSettings
+		Enabled  bool
+		Valid    bool
+	}{
+		"disabled": {
+			Settings: tlsSettings{},
+			Enabled:  false,
+			Valid:    true,
+		},
+		"client auth without certificate": {
+			Settings: tlsSettings{ClientAuth: true},
+			Valid:    false,
+		},
+		"CA file without certificate": {
+			Settings: tlsSettings{Files: tls_config.Files{CAFile: "ca.pem"}},
+			Valid:    false,
+		},
+		"certificate without key": {
+			Settings: tlsSettings{Files: tls_config.Files{CertFile: "server.pem"}},
+			Valid:    false,
+		},
+		"missing files": {
+			Settings: tlsSettings{Files: tls_config.Files{CertFile: "server.pem", KeyFile: "server-key.pem"}},
+			Valid:    false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			creds, reloader, err := newServerCredentials(test.Settings, logrus.New())
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if (creds != nil) != test.Enabled || (reloader != nil) != test.Enabled {
+				t.Errorf("credentials should be returned only if TLS is enabled")
+			}
+		})
+	}
+}
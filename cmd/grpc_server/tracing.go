@@ -0,0 +1,46 @@
+package main
+
+import (
+	"time"
+
+	"github.com/canbo-x/dog-ceo/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// traceServiceName is the service name of the spans of the server.
+const traceServiceName = "grpc_server"
+
+// traceShutdownTimeout is the time the tracer provider is given to export the remaining spans when the server stops.
+const traceShutdownTimeout = time.Second * 5
+
+// newTracerProvider creates the tracer provider of the server with the given settings and sets it as the global provider.
+// If the exporter is none, the spans are not exported, but the trace context of the clients is still propagated.
+func newTracerProvider(settings tracing.Settings, logger *logrus.Logger) (*sdktrace.TracerProvider, error) {
+	settings.ServiceName = traceServiceName
+	tp, err := tracing.NewProvider(settings)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(tp)
+
+	switch settings.Exporter {
+	case tracing.ExporterNone:
+		logger.Info("Trace exporter is disabled")
+	case tracing.ExporterOTLP:
+		logger.Infof("Traces are exported to %s with %v sample ratio", settings.Endpoint, settings.SampleRatio)
+	case tracing.ExporterFile:
+		logger.Infof("Traces are written to %s with %v sample ratio", settings.File, settings.SampleRatio)
+	default:
+		logger.Infof("Traces are written to the %s exporter with %v sample ratio", settings.Exporter, settings.SampleRatio)
+	}
+	return tp, nil
+}
+
+// shutdownTracerProvider exports the remaining spans and stops the tracer provider.
+func shutdownTracerProvider(tp *sdktrace.TracerProvider, logger *logrus.Logger) {
+	if err := tracing.Shutdown(tp, traceShutdownTimeout); err != nil {
+		logger.Warnf("Failed to stop the tracer provider : %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package data_service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/canbo-x/dog-ceo/circuit_breaker"
+)
+
+// BreakerDataSource is a DataSource which puts a circuit breaker in front of another DataSource.
+// While the breaker is open, every call fails immediately with circuit_breaker.ErrOpen.
+type BreakerDataSource struct {
+	source  DataSource
+	breaker *circuit_breaker.Breaker
+}
+
+// BreakerDataSource must implement the DataSource interface.
+var _ DataSource = (*BreakerDataSource)(nil)
+
+// NewBreakerDataSource returns a new BreakerDataSource which guards the given source with the given breaker.
+func NewBreakerDataSource(source DataSource, breaker *circuit_breaker.Breaker) *BreakerDataSource {
+	return &BreakerDataSource{
+		source:  source,
+		breaker: breaker,
+	}
+}
+
+// GetRandomImageURL returns the image URL as a string and an error if any.
+func (ds *BreakerDataSource) GetRandomImageURL(ctx context.Context, breed, subBreed string) (string, int, error) {
+	done, err := ds.breaker.Allow()
+	if err != nil {
+		return "", http.StatusServiceUnavailable, err
+	}
+	imageURL, statusCode, err := ds.source.GetRandomImageURL(ctx, breed, subBreed)
+	done(breakerResult(ctx, statusCode, err))
+	return imageURL, statusCode, err
+}
+
+// GetRandomImageURLs returns up to the given number of image URLs as a string slice and an error if any.
+func (ds *BreakerDataSource) GetRandomImageURLs(ctx context.Context, breed, subBreed string, count int) ([]string, int, error) {
+	done, err := ds.breaker.Allow()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	imageURLs, statusCode, err := ds.source.GetRandomImageURLs(ctx, breed, subBreed, count)
+	done(breakerResult(ctx, statusCode, err))
+	return imageURLs, statusCode, err
+}
+
+// GetImage returns the image as a byte array and an error if any.
+func (ds *BreakerDataSource) GetImage(ctx context.Context, imageURL string) ([]byte, int, error) {
+	done, err := ds.breaker.Allow()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	image, statusCode, err := ds.source.GetImage(ctx, imageURL)
+	done(breakerResult(ctx, statusCode, err))
+	return image, statusCode, err
+}
+
+// OpenImage returns the image stream, status code as an integer and an error if any.
+// Only opening the image is reported to the breaker, reading the body is not.
+func (ds *BreakerDataSource) OpenImage(ctx context.Context, imageURL string) (*ImageStream, int, error) {
+	done, err := ds.breaker.Allow()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	stream, statusCode, err := ds.source.OpenImage(ctx, imageURL)
+	done(breakerResult(ctx, statusCode, err))
+	return stream, statusCode, err
+}
+
+// ListBreeds returns all the breeds with their sub-breeds, status code as an integer and an error if any.
+func (ds *BreakerDataSource) ListBreeds(ctx context.Context) (map[string][]string, int, error) {
+	done, err := ds.breaker.Allow()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	breeds, statusCode, err := ds.source.ListBreeds(ctx)
+	done(breakerResult(ctx, statusCode, err))
+	return breeds, statusCode, err
+}
+
+// ListSubBreeds returns the sub-breeds of the given breed, status code as an integer and an error if any.
+func (ds *BreakerDataSource) ListSubBreeds(ctx context.Context, breed string) ([]string, int, error) {
+	done, err := ds.breaker.Allow()
+	if err != nil {
+		return nil, http.StatusServiceUnavailable, err
+	}
+	subBreeds, statusCode, err := ds.source.ListSubBreeds(ctx, breed)
+	done(breakerResult(ctx, statusCode, err))
+	return subBreeds, statusCode, err
+}
+
+// breakerResult returns the result of an upstream call for the breaker.
+// Transport errors and 5xx responses are failures, the other responses such as 404 are successes.
+// If the caller gave up on the request, the result is ignored because it says nothing about the upstream.
+func breakerResult(ctx context.Context, statusCode int, err error) circuit_breaker.Result {
+	if ctx.Err() != nil {
+		return circuit_breaker.Ignored
+	}
+	if err != nil || statusCode >= http.StatusInternalServerError {
+		return circuit_breaker.Failure
+	}
+	return circuit_breaker.Success
+}
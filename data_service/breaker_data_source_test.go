@@ -0,0 +1,124 @@
+package data_service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/circuit_breaker"
+	"github.com/canbo-x/dog-ceo/fakedogceo"
+)
+
+func TestBreakerDataSourceOpens(t *testing.T) {
+	var hits int32
+	fake := fakedogceo.New(fakedogceo.Options{ErrorRate: 1})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	breaker := circuit_breaker.NewBreaker(circuit_breaker.Settings{FailureThreshold: 2, CoolDown: time.Minute})
+	ds := NewBreakerDataSource(NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath), breaker)
+
+	for i := 0; i < 2; i++ {
+		_, statusCode, err := ds.GetRandomImageURL(context.Background(), "husky", "")
+		if err != nil || statusCode != http.StatusInternalServerError {
+			t.Fatalf("want status code %d and no error; got %d %v", http.StatusInternalServerError, statusCode, err)
+		}
+	}
+
+	if breaker.State() != circuit_breaker.Open {
+		t.Fatalf("breaker supposed to be open but it is %v", breaker.State())
+	}
+
+	calls := map[string]func() error{
+		"GetRandomImageURL": func() error {
+			_, _, err := ds.GetRandomImageURL(context.Background(), "husky", "")
+			return err
+		},
+		"GetRandomImageURLs": func() error {
+			_, _, err := ds.GetRandomImageURLs(context.Background(), "husky", "", 3)
+			return err
+		},
+		"GetImage": func() error {
+			_, _, err := ds.GetImage(context.Background(), ts.URL+"/breeds/husky/n02110185_12678.jpg")
+			return err
+		},
+		"OpenImage": func() error {
+			_, _, err := ds.OpenImage(context.Background(), ts.URL+"/breeds/husky/n02110185_12678.jpg")
+			return err
+		},
+		"ListBreeds": func() error {
+			_, _, err := ds.ListBreeds(context.Background())
+			return err
+		},
+		"ListSubBreeds": func() error {
+			_, _, err := ds.ListSubBreeds(context.Background(), "hound")
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, circuit_breaker.ErrOpen) {
+			t.Errorf("%s: want ErrOpen; got %v", name, err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Errorf("upstream supposed to be hit 2 times; got %d", got)
+	}
+}
+
+func TestBreakerResult(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := map[string]struct {
+		Ctx        context.Context
+		StatusCode int
+		Err        error
+		Expected   circuit_breaker.Result
+	}{
+		"ok": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusOK,
+			Expected:   circuit_breaker.Success,
+		},
+		"not found": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusNotFound,
+			Expected:   circuit_breaker.Success,
+		},
+		"server error": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusBadGateway,
+			Expected:   circuit_breaker.Failure,
+		},
+		"transport error": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusInternalServerError,
+			Err:        errors.New("connection refused"),
+			Expected:   circuit_breaker.Failure,
+		},
+		"canceled by the caller": {
+			Ctx:        canceledCtx,
+			StatusCode: http.StatusInternalServerError,
+			Err:        context.Canceled,
+			Expected:   circuit_breaker.Ignored,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := breakerResult(test.Ctx, test.StatusCode, test.Err); got != test.Expected {
+				t.Fatalf("want %v; got %v", test.Expected, got)
+			}
+		})
+	}
+}
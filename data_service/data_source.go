@@ -0,0 +1,45 @@
+package data_service
+
+import (
+	"context"
+	"io"
+)
+
+// DefaultBaseURL is the base URL of the public dog.ceo API.
+const DefaultBaseURL = "https://dog.ceo/api"
+
+// DataSource is the source of the breeds and their images.
+// Every method returns the upstream status code next to the result,
+// so the callers can tell a missing breed apart from a failing upstream.
+type DataSource interface {
+	// GetRandomImageURL returns a random image URL of the given breed and sub-breed.
+	GetRandomImageURL(ctx context.Context, breed, subBreed string) (string, int, error)
+
+	// GetRandomImageURLs returns up to the given number of random image URLs of the given breed and sub-breed.
+	GetRandomImageURLs(ctx context.Context, breed, subBreed string, count int) ([]string, int, error)
+
+	// GetImage downloads the image from the given URL.
+	GetImage(ctx context.Context, imageURL string) ([]byte, int, error)
+
+	// OpenImage opens the image from the given URL to read it as a stream.
+	// The stream is only returned with the status code 200, the caller must close its body.
+	OpenImage(ctx context.Context, imageURL string) (*ImageStream, int, error)
+
+	// ListBreeds returns all the breeds mapped to their sub-breeds.
+	ListBreeds(ctx context.Context) (map[string][]string, int, error)
+
+	// ListSubBreeds returns the sub-breeds of the given breed.
+	ListSubBreeds(ctx context.Context, breed string) ([]string, int, error)
+}
+
+// ImageStream is an image which is read directly from the upstream response.
+type ImageStream struct {
+	// Body is the image data, it must be closed by the caller.
+	Body io.ReadCloser
+
+	// ContentType is the content type of the image, e.g. "image/jpeg".
+	ContentType string
+
+	// Size is the size of the image in bytes, it is -1 if the upstream API does not tell.
+	Size int64
+}
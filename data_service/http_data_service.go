@@ -5,11 +5,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// instrumentationName is the name of the tracer of the upstream attempts.
+const instrumentationName = "github.com/canbo-x/dog-ceo/data_service"
+
 // getRandomImageAPIResponse is the response from the API.
 // You can find the response structure in the API documentation.
 // https://dog.ceo/dog-api/documentation/random
@@ -19,44 +36,361 @@ type getRandomImageAPIResponse struct {
 	Code    int    `json:"code,omitempty"`
 }
 
-// Creates a new http client with a timeout of 5 seconds.
-// I would not create a new client for every request, but in this example it should be fine.
+// getRandomImagesAPIResponse is the response from the multiple random images endpoint.
+// https://dog.ceo/dog-api/documentation/random
+type getRandomImagesAPIResponse struct {
+	Message []string `json:"message"`
+	Status  string   `json:"status"`
+	Code    int      `json:"code,omitempty"`
+}
+
+// getBreedListAPIResponse is the response from the list all breeds endpoint.
+// The message maps every breed to its sub-breeds.
+// https://dog.ceo/dog-api/documentation/
+type getBreedListAPIResponse struct {
+	Message map[string][]string `json:"message"`
+	Status  string              `json:"status"`
+	Code    int                 `json:"code,omitempty"`
+}
+
+// getSubBreedListAPIResponse is the response from the list sub-breeds endpoint.
+// https://dog.ceo/dog-api/documentation/sub-breed
+type getSubBreedListAPIResponse struct {
+	Message []string `json:"message"`
+	Status  string   `json:"status"`
+	Code    int      `json:"code,omitempty"`
+}
+
+// These are the operations which are reported to the request observer.
+// The URLs are not reported because they have an unbounded number of values.
+const (
+	OperationRandomImage  = "random_image"
+	OperationRandomImages = "random_images"
+	OperationImage        = "image"
+	OperationOpenImage    = "open_image"
+	OperationBreeds       = "breeds"
+	OperationSubBreeds    = "sub_breeds"
+)
+
+// RequestObserver is called after every upstream attempt with its operation, status code, error and duration.
+// For OpenImage, the duration is the time until the response headers are received.
+type RequestObserver func(operation string, statusCode int, err error, duration time.Duration)
+
+// ClientConfig holds the settings of the http client which is used for the upstream calls.
+type ClientConfig struct {
+	// Timeout is the time limit of a request including reading the response body.
+	Timeout time.Duration
+
+	// DialTimeout is the time limit of establishing a connection.
+	DialTimeout time.Duration
+
+	// KeepAlive is the interval of the keep-alive probes of an active connection.
+	KeepAlive time.Duration
+
+	// MaxIdleConns is the maximum number of idle connections across all hosts.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections to keep per host.
+	MaxIdleConnsPerHost int
+
+	// IdleConnTimeout is the time limit of an idle connection before it is closed.
+	IdleConnTimeout time.Duration
+
+	// TLSHandshakeTimeout is the time limit of the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+}
+
+// DefaultClientConfig returns the default http client settings.
+// The request timeout is 5 seconds.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		Timeout:             time.Second * 5,
+		DialTimeout:         time.Second * 5,
+		KeepAlive:           time.Second * 30,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     time.Second * 90,
+		TLSHandshakeTimeout: time.Second * 5,
+	}
+}
+
+// NewHttpClient creates a new http client with the default settings.
 func NewHttpClient() *http.Client {
+	return NewHttpClientWithConfig(DefaultClientConfig())
+}
+
+// NewHttpClientWithConfig creates a new http client with the given settings.
+// The client keeps the connections alive and reuses them,
+// so it should be created once and shared by all the upstream calls.
+func NewHttpClientWithConfig(cfg ClientConfig) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: cfg.KeepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
 	return &http.Client{
-		Timeout: time.Second * 5,
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+	}
+}
+
+// HttpDataSource is the DataSource implementation which uses the dog.ceo HTTP API.
+type HttpDataSource struct {
+	// client is the shared http client which is used for all the requests.
+	client *http.Client
+
+	// baseURL is the base URL of the API without the trailing slash.
+	// Example: "https://dog.ceo/api"
+	baseURL string
+
+	// Mutex is used for handling the concurrent
+	// read/write requests for the retry policy
+	mu sync.Mutex
+
+	// retryPolicy is used to retry the failed requests.
+	retryPolicy RetryPolicy
+
+	// retries is the number of retries made so far.
+	// It must be accessed atomically.
+	retries uint64
+
+	// coalesced is the number of the requests which shared the result of an in-flight request.
+	// It must be accessed atomically.
+	coalesced uint64
+
+	// flights coalesces the concurrent identical requests.
+	flights flightGroup
+
+	// limiter limits the requests to the upstream API, it has no limits by default.
+	limiter *outboundLimiter
+
+	// observer is called after every attempt, it can be nil.
+	observer RequestObserver
+
+	// tracer starts a span for every attempt.
+	tracer trace.Tracer
+
+	// logger is used to log the failed attempts.
+	logger logrus.FieldLogger
+}
+
+// Option configures an HttpDataSource.
+type Option func(*HttpDataSource)
+
+// WithRetryPolicy sets the retry policy of the data source.
+// By default, the requests are not retried.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(ds *HttpDataSource) {
+		ds.retryPolicy = policy
+	}
+}
+
+// WithOutboundLimit limits the rate and the concurrency of the requests to the upstream API.
+// The requests over the limits wait in a queue until their context is done.
+// By default, the requests are not limited.
+func WithOutboundLimit(limit OutboundLimit) Option {
+	return func(ds *HttpDataSource) {
+		ds.limiter.setLimit(limit)
+	}
+}
+
+// WithQueueObserver sets the function which is called with the wait of every attempt for the outbound limits.
+// It is used to collect the metrics of the queue.
+func WithQueueObserver(observer QueueObserver) Option {
+	return func(ds *HttpDataSource) {
+		ds.limiter.onWait = observer
+	}
+}
+
+// WithRequestObserver sets the function which is called after every upstream attempt.
+// It is used to collect the metrics of the upstream API.
+func WithRequestObserver(observer RequestObserver) Option {
+	return func(ds *HttpDataSource) {
+		ds.observer = observer
+	}
+}
+
+// WithTracerProvider sets the tracer provider of the spans of the upstream attempts.
+// By default, the global tracer provider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(ds *HttpDataSource) {
+		ds.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// WithLogger sets the logger of the data source.
+// By default, the standard logrus logger is used.
+func WithLogger(logger logrus.FieldLogger) Option {
+	return func(ds *HttpDataSource) {
+		ds.logger = logger
+	}
+}
+
+// HttpDataSource must implement the DataSource interface.
+var _ DataSource = (*HttpDataSource)(nil)
+
+// NewHttpDataSource returns a new HttpDataSource which uses the given client and base URL.
+// If the base URL is empty, DefaultBaseURL is used.
+func NewHttpDataSource(client *http.Client, baseURL string, opts ...Option) *HttpDataSource {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	ds := &HttpDataSource{
+		client:      client,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		retryPolicy: NoRetryPolicy(),
+		limiter:     newOutboundLimiter(OutboundLimit{}),
+		tracer:      otel.Tracer(instrumentationName),
+		logger:      logrus.StandardLogger(),
 	}
+	for _, opt := range opts {
+		opt(ds)
+	}
+	return ds
+}
+
+// SetRetryPolicy changes the retry policy of the data source.
+// The requests in flight keep the policy they started with.
+func (ds *HttpDataSource) SetRetryPolicy(policy RetryPolicy) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.retryPolicy = policy
+}
+
+// SetOutboundLimit changes the limits of the requests to the upstream API.
+// Zero values disable the limits, as in WithOutboundLimit.
+func (ds *HttpDataSource) SetOutboundLimit(limit OutboundLimit) {
+	ds.limiter.setLimit(limit)
+}
+
+// policy returns the current retry policy.
+func (ds *HttpDataSource) policy() RetryPolicy {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.retryPolicy
 }
 
-// GetBreedImageURL returns the image URL as a string and an error if any.
-func GetBreedImageURL(ctx context.Context, client *http.Client, breed, subBreed string) (string, int, error) {
-	endpoint := createEndpoint(breed, subBreed)
-	return getRandomImageURL(ctx, client, endpoint)
+// Retries returns the number of retries made so far.
+func (ds *HttpDataSource) Retries() uint64 {
+	return atomic.LoadUint64(&ds.retries)
+}
+
+// Coalesced returns the number of the requests which shared the result of an in-flight request so far.
+func (ds *HttpDataSource) Coalesced() uint64 {
+	return atomic.LoadUint64(&ds.coalesced)
+}
+
+// QueueStats returns the statistics of the requests waiting for the outbound limits.
+func (ds *HttpDataSource) QueueStats() QueueStats {
+	return ds.limiter.Stats()
+}
+
+// GetRandomImageURL returns the image URL as a string and an error if any.
+func (ds *HttpDataSource) GetRandomImageURL(ctx context.Context, breed, subBreed string) (string, int, error) {
+	endpoint := createEndpoint(ds.baseURL, breed, subBreed)
+	return ds.getRandomImageURL(ctx, endpoint)
+}
+
+// GetRandomImageURLs returns up to the given number of image URLs as a string slice and an error if any.
+// The upstream API returns at most 50 images.
+func (ds *HttpDataSource) GetRandomImageURLs(ctx context.Context, breed, subBreed string, count int) ([]string, int, error) {
+	endpoint := createMultiEndpoint(ds.baseURL, breed, subBreed, count)
+	return ds.getRandomImageURLs(ctx, endpoint)
 }
 
 // GetImage returns the image as a byte array and an error if any.
 // It downloads the image from the given URL.
-func GetImage(ctx context.Context, client *http.Client, imageURL string) ([]byte, int, error) {
-	return processHttpGet(ctx, client, imageURL)
+func (ds *HttpDataSource) GetImage(ctx context.Context, imageURL string) ([]byte, int, error) {
+	return ds.getShared(ctx, OperationImage, imageURL)
+}
+
+// OpenImage returns the image stream, status code as an integer and an error if any.
+// The image is read directly from the upstream response body, the caller must close it.
+// The request is retried until the upstream API responds, the body itself is not retried.
+func (ds *HttpDataSource) OpenImage(ctx context.Context, imageURL string) (*ImageStream, int, error) {
+	var stream *ImageStream
+	statusCode, err := ds.retry(ctx, OperationOpenImage, imageURL, func(ctx context.Context) (int, int64, error) {
+		release, err := ds.limiter.acquire(ctx)
+		if err != nil {
+			return http.StatusInternalServerError, -1, err
+		}
+
+		var statusCode int
+		stream, statusCode, err = processHttpOpen(ctx, ds.client, imageURL)
+		if stream == nil {
+			release()
+			return statusCode, -1, err
+		}
+		// the request is in flight until the caller closes the body
+		stream.Body = &releasingBody{ReadCloser: stream.Body, release: release}
+		return statusCode, stream.Size, err
+	})
+	return stream, statusCode, err
+}
+
+// ListBreeds returns all the breeds with their sub-breeds, status code as an integer and an error if any.
+func (ds *HttpDataSource) ListBreeds(ctx context.Context) (map[string][]string, int, error) {
+	return ds.getBreedList(ctx, createBreedListEndpoint(ds.baseURL))
+}
+
+// ListSubBreeds returns the sub-breeds of the given breed, status code as an integer and an error if any.
+func (ds *HttpDataSource) ListSubBreeds(ctx context.Context, breed string) ([]string, int, error) {
+	return ds.getSubBreedList(ctx, createSubBreedListEndpoint(ds.baseURL, breed))
 }
 
 // createEndpoint returns the endpoint URL for the given breed and sub-breed.
 // If the sub-breed is empty, it returns the endpoint for the breed.
 // If the sub-breed is not empty, it returns the endpoint for breed and the sub-breed.
 // Example:
+// baseURL: "https://dog.ceo/api"
 // breed: "husky"
 // subBreed: ""
 // endpoint: "https://dog.ceo/api/breed/husky/images/random"
-func createEndpoint(breed, subBreed string) string {
+func createEndpoint(baseURL, breed, subBreed string) string {
 	if len(subBreed) > 0 {
-		return fmt.Sprintf("https://dog.ceo/api/breed/%s/%s/images/random", breed, subBreed)
+		return fmt.Sprintf("%s/breed/%s/%s/images/random", baseURL, breed, subBreed)
 	}
-	return fmt.Sprintf("https://dog.ceo/api/breed/%s/images/random", breed)
+	return fmt.Sprintf("%s/breed/%s/images/random", baseURL, breed)
+}
+
+// createMultiEndpoint returns the endpoint URL for the given number of images of the given breed and sub-breed.
+// Example:
+// baseURL: "https://dog.ceo/api"
+// breed: "hound"
+// subBreed: "afghan"
+// count: 3
+// endpoint: "https://dog.ceo/api/breed/hound/afghan/images/random/3"
+func createMultiEndpoint(baseURL, breed, subBreed string, count int) string {
+	return fmt.Sprintf("%s/%d", createEndpoint(baseURL, breed, subBreed), count)
+}
+
+// createBreedListEndpoint returns the endpoint URL to list all the breeds.
+func createBreedListEndpoint(baseURL string) string {
+	return baseURL + "/breeds/list/all"
+}
+
+// createSubBreedListEndpoint returns the endpoint URL to list the sub-breeds of the given breed.
+// Example:
+// baseURL: "https://dog.ceo/api"
+// breed: "hound"
+// endpoint: "https://dog.ceo/api/breed/hound/list"
+func createSubBreedListEndpoint(baseURL, breed string) string {
+	return fmt.Sprintf("%s/breed/%s/list", baseURL, breed)
 }
 
 // getRandomImageURL returns the image URL as a string, status code as an integer and an error if any.
 // It uses the given endpoint to get the image URL.
-func getRandomImageURL(ctx context.Context, client *http.Client, endpoint string) (string, int, error) {
-	resp, statusCode, err := processHttpGet(ctx, client, endpoint)
+func (ds *HttpDataSource) getRandomImageURL(ctx context.Context, endpoint string) (string, int, error) {
+	resp, statusCode, err := ds.get(ctx, OperationRandomImage, endpoint)
 	if err != nil {
 		return "", statusCode, err
 	}
@@ -73,8 +407,174 @@ func getRandomImageURL(ctx context.Context, client *http.Client, endpoint string
 	return string(apiResp.Message), statusCode, nil
 }
 
+// getRandomImageURLs returns the image URLs as a string slice, status code as an integer and an error if any.
+// It uses the given endpoint to get the image URLs.
+func (ds *HttpDataSource) getRandomImageURLs(ctx context.Context, endpoint string) ([]string, int, error) {
+	resp, statusCode, err := ds.get(ctx, OperationRandomImages, endpoint)
+	if err != nil {
+		return nil, statusCode, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, statusCode, nil
+	}
+
+	apiResp := &getRandomImagesAPIResponse{}
+	if err := json.Unmarshal(resp, apiResp); err != nil {
+		return nil, statusCode, err
+	}
+
+	return apiResp.Message, statusCode, nil
+}
+
+// getBreedList returns the breed to sub-breeds map, status code as an integer and an error if any.
+// It uses the given endpoint to get the breed list.
+func (ds *HttpDataSource) getBreedList(ctx context.Context, endpoint string) (map[string][]string, int, error) {
+	resp, statusCode, err := ds.getShared(ctx, OperationBreeds, endpoint)
+	if err != nil {
+		return nil, statusCode, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, statusCode, nil
+	}
+
+	apiResp := &getBreedListAPIResponse{}
+	if err := json.Unmarshal(resp, apiResp); err != nil {
+		return nil, statusCode, err
+	}
+
+	return apiResp.Message, statusCode, nil
+}
+
+// getSubBreedList returns the sub-breeds as a string slice, status code as an integer and an error if any.
+// It uses the given endpoint to get the sub-breed list.
+func (ds *HttpDataSource) getSubBreedList(ctx context.Context, endpoint string) ([]string, int, error) {
+	resp, statusCode, err := ds.getShared(ctx, OperationSubBreeds, endpoint)
+	if err != nil {
+		return nil, statusCode, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, statusCode, nil
+	}
+
+	apiResp := &getSubBreedListAPIResponse{}
+	if err := json.Unmarshal(resp, apiResp); err != nil {
+		return nil, statusCode, err
+	}
+
+	return apiResp.Message, statusCode, nil
+}
+
+// getShared returns the response as a byte array, status code as an integer and an error if any.
+// The concurrent requests to the same endpoint share a single upstream request and its result,
+// so it must not be used for the random endpoints. The returned byte array must not be modified.
+// If the shared request fails because the caller who started it gave up, the request is made again.
+func (ds *HttpDataSource) getShared(ctx context.Context, operation, endpoint string) ([]byte, int, error) {
+	for {
+		body, statusCode, shared, err := ds.flights.do(ctx, endpoint, func() ([]byte, int, error) {
+			return ds.get(ctx, operation, endpoint)
+		})
+		if !shared {
+			return body, statusCode, err
+		}
+		if isContextError(err) && ctx.Err() == nil {
+			continue
+		}
+		atomic.AddUint64(&ds.coalesced, 1)
+		return body, statusCode, err
+	}
+}
+
+// get returns the response as a byte array, status code as an integer and an error if any.
+// It retries the request with the retry policy of the data source.
+// Every attempt waits for the outbound limits.
+// If all the attempts fail, it returns the result of the last attempt.
+func (ds *HttpDataSource) get(ctx context.Context, operation, endpoint string) ([]byte, int, error) {
+	var body []byte
+	statusCode, err := ds.retry(ctx, operation, endpoint, func(ctx context.Context) (int, int64, error) {
+		release, err := ds.limiter.acquire(ctx)
+		if err != nil {
+			return http.StatusInternalServerError, -1, err
+		}
+		defer release()
+
+		var statusCode int
+		body, statusCode, err = processHttpGet(ctx, ds.client, endpoint)
+		return statusCode, int64(len(body)), err
+	})
+	return body, statusCode, err
+}
+
+// retry calls the given attempt until it succeeds or the retry policy gives up.
+// The attempt returns its status code, the size of its response body or -1 if it is unknown, and its error.
+// Every attempt has its own span and it is reported to the request observer with the given operation.
+// It returns the status code and the error of the last attempt.
+func (ds *HttpDataSource) retry(ctx context.Context, operation, endpoint string, attemptFn func(ctx context.Context) (int, int64, error)) (int, error) {
+	retryPolicy := ds.policy()
+	for attempt := 1; ; attempt++ {
+		attemptCtx, span := ds.tracer.Start(ctx, "dog.ceo "+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(http.MethodGet),
+				semconv.HTTPURLKey.String(endpoint),
+				attribute.Int("dogceo.attempt", attempt),
+			),
+		)
+		start := time.Now()
+		statusCode, size, err := attemptFn(attemptCtx)
+		if ds.observer != nil {
+			ds.observer(operation, statusCode, err, time.Since(start))
+		}
+		endAttemptSpan(span, statusCode, size, err)
+
+		if attempt >= retryPolicy.MaxAttempts || !retryPolicy.shouldRetry(ctx, statusCode, err) {
+			return statusCode, err
+		}
+
+		backoff := retryPolicy.Backoff(attempt, rand.Float64())
+		// the fields of the request, e.g. its request ID, are added to the log lines of its attempts
+		logger := ds.logger.WithFields(ctxlogrus.Extract(ctx).Data).WithFields(logrus.Fields{
+			"endpoint":    endpoint,
+			"attempt":     attempt,
+			"status_code": statusCode,
+			"backoff":     backoff.String(),
+		})
+		if err != nil {
+			logger = logger.WithError(err)
+		}
+
+		if !waitForRetry(ctx, backoff) {
+			logger.Warn("Upstream request failed and there is no time left to retry")
+			return statusCode, err
+		}
+
+		logger.Warn("Upstream request failed, retrying")
+		atomic.AddUint64(&ds.retries, 1)
+	}
+}
+
+// endAttemptSpan records the result of an attempt on its span and ends it.
+// The transport errors and the status codes 4xx and 5xx mark the span as failed.
+func endAttemptSpan(span trace.Span, statusCode int, size int64, err error) {
+	defer span.End()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(statusCode))
+	if size >= 0 {
+		span.SetAttributes(semconv.HTTPResponseContentLengthKey.Int64(size))
+	}
+	if statusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+}
+
 // processHttpGet returns the response as a byte array, status code as an integer and an error if any.
-// It uses the given endpoint to get the response.
+// It uses the given endpoint to get the response with a single attempt.
 func processHttpGet(ctx context.Context, client *http.Client, endpoint string) ([]byte, int, error) {
 	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
 	if err != nil {
@@ -95,3 +595,31 @@ func processHttpGet(ctx context.Context, client *http.Client, endpoint string) (
 
 	return body, resp.StatusCode, nil
 }
+
+// processHttpOpen returns the image stream of the response, status code as an integer and an error if any.
+// It uses the given endpoint to get the response with a single attempt.
+// The body is only returned with the status code 200, the caller must close it.
+func processHttpOpen(ctx context.Context, client *http.Client, endpoint string) (*ImageStream, int, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// drain the body to reuse the connection
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, resp.StatusCode, nil
+	}
+
+	return &ImageStream{
+		Body:        resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+	}, resp.StatusCode, nil
+}
@@ -1,14 +1,21 @@
 package data_service
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/canbo-x/dog-ceo/fakedogceo"
 )
 
 func TestNewHttpClient(t *testing.T) {
@@ -18,6 +25,65 @@ func TestNewHttpClient(t *testing.T) {
 	}
 }
 
+func TestNewHttpClientWithConfig(t *testing.T) {
+	cfg := ClientConfig{
+		Timeout:             time.Second * 3,
+		DialTimeout:         time.Second,
+		KeepAlive:           time.Second * 10,
+		MaxIdleConns:        7,
+		MaxIdleConnsPerHost: 3,
+		IdleConnTimeout:     time.Second * 20,
+		TLSHandshakeTimeout: time.Second * 2,
+	}
+
+	client := NewHttpClientWithConfig(cfg)
+	if client.Timeout != cfg.Timeout {
+		t.Errorf("timeout is not correct got %v want %v", client.Timeout, cfg.Timeout)
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport is not *http.Transport")
+	}
+	if transport.MaxIdleConns != cfg.MaxIdleConns {
+		t.Errorf("max idle conns is not correct got %d want %d", transport.MaxIdleConns, cfg.MaxIdleConns)
+	}
+	if transport.MaxIdleConnsPerHost != cfg.MaxIdleConnsPerHost {
+		t.Errorf("max idle conns per host is not correct got %d want %d", transport.MaxIdleConnsPerHost, cfg.MaxIdleConnsPerHost)
+	}
+	if transport.IdleConnTimeout != cfg.IdleConnTimeout {
+		t.Errorf("idle conn timeout is not correct got %v want %v", transport.IdleConnTimeout, cfg.IdleConnTimeout)
+	}
+	if transport.TLSHandshakeTimeout != cfg.TLSHandshakeTimeout {
+		t.Errorf("tls handshake timeout is not correct got %v want %v", transport.TLSHandshakeTimeout, cfg.TLSHandshakeTimeout)
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	var newConns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client := NewHttpClient()
+	for i := 0; i < 5; i++ {
+		if _, _, err := processHttpGet(context.Background(), client, ts.URL); err != nil {
+			t.Fatalf("error is not nil %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&newConns); got != 1 {
+		t.Errorf("connection supposed to be reused; got %d new connections", got)
+	}
+}
+
 func TestTimeout(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(time.Second * 7)
@@ -41,21 +107,21 @@ func TestGetBreedImageURL(t *testing.T) {
 		"valid breed and subbreed": {
 			Breed:              "australian",
 			SubBreed:           "shepherd",
-			ExpectedURL:        "https://images.dog.ceo/breeds/australian-shepherd/",
+			ExpectedURL:        "/breeds/australian-shepherd/",
 			ExpectedStatusCode: http.StatusOK,
 			Valid:              true,
 		},
 		"valid breed and empty subbreed - dog does not have subbreed": {
 			Breed:              "husky",
 			SubBreed:           "",
-			ExpectedURL:        "https://images.dog.ceo/breeds/husky/",
+			ExpectedURL:        "/breeds/husky/",
 			ExpectedStatusCode: http.StatusOK,
 			Valid:              true,
 		},
 		"valid breed and empty subbreed - dog have subbreed ": {
 			Breed:              "australian",
 			SubBreed:           "",
-			ExpectedURL:        "https://images.dog.ceo/breeds/australian-shepherd/",
+			ExpectedURL:        "/breeds/australian-shepherd/",
 			ExpectedStatusCode: http.StatusOK,
 			Valid:              true,
 		},
@@ -96,13 +162,15 @@ func TestGetBreedImageURL(t *testing.T) {
 		},
 	}
 
-	client := NewHttpClient()
+	ts := httptest.NewServer(fakedogceo.New(fakedogceo.Options{}))
+	t.Cleanup(ts.Close)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
 
 	for name, test := range tests {
 		test := test
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			url, statusCode, err := GetBreedImageURL(context.Background(), client, test.Breed, test.SubBreed)
+			url, statusCode, err := ds.GetRandomImageURL(context.Background(), test.Breed, test.SubBreed)
 			if (err == nil) != test.Valid {
 				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
 			}
@@ -116,33 +184,101 @@ func TestGetBreedImageURL(t *testing.T) {
 	}
 }
 
+func TestGetBreedImageURLs(t *testing.T) {
+	tests := map[string]struct {
+		Breed              string
+		SubBreed           string
+		Count              int
+		ExpectedCount      int
+		ExpectedURL        string
+		ExpectedStatusCode int
+	}{
+		"breed": {
+			Breed:              "husky",
+			Count:              3,
+			ExpectedCount:      3,
+			ExpectedURL:        "/breeds/husky/",
+			ExpectedStatusCode: http.StatusOK,
+		},
+		"breed and subbreed": {
+			Breed:              "hound",
+			SubBreed:           "afghan",
+			Count:              2,
+			ExpectedCount:      2,
+			ExpectedURL:        "/breeds/hound-afghan/",
+			ExpectedStatusCode: http.StatusOK,
+		},
+		"capped by the available images": {
+			Breed:              "pug",
+			Count:              10,
+			ExpectedCount:      2,
+			ExpectedURL:        "/breeds/pug/",
+			ExpectedStatusCode: http.StatusOK,
+		},
+		"invalid breed": {
+			Breed:              "INVALID",
+			Count:              3,
+			ExpectedCount:      0,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	ts := httptest.NewServer(fakedogceo.New(fakedogceo.Options{}))
+	t.Cleanup(ts.Close)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			urls, statusCode, err := ds.GetRandomImageURLs(context.Background(), test.Breed, test.SubBreed, test.Count)
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if statusCode != test.ExpectedStatusCode {
+				t.Fatalf("status code is not correct got %d want %d", statusCode, test.ExpectedStatusCode)
+			}
+			if len(urls) != test.ExpectedCount {
+				t.Fatalf("want %d urls; got %d", test.ExpectedCount, len(urls))
+			}
+			for _, url := range urls {
+				if !strings.Contains(url, test.ExpectedURL) {
+					t.Fatalf("url is not correct got: %v expected to contain: %v", url, test.ExpectedURL)
+				}
+			}
+		})
+	}
+}
+
 func TestGetImage(t *testing.T) {
 	tests := map[string]struct {
-		URL                string
+		Path               string
 		ExpectedStatusCode int
 		ShouldHaveImage    bool
 		Valid              bool
 	}{
 		"valid url": {
-			URL:                "https://images.dog.ceo/breeds/husky/n02110185_12678.jpg",
+			Path:               "/breeds/husky/n02110185_12678.jpg",
 			ExpectedStatusCode: http.StatusOK,
 			ShouldHaveImage:    true,
 			Valid:              true,
 		},
 		"invalid url": {
-			URL:                "https://images.dog.ceo/breeds/INVALID/no.jpg",
+			Path:               "/breeds/INVALID/no.jpg",
 			ExpectedStatusCode: http.StatusNotFound,
 			ShouldHaveImage:    false,
 			Valid:              true,
 		},
 	}
 
-	client := NewHttpClient()
+	ts := httptest.NewServer(fakedogceo.New(fakedogceo.Options{}))
+	t.Cleanup(ts.Close)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
 	for name, test := range tests {
 		test := test
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			image, statusCode, err := GetImage(context.Background(), client, test.URL)
+			image, statusCode, err := ds.GetImage(context.Background(), ts.URL+test.Path)
 			if (err == nil) != test.Valid {
 				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
 			}
@@ -156,6 +292,65 @@ func TestGetImage(t *testing.T) {
 	}
 }
 
+func TestOpenImage(t *testing.T) {
+	tests := map[string]struct {
+		Path               string
+		ExpectedStatusCode int
+		ShouldHaveImage    bool
+	}{
+		"valid url": {
+			Path:               "/breeds/husky/n02110185_12678.jpg",
+			ExpectedStatusCode: http.StatusOK,
+			ShouldHaveImage:    true,
+		},
+		"invalid url": {
+			Path:               "/breeds/INVALID/no.jpg",
+			ExpectedStatusCode: http.StatusNotFound,
+			ShouldHaveImage:    false,
+		},
+	}
+
+	ts := httptest.NewServer(fakedogceo.New(fakedogceo.Options{}))
+	t.Cleanup(ts.Close)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			stream, statusCode, err := ds.OpenImage(context.Background(), ts.URL+test.Path)
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if statusCode != test.ExpectedStatusCode {
+				t.Fatalf("status code is not correct got %d want %d", statusCode, test.ExpectedStatusCode)
+			}
+			if !test.ShouldHaveImage {
+				if stream != nil {
+					t.Fatalf("stream supposed to be nil")
+				}
+				return
+			}
+			defer stream.Body.Close()
+
+			image, err := ioutil.ReadAll(stream.Body)
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if stream.ContentType != "image/jpeg" {
+				t.Fatalf("want content type image/jpeg; got %v", stream.ContentType)
+			}
+			if stream.Size != int64(len(image)) {
+				t.Fatalf("want size %d; got %d", len(image), stream.Size)
+			}
+
+			expected, _, err := ds.GetImage(context.Background(), ts.URL+test.Path)
+			if err != nil || !bytes.Equal(image, expected) {
+				t.Fatalf("streamed image is not the same as the downloaded image, error %v", err)
+			}
+		})
+	}
+}
+
 func TestCreateEndpoint(t *testing.T) {
 	tests := map[string]struct {
 		Breed       string
@@ -188,11 +383,241 @@ func TestCreateEndpoint(t *testing.T) {
 		test := test
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			url := createEndpoint(test.Breed, test.SubBreed)
+			url := createEndpoint(DefaultBaseURL, test.Breed, test.SubBreed)
+			if url != test.ExpectedURL {
+				t.Fatalf("want url %v; got %v", test.ExpectedURL, url)
+			}
+		})
+	}
+
+}
+
+func TestCreateMultiEndpoint(t *testing.T) {
+	tests := map[string]struct {
+		Breed       string
+		SubBreed    string
+		Count       int
+		ExpectedURL string
+	}{
+		"only breed": {
+			Breed:       "husky",
+			Count:       3,
+			ExpectedURL: "https://dog.ceo/api/breed/husky/images/random/3",
+		},
+		"both breed and subbreed": {
+			Breed:       "hound",
+			SubBreed:    "afghan",
+			Count:       10,
+			ExpectedURL: "https://dog.ceo/api/breed/hound/afghan/images/random/10",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			url := createMultiEndpoint(DefaultBaseURL, test.Breed, test.SubBreed, test.Count)
+			if url != test.ExpectedURL {
+				t.Fatalf("want url %v; got %v", test.ExpectedURL, url)
+			}
+		})
+	}
+}
+
+func TestNewHttpDataSource(t *testing.T) {
+	tests := map[string]struct {
+		BaseURL         string
+		ExpectedBaseURL string
+	}{
+		"empty base url": {
+			BaseURL:         "",
+			ExpectedBaseURL: DefaultBaseURL,
+		},
+		"custom base url": {
+			BaseURL:         "http://localhost:8080/api",
+			ExpectedBaseURL: "http://localhost:8080/api",
+		},
+		"trailing slash": {
+			BaseURL:         "http://localhost:8080/api/",
+			ExpectedBaseURL: "http://localhost:8080/api",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ds := NewHttpDataSource(NewHttpClient(), test.BaseURL)
+			if ds.baseURL != test.ExpectedBaseURL {
+				t.Fatalf("want base url %v; got %v", test.ExpectedBaseURL, ds.baseURL)
+			}
+		})
+	}
+}
+
+func TestHttpDataSourceBaseURL(t *testing.T) {
+	var gotPaths []string
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotPaths = append(gotPaths, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`{"message":{},"status":"success"}`))
+	}))
+	defer ts.Close()
+
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+"/mirror/api")
+	ds.GetRandomImageURL(context.Background(), "australian", "shepherd")
+	ds.ListBreeds(context.Background())
+	ds.ListSubBreeds(context.Background(), "hound")
+
+	expectedPaths := []string{
+		"/mirror/api/breed/australian/shepherd/images/random",
+		"/mirror/api/breeds/list/all",
+		"/mirror/api/breed/hound/list",
+	}
+	if !reflect.DeepEqual(gotPaths, expectedPaths) {
+		t.Fatalf("want paths %v; got %v", expectedPaths, gotPaths)
+	}
+}
+
+func TestCreateSubBreedListEndpoint(t *testing.T) {
+	tests := map[string]struct {
+		Breed       string
+		ExpectedURL string
+	}{
+		"breed": {
+			Breed:       "hound",
+			ExpectedURL: "https://dog.ceo/api/breed/hound/list",
+		},
+		"empty breed": {
+			Breed:       "",
+			ExpectedURL: "https://dog.ceo/api/breed//list",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			url := createSubBreedListEndpoint(DefaultBaseURL, test.Breed)
 			if url != test.ExpectedURL {
 				t.Fatalf("want url %v; got %v", test.ExpectedURL, url)
 			}
 		})
 	}
+}
 
+func TestGetBreedList(t *testing.T) {
+	tests := map[string]struct {
+		Body               string
+		StatusCode         int
+		ExpectedBreeds     map[string][]string
+		ExpectedStatusCode int
+		Valid              bool
+	}{
+		"valid list": {
+			Body:               `{"message":{"australian":["shepherd"],"husky":[]},"status":"success"}`,
+			StatusCode:         http.StatusOK,
+			ExpectedBreeds:     map[string][]string{"australian": {"shepherd"}, "husky": {}},
+			ExpectedStatusCode: http.StatusOK,
+			Valid:              true,
+		},
+		"server error": {
+			Body:               `{"status":"error","message":"internal error","code":500}`,
+			StatusCode:         http.StatusInternalServerError,
+			ExpectedBreeds:     nil,
+			ExpectedStatusCode: http.StatusInternalServerError,
+			Valid:              true,
+		},
+		"broken body": {
+			Body:               `{"message":`,
+			StatusCode:         http.StatusOK,
+			ExpectedBreeds:     nil,
+			ExpectedStatusCode: http.StatusOK,
+			Valid:              false,
+		},
+	}
+
+	ds := NewHttpDataSource(NewHttpClient(), "")
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.StatusCode)
+				w.Write([]byte(test.Body))
+			}))
+			defer ts.Close()
+
+			breeds, statusCode, err := ds.getBreedList(context.Background(), ts.URL)
+			if (err == nil) != test.Valid {
+				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
+			}
+			if statusCode != test.ExpectedStatusCode {
+				t.Fatalf("status code is not correct got %d want %d", statusCode, test.ExpectedStatusCode)
+			}
+			if !reflect.DeepEqual(breeds, test.ExpectedBreeds) {
+				t.Fatalf("breeds are not correct got %v want %v", breeds, test.ExpectedBreeds)
+			}
+		})
+	}
+}
+
+func TestGetSubBreedList(t *testing.T) {
+	tests := map[string]struct {
+		Body               string
+		StatusCode         int
+		ExpectedSubBreeds  []string
+		ExpectedStatusCode int
+		Valid              bool
+	}{
+		"breed with sub-breeds": {
+			Body:               `{"message":["afghan","basset"],"status":"success"}`,
+			StatusCode:         http.StatusOK,
+			ExpectedSubBreeds:  []string{"afghan", "basset"},
+			ExpectedStatusCode: http.StatusOK,
+			Valid:              true,
+		},
+		"breed without sub-breeds": {
+			Body:               `{"message":[],"status":"success"}`,
+			StatusCode:         http.StatusOK,
+			ExpectedSubBreeds:  []string{},
+			ExpectedStatusCode: http.StatusOK,
+			Valid:              true,
+		},
+		"breed not found": {
+			Body:               `{"status":"error","message":"Breed not found (master breed does not exist)","code":404}`,
+			StatusCode:         http.StatusNotFound,
+			ExpectedSubBreeds:  nil,
+			ExpectedStatusCode: http.StatusNotFound,
+			Valid:              true,
+		},
+	}
+
+	ds := NewHttpDataSource(NewHttpClient(), "")
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.StatusCode)
+				w.Write([]byte(test.Body))
+			}))
+			defer ts.Close()
+
+			subBreeds, statusCode, err := ds.getSubBreedList(context.Background(), ts.URL)
+			if (err == nil) != test.Valid {
+				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
+			}
+			if statusCode != test.ExpectedStatusCode {
+				t.Fatalf("status code is not correct got %d want %d", statusCode, test.ExpectedStatusCode)
+			}
+			if !reflect.DeepEqual(subBreeds, test.ExpectedSubBreeds) {
+				t.Fatalf("sub-breeds are not correct got %v want %v", subBreeds, test.ExpectedSubBreeds)
+			}
+		})
+	}
 }
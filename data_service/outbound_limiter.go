@@ -0,0 +1,231 @@
+package data_service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/rate_limiter"
+)
+
+// OutboundLimit holds the limits of the requests to the upstream API.
+// Every attempt of a request counts, including the retries.
+type OutboundLimit struct {
+	// Rate is the maximum number of the requests started every second. Zero means no rate limit.
+	Rate float64
+
+	// Burst is the maximum number of the requests started at once. It is at least 1.
+	Burst int
+
+	// MaxConcurrent is the maximum number of the requests in flight. Zero means no concurrency limit.
+	MaxConcurrent int
+}
+
+// QueueStats holds the statistics of the requests waiting for the outbound limits.
+type QueueStats struct {
+	// Requests is the number of the requests which passed the limits.
+	Requests uint64
+
+	// Queued is the number of the requests which had to wait before passing the limits.
+	Queued uint64
+
+	// GaveUp is the number of the requests whose context was done while they were waiting.
+	GaveUp uint64
+
+	// TotalWait and MaxWait are the total and the longest wait of the requests.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+
+	// InFlight is the number of the requests in flight right now.
+	InFlight int
+}
+
+// AverageWait returns the average wait of the requests which passed the limits.
+func (s QueueStats) AverageWait() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Requests)
+}
+
+// String returns the statistics as a human readable text.
+func (s QueueStats) String() string {
+	return fmt.Sprintf("requests: %d queued: %d gave up: %d average wait: %v max wait: %v in flight: %d",
+		s.Requests, s.Queued, s.GaveUp, s.AverageWait(), s.MaxWait, s.InFlight)
+}
+
+// outboundLimiter holds the required variables to limit the requests to the upstream API.
+// The requests wait for a free slot first and then for a token,
+// so the rate is respected when the requests are actually sent.
+type outboundLimiter struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the limits and the statistics
+	mu sync.Mutex
+
+	limit OutboundLimit
+
+	// bucket is nil if there is no rate limit.
+	bucket *rate_limiter.TokenBucket
+
+	// slots is nil if there is no concurrency limit.
+	slots chan struct{}
+
+	stats QueueStats
+
+	// onWait is called with the wait of every request which passed the limits, it can be nil.
+	onWait QueueObserver
+}
+
+// QueueObserver is called for every upstream attempt which passed the outbound limits
+// with the time it waited for them, zero if it did not wait.
+// It is not called when there are no outbound limits.
+type QueueObserver func(wait time.Duration)
+
+// newOutboundLimiter returns a new outboundLimiter with the given limits.
+func newOutboundLimiter(limit OutboundLimit) *outboundLimiter {
+	l := &outboundLimiter{}
+	l.setLimit(limit)
+	return l
+}
+
+// setLimit changes the limits of the limiter.
+// The token bucket keeps its tokens if the rate limit stays enabled.
+// A new concurrency limit is used by the new requests, the requests in flight release the slots of the old one,
+// so there can be more requests in flight than the new limit until they are completed.
+func (l *outboundLimiter) setLimit(limit OutboundLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	settings := rate_limiter.Settings{Rate: limit.Rate, Burst: limit.Burst}
+	switch {
+	case limit.Rate <= 0:
+		l.bucket = nil
+	case l.bucket == nil:
+		l.bucket = rate_limiter.NewTokenBucket(settings)
+	default:
+		l.bucket.SetSettings(settings)
+	}
+
+	switch {
+	case limit.MaxConcurrent <= 0:
+		l.slots = nil
+	case limit.MaxConcurrent != l.limit.MaxConcurrent || l.slots == nil:
+		l.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	l.limit = limit
+}
+
+// acquire waits until the request can be sent and returns the function which releases its slot.
+// The release function must be called once when the request is completed.
+// It returns the error of the context if the context is done while waiting.
+// A nil limiter or a limiter without limits lets every request through.
+func (l *outboundLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	bucket, slots := l.bucket, l.slots
+	l.mu.Unlock()
+	if bucket == nil && slots == nil {
+		return func() {}, nil
+	}
+
+	start := time.Now()
+	queued := false
+
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			queued = true
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				l.gaveUp()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	if bucket != nil {
+		if decision := bucket.Take(); decision.Limited {
+			queued = true
+			if err := bucket.Wait(ctx); err != nil {
+				releaseSlot(slots)
+				l.gaveUp()
+				return nil, err
+			}
+		}
+	}
+
+	wait := time.Since(start)
+	l.mu.Lock()
+	l.stats.Requests++
+	if queued {
+		l.stats.Queued++
+		l.stats.TotalWait += wait
+		if wait > l.stats.MaxWait {
+			l.stats.MaxWait = wait
+		}
+	}
+	l.stats.InFlight++
+	l.mu.Unlock()
+	if l.onWait != nil {
+		if !queued {
+			wait = 0
+		}
+		l.onWait(wait)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.stats.InFlight--
+			l.mu.Unlock()
+			releaseSlot(slots)
+		})
+	}, nil
+}
+
+// Stats returns the statistics of the limiter.
+// A nil limiter has no statistics.
+func (l *outboundLimiter) Stats() QueueStats {
+	if l == nil {
+		return QueueStats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// gaveUp counts a request which gave up while waiting.
+func (l *outboundLimiter) gaveUp() {
+	l.mu.Lock()
+	l.stats.GaveUp++
+	l.mu.Unlock()
+}
+
+// releaseSlot frees the slot of a request in the given slots if there is a concurrency limit.
+func releaseSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// releasingBody is a response body which releases the slot of its request when it is closed,
+// so a streamed image counts as in flight until it is read.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close closes the body and releases the slot of its request.
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,182 @@
+package data_service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/fakedogceo"
+)
+
+// slowUpstream returns a fake dog.ceo API which holds every request for the given delay
+// and returns a function which reports the maximum number of the concurrent requests.
+func slowUpstream(t *testing.T, delay time.Duration) (*httptest.Server, func() int32) {
+	var inFlight, maxInFlight int32
+	fake := fakedogceo.New(fakedogceo.Options{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, func() int32 { return atomic.LoadInt32(&maxInFlight) }
+}
+
+func TestOutboundConcurrencyLimit(t *testing.T) {
+	ts, maxInFlight := slowUpstream(t, time.Millisecond*20)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath, WithOutboundLimit(OutboundLimit{MaxConcurrent: 3}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, statusCode, err := ds.GetRandomImageURL(context.Background(), "husky", ""); err != nil || statusCode != http.StatusOK {
+				t.Errorf("want status code 200 and no error; got %d %v", statusCode, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := maxInFlight(); got > 3 {
+		t.Fatalf("want at most 3 concurrent upstream requests; got %d", got)
+	}
+	stats := ds.QueueStats()
+	if stats.Requests != 20 || stats.Queued == 0 || stats.InFlight != 0 || stats.MaxWait == 0 {
+		t.Fatalf("queue stats are not correct %v", stats)
+	}
+}
+
+func TestQueueObserver(t *testing.T) {
+	ts, _ := slowUpstream(t, 0)
+	var mu sync.Mutex
+	var waits []time.Duration
+	observer := func(wait time.Duration) {
+		mu.Lock()
+		waits = append(waits, wait)
+		mu.Unlock()
+	}
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath,
+		WithOutboundLimit(OutboundLimit{Rate: 50, Burst: 1}), WithQueueObserver(observer))
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := ds.ListBreeds(context.Background()); err != nil {
+			t.Fatalf("error is not nil %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the first request uses the burst, the second one is queued for about 20ms
+	if len(waits) != 2 || waits[0] != 0 || waits[1] < time.Millisecond*10 {
+		t.Fatalf("want no wait and about 20ms wait; got %v", waits)
+	}
+}
+
+func TestOutboundRateLimit(t *testing.T) {
+	ts, _ := slowUpstream(t, 0)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath, WithOutboundLimit(OutboundLimit{Rate: 50, Burst: 1}))
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, _, err := ds.ListBreeds(context.Background()); err != nil {
+			t.Fatalf("error is not nil %v", err)
+		}
+	}
+	// the first request uses the burst, the next four wait about 20ms each
+	if elapsed := time.Since(start); elapsed < time.Millisecond*70 {
+		t.Fatalf("requests supposed to take about 80ms; took %v", elapsed)
+	}
+	if stats := ds.QueueStats(); stats.Requests != 5 || stats.Queued < 3 {
+		t.Fatalf("queue stats are not correct %v", stats)
+	}
+}
+
+func TestOutboundLimitWaitIsContextAware(t *testing.T) {
+	ts, _ := slowUpstream(t, 0)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath, WithOutboundLimit(OutboundLimit{MaxConcurrent: 1}))
+	imageURL := ts.URL + "/breeds/husky/n02110185_12678.jpg"
+
+	// an open image stream holds the only slot until it is closed
+	stream, _, err := ds.OpenImage(context.Background(), imageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ds.QueueStats().InFlight; got != 1 {
+		t.Fatalf("want 1 request in flight; got %d", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*30)
+	defer cancel()
+	if _, _, err := ds.GetImage(ctx, imageURL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded while waiting for a slot; got %v", err)
+	}
+	if got := ds.QueueStats().GaveUp; got != 1 {
+		t.Fatalf("want 1 request which gave up; got %d", got)
+	}
+
+	stream.Body.Close()
+	stream.Body.Close()
+	if _, statusCode, err := ds.GetImage(context.Background(), imageURL); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("want status code 200 and no error after the slot is released; got %d %v", statusCode, err)
+	}
+	if got := ds.QueueStats().InFlight; got != 0 {
+		t.Fatalf("want 0 requests in flight; got %d", got)
+	}
+}
+
+func TestSetOutboundLimit(t *testing.T) {
+	ts, maxInFlight := slowUpstream(t, time.Millisecond*20)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
+	ds.SetOutboundLimit(OutboundLimit{MaxConcurrent: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds.GetRandomImageURL(context.Background(), "husky", "")
+		}()
+	}
+	wg.Wait()
+
+	if got := maxInFlight(); got > 2 {
+		t.Fatalf("want at most 2 concurrent upstream requests; got %d", got)
+	}
+	if stats := ds.QueueStats(); stats.Requests != 10 || stats.Queued == 0 {
+		t.Fatalf("queue stats are not correct %v", stats)
+	}
+
+	// the limits can be removed again
+	ds.SetOutboundLimit(OutboundLimit{})
+	if _, _, err := ds.GetRandomImageURL(context.Background(), "husky", ""); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if stats := ds.QueueStats(); stats.Requests != 10 {
+		t.Fatalf("requests without limits supposed to skip the queue %v", stats)
+	}
+}
+
+func TestNoOutboundLimit(t *testing.T) {
+	ds := NewHttpDataSource(NewHttpClient(), "")
+	release, err := ds.limiter.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	release()
+	if stats := ds.QueueStats(); stats != (QueueStats{}) {
+		t.Fatalf("queue stats supposed to be empty; got %v", stats)
+	}
+}
@@ -0,0 +1,132 @@
+package data_service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how the failed upstream requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// 1 or less means the requests are not retried.
+	MaxAttempts int
+
+	// BaseBackoff is the wait before the first retry.
+	// It doubles after every retry.
+	BaseBackoff time.Duration
+
+	// MaxBackoff is the upper limit of the wait between two attempts.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of the backoff which is randomized, between 0 and 1.
+	// For instance, 0.2 means the wait is between 80% and 100% of the backoff.
+	Jitter float64
+
+	// RetryableStatusCodes are the status codes which are retried.
+	// Transport errors such as timeouts and connection resets are always retried,
+	// the other errors are never retried because they fail the same way again.
+	RetryableStatusCodes map[int]bool
+}
+
+// DefaultRetryableStatusCodes returns the status codes which are retried by default.
+func DefaultRetryableStatusCodes() map[int]bool {
+	return map[int]bool{
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+		http.StatusGatewayTimeout:      true,
+	}
+}
+
+// DefaultRetryPolicy returns the default retry policy.
+// It makes 3 attempts at most and waits 100ms, then 200ms between them.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:          3,
+		BaseBackoff:          time.Millisecond * 100,
+		MaxBackoff:           time.Second * 2,
+		Jitter:               0.2,
+		RetryableStatusCodes: DefaultRetryableStatusCodes(),
+	}
+}
+
+// NoRetryPolicy returns a policy which makes a single attempt.
+func NoRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// Backoff returns the wait before the given retry.
+// The retry starts from 1 which is the wait after the first attempt.
+// The random value must be between 0 and 1, it is used for the jitter.
+func (p RetryPolicy) Backoff(retry int, random float64) time.Duration {
+	if retry < 1 || p.BaseBackoff <= 0 {
+		return 0
+	}
+
+	backoff := float64(p.BaseBackoff) * math.Pow(2, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	return time.Duration(backoff * (1 - jitter*random))
+}
+
+// shouldRetry returns true if the result of an attempt should be retried.
+// The errors caused by the request context are never retried.
+func (p RetryPolicy) shouldRetry(ctx context.Context, statusCode int, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return isTransportError(err)
+	}
+	return p.RetryableStatusCodes[statusCode]
+}
+
+// isTransportError returns true if the given error is a network failure which may not happen again,
+// e.g. a timeout, a refused or reset connection or a connection closed before the whole response is read.
+// The errors of building the request, e.g. an invalid URL or an unsupported scheme, are not transport errors.
+func isTransportError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	// url.Error implements net.Error itself, so the error inside it is checked
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// waitForRetry waits for the given backoff.
+// It returns false without waiting if the request context would expire before the next attempt.
+func waitForRetry(ctx context.Context, backoff time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+		return false
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,504 @@
+package data_service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
+	"github.com/sirupsen/logrus"
+	logrus_test "github.com/sirupsen/logrus/hooks/test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		BaseBackoff: time.Millisecond * 100,
+		MaxBackoff:  time.Millisecond * 500,
+		Jitter:      0.5,
+	}
+
+	tests := map[string]struct {
+		Policy   RetryPolicy
+		Retry    int
+		Random   float64
+		Expected time.Duration
+	}{
+		"first retry without jitter": {
+			Policy:   policy,
+			Retry:    1,
+			Random:   0,
+			Expected: time.Millisecond * 100,
+		},
+		"second retry doubles": {
+			Policy:   policy,
+			Retry:    2,
+			Random:   0,
+			Expected: time.Millisecond * 200,
+		},
+		"capped by max backoff": {
+			Policy:   policy,
+			Retry:    5,
+			Random:   0,
+			Expected: time.Millisecond * 500,
+		},
+		"full jitter": {
+			Policy:   policy,
+			Retry:    1,
+			Random:   1,
+			Expected: time.Millisecond * 50,
+		},
+		"jitter on capped backoff": {
+			Policy:   policy,
+			Retry:    10,
+			Random:   0.5,
+			Expected: time.Millisecond * 375,
+		},
+		"zero retry": {
+			Policy:   policy,
+			Retry:    0,
+			Random:   0,
+			Expected: 0,
+		},
+		"no base backoff": {
+			Policy:   RetryPolicy{},
+			Retry:    3,
+			Random:   0,
+			Expected: 0,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := test.Policy.Backoff(test.Retry, test.Random)
+			if got != test.Expected {
+				t.Fatalf("want %v; got %v", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := map[string]struct {
+		Ctx        context.Context
+		StatusCode int
+		Err        error
+		Expected   bool
+	}{
+		"ok": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusOK,
+			Expected:   false,
+		},
+		"not found": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusNotFound,
+			Expected:   false,
+		},
+		"service unavailable": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusServiceUnavailable,
+			Expected:   true,
+		},
+		"connection reset": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusInternalServerError,
+			Err:        &url.Error{Op: "Get", URL: "https://dog.ceo/api", Err: syscall.ECONNRESET},
+			Expected:   true,
+		},
+		"dial timeout": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusInternalServerError,
+			Err:        &url.Error{Op: "Get", URL: "https://dog.ceo/api", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("i/o timeout")}},
+			Expected:   true,
+		},
+		"body closed early": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusInternalServerError,
+			Err:        io.ErrUnexpectedEOF,
+			Expected:   true,
+		},
+		"unsupported scheme": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusInternalServerError,
+			Err:        &url.Error{Op: "Get", URL: "ftp://dog.ceo/api", Err: errors.New(`unsupported protocol scheme "ftp"`)},
+			Expected:   false,
+		},
+		"invalid url": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusInternalServerError,
+			Err:        &url.Error{Op: "parse", URL: "://dog.ceo", Err: errors.New("missing protocol scheme")},
+			Expected:   false,
+		},
+		"decode error": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusOK,
+			Err:        errors.New("invalid character '<' looking for beginning of value"),
+			Expected:   false,
+		},
+		"canceled error": {
+			Ctx:        context.Background(),
+			StatusCode: http.StatusInternalServerError,
+			Err:        context.Canceled,
+			Expected:   false,
+		},
+		"canceled context": {
+			Ctx:        canceledCtx,
+			StatusCode: http.StatusServiceUnavailable,
+			Expected:   false,
+		},
+	}
+
+	policy := DefaultRetryPolicy()
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := policy.shouldRetry(test.Ctx, test.StatusCode, test.Err)
+			if got != test.Expected {
+				t.Fatalf("want %t; got %t", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := map[string]struct {
+		Failures           int32
+		FailureStatusCode  int
+		Policy             RetryPolicy
+		ExpectedAttempts   int32
+		ExpectedRetries    uint64
+		ExpectedStatusCode int
+	}{
+		"succeeds after retries": {
+			Failures:           2,
+			FailureStatusCode:  http.StatusServiceUnavailable,
+			Policy:             RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, RetryableStatusCodes: DefaultRetryableStatusCodes()},
+			ExpectedAttempts:   3,
+			ExpectedRetries:    2,
+			ExpectedStatusCode: http.StatusOK,
+		},
+		"gives up after max attempts": {
+			Failures:           5,
+			FailureStatusCode:  http.StatusBadGateway,
+			Policy:             RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, RetryableStatusCodes: DefaultRetryableStatusCodes()},
+			ExpectedAttempts:   3,
+			ExpectedRetries:    2,
+			ExpectedStatusCode: http.StatusBadGateway,
+		},
+		"does not retry not found": {
+			Failures:           5,
+			FailureStatusCode:  http.StatusNotFound,
+			Policy:             RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, RetryableStatusCodes: DefaultRetryableStatusCodes()},
+			ExpectedAttempts:   1,
+			ExpectedRetries:    0,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		"no retry policy": {
+			Failures:           5,
+			FailureStatusCode:  http.StatusServiceUnavailable,
+			Policy:             NoRetryPolicy(),
+			ExpectedAttempts:   1,
+			ExpectedRetries:    0,
+			ExpectedStatusCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) <= test.Failures {
+					w.WriteHeader(test.FailureStatusCode)
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer ts.Close()
+
+			ds := NewHttpDataSource(NewHttpClient(), ts.URL, WithRetryPolicy(test.Policy))
+			_, statusCode, err := ds.GetImage(context.Background(), ts.URL)
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if statusCode != test.ExpectedStatusCode {
+				t.Fatalf("status code is not correct got %d want %d", statusCode, test.ExpectedStatusCode)
+			}
+			if got := atomic.LoadInt32(&attempts); got != test.ExpectedAttempts {
+				t.Fatalf("want %d attempts; got %d", test.ExpectedAttempts, got)
+			}
+			if got := ds.Retries(); got != test.ExpectedRetries {
+				t.Fatalf("want %d retries; got %d", test.ExpectedRetries, got)
+			}
+		})
+	}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL)
+	ds.GetImage(context.Background(), ts.URL)
+	if got := atomic.SwapInt32(&attempts, 0); got != 1 {
+		t.Fatalf("want 1 attempt; got %d", got)
+	}
+
+	ds.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, RetryableStatusCodes: DefaultRetryableStatusCodes()})
+	ds.GetImage(context.Background(), ts.URL)
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Fatalf("want 3 attempts with the new policy; got %d", got)
+	}
+}
+
+func TestRetryRespectsDeadline(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	policy := DefaultRetryPolicy()
+	policy.BaseBackoff = time.Second * 10
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL, WithRetryPolicy(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, statusCode, _ := ds.GetImage(ctx, ts.URL)
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("retry supposed to give up before the deadline; took %v", elapsed)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status code is not correct got %d want %d", statusCode, http.StatusServiceUnavailable)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Fatalf("want 1 attempt; got %d", got)
+	}
+}
+
+func TestRetryTransportError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+	ds := NewHttpDataSource(NewHttpClient(), url, WithRetryPolicy(policy))
+
+	_, _, err := ds.GetImage(context.Background(), url)
+	if err == nil {
+		t.Fatalf("error supposed to be returned")
+	}
+	if got := ds.Retries(); got != 2 {
+		t.Fatalf("want 2 retries; got %d", got)
+	}
+}
+
+func TestRetryRequestError(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond}
+	ds := NewHttpDataSource(NewHttpClient(), "ftp://dog.ceo/api", WithRetryPolicy(policy))
+
+	_, _, err := ds.GetImage(context.Background(), "ftp://images.dog.ceo/breeds/hound/1.jpg")
+	if err == nil {
+		t.Fatalf("error supposed to be returned")
+	}
+	if got := ds.Retries(); got != 0 {
+		t.Fatalf("want no retries of an unsupported scheme; got %d", got)
+	}
+}
+
+func TestRetryOpenImage(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("image"))
+	}))
+	defer ts.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseBackoff: time.Millisecond, RetryableStatusCodes: DefaultRetryableStatusCodes()}
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL, WithRetryPolicy(policy))
+
+	stream, statusCode, err := ds.OpenImage(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("status code is not correct got %d want %d", statusCode, http.StatusOK)
+	}
+	defer stream.Body.Close()
+	if got := ds.Retries(); got != 2 {
+		t.Fatalf("want 2 retries; got %d", got)
+	}
+}
+
+func TestRequestObserver(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("image"))
+	}))
+	defer ts.Close()
+
+	type observation struct {
+		operation  string
+		statusCode int
+	}
+	var observations []observation
+	policy := DefaultRetryPolicy()
+	policy.BaseBackoff = time.Millisecond
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL,
+		WithRetryPolicy(policy),
+		WithRequestObserver(func(operation string, statusCode int, err error, duration time.Duration) {
+			if err != nil || duration <= 0 {
+				t.Errorf("observation is not correct %v %v", err, duration)
+			}
+			observations = append(observations, observation{operation, statusCode})
+		}),
+	)
+
+	if _, _, err := ds.GetImage(context.Background(), ts.URL); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	expected := []observation{{OperationImage, http.StatusServiceUnavailable}, {OperationImage, http.StatusOK}}
+	if len(observations) != len(expected) {
+		t.Fatalf("want %v; got %v", expected, observations)
+	}
+	for i := range expected {
+		if observations[i] != expected[i] {
+			t.Fatalf("want %v; got %v", expected, observations)
+		}
+	}
+}
+
+func TestAttemptSpans(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("image"))
+	}))
+	defer ts.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	policy := DefaultRetryPolicy()
+	policy.BaseBackoff = time.Millisecond
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL,
+		WithRetryPolicy(policy),
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+	)
+
+	if _, _, err := ds.GetImage(context.Background(), ts.URL); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("want 2 spans; got %d", len(spans))
+	}
+
+	expected := []struct {
+		StatusCode int64
+		Failed     bool
+	}{
+		{StatusCode: http.StatusServiceUnavailable, Failed: true},
+		{StatusCode: http.StatusOK, Failed: false},
+	}
+	for i, span := range spans {
+		if span.Name() != "dog.ceo "+OperationImage {
+			t.Errorf("span %d name = %q", i, span.Name())
+		}
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, attr := range span.Attributes() {
+			attrs[attr.Key] = attr.Value
+		}
+		if got := attrs[semconv.HTTPURLKey].AsString(); got != ts.URL {
+			t.Errorf("span %d url = %q; want %q", i, got, ts.URL)
+		}
+		if got := attrs[semconv.HTTPStatusCodeKey].AsInt64(); got != expected[i].StatusCode {
+			t.Errorf("span %d status code = %d; want %d", i, got, expected[i].StatusCode)
+		}
+		if failed := span.Status().Code == codes.Error; failed != expected[i].Failed {
+			t.Errorf("span %d failed = %v; want %v", i, failed, expected[i].Failed)
+		}
+	}
+	if got := spans[1].Attributes(); !hasAttribute(got, semconv.HTTPResponseContentLengthKey.Int64(int64(len("image")))) {
+		t.Errorf("the successful span should have the response size %v", got)
+	}
+}
+
+// hasAttribute returns true if the given attributes contain the given attribute.
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRetryLogsRequestFields(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("image"))
+	}))
+	defer ts.Close()
+
+	logger, hook := logrus_test.NewNullLogger()
+	policy := DefaultRetryPolicy()
+	policy.BaseBackoff = time.Millisecond
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL, WithRetryPolicy(policy), WithLogger(logger))
+
+	// the fields of the request logger are added to the log lines of the data source
+	ctx := ctxlogrus.ToContext(context.Background(), logrus.NewEntry(logrus.New()).WithField("request_id", "abc"))
+	if _, _, err := ds.GetImage(ctx, ts.URL); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("want 1 log entry; got %d", len(entries))
+	}
+	if entries[0].Level != logrus.WarnLevel || entries[0].Data["request_id"] != "abc" {
+		t.Errorf("log entry is not correct %v %v", entries[0].Level, entries[0].Data)
+	}
+}
@@ -0,0 +1,61 @@
+package data_service
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// flightCall is an in-flight or completed call of a flightGroup.
+type flightCall struct {
+	// done is closed when the call is completed.
+	done chan struct{}
+
+	body       []byte
+	statusCode int
+	err        error
+}
+
+// flightGroup coalesces the concurrent calls with the same key into a single call.
+// The callers which join an in-flight call share its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do calls the given function once for the concurrent calls with the same key and returns its result.
+// shared is true if the result came from the call of another caller.
+// A caller which joins stops waiting when its context is done, the call itself goes on for the others.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() ([]byte, int, error)) (body []byte, statusCode int, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.body, call.statusCode, true, call.err
+		case <-ctx.Done():
+			return nil, 0, false, ctx.Err()
+		}
+	}
+
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.body, call.statusCode, call.err = fn()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(call.done)
+
+	return call.body, call.statusCode, false, call.err
+}
+
+// isContextError returns true if the error is caused by a canceled or expired context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
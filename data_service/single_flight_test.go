@@ -0,0 +1,210 @@
+package data_service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/canbo-x/dog-ceo/fakedogceo"
+)
+
+// blockingUpstream returns a fake dog.ceo API which counts the requests per path
+// and holds every request until the release channel is closed.
+func blockingUpstream(t *testing.T, release chan struct{}) (*httptest.Server, func(path string) int32) {
+	var mu sync.Mutex
+	hits := make(map[string]*int32)
+	fake := fakedogceo.New(fakedogceo.Options{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		counter, ok := hits[r.URL.Path]
+		if !ok {
+			counter = new(int32)
+			hits[r.URL.Path] = counter
+		}
+		mu.Unlock()
+		atomic.AddInt32(counter, 1)
+
+		<-release
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, func(path string) int32 {
+		mu.Lock()
+		defer mu.Unlock()
+		counter, ok := hits[path]
+		if !ok {
+			return 0
+		}
+		return atomic.LoadInt32(counter)
+	}
+}
+
+// waitForHits waits until the path is requested at least the given times.
+func waitForHits(t *testing.T, hits func(path string) int32, path string, n int32) {
+	deadline := time.Now().Add(time.Second * 5)
+	for hits(path) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %d hits for %s; got %d", n, path, hits(path))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalescing(t *testing.T) {
+	release := make(chan struct{})
+	ts, hits := blockingUpstream(t, release)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
+
+	const callers = 50
+	imagePath := "/breeds/husky/n02110185_12678.jpg"
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers*3)
+	for i := 0; i < callers; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			breeds, statusCode, err := ds.ListBreeds(context.Background())
+			if err != nil || statusCode != http.StatusOK || len(breeds) == 0 {
+				errs <- errors.New("breed list is not correct")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			subBreeds, statusCode, err := ds.ListSubBreeds(context.Background(), "hound")
+			if err != nil || statusCode != http.StatusOK || len(subBreeds) == 0 {
+				errs <- errors.New("sub-breed list is not correct")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			image, statusCode, err := ds.GetImage(context.Background(), ts.URL+imagePath)
+			if err != nil || statusCode != http.StatusOK || len(image) == 0 {
+				errs <- errors.New("image is not correct")
+			}
+		}()
+	}
+
+	waitForHits(t, hits, "/api/breeds/list/all", 1)
+	waitForHits(t, hits, "/api/breed/hound/list", 1)
+	waitForHits(t, hits, imagePath, 1)
+	// give the rest of the callers time to join the in-flight requests
+	time.Sleep(time.Millisecond * 100)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/api/breeds/list/all", "/api/breed/hound/list", imagePath} {
+		if got := hits(path); got != 1 {
+			t.Fatalf("want 1 upstream hit for %s; got %d", path, got)
+		}
+	}
+	if got := ds.Coalesced(); got != callers*3-3 {
+		t.Fatalf("want %d coalesced requests; got %d", callers*3-3, got)
+	}
+}
+
+func TestRandomImageIsNotCoalesced(t *testing.T) {
+	release := make(chan struct{})
+	ts, hits := blockingUpstream(t, release)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ds.GetRandomImageURL(context.Background(), "husky", "")
+		}()
+	}
+
+	waitForHits(t, hits, "/api/breed/husky/images/random", callers)
+	close(release)
+	wg.Wait()
+
+	if got := ds.Coalesced(); got != 0 {
+		t.Fatalf("want 0 coalesced requests; got %d", got)
+	}
+}
+
+func TestCoalescingLeaderCanceled(t *testing.T) {
+	release := make(chan struct{})
+	ts, hits := blockingUpstream(t, release)
+	ds := NewHttpDataSource(NewHttpClient(), ts.URL+fakedogceo.APIPath)
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, _, err := ds.ListBreeds(leaderCtx)
+		leaderErr <- err
+	}()
+	waitForHits(t, hits, "/api/breeds/list/all", 1)
+
+	followerResult := make(chan int, 1)
+	go func() {
+		_, statusCode, _ := ds.ListBreeds(context.Background())
+		followerResult <- statusCode
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	// the leader gives up, so the follower has to make its own request
+	cancel()
+	if err := <-leaderErr; !isContextError(err) {
+		t.Fatalf("want context error for the leader; got %v", err)
+	}
+	waitForHits(t, hits, "/api/breeds/list/all", 2)
+	close(release)
+
+	if statusCode := <-followerResult; statusCode != http.StatusOK {
+		t.Fatalf("follower supposed to get the breed list got status code %d", statusCode)
+	}
+}
+
+func TestFlightGroupFollowerGivesUp(t *testing.T) {
+	var g flightGroup
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go g.do(context.Background(), "key", func() ([]byte, int, error) {
+		close(started)
+		<-release
+		return []byte("ok"), http.StatusOK, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, _, shared, err := g.do(ctx, "key", func() ([]byte, int, error) {
+		t.Fatalf("follower supposed to join the in-flight call")
+		return nil, 0, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || shared {
+		t.Fatalf("want deadline exceeded without a shared result; got %v %t", err, shared)
+	}
+	close(release)
+
+	// the key is released after the call, so the next call runs again
+	deadline := time.Now().Add(time.Second)
+	for {
+		body, _, _, _ := g.do(context.Background(), "key", func() ([]byte, int, error) {
+			return []byte("again"), http.StatusOK, nil
+		})
+		if strings.EqualFold(string(body), "again") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("key supposed to be released")
+		}
+	}
+}
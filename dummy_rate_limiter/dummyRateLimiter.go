@@ -15,11 +15,20 @@ type LimitCounter struct {
 
 	// count holds the number of requests
 	count int
+
+	// interval is the interval the count is decreased, it is replaced in the tests.
+	interval time.Duration
+
+	// quit stops the ticker of the limiter, it is nil until the limiter is started.
+	quit chan struct{}
+
+	// done is closed when the ticker goroutine exits.
+	done chan struct{}
 }
 
 // NewLimitCounter returns a new LimitCounter instance with count 0.
 func NewLimitCounter() *LimitCounter {
-	return &LimitCounter{}
+	return &LimitCounter{interval: time.Second * 1}
 }
 
 // Limit returns true if the limit is reached.
@@ -32,10 +41,33 @@ func (lc *LimitCounter) Limit() bool {
 
 // StartLimiter starts the limiter with a ticker.
 // The limiter will be decreased every 1 second.
+// It does nothing if the limiter is already started.
 func (lc *LimitCounter) StartLimiter() {
-	ticker := time.NewTicker(time.Second * 1)
-	quit := make(chan struct{})
-	go tickerToDecrease(ticker, quit, lc)
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.quit != nil {
+		return
+	}
+	ticker := time.NewTicker(lc.interval)
+	lc.quit = make(chan struct{})
+	lc.done = make(chan struct{})
+	go tickerToDecrease(ticker, lc.quit, lc.done, lc)
+}
+
+// Stop stops the ticker of the limiter and waits until its goroutine exits.
+// It does nothing if the limiter is not started or already stopped.
+func (lc *LimitCounter) Stop() {
+	lc.mu.Lock()
+	quit, done := lc.quit, lc.done
+	lc.quit, lc.done = nil, nil
+	lc.mu.Unlock()
+	if quit == nil {
+		return
+	}
+
+	// the lock is released, because the goroutine may be waiting for it to decrease the count
+	close(quit)
+	<-done
 }
 
 // get returns the count.
@@ -76,7 +108,9 @@ func (lc *LimitCounter) isLimitReached() bool {
 }
 
 // tickerToDecrease decreases the count every given ticker.
-func tickerToDecrease(ticker *time.Ticker, quit chan struct{}, lc *LimitCounter) {
+// It closes the done channel when it exits.
+func tickerToDecrease(ticker *time.Ticker, quit, done chan struct{}, lc *LimitCounter) {
+	defer close(done)
 	for {
 		select {
 		case <-ticker.C:
@@ -66,3 +66,30 @@ func TestLimitCounter(t *testing.T) {
 	}
 
 }
+
+func TestLimitCounterStop(t *testing.T) {
+	lc := NewLimitCounter()
+	lc.interval = time.Millisecond
+	lc.Stop()
+
+	lc.StartLimiter()
+	lc.StartLimiter()
+	done := lc.done
+	lc.Stop()
+	lc.Stop()
+
+	select {
+	case <-done:
+	default:
+		t.Fatalf("ticker goroutine supposed to exit when Stop returns")
+	}
+
+	// nothing decreases the count after the stop
+	for i := 0; i < 10; i++ {
+		lc.increase()
+	}
+	time.Sleep(lc.interval * 10)
+	if c := lc.get(); c != 10 {
+		t.Errorf("get supposed to return 10 after stop but returned %d", c)
+	}
+}
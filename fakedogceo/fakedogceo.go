@@ -0,0 +1,376 @@
+// fakedogceo is a fake of the dog.ceo API which serves an embedded fixture set.
+// It is used for hermetic tests and offline demos.
+//
+// It serves the following endpoints:
+//
+//	GET /api/breeds/list/all
+//	GET /api/breeds/image/random
+//	GET /api/breed/{breed}/list
+//	GET /api/breed/{breed}/images/random
+//	GET /api/breed/{breed}/images/random/{count}
+//	GET /api/breed/{breed}/{sub-breed}/images/random
+//	GET /api/breed/{breed}/{sub-breed}/images/random/{count}
+//	GET /breeds/{breed-sub-breed}/{file}
+package fakedogceo
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIPath is the path prefix of the API endpoints.
+// The base URL of the fake API is the server URL followed by APIPath.
+const APIPath = "/api"
+
+// maxImageCount is the maximum number of images returned by the multi-image endpoints.
+// It is the same limit with the dog.ceo API.
+const maxImageCount = 50
+
+// fixtures holds the images of every breed and sub-breed.
+// The directory names follow the dog.ceo naming: "{breed}" or "{breed}-{sub-breed}".
+//
+//go:embed fixtures/breeds
+var fixtures embed.FS
+
+// Options holds the knobs of the fake server.
+type Options struct {
+	// Latency is added to every response.
+	Latency time.Duration
+
+	// ErrorRate is the probability of responding with 500 Internal Server Error.
+	// It must be between 0 and 1.
+	ErrorRate float64
+
+	// NotFoundRate is the probability of responding with 404 Not Found even if the resource exists.
+	// It must be between 0 and 1.
+	NotFoundRate float64
+
+	// Seed is the seed of the random source which picks the images and the failures.
+	// If it is zero, the current time is used.
+	Seed int64
+}
+
+// Server is the fake dog.ceo API server. It implements http.Handler.
+type Server struct {
+	opts Options
+
+	// Mutex is used for handling the concurrent
+	// access to the random source
+	mu  sync.Mutex
+	rnd *rand.Rand
+
+	// breeds maps every breed to its sub-breeds.
+	breeds map[string][]string
+
+	// images maps every image directory to its image file names.
+	images map[string][]string
+}
+
+// apiResponse is the response structure of the dog.ceo API.
+type apiResponse struct {
+	Message interface{} `json:"message"`
+	Status  string      `json:"status"`
+	Code    int         `json:"code,omitempty"`
+}
+
+// New returns a new fake server which serves the embedded fixture set with the given options.
+func New(opts Options) *Server {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	s := &Server{
+		opts:   opts,
+		rnd:    rand.New(rand.NewSource(seed)),
+		breeds: make(map[string][]string),
+		images: make(map[string][]string),
+	}
+
+	dirs, err := fs.ReadDir(fixtures, "fixtures/breeds")
+	if err != nil {
+		panic(fmt.Sprintf("fakedogceo: failed to read the fixtures : %v", err))
+	}
+
+	for _, dir := range dirs {
+		files, err := fs.ReadDir(fixtures, path.Join("fixtures/breeds", dir.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("fakedogceo: failed to read the fixtures : %v", err))
+		}
+		for _, file := range files {
+			s.images[dir.Name()] = append(s.images[dir.Name()], file.Name())
+		}
+
+		breed, subBreed, hasSubBreed := strings.Cut(dir.Name(), "-")
+		if _, ok := s.breeds[breed]; !ok {
+			s.breeds[breed] = []string{}
+		}
+		if hasSubBreed {
+			s.breeds[breed] = append(s.breeds[breed], subBreed)
+		}
+	}
+
+	return s
+}
+
+// Breeds returns a copy of the breeds mapped to their sub-breeds.
+func (s *Server) Breeds() map[string][]string {
+	breeds := make(map[string][]string, len(s.breeds))
+	for breed, subBreeds := range s.breeds {
+		breeds[breed] = append([]string{}, subBreeds...)
+	}
+	return breeds
+}
+
+// ImagePaths returns the paths of all the images which are served by the fake server.
+// Example: "/breeds/husky/n02110185_12678.jpg"
+func (s *Server) ImagePaths() []string {
+	var paths []string
+	for dir, files := range s.images {
+		for _, file := range files {
+			paths = append(paths, path.Join("/breeds", dir, file))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ServeHTTP serves the fake API and the images.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if s.chance(s.opts.ErrorRate) {
+		writeError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	if s.chance(s.opts.NotFoundRate) {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, APIPath+"/"):
+		s.serveAPI(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, APIPath+"/"), "/"))
+	case strings.HasPrefix(r.URL.Path, "/breeds/"):
+		s.serveImage(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "No route found")
+	}
+}
+
+// serveAPI routes the given path segments to the API endpoints.
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case matches(segments, "breeds", "list", "all"):
+		writeJSON(w, http.StatusOK, apiResponse{Message: s.Breeds(), Status: "success"})
+	case matches(segments, "breeds", "image", "random"):
+		s.serveRandomImages(w, r, s.allDirs(), "", false)
+	case len(segments) == 3 && matches(segments, "breed", "*", "list"):
+		s.serveSubBreedList(w, segments[1])
+	case len(segments) >= 4 && segments[0] == "breed":
+		s.serveBreedImages(w, r, segments[1:])
+	default:
+		writeError(w, http.StatusNotFound, "No route found")
+	}
+}
+
+// serveSubBreedList serves the sub-breeds of the given breed.
+func (s *Server) serveSubBreedList(w http.ResponseWriter, breed string) {
+	subBreeds, ok := s.breeds[breed]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Breed not found (master breed does not exist)")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiResponse{Message: subBreeds, Status: "success"})
+}
+
+// serveBreedImages serves the random image endpoints of a breed or a sub-breed.
+// The segments are the path segments after "breed/".
+// Examples:
+// [husky images random]
+// [husky images random 3]
+// [australian shepherd images random]
+// [australian shepherd images random 3]
+func (s *Server) serveBreedImages(w http.ResponseWriter, r *http.Request, segments []string) {
+	breed := segments[0]
+	subBreed := ""
+	rest := segments[1:]
+	if len(rest) > 0 && rest[0] != "images" {
+		subBreed = rest[0]
+		rest = rest[1:]
+	}
+
+	if len(rest) < 2 || len(rest) > 3 || rest[0] != "images" || rest[1] != "random" {
+		writeError(w, http.StatusNotFound, "No route found")
+		return
+	}
+
+	count := ""
+	if len(rest) == 3 {
+		count = rest[2]
+	}
+
+	subBreeds, ok := s.breeds[breed]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Breed not found (master breed does not exist)")
+		return
+	}
+
+	var dirs []string
+	if subBreed != "" {
+		if !contains(subBreeds, subBreed) {
+			writeError(w, http.StatusNotFound, "Breed not found (sub breed does not exist)")
+			return
+		}
+		dirs = []string{breed + "-" + subBreed}
+	} else {
+		dirs = s.breedDirs(breed)
+	}
+
+	s.serveRandomImages(w, r, dirs, count, len(rest) == 3)
+}
+
+// serveRandomImages serves random image URLs from the given directories.
+// If isMulti is true, it serves a list of image URLs with the given count.
+// Otherwise, it serves a single image URL.
+func (s *Server) serveRandomImages(w http.ResponseWriter, r *http.Request, dirs []string, count string, isMulti bool) {
+	var urls []string
+	for _, dir := range dirs {
+		for _, file := range s.images[dir] {
+			urls = append(urls, imageBaseURL(r)+path.Join("/breeds", dir, file))
+		}
+	}
+	sort.Strings(urls)
+
+	s.mu.Lock()
+	s.rnd.Shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+	s.mu.Unlock()
+
+	if !isMulti {
+		writeJSON(w, http.StatusOK, apiResponse{Message: urls[0], Status: "success"})
+		return
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		n = 1
+	}
+	if n > maxImageCount {
+		n = maxImageCount
+	}
+	if n > len(urls) {
+		n = len(urls)
+	}
+	writeJSON(w, http.StatusOK, apiResponse{Message: urls[:n], Status: "success"})
+}
+
+// serveImage serves the image bytes of the requested image path.
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request) {
+	image, err := fixtures.ReadFile(path.Join("fixtures", path.Clean(r.URL.Path)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(image)
+}
+
+// breedDirs returns the image directories of the given breed including its sub-breeds.
+func (s *Server) breedDirs(breed string) []string {
+	var dirs []string
+	for dir := range s.images {
+		if dir == breed || strings.HasPrefix(dir, breed+"-") {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// allDirs returns all the image directories.
+func (s *Server) allDirs() []string {
+	dirs := make([]string, 0, len(s.images))
+	for dir := range s.images {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// chance returns true with the given probability.
+func (s *Server) chance(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64() < probability
+}
+
+// imageBaseURL returns the URL of the server which received the request.
+// The image URLs point to the fake server itself.
+func imageBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+// matches returns true if the segments match the given pattern.
+// "*" matches any segment.
+func matches(segments []string, pattern ...string) bool {
+	if len(segments) != len(pattern) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// contains returns true if the given slice contains the given value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError writes an error response in the dog.ceo error format.
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, apiResponse{Message: message, Status: "error", Code: statusCode})
+}
+
+// writeJSON writes the given response as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, statusCode int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(resp)
+}
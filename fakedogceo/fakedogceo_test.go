@@ -0,0 +1,254 @@
+package fakedogceo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// get returns the status code and the body of the given path.
+func get(t *testing.T, ts *httptest.Server, path string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestBreedList(t *testing.T) {
+	ts := httptest.NewServer(New(Options{Seed: 1}))
+	defer ts.Close()
+
+	statusCode, body := get(t, ts, "/api/breeds/list/all")
+	if statusCode != http.StatusOK {
+		t.Fatalf("status code is not correct got %d want %d", statusCode, http.StatusOK)
+	}
+
+	resp := struct {
+		Message map[string][]string `json:"message"`
+		Status  string              `json:"status"`
+	}{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	if resp.Status != "success" {
+		t.Errorf("status is not correct got %s", resp.Status)
+	}
+	if subBreeds, ok := resp.Message["husky"]; !ok || len(subBreeds) != 0 {
+		t.Errorf("husky supposed to be in the list without sub-breeds got %v", subBreeds)
+	}
+	if subBreeds := resp.Message["australian"]; len(subBreeds) != 1 || subBreeds[0] != "shepherd" {
+		t.Errorf("australian supposed to have the shepherd sub-breed got %v", subBreeds)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	tests := map[string]struct {
+		Path               string
+		ExpectedStatusCode int
+		ExpectedContains   string
+	}{
+		"sub-breed list": {
+			Path:               "/api/breed/hound/list",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedContains:   `"afghan"`,
+		},
+		"sub-breed list of unknown breed": {
+			Path:               "/api/breed/INVALID/list",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedContains:   "master breed does not exist",
+		},
+		"random image of breed": {
+			Path:               "/api/breed/husky/images/random",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedContains:   "/breeds/husky/",
+		},
+		"random image of breed with sub-breeds": {
+			Path:               "/api/breed/australian/images/random",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedContains:   "/breeds/australian-shepherd/",
+		},
+		"random image of sub-breed": {
+			Path:               "/api/breed/wolfhound/irish/images/random",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedContains:   "/breeds/wolfhound-irish/",
+		},
+		"random image of any breed": {
+			Path:               "/api/breeds/image/random",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedContains:   "/breeds/",
+		},
+		"random image of unknown breed": {
+			Path:               "/api/breed/INVALID/images/random",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedContains:   "master breed does not exist",
+		},
+		"random image of unknown sub-breed": {
+			Path:               "/api/breed/australian/INVALID/images/random",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedContains:   "sub breed does not exist",
+		},
+		"random image of empty breed": {
+			Path:               "/api/breed//images/random",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedContains:   "master breed does not exist",
+		},
+		"unknown route": {
+			Path:               "/api/unknown",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedContains:   "No route found",
+		},
+		"image": {
+			Path:               "/breeds/husky/n02110185_12678.jpg",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedContains:   "",
+		},
+		"unknown image": {
+			Path:               "/breeds/INVALID/no.jpg",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedContains:   "",
+		},
+	}
+
+	ts := httptest.NewServer(New(Options{Seed: 1}))
+	t.Cleanup(ts.Close)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			statusCode, body := get(t, ts, test.Path)
+			if statusCode != test.ExpectedStatusCode {
+				t.Fatalf("status code is not correct got %d want %d", statusCode, test.ExpectedStatusCode)
+			}
+			if !strings.Contains(string(body), test.ExpectedContains) {
+				t.Fatalf("body %s is expected to contain %s", body, test.ExpectedContains)
+			}
+		})
+	}
+}
+
+func TestMultipleImages(t *testing.T) {
+	tests := map[string]struct {
+		Path          string
+		ExpectedCount int
+	}{
+		"fewer than available": {
+			Path:          "/api/breed/husky/images/random/2",
+			ExpectedCount: 2,
+		},
+		"more than available": {
+			Path:          "/api/breed/husky/images/random/10",
+			ExpectedCount: 3,
+		},
+		"sub-breed": {
+			Path:          "/api/breed/hound/afghan/images/random/2",
+			ExpectedCount: 2,
+		},
+		"invalid count": {
+			Path:          "/api/breed/husky/images/random/abc",
+			ExpectedCount: 1,
+		},
+	}
+
+	ts := httptest.NewServer(New(Options{Seed: 1}))
+	t.Cleanup(ts.Close)
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			statusCode, body := get(t, ts, test.Path)
+			if statusCode != http.StatusOK {
+				t.Fatalf("status code is not correct got %d want %d", statusCode, http.StatusOK)
+			}
+			resp := struct {
+				Message []string `json:"message"`
+			}{}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if len(resp.Message) != test.ExpectedCount {
+				t.Fatalf("want %d images; got %d", test.ExpectedCount, len(resp.Message))
+			}
+			for _, url := range resp.Message {
+				if !strings.HasPrefix(url, ts.URL+"/breeds/") {
+					t.Fatalf("image url %s supposed to point to the fake server", url)
+				}
+			}
+		})
+	}
+}
+
+func TestImagePathsAreServed(t *testing.T) {
+	s := New(Options{Seed: 1})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	paths := s.ImagePaths()
+	if len(paths) == 0 {
+		t.Fatalf("there are no images")
+	}
+	for _, path := range paths {
+		statusCode, body := get(t, ts, path)
+		if statusCode != http.StatusOK || len(body) == 0 {
+			t.Fatalf("image %s is not served", path)
+		}
+	}
+}
+
+func TestKnobs(t *testing.T) {
+	tests := map[string]struct {
+		Options            Options
+		ExpectedStatusCode int
+	}{
+		"error rate": {
+			Options:            Options{ErrorRate: 1, Seed: 1},
+			ExpectedStatusCode: http.StatusInternalServerError,
+		},
+		"not found rate": {
+			Options:            Options{NotFoundRate: 1, Seed: 1},
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		"no failures": {
+			Options:            Options{Seed: 1},
+			ExpectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ts := httptest.NewServer(New(test.Options))
+			defer ts.Close()
+			for i := 0; i < 5; i++ {
+				statusCode, _ := get(t, ts, "/api/breed/husky/images/random")
+				if statusCode != test.ExpectedStatusCode {
+					t.Fatalf("status code is not correct got %d want %d", statusCode, test.ExpectedStatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	ts := httptest.NewServer(New(Options{Latency: time.Millisecond * 100, Seed: 1}))
+	defer ts.Close()
+
+	start := time.Now()
+	get(t, ts, "/api/breeds/list/all")
+	if elapsed := time.Since(start); elapsed < time.Millisecond*100 {
+		t.Errorf("response supposed to be delayed at least 100ms; got %v", elapsed)
+	}
+}
@@ -0,0 +1,191 @@
+// health_prober checks the dependencies of the server in the background.
+// The results are used to tell the load balancers whether the server can serve the requests.
+package health_prober
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNotProbed is the result of a check which has not run yet.
+var ErrNotProbed = errors.New("not probed yet")
+
+// Check checks a dependency and returns an error if it is not healthy.
+type Check func(ctx context.Context) error
+
+// Settings holds the settings of the prober.
+type Settings struct {
+	// Interval is the time between two probes.
+	Interval time.Duration
+
+	// Timeout is the time limit of a single check.
+	Timeout time.Duration
+
+	// OnChange is called after a probe which changed the result of a check, it can be nil.
+	// The error is nil if the check became healthy.
+	OnChange func(name string, err error)
+
+	// OnProbe is called after every probe with the results of all the checks, it can be nil.
+	OnProbe func(results map[string]error)
+}
+
+// namedCheck is a check with its name.
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Prober holds the required variables to compose a health prober.
+type Prober struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the results
+	mu sync.RWMutex
+
+	settings Settings
+
+	checks []namedCheck
+
+	// results holds the error of the last run of every check, nil means healthy.
+	results map[string]error
+
+	// quit is used to stop the prober.
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewProber returns a new Prober without any checks.
+func NewProber(settings Settings) *Prober {
+	return &Prober{
+		settings: settings,
+		results:  make(map[string]error),
+		quit:     make(chan struct{}),
+	}
+}
+
+// AddCheck adds a check with the given name.
+// The checks must be added before the prober is started.
+func (p *Prober) AddCheck(name string, check Check) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks = append(p.checks, namedCheck{name: name, check: check})
+	p.results[name] = ErrNotProbed
+}
+
+// Probe runs all the checks concurrently, stores their results and returns them.
+// Every check is limited by the timeout of the settings.
+func (p *Prober) Probe(ctx context.Context) map[string]error {
+	p.mu.RLock()
+	checks := p.checks
+	p.mu.RUnlock()
+
+	results := make(map[string]error, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			checkCtx, cancel := p.checkContext(ctx)
+			defer cancel()
+			err := c.check(checkCtx)
+			mu.Lock()
+			results[c.name] = err
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	changed := make(map[string]error)
+	for name, err := range results {
+		if (p.results[name] == nil) != (err == nil) {
+			changed[name] = err
+		}
+		p.results[name] = err
+	}
+	p.mu.Unlock()
+
+	if p.settings.OnChange != nil {
+		for _, name := range sortedNames(changed) {
+			p.settings.OnChange(name, changed[name])
+		}
+	}
+	if p.settings.OnProbe != nil {
+		p.settings.OnProbe(results)
+	}
+	return results
+}
+
+// Results returns the result of the last run of every check.
+// The checks which have not run yet have ErrNotProbed.
+func (p *Prober) Results() map[string]error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	results := make(map[string]error, len(p.results))
+	for name, err := range p.results {
+		results[name] = err
+	}
+	return results
+}
+
+// Healthy returns true if the last run of every check passed.
+func (p *Prober) Healthy() bool {
+	return Healthy(p.Results())
+}
+
+// Start probes every interval of the settings in the background.
+func (p *Prober) Start() {
+	ticker := time.NewTicker(p.settings.Interval)
+	go tickerToProbe(ticker, p.quit, p)
+}
+
+// Stop stops the prober. It is safe to call Stop more than once.
+func (p *Prober) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+	})
+}
+
+// Healthy returns true if all the given results passed.
+func Healthy(results map[string]error) bool {
+	for _, err := range results {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checkContext returns the context of a single check.
+func (p *Prober) checkContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.settings.Timeout > 0 {
+		return context.WithTimeout(ctx, p.settings.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// sortedNames returns the names of the given results in order, so the changes are reported in the same order.
+func sortedNames(results map[string]error) []string {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tickerToProbe probes every given ticker.
+func tickerToProbe(ticker *time.Ticker, quit chan struct{}, p *Prober) {
+	for {
+		select {
+		case <-ticker.C:
+			p.Probe(context.Background())
+		case <-quit:
+			ticker.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package health_prober
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// switchCheck returns a check which fails while the given flag is set.
+func switchCheck(failing *int32) Check {
+	return func(ctx context.Context) error {
+		if atomic.LoadInt32(failing) == 1 {
+			return errors.New("dependency is down")
+		}
+		return nil
+	}
+}
+
+func TestNewProber(t *testing.T) {
+	p := NewProber(Settings{})
+	if !p.Healthy() {
+		t.Errorf("prober without checks supposed to be healthy")
+	}
+
+	p.AddCheck("upstream", switchCheck(new(int32)))
+	if p.Healthy() {
+		t.Errorf("prober supposed to be unhealthy before the first probe")
+	}
+	if err := p.Results()["upstream"]; !errors.Is(err, ErrNotProbed) {
+		t.Errorf("want ErrNotProbed; got %v", err)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	tests := map[string]struct {
+		UpstreamDown bool
+		CatalogDown  bool
+		Healthy      bool
+	}{
+		"all healthy": {
+			Healthy: true,
+		},
+		"upstream is down": {
+			UpstreamDown: true,
+			Healthy:      false,
+		},
+		"catalog is stale": {
+			CatalogDown: true,
+			Healthy:     false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var upstreamDown, catalogDown int32
+			if test.UpstreamDown {
+				upstreamDown = 1
+			}
+			if test.CatalogDown {
+				catalogDown = 1
+			}
+
+			p := NewProber(Settings{})
+			p.AddCheck("upstream", switchCheck(&upstreamDown))
+			p.AddCheck("catalog", switchCheck(&catalogDown))
+
+			results := p.Probe(context.Background())
+			if (results["upstream"] != nil) != test.UpstreamDown || (results["catalog"] != nil) != test.CatalogDown {
+				t.Fatalf("results are not correct %v", results)
+			}
+			if p.Healthy() != test.Healthy {
+				t.Fatalf("want healthy %t; got %t", test.Healthy, p.Healthy())
+			}
+		})
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	p := NewProber(Settings{Timeout: time.Millisecond * 10})
+	p.AddCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	results := p.Probe(context.Background())
+	if !errors.Is(results["slow"], context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded; got %v", results["slow"])
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("probe supposed to stop at the timeout; took %v", elapsed)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+	var failing int32
+
+	p := NewProber(Settings{OnChange: func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			changes = append(changes, name+" down")
+		} else {
+			changes = append(changes, name+" up")
+		}
+	}})
+	p.AddCheck("upstream", switchCheck(&failing))
+
+	// not probed -> healthy -> healthy -> unhealthy -> unhealthy -> healthy
+	p.Probe(context.Background())
+	p.Probe(context.Background())
+	atomic.StoreInt32(&failing, 1)
+	p.Probe(context.Background())
+	p.Probe(context.Background())
+	atomic.StoreInt32(&failing, 0)
+	p.Probe(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"upstream up", "upstream down", "upstream up"}
+	if len(changes) != len(expected) {
+		t.Fatalf("want changes %v; got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("want changes %v; got %v", expected, changes)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	var probes int32
+	p := NewProber(Settings{
+		Interval: time.Millisecond * 10,
+		OnProbe: func(results map[string]error) {
+			atomic.AddInt32(&probes, 1)
+		},
+	})
+	p.AddCheck("upstream", switchCheck(new(int32)))
+	p.Start()
+
+	deadline := time.Now().Add(time.Second * 2)
+	for atomic.LoadInt32(&probes) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("prober supposed to probe in the background")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	p.Stop()
+	p.Stop()
+	if !p.Healthy() {
+		t.Fatalf("prober supposed to be healthy")
+	}
+}
@@ -0,0 +1,325 @@
+// image_cache is a thread safe cache of the images keyed by their URLs.
+// It keeps the images in memory in a least recently used list bounded by the total bytes,
+// and optionally on disk in a second bounded tier which survives the restarts.
+package image_cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileExt is the extension of the image files of the disk tier.
+const fileExt = ".img"
+
+// defaultDirPerm is the permission of the directory of the disk tier.
+const defaultDirPerm os.FileMode = 0755
+
+// Settings holds the settings of the cache.
+type Settings struct {
+	// MaxBytes is the memory budget of the cache.
+	MaxBytes int64
+
+	// TTL is the time an image is kept after it is added. Zero means the images never expire.
+	TTL time.Duration
+
+	// Dir is the directory of the disk tier. Empty disables the disk tier.
+	Dir string
+
+	// MaxDiskBytes is the disk budget of the disk tier.
+	MaxDiskBytes int64
+}
+
+// Stats holds the statistics of the cache.
+type Stats struct {
+	// Hits is the number of the images served from the cache.
+	Hits uint64
+
+	// DiskHits is the number of the hits which are served from the disk tier.
+	DiskHits uint64
+
+	// Misses is the number of the images which are not in the cache.
+	Misses uint64
+
+	// Evictions is the number of the images which are removed to stay in the budget or because they are expired.
+	Evictions uint64
+
+	// Entries and Bytes are the number and the total size of the images in memory.
+	Entries int
+	Bytes   int64
+
+	// DiskEntries and DiskBytes are the number and the total size of the images on disk.
+	DiskEntries int
+	DiskBytes   int64
+}
+
+// String returns the statistics as a human readable text.
+func (s Stats) String() string {
+	return fmt.Sprintf("hits: %d (disk: %d) misses: %d evictions: %d memory: %d images %d bytes disk: %d images %d bytes",
+		s.Hits, s.DiskHits, s.Misses, s.Evictions, s.Entries, s.Bytes, s.DiskEntries, s.DiskBytes)
+}
+
+// HitRatio returns the fraction of the lookups which are served from the cache.
+// It is 0 if there are no lookups yet.
+func (s Stats) HitRatio() float64 {
+	lookups := s.Hits + s.Misses
+	if lookups == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(lookups)
+}
+
+// Cache holds the required variables to compose an image cache.
+type Cache struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the lists and the statistics
+	mu sync.Mutex
+
+	settings Settings
+
+	memory *lru
+
+	// disk is nil if the disk tier is disabled.
+	// Its keys are the file names of the images.
+	disk *lru
+
+	stats Stats
+
+	// now returns the current time, it is replaced in the tests.
+	now func() time.Time
+}
+
+// NewCache returns a new Cache with the given settings.
+// If the disk tier is enabled, it creates the directory and loads the images which are already there.
+func NewCache(settings Settings) (*Cache, error) {
+	c := &Cache{
+		settings: settings,
+		memory:   newLRU(settings.MaxBytes),
+		now:      time.Now,
+	}
+
+	if settings.Dir != "" {
+		c.disk = newLRU(settings.MaxDiskBytes)
+		if err := c.loadDisk(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Get returns the image of the given URL and true if it is in the cache.
+// An image found on disk is moved to memory.
+// The returned image is shared with the cache, it must not be modified.
+func (c *Cache) Get(imageURL string) ([]byte, bool) {
+	c.mu.Lock()
+	now := c.now()
+
+	if e, ok := c.memory.get(imageURL); ok {
+		if !e.expired(now) {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.data, true
+		}
+		c.memory.remove(imageURL)
+		c.stats.Evictions++
+	}
+
+	if c.disk == nil {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+
+	name := fileName(imageURL)
+	e, ok := c.disk.get(name)
+	if ok && e.expired(now) {
+		c.disk.remove(name)
+		c.stats.Evictions++
+		c.removeFile(name)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	expiresAt := e.expiresAt
+	c.mu.Unlock()
+
+	// the file is read without the lock, so the other requests are not blocked by the disk
+	data, err := os.ReadFile(filepath.Join(c.settings.Dir, name))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.disk.remove(name)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.stats.DiskHits++
+	c.stats.Evictions += uint64(len(c.memory.add(&entry{key: imageURL, data: data, size: int64(len(data)), expiresAt: expiresAt})))
+	return data, true
+}
+
+// Set adds the image of the given URL to the cache.
+// The least recently used images are evicted to stay in the budget.
+// If the disk tier is enabled, the image is also written to disk.
+func (c *Cache) Set(imageURL string, data []byte) {
+	c.mu.Lock()
+	var expiresAt time.Time
+	if c.settings.TTL > 0 {
+		expiresAt = c.now().Add(c.settings.TTL)
+	}
+	c.stats.Evictions += uint64(len(c.memory.add(&entry{key: imageURL, data: data, size: int64(len(data)), expiresAt: expiresAt})))
+	maxDiskBytes := c.settings.MaxDiskBytes
+	c.mu.Unlock()
+
+	if c.disk == nil || int64(len(data)) > maxDiskBytes {
+		return
+	}
+
+	name := fileName(imageURL)
+	if err := c.writeFile(name, data); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	evicted := c.disk.add(&entry{key: name, size: int64(len(data)), expiresAt: expiresAt})
+	c.stats.Evictions += uint64(len(evicted))
+	c.mu.Unlock()
+
+	for _, e := range evicted {
+		c.removeFile(e.key)
+	}
+}
+
+// Update changes the budgets and the TTL of the cache without emptying it.
+// The least recently used images are evicted if they do not fit into the new budgets.
+// The new TTL is used for the images added after the update.
+// The directory of the disk tier can not be changed, so it must be the same.
+func (c *Cache) Update(settings Settings) error {
+	c.mu.Lock()
+	if settings.Dir != c.settings.Dir {
+		c.mu.Unlock()
+		return fmt.Errorf("cache directory can not be changed : %v", settings.Dir)
+	}
+	// the directory is read without the lock, so only the other settings are written
+	c.settings.MaxBytes = settings.MaxBytes
+	c.settings.TTL = settings.TTL
+	c.settings.MaxDiskBytes = settings.MaxDiskBytes
+	c.stats.Evictions += uint64(len(c.memory.resize(settings.MaxBytes)))
+
+	var evicted []*entry
+	if c.disk != nil {
+		evicted = c.disk.resize(settings.MaxDiskBytes)
+		c.stats.Evictions += uint64(len(evicted))
+	}
+	c.mu.Unlock()
+
+	for _, e := range evicted {
+		c.removeFile(e.key)
+	}
+	return nil
+}
+
+// Stats returns the statistics of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.memory.len()
+	stats.Bytes = c.memory.bytes
+	if c.disk != nil {
+		stats.DiskEntries = c.disk.len()
+		stats.DiskBytes = c.disk.bytes
+	}
+	return stats
+}
+
+// loadDisk adds the images which are already in the directory to the disk tier.
+// The older images are evicted first if they do not fit into the budget.
+func (c *Cache) loadDisk() error {
+	if err := os.MkdirAll(c.settings.Dir, defaultDirPerm); err != nil {
+		return fmt.Errorf("failed to create the cache directory : %v", err)
+	}
+
+	dirEntries, err := os.ReadDir(c.settings.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read the cache directory : %v", err)
+	}
+
+	var files []os.FileInfo
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		// leftovers of the interrupted writes
+		if strings.HasSuffix(dirEntry.Name(), ".tmp") {
+			c.removeFile(dirEntry.Name())
+			continue
+		}
+		if !strings.HasSuffix(dirEntry.Name(), fileExt) {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	now := c.now()
+	for _, info := range files {
+		e := &entry{key: info.Name(), size: info.Size()}
+		if c.settings.TTL > 0 {
+			e.expiresAt = info.ModTime().Add(c.settings.TTL)
+		}
+		if e.expired(now) || e.size > c.settings.MaxDiskBytes {
+			c.removeFile(e.key)
+			continue
+		}
+		for _, evicted := range c.disk.add(e) {
+			c.removeFile(evicted.key)
+		}
+	}
+	return nil
+}
+
+// writeFile writes the image to a temporary file and renames it,
+// so a reader never sees a half written image.
+func (c *Cache) writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(c.settings.Dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(c.settings.Dir, name))
+}
+
+// removeFile removes the file of the disk tier, the errors are ignored.
+func (c *Cache) removeFile(name string) {
+	os.Remove(filepath.Join(c.settings.Dir, name))
+}
+
+// fileName returns the file name of the given image URL in the disk tier.
+func fileName(imageURL string) string {
+	hash := sha256.Sum256([]byte(imageURL))
+	return hex.EncodeToString(hash[:]) + fileExt
+}
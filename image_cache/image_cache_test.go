@@ -0,0 +1,249 @@
+package image_cache
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCache returns a cache with a manual clock and the pointer of its current time.
+func newTestCache(t *testing.T, settings Settings) (*Cache, *time.Time) {
+	c, err := NewCache(settings)
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	now := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestGetAndSet(t *testing.T) {
+	c, _ := newTestCache(t, Settings{MaxBytes: 10})
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a supposed to be a miss")
+	}
+
+	c.Set("a", []byte("1234"))
+	image, ok := c.Get("a")
+	if !ok || string(image) != "1234" {
+		t.Fatalf("want a hit with 1234; got %v %s", ok, image)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes != 4 {
+		t.Fatalf("stats are not correct %v", stats)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c, _ := newTestCache(t, Settings{MaxBytes: 10})
+
+	c.Set("a", []byte("1234"))
+	c.Set("b", []byte("1234"))
+	c.Get("a")
+	c.Set("c", []byte("1234"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatalf("b supposed to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("a supposed to be in the cache")
+	}
+
+	// an image bigger than the budget is not cached
+	c.Set("big", make([]byte, 11))
+	if _, ok := c.Get("big"); ok {
+		t.Fatalf("big image supposed to be rejected")
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.Bytes != 8 {
+		t.Fatalf("stats are not correct %v", stats)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c, now := newTestCache(t, Settings{MaxBytes: 10, TTL: time.Minute})
+
+	c.Set("a", []byte("1234"))
+
+	*now = now.Add(time.Second * 59)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatalf("a supposed to be in the cache before the ttl")
+	}
+
+	*now = now.Add(time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a supposed to be expired after the ttl")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Evictions != 1 {
+		t.Fatalf("stats are not correct %v", stats)
+	}
+}
+
+func TestDiskTier(t *testing.T) {
+	dir := t.TempDir()
+	settings := Settings{MaxBytes: 10, Dir: dir, MaxDiskBytes: 100}
+
+	c, _ := newTestCache(t, settings)
+	c.Set("a", []byte("1234"))
+	c.Set("b", []byte("5678"))
+
+	// a new cache with the same directory serves the images from disk
+	c, _ = newTestCache(t, settings)
+	if stats := c.Stats(); stats.DiskEntries != 2 || stats.DiskBytes != 8 {
+		t.Fatalf("images supposed to be loaded from disk %v", stats)
+	}
+
+	image, ok := c.Get("a")
+	if !ok || string(image) != "1234" {
+		t.Fatalf("want a hit with 1234; got %v %s", ok, image)
+	}
+	// the second get is served from memory
+	c.Get("a")
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.DiskHits != 1 || stats.Entries != 1 {
+		t.Fatalf("stats are not correct %v", stats)
+	}
+}
+
+func TestDiskTierEviction(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := newTestCache(t, Settings{MaxBytes: 4, Dir: dir, MaxDiskBytes: 8})
+
+	c.Set("a", []byte("1234"))
+	c.Set("b", []byte("1234"))
+	c.Set("c", []byte("1234"))
+
+	if _, err := os.Stat(filepath.Join(dir, fileName("a"))); !os.IsNotExist(err) {
+		t.Fatalf("file of a supposed to be removed got %v", err)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a supposed to be evicted from both tiers")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Fatalf("b supposed to be on disk")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	c, now := newTestCache(t, Settings{MaxBytes: 12, Dir: dir, MaxDiskBytes: 12})
+	c.Set("a", []byte("1234"))
+	c.Set("b", []byte("1234"))
+	c.Set("c", []byte("1234"))
+
+	if err := c.Update(Settings{MaxBytes: 8, TTL: time.Minute, Dir: dir, MaxDiskBytes: 4}); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	stats := c.Stats()
+	if stats.Bytes != 8 || stats.DiskBytes != 4 || stats.Evictions != 3 {
+		t.Fatalf("images supposed to be evicted to the new budgets %v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fileName("a"))); !os.IsNotExist(err) {
+		t.Fatalf("file of a supposed to be removed got %v", err)
+	}
+
+	// the new TTL is used for the new images
+	c.Set("d", []byte("1234"))
+	*now = now.Add(time.Minute)
+	if _, ok := c.Get("d"); ok {
+		t.Fatalf("d supposed to be expired")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Fatalf("c supposed to be kept without expiry")
+	}
+
+	if err := c.Update(Settings{MaxBytes: 8, Dir: t.TempDir(), MaxDiskBytes: 4}); err == nil {
+		t.Errorf("error supposed to be returned for a new directory")
+	}
+}
+
+func TestDiskTierTTL(t *testing.T) {
+	dir := t.TempDir()
+	c, now := newTestCache(t, Settings{MaxBytes: 4, TTL: time.Minute, Dir: dir, MaxDiskBytes: 100})
+
+	c.Set("a", []byte("1234"))
+	// b pushes a out of memory, so it is only on disk
+	c.Set("b", []byte("1234"))
+
+	*now = now.Add(time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("a supposed to be expired on disk")
+	}
+	if _, err := os.Stat(filepath.Join(dir, fileName("a"))); !os.IsNotExist(err) {
+		t.Fatalf("expired file supposed to be removed got %v", err)
+	}
+}
+
+func TestLoadDiskRemovesLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	leftover := filepath.Join(dir, fileName("a")+".123.tmp")
+	if err := os.WriteFile(leftover, []byte("half"), 0644); err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	newTestCache(t, Settings{MaxBytes: 4, Dir: dir, MaxDiskBytes: 100})
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Fatalf("leftover supposed to be removed got %v", err)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	c, err := NewCache(Settings{MaxBytes: 1024, Dir: t.TempDir(), MaxDiskBytes: 2048})
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := fmt.Sprintf("image-%d", (i+j)%30)
+				image := bytes.Repeat([]byte{byte(j)}, 100)
+				if _, ok := c.Get(key); !ok {
+					c.Set(key, image)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Bytes > 1024 || stats.DiskBytes > 2048 {
+		t.Fatalf("cache exceeded the budget %v", stats)
+	}
+	if stats.Hits+stats.Misses != 20*50 {
+		t.Fatalf("want %d lookups; got %d", 20*50, stats.Hits+stats.Misses)
+	}
+}
+
+func TestHitRatio(t *testing.T) {
+	tests := map[string]struct {
+		Stats Stats
+		Ratio float64
+	}{
+		"no lookups": {Stats: Stats{}, Ratio: 0},
+		"all hits":   {Stats: Stats{Hits: 4}, Ratio: 1},
+		"all misses": {Stats: Stats{Misses: 4}, Ratio: 0},
+		"mixed":      {Stats: Stats{Hits: 3, Misses: 1}, Ratio: 0.75},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := test.Stats.HitRatio(); got != test.Ratio {
+				t.Errorf("HitRatio() = %v, want %v", got, test.Ratio)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package image_cache
+
+import (
+	"container/list"
+	"time"
+)
+
+// entry is an item of the lru list.
+type entry struct {
+	key string
+
+	// data is the image, it is nil for the disk tier because the image is in the file.
+	data []byte
+
+	size int64
+
+	expiresAt time.Time
+}
+
+// expired returns true if the entry is expired at the given time.
+// An entry without expiry time never expires.
+func (e *entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// lru is a least recently used list bounded by the total size of its entries.
+// It is not thread safe, the cache guards it with its own lock.
+type lru struct {
+	maxBytes int64
+	bytes    int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+// newLRU returns a new empty lru list with the given size budget.
+func newLRU(maxBytes int64) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry of the given key and marks it as the most recently used.
+func (l *lru) get(key string) (*entry, bool) {
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.ll.MoveToFront(elem)
+	return elem.Value.(*entry), true
+}
+
+// add adds or replaces the given entry and returns the evicted entries.
+// An entry bigger than the budget is not added.
+func (l *lru) add(e *entry) []*entry {
+	if e.size > l.maxBytes {
+		return nil
+	}
+
+	if elem, ok := l.items[e.key]; ok {
+		l.bytes -= elem.Value.(*entry).size
+		elem.Value = e
+		l.ll.MoveToFront(elem)
+	} else {
+		l.items[e.key] = l.ll.PushFront(e)
+	}
+	l.bytes += e.size
+
+	var evicted []*entry
+	for l.bytes > l.maxBytes {
+		oldest := l.ll.Back()
+		evicted = append(evicted, l.removeElement(oldest))
+	}
+	return evicted
+}
+
+// resize changes the size budget and returns the entries evicted to stay in it.
+func (l *lru) resize(maxBytes int64) []*entry {
+	l.maxBytes = maxBytes
+	var evicted []*entry
+	for l.bytes > l.maxBytes {
+		evicted = append(evicted, l.removeElement(l.ll.Back()))
+	}
+	return evicted
+}
+
+// remove removes the entry of the given key.
+func (l *lru) remove(key string) (*entry, bool) {
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	return l.removeElement(elem), true
+}
+
+// removeElement removes the given element from the list and returns its entry.
+func (l *lru) removeElement(elem *list.Element) *entry {
+	e := l.ll.Remove(elem).(*entry)
+	delete(l.items, e.key)
+	l.bytes -= e.size
+	return e
+}
+
+// len returns the number of the entries.
+func (l *lru) len() int {
+	return l.ll.Len()
+}
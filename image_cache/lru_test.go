@@ -0,0 +1,44 @@
+package image_cache
+
+import "testing"
+
+func TestLRU(t *testing.T) {
+	l := newLRU(10)
+
+	l.add(&entry{key: "a", size: 4})
+	l.add(&entry{key: "b", size: 4})
+
+	// a is used, so b is the least recently used one
+	if _, ok := l.get("a"); !ok {
+		t.Fatalf("a supposed to be in the list")
+	}
+
+	evicted := l.add(&entry{key: "c", size: 4})
+	if len(evicted) != 1 || evicted[0].key != "b" {
+		t.Fatalf("want b to be evicted; got %v", evicted)
+	}
+	if l.bytes != 8 || l.len() != 2 {
+		t.Fatalf("want 2 entries and 8 bytes; got %d entries %d bytes", l.len(), l.bytes)
+	}
+
+	// replacing an entry updates the size
+	l.add(&entry{key: "a", size: 2})
+	if l.bytes != 6 || l.len() != 2 {
+		t.Fatalf("want 2 entries and 6 bytes; got %d entries %d bytes", l.len(), l.bytes)
+	}
+
+	// an entry bigger than the budget is not added
+	if evicted := l.add(&entry{key: "big", size: 11}); evicted != nil {
+		t.Fatalf("nothing supposed to be evicted got %v", evicted)
+	}
+	if _, ok := l.get("big"); ok {
+		t.Fatalf("big entry supposed to be rejected")
+	}
+
+	if _, ok := l.remove("a"); !ok {
+		t.Fatalf("a supposed to be removed")
+	}
+	if l.bytes != 4 || l.len() != 1 {
+		t.Fatalf("want 1 entry and 4 bytes; got %d entries %d bytes", l.len(), l.bytes)
+	}
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// These are the types of the RPCs.
+const (
+	unary        = "unary"
+	serverStream = "server_stream"
+	clientStream = "client_stream"
+	bidiStream   = "bidi_stream"
+)
+
+// UnaryServerInterceptor returns a new unary server interceptor which counts the RPCs and measures their latency.
+// A nil Metrics returns an interceptor which only calls the handler.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if m == nil {
+			return handler(ctx, req)
+		}
+		service, method := splitMethodName(info.FullMethod)
+		m.grpcStarted.WithLabelValues(unary, service, method).Inc()
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.handled(unary, service, method, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a new stream server interceptor which counts the RPCs and measures their latency.
+// A nil Metrics returns an interceptor which only calls the handler.
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if m == nil {
+			return handler(srv, stream)
+		}
+		rpcType := streamType(info)
+		service, method := splitMethodName(info.FullMethod)
+		m.grpcStarted.WithLabelValues(rpcType, service, method).Inc()
+		start := time.Now()
+		err := handler(srv, stream)
+		m.handled(rpcType, service, method, err, time.Since(start))
+		return err
+	}
+}
+
+// handled records a completed RPC.
+func (m *Metrics) handled(rpcType, service, method string, err error, duration time.Duration) {
+	m.grpcHandled.WithLabelValues(rpcType, service, method, status.Code(err).String()).Inc()
+	m.grpcDuration.WithLabelValues(rpcType, service, method).Observe(duration.Seconds())
+}
+
+// streamType returns the type of the given stream RPC.
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return bidiStream
+	case info.IsClientStream:
+		return clientStream
+	default:
+		return serverStream
+	}
+}
+
+// splitMethodName splits the full method name into its service and method.
+// Example: "/breed_image.BreedImageService/Search" -> "breed_image.BreedImageService", "Search"
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
@@ -0,0 +1,155 @@
+// metrics collects the Prometheus metrics of the server.
+// All the methods of a nil Metrics do nothing, so the metrics can be disabled by not creating them.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace is the prefix of the metrics of the server.
+const namespace = "dogceo"
+
+// Metrics holds the collectors of the server and the registry they are registered to.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	grpcStarted  *prometheus.CounterVec
+	grpcHandled  *prometheus.CounterVec
+	grpcDuration *prometheus.HistogramVec
+
+	upstreamDuration *prometheus.HistogramVec
+
+	upstreamQueueWait prometheus.Histogram
+
+	rateLimited *prometheus.CounterVec
+
+	imageBytes *prometheus.CounterVec
+}
+
+// New returns a new Metrics with its own registry.
+// The registry also has the Go runtime and the process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		grpcStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "Total number of RPCs started on the server.",
+		}, []string{"grpc_type", "grpc_service", "grpc_method"}),
+		grpcHandled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Histogram of response latency of the RPCs handled by the server.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"grpc_type", "grpc_service", "grpc_method"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Histogram of the latency of the upstream attempts by operation and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "code"}),
+		upstreamQueueWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_queue_wait_seconds",
+			Help:      "Histogram of the wait of the upstream attempts for the outbound limits.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Total number of the requests rejected by the rate limiter.",
+		}, []string{"limiter"}),
+		imageBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "image_bytes_total",
+			Help:      "Total number of the image bytes sent to the clients by RPC.",
+		}, []string{"grpc_method"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.grpcStarted,
+		m.grpcHandled,
+		m.grpcDuration,
+		m.upstreamDuration,
+		m.upstreamQueueWait,
+		m.rateLimited,
+		m.imageBytes,
+	)
+	return m
+}
+
+// Handler returns the HTTP handler which serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Registry returns the registry of the metrics, it is used to register the collectors of the other packages.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// ObserveUpstream records an upstream attempt.
+// Its signature matches data_service.RequestObserver.
+// Transport errors are recorded with the "error" code.
+func (m *Metrics) ObserveUpstream(operation string, statusCode int, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(statusCode)
+	if err != nil {
+		code = "error"
+	}
+	m.upstreamDuration.WithLabelValues(operation, code).Observe(duration.Seconds())
+}
+
+// ObserveQueueWait records the wait of an upstream attempt for the outbound limits.
+// Its signature matches data_service.QueueObserver.
+func (m *Metrics) ObserveQueueWait(wait time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstreamQueueWait.Observe(wait.Seconds())
+}
+
+// RateLimited records a request rejected by the given rate limiter.
+func (m *Metrics) RateLimited(limiter string) {
+	if m == nil {
+		return
+	}
+	m.rateLimited.WithLabelValues(limiter).Inc()
+}
+
+// AddImageBytes records the image bytes sent to a client by the given RPC method.
+func (m *Metrics) AddImageBytes(method string, n int) {
+	if m == nil || n <= 0 {
+		return
+	}
+	m.imageBytes.WithLabelValues(method).Add(float64(n))
+}
+
+// AddCounterFunc registers a counter whose value is read from the given function when the metrics are collected.
+// It is used for the counters which are already kept by the other packages, e.g. the retries of the data source.
+func (m *Metrics) AddCounterFunc(name, help string, fn func() float64) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, fn))
+}
+
+// AddGaugeFunc registers a gauge whose value is read from the given function when the metrics are collected.
+func (m *Metrics) AddGaugeFunc(name, help string, fn func() float64) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, fn))
+}
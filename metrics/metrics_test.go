@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// operationForTest is the upstream operation used by the tests.
+const operationForTest = "breeds"
+
+// newHealthClient starts a health server behind the metrics interceptors and returns its client.
+func newHealthClient(t *testing.T, m *Metrics) grpc_health_v1.HealthClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(m.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(m.StreamServerInterceptor()),
+	)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+func TestServerInterceptors(t *testing.T) {
+	m := New()
+	client := newHealthClient(t, m)
+	ctx := context.Background()
+
+	if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check returned an error : %v", err)
+	}
+	if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: "unknown"}); err == nil {
+		t.Fatal("Check of an unknown service should return an error")
+	}
+
+	watch, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch returned an error : %v", err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatalf("Recv returned an error : %v", err)
+	}
+
+	const service = "grpc.health.v1.Health"
+	if got := testutil.ToFloat64(m.grpcStarted.WithLabelValues(unary, service, "Check")); got != 2 {
+		t.Errorf("started Check RPCs = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.grpcHandled.WithLabelValues(unary, service, "Check", "OK")); got != 1 {
+		t.Errorf("handled OK Check RPCs = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.grpcHandled.WithLabelValues(unary, service, "Check", "NotFound")); got != 1 {
+		t.Errorf("handled NotFound Check RPCs = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.grpcStarted.WithLabelValues(serverStream, service, "Watch")); got != 1 {
+		t.Errorf("started Watch RPCs = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(m.grpcDuration); got != 1 {
+		t.Errorf("latency histograms = %d, want 1", got)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	client := newHealthClient(t, m)
+
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check returned an error : %v", err)
+	}
+
+	// none of these should panic
+	m.ObserveUpstream(operationForTest, 200, nil, time.Second)
+	m.ObserveQueueWait(time.Second)
+	m.RateLimited("token-bucket")
+	m.AddImageBytes("Search", 10)
+	m.AddCounterFunc("test_total", "test", func() float64 { return 0 })
+	m.AddGaugeFunc("test", "test", func() float64 { return 0 })
+}
+
+func TestObserveUpstream(t *testing.T) {
+	m := New()
+	m.ObserveUpstream(operationForTest, 200, nil, time.Millisecond)
+	m.ObserveUpstream(operationForTest, 200, nil, time.Millisecond)
+	m.ObserveUpstream(operationForTest, 503, nil, time.Millisecond)
+	m.ObserveUpstream(operationForTest, 0, errors.New("connection reset"), time.Millisecond)
+
+	if got := testutil.CollectAndCount(m.upstreamDuration); got != 3 {
+		t.Errorf("upstream histograms = %d, want 3", got)
+	}
+}
+
+func TestObserveQueueWait(t *testing.T) {
+	m := New()
+	m.ObserveQueueWait(0)
+	m.ObserveQueueWait(time.Millisecond * 250)
+
+	expected := `
+# HELP dogceo_upstream_queue_wait_seconds Histogram of the wait of the upstream attempts for the outbound limits.
+# TYPE dogceo_upstream_queue_wait_seconds histogram
+dogceo_upstream_queue_wait_seconds_bucket{le="0.005"} 1
+dogceo_upstream_queue_wait_seconds_bucket{le="0.01"} 1
+dogceo_upstream_queue_wait_seconds_bucket{le="0.025"} 1
+dogceo_upstream_queue_wait_seconds_bucket{le="0.05"} 1
+dogceo_upstream_queue_wait_seconds_bucket{le="0.1"} 1
+dogceo_upstream_queue_wait_seconds_bucket{le="0.25"} 2
+dogceo_upstream_queue_wait_seconds_bucket{le="0.5"} 2
+dogceo_upstream_queue_wait_seconds_bucket{le="1"} 2
+dogceo_upstream_queue_wait_seconds_bucket{le="2.5"} 2
+dogceo_upstream_queue_wait_seconds_bucket{le="5"} 2
+dogceo_upstream_queue_wait_seconds_bucket{le="10"} 2
+dogceo_upstream_queue_wait_seconds_bucket{le="+Inf"} 2
+dogceo_upstream_queue_wait_seconds_sum 0.25
+dogceo_upstream_queue_wait_seconds_count 2
+`
+	if err := testutil.CollectAndCompare(m.upstreamQueueWait, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	m := New()
+	m.RateLimited("token-bucket")
+	m.RateLimited("token-bucket")
+	m.AddImageBytes("Search", 100)
+	m.AddImageBytes("Search", 50)
+	m.AddImageBytes("Search", 0)
+
+	if got := testutil.ToFloat64(m.rateLimited.WithLabelValues("token-bucket")); got != 2 {
+		t.Errorf("rate limited requests = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.imageBytes.WithLabelValues("Search")); got != 150 {
+		t.Errorf("image bytes = %v, want 150", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	value := 0.0
+	m.AddGaugeFunc("test_value", "Test value.", func() float64 { return value })
+	value = 42
+
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"dogceo_test_value 42", "go_goroutines"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics should contain %q", want)
+		}
+	}
+}
+
+func TestSplitMethodName(t *testing.T) {
+	tests := map[string]struct {
+		FullMethod string
+		Service    string
+		Method     string
+	}{
+		"full method": {FullMethod: "/breed_image.BreedImageService/Search", Service: "breed_image.BreedImageService", Method: "Search"},
+		"no slash":    {FullMethod: "Search", Service: "unknown", Method: "unknown"},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			service, method := splitMethodName(test.FullMethod)
+			if service != test.Service || method != test.Method {
+				t.Errorf("splitMethodName(%q) = %q, %q, want %q, %q", test.FullMethod, service, method, test.Service, test.Method)
+			}
+		})
+	}
+}
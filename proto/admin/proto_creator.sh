@@ -0,0 +1,7 @@
+#!/bin/bash
+
+# Generate all proto code
+
+protoc --go_out=. --go_opt=paths=source_relative \
+    --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+    admin.proto
\ No newline at end of file
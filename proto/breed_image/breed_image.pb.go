@@ -130,6 +130,552 @@ func (x *BreedImageSearchResponse) GetImage() []byte {
 	return nil
 }
 
+type SearchManyRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Breed    string `protobuf:"bytes,1,opt,name=breed,proto3" json:"breed,omitempty"`
+	SubBreed string `protobuf:"bytes,2,opt,name=subBreed,proto3" json:"subBreed,omitempty"`
+	// count is the number of the images between 1 and 50.
+	Count int32 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *SearchManyRequest) Reset() {
+	*x = SearchManyRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SearchManyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchManyRequest) ProtoMessage() {}
+
+func (x *SearchManyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchManyRequest.ProtoReflect.Descriptor instead.
+func (*SearchManyRequest) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SearchManyRequest) GetBreed() string {
+	if x != nil {
+		return x.Breed
+	}
+	return ""
+}
+
+func (x *SearchManyRequest) GetSubBreed() string {
+	if x != nil {
+		return x.SubBreed
+	}
+	return ""
+}
+
+func (x *SearchManyRequest) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type BreedImage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ImageURL string `protobuf:"bytes,1,opt,name=imageURL,proto3" json:"imageURL,omitempty"`
+	Image    []byte `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+}
+
+func (x *BreedImage) Reset() {
+	*x = BreedImage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BreedImage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BreedImage) ProtoMessage() {}
+
+func (x *BreedImage) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BreedImage.ProtoReflect.Descriptor instead.
+func (*BreedImage) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BreedImage) GetImageURL() string {
+	if x != nil {
+		return x.ImageURL
+	}
+	return ""
+}
+
+func (x *BreedImage) GetImage() []byte {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+type SearchManyResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Images []*BreedImage `protobuf:"bytes,1,rep,name=images,proto3" json:"images,omitempty"`
+}
+
+func (x *SearchManyResponse) Reset() {
+	*x = SearchManyResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SearchManyResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchManyResponse) ProtoMessage() {}
+
+func (x *SearchManyResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchManyResponse.ProtoReflect.Descriptor instead.
+func (*SearchManyResponse) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SearchManyResponse) GetImages() []*BreedImage {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+type ImageMetadata struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ImageURL    string `protobuf:"bytes,1,opt,name=imageURL,proto3" json:"imageURL,omitempty"`
+	ContentType string `protobuf:"bytes,2,opt,name=contentType,proto3" json:"contentType,omitempty"`
+	// size is the size of the image in bytes, it is -1 if it is not known.
+	Size int64 `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+}
+
+func (x *ImageMetadata) Reset() {
+	*x = ImageMetadata{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ImageMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImageMetadata) ProtoMessage() {}
+
+func (x *ImageMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImageMetadata.ProtoReflect.Descriptor instead.
+func (*ImageMetadata) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ImageMetadata) GetImageURL() string {
+	if x != nil {
+		return x.ImageURL
+	}
+	return ""
+}
+
+func (x *ImageMetadata) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *ImageMetadata) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type StreamSearchResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Data:
+	//	*StreamSearchResponse_Metadata
+	//	*StreamSearchResponse_Chunk
+	Data isStreamSearchResponse_Data `protobuf_oneof:"data"`
+}
+
+func (x *StreamSearchResponse) Reset() {
+	*x = StreamSearchResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamSearchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamSearchResponse) ProtoMessage() {}
+
+func (x *StreamSearchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamSearchResponse.ProtoReflect.Descriptor instead.
+func (*StreamSearchResponse) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{6}
+}
+
+func (m *StreamSearchResponse) GetData() isStreamSearchResponse_Data {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (x *StreamSearchResponse) GetMetadata() *ImageMetadata {
+	if x, ok := x.GetData().(*StreamSearchResponse_Metadata); ok {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *StreamSearchResponse) GetChunk() []byte {
+	if x, ok := x.GetData().(*StreamSearchResponse_Chunk); ok {
+		return x.Chunk
+	}
+	return nil
+}
+
+type isStreamSearchResponse_Data interface {
+	isStreamSearchResponse_Data()
+}
+
+type StreamSearchResponse_Metadata struct {
+	Metadata *ImageMetadata `protobuf:"bytes,1,opt,name=metadata,proto3,oneof"`
+}
+
+type StreamSearchResponse_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*StreamSearchResponse_Metadata) isStreamSearchResponse_Data() {}
+
+func (*StreamSearchResponse_Chunk) isStreamSearchResponse_Data() {}
+
+type ListBreedsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListBreedsRequest) Reset() {
+	*x = ListBreedsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListBreedsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBreedsRequest) ProtoMessage() {}
+
+func (x *ListBreedsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBreedsRequest.ProtoReflect.Descriptor instead.
+func (*ListBreedsRequest) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{7}
+}
+
+type SubBreedList struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	SubBreeds []string `protobuf:"bytes,1,rep,name=subBreeds,proto3" json:"subBreeds,omitempty"`
+}
+
+func (x *SubBreedList) Reset() {
+	*x = SubBreedList{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubBreedList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubBreedList) ProtoMessage() {}
+
+func (x *SubBreedList) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubBreedList.ProtoReflect.Descriptor instead.
+func (*SubBreedList) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SubBreedList) GetSubBreeds() []string {
+	if x != nil {
+		return x.SubBreeds
+	}
+	return nil
+}
+
+type ListBreedsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// breeds maps every breed to its sub-breeds.
+	// A breed without sub-breeds has an empty list.
+	Breeds map[string]*SubBreedList `protobuf:"bytes,1,rep,name=breeds,proto3" json:"breeds,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *ListBreedsResponse) Reset() {
+	*x = ListBreedsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListBreedsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBreedsResponse) ProtoMessage() {}
+
+func (x *ListBreedsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBreedsResponse.ProtoReflect.Descriptor instead.
+func (*ListBreedsResponse) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListBreedsResponse) GetBreeds() map[string]*SubBreedList {
+	if x != nil {
+		return x.Breeds
+	}
+	return nil
+}
+
+type ListSubBreedsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Breed string `protobuf:"bytes,1,opt,name=breed,proto3" json:"breed,omitempty"`
+}
+
+func (x *ListSubBreedsRequest) Reset() {
+	*x = ListSubBreedsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListSubBreedsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSubBreedsRequest) ProtoMessage() {}
+
+func (x *ListSubBreedsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSubBreedsRequest.ProtoReflect.Descriptor instead.
+func (*ListSubBreedsRequest) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListSubBreedsRequest) GetBreed() string {
+	if x != nil {
+		return x.Breed
+	}
+	return ""
+}
+
+type ListSubBreedsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Breed     string   `protobuf:"bytes,1,opt,name=breed,proto3" json:"breed,omitempty"`
+	SubBreeds []string `protobuf:"bytes,2,rep,name=subBreeds,proto3" json:"subBreeds,omitempty"`
+}
+
+func (x *ListSubBreedsResponse) Reset() {
+	*x = ListSubBreedsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_breed_image_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListSubBreedsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSubBreedsResponse) ProtoMessage() {}
+
+func (x *ListSubBreedsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_breed_image_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSubBreedsResponse.ProtoReflect.Descriptor instead.
+func (*ListSubBreedsResponse) Descriptor() ([]byte, []int) {
+	return file_breed_image_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ListSubBreedsResponse) GetBreed() string {
+	if x != nil {
+		return x.Breed
+	}
+	return ""
+}
+
+func (x *ListSubBreedsResponse) GetSubBreeds() []string {
+	if x != nil {
+		return x.SubBreeds
+	}
+	return nil
+}
+
 var File_breed_image_proto protoreflect.FileDescriptor
 
 var file_breed_image_proto_rawDesc = []byte{
@@ -144,18 +690,90 @@ var file_breed_image_proto_rawDesc = []byte{
 	0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6d, 0x61,
 	0x67, 0x65, 0x55, 0x52, 0x4c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x69, 0x6d, 0x61,
 	0x67, 0x65, 0x55, 0x52, 0x4c, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x32, 0x6c, 0x0a, 0x11, 0x42,
-	0x72, 0x65, 0x65, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x12, 0x57, 0x0a, 0x06, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x12, 0x24, 0x2e, 0x62, 0x72, 0x65,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x22, 0x5b, 0x0a, 0x11, 0x53,
+	0x65, 0x61, 0x72, 0x63, 0x68, 0x4d, 0x61, 0x6e, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x14, 0x0a, 0x05, 0x62, 0x72, 0x65, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x62, 0x72, 0x65, 0x65, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x75, 0x62, 0x42, 0x72, 0x65,
+	0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x73, 0x75, 0x62, 0x42, 0x72, 0x65,
+	0x65, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0x3e, 0x0a, 0x0a, 0x42, 0x72, 0x65, 0x65,
+	0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x55,
+	0x52, 0x4c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x55,
+	0x52, 0x4c, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x05, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x22, 0x45, 0x0a, 0x12, 0x53, 0x65, 0x61, 0x72,
+	0x63, 0x68, 0x4d, 0x61, 0x6e, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2f,
+	0x0a, 0x06, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17,
+	0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x42, 0x72, 0x65,
+	0x65, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x52, 0x06, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x73, 0x22,
+	0x61, 0x0a, 0x0d, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x55, 0x52, 0x4c, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x55, 0x52, 0x4c, 0x12, 0x20, 0x0a, 0x0b,
+	0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x12,
+	0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x73, 0x69,
+	0x7a, 0x65, 0x22, 0x70, 0x0a, 0x14, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x61, 0x72,
+	0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x38, 0x0a, 0x08, 0x6d, 0x65,
+	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x62,
+	0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x49, 0x6d, 0x61, 0x67, 0x65,
+	0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x48, 0x00, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61,
+	0x64, 0x61, 0x74, 0x61, 0x12, 0x16, 0x0a, 0x05, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x05, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x42, 0x06, 0x0a, 0x04,
+	0x64, 0x61, 0x74, 0x61, 0x22, 0x13, 0x0a, 0x11, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x72, 0x65, 0x65,
+	0x64, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x2c, 0x0a, 0x0c, 0x53, 0x75, 0x62,
+	0x42, 0x72, 0x65, 0x65, 0x64, 0x4c, 0x69, 0x73, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x75, 0x62,
+	0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x73, 0x75,
+	0x62, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x22, 0xaf, 0x01, 0x0a, 0x12, 0x4c, 0x69, 0x73, 0x74,
+	0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x43,
+	0x0a, 0x06, 0x62, 0x72, 0x65, 0x65, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2b,
+	0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x4c, 0x69, 0x73,
+	0x74, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x2e,
+	0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x62, 0x72, 0x65,
+	0x65, 0x64, 0x73, 0x1a, 0x54, 0x0a, 0x0b, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x45, 0x6e, 0x74,
+	0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x03, 0x6b, 0x65, 0x79, 0x12, 0x2f, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67,
+	0x65, 0x2e, 0x53, 0x75, 0x62, 0x42, 0x72, 0x65, 0x65, 0x64, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x2c, 0x0a, 0x14, 0x4c, 0x69, 0x73,
+	0x74, 0x53, 0x75, 0x62, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x72, 0x65, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x62, 0x72, 0x65, 0x65, 0x64, 0x22, 0x4b, 0x0a, 0x15, 0x4c, 0x69, 0x73, 0x74, 0x53,
+	0x75, 0x62, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x14, 0x0a, 0x05, 0x62, 0x72, 0x65, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x62, 0x72, 0x65, 0x65, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x75, 0x62, 0x42, 0x72, 0x65,
+	0x65, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x09, 0x73, 0x75, 0x62, 0x42, 0x72,
+	0x65, 0x65, 0x64, 0x73, 0x32, 0xc5, 0x03, 0x0a, 0x11, 0x42, 0x72, 0x65, 0x65, 0x64, 0x49, 0x6d,
+	0x61, 0x67, 0x65, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x57, 0x0a, 0x06, 0x53, 0x65,
+	0x61, 0x72, 0x63, 0x68, 0x12, 0x24, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61,
+	0x67, 0x65, 0x2e, 0x42, 0x72, 0x65, 0x65, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x53, 0x65, 0x61,
+	0x72, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e, 0x62, 0x72, 0x65,
 	0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x42, 0x72, 0x65, 0x65, 0x64, 0x49, 0x6d,
-	0x61, 0x67, 0x65, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x1a, 0x25, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x42,
-	0x72, 0x65, 0x65, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x52,
-	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x2e, 0x5a, 0x2c, 0x67, 0x69, 0x74,
-	0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x63, 0x61, 0x6e, 0x62, 0x6f, 0x2d, 0x78, 0x2f,
-	0x64, 0x6f, 0x67, 0x2d, 0x63, 0x65, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x3b, 0x62, 0x72,
-	0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x61, 0x67, 0x65, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0x00, 0x12, 0x4f, 0x0a, 0x0a, 0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4d, 0x61, 0x6e,
+	0x79, 0x12, 0x1e, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e,
+	0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4d, 0x61, 0x6e, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x1f, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e,
+	0x53, 0x65, 0x61, 0x72, 0x63, 0x68, 0x4d, 0x61, 0x6e, 0x79, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x22, 0x00, 0x12, 0x5b, 0x0a, 0x0c, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65,
+	0x61, 0x72, 0x63, 0x68, 0x12, 0x24, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61,
+	0x67, 0x65, 0x2e, 0x42, 0x72, 0x65, 0x65, 0x64, 0x49, 0x6d, 0x61, 0x67, 0x65, 0x53, 0x65, 0x61,
+	0x72, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x62, 0x72, 0x65,
+	0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53,
+	0x65, 0x61, 0x72, 0x63, 0x68, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x30,
+	0x01, 0x12, 0x4f, 0x0a, 0x0a, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x12,
+	0x1e, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x4c, 0x69,
+	0x73, 0x74, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1f, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x2e, 0x4c, 0x69,
+	0x73, 0x74, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x12, 0x58, 0x0a, 0x0d, 0x4c, 0x69, 0x73, 0x74, 0x53, 0x75, 0x62, 0x42, 0x72, 0x65,
+	0x65, 0x64, 0x73, 0x12, 0x21, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67,
+	0x65, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x53, 0x75, 0x62, 0x42, 0x72, 0x65, 0x65, 0x64, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22, 0x2e, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69,
+	0x6d, 0x61, 0x67, 0x65, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x53, 0x75, 0x62, 0x42, 0x72, 0x65, 0x65,
+	0x64, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x2e, 0x5a, 0x2c,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x63, 0x61, 0x6e, 0x62, 0x6f,
+	0x2d, 0x78, 0x2f, 0x64, 0x6f, 0x67, 0x2d, 0x63, 0x65, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x3b, 0x62, 0x72, 0x65, 0x65, 0x64, 0x5f, 0x69, 0x6d, 0x61, 0x67, 0x65, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -170,19 +788,42 @@ func file_breed_image_proto_rawDescGZIP() []byte {
 	return file_breed_image_proto_rawDescData
 }
 
-var file_breed_image_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_breed_image_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_breed_image_proto_goTypes = []interface{}{
 	(*BreedImageSearchRequest)(nil),  // 0: breed_image.BreedImageSearchRequest
 	(*BreedImageSearchResponse)(nil), // 1: breed_image.BreedImageSearchResponse
+	(*SearchManyRequest)(nil),        // 2: breed_image.SearchManyRequest
+	(*BreedImage)(nil),               // 3: breed_image.BreedImage
+	(*SearchManyResponse)(nil),       // 4: breed_image.SearchManyResponse
+	(*ImageMetadata)(nil),            // 5: breed_image.ImageMetadata
+	(*StreamSearchResponse)(nil),     // 6: breed_image.StreamSearchResponse
+	(*ListBreedsRequest)(nil),        // 7: breed_image.ListBreedsRequest
+	(*SubBreedList)(nil),             // 8: breed_image.SubBreedList
+	(*ListBreedsResponse)(nil),       // 9: breed_image.ListBreedsResponse
+	(*ListSubBreedsRequest)(nil),     // 10: breed_image.ListSubBreedsRequest
+	(*ListSubBreedsResponse)(nil),    // 11: breed_image.ListSubBreedsResponse
+	nil,                              // 12: breed_image.ListBreedsResponse.BreedsEntry
 }
 var file_breed_image_proto_depIdxs = []int32{
-	0, // 0: breed_image.BreedImageService.Search:input_type -> breed_image.BreedImageSearchRequest
-	1, // 1: breed_image.BreedImageService.Search:output_type -> breed_image.BreedImageSearchResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	3,  // 0: breed_image.SearchManyResponse.images:type_name -> breed_image.BreedImage
+	5,  // 1: breed_image.StreamSearchResponse.metadata:type_name -> breed_image.ImageMetadata
+	12, // 2: breed_image.ListBreedsResponse.breeds:type_name -> breed_image.ListBreedsResponse.BreedsEntry
+	8,  // 3: breed_image.ListBreedsResponse.BreedsEntry.value:type_name -> breed_image.SubBreedList
+	0,  // 4: breed_image.BreedImageService.Search:input_type -> breed_image.BreedImageSearchRequest
+	2,  // 5: breed_image.BreedImageService.SearchMany:input_type -> breed_image.SearchManyRequest
+	0,  // 6: breed_image.BreedImageService.StreamSearch:input_type -> breed_image.BreedImageSearchRequest
+	7,  // 7: breed_image.BreedImageService.ListBreeds:input_type -> breed_image.ListBreedsRequest
+	10, // 8: breed_image.BreedImageService.ListSubBreeds:input_type -> breed_image.ListSubBreedsRequest
+	1,  // 9: breed_image.BreedImageService.Search:output_type -> breed_image.BreedImageSearchResponse
+	4,  // 10: breed_image.BreedImageService.SearchMany:output_type -> breed_image.SearchManyResponse
+	6,  // 11: breed_image.BreedImageService.StreamSearch:output_type -> breed_image.StreamSearchResponse
+	9,  // 12: breed_image.BreedImageService.ListBreeds:output_type -> breed_image.ListBreedsResponse
+	11, // 13: breed_image.BreedImageService.ListSubBreeds:output_type -> breed_image.ListSubBreedsResponse
+	9,  // [9:14] is the sub-list for method output_type
+	4,  // [4:9] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_breed_image_proto_init() }
@@ -215,6 +856,130 @@ func file_breed_image_proto_init() {
 				return nil
 			}
 		}
+		file_breed_image_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SearchManyRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BreedImage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SearchManyResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ImageMetadata); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamSearchResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListBreedsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubBreedList); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListBreedsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListSubBreedsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_breed_image_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListSubBreedsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_breed_image_proto_msgTypes[6].OneofWrappers = []interface{}{
+		(*StreamSearchResponse_Metadata)(nil),
+		(*StreamSearchResponse_Chunk)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -222,7 +987,7 @@ func file_breed_image_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_breed_image_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
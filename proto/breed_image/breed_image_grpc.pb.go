@@ -23,6 +23,17 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type BreedImageServiceClient interface {
 	Search(ctx context.Context, in *BreedImageSearchRequest, opts ...grpc.CallOption) (*BreedImageSearchResponse, error)
+	// SearchMany returns up to the given number of random images of the given breed and sub-breed.
+	SearchMany(ctx context.Context, in *SearchManyRequest, opts ...grpc.CallOption) (*SearchManyResponse, error)
+	// StreamSearch streams a random image of the given breed and sub-breed.
+	// The first message is the metadata of the image and the rest are the chunks of the image.
+	// The SHA-256 hash of the image is sent in the "image-sha256" trailer after the last chunk,
+	// because the image is streamed directly from the upstream API without buffering.
+	StreamSearch(ctx context.Context, in *BreedImageSearchRequest, opts ...grpc.CallOption) (BreedImageService_StreamSearchClient, error)
+	// ListBreeds returns all the breeds with their sub-breeds.
+	ListBreeds(ctx context.Context, in *ListBreedsRequest, opts ...grpc.CallOption) (*ListBreedsResponse, error)
+	// ListSubBreeds returns the sub-breeds of the given breed.
+	ListSubBreeds(ctx context.Context, in *ListSubBreedsRequest, opts ...grpc.CallOption) (*ListSubBreedsResponse, error)
 }
 
 type breedImageServiceClient struct {
@@ -42,11 +53,81 @@ func (c *breedImageServiceClient) Search(ctx context.Context, in *BreedImageSear
 	return out, nil
 }
 
+func (c *breedImageServiceClient) SearchMany(ctx context.Context, in *SearchManyRequest, opts ...grpc.CallOption) (*SearchManyResponse, error) {
+	out := new(SearchManyResponse)
+	err := c.cc.Invoke(ctx, "/breed_image.BreedImageService/SearchMany", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *breedImageServiceClient) StreamSearch(ctx context.Context, in *BreedImageSearchRequest, opts ...grpc.CallOption) (BreedImageService_StreamSearchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BreedImageService_ServiceDesc.Streams[0], "/breed_image.BreedImageService/StreamSearch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &breedImageServiceStreamSearchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BreedImageService_StreamSearchClient interface {
+	Recv() (*StreamSearchResponse, error)
+	grpc.ClientStream
+}
+
+type breedImageServiceStreamSearchClient struct {
+	grpc.ClientStream
+}
+
+func (x *breedImageServiceStreamSearchClient) Recv() (*StreamSearchResponse, error) {
+	m := new(StreamSearchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *breedImageServiceClient) ListBreeds(ctx context.Context, in *ListBreedsRequest, opts ...grpc.CallOption) (*ListBreedsResponse, error) {
+	out := new(ListBreedsResponse)
+	err := c.cc.Invoke(ctx, "/breed_image.BreedImageService/ListBreeds", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *breedImageServiceClient) ListSubBreeds(ctx context.Context, in *ListSubBreedsRequest, opts ...grpc.CallOption) (*ListSubBreedsResponse, error) {
+	out := new(ListSubBreedsResponse)
+	err := c.cc.Invoke(ctx, "/breed_image.BreedImageService/ListSubBreeds", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BreedImageServiceServer is the server API for BreedImageService service.
 // All implementations must embed UnimplementedBreedImageServiceServer
 // for forward compatibility
 type BreedImageServiceServer interface {
 	Search(context.Context, *BreedImageSearchRequest) (*BreedImageSearchResponse, error)
+	// SearchMany returns up to the given number of random images of the given breed and sub-breed.
+	SearchMany(context.Context, *SearchManyRequest) (*SearchManyResponse, error)
+	// StreamSearch streams a random image of the given breed and sub-breed.
+	// The first message is the metadata of the image and the rest are the chunks of the image.
+	// The SHA-256 hash of the image is sent in the "image-sha256" trailer after the last chunk,
+	// because the image is streamed directly from the upstream API without buffering.
+	StreamSearch(*BreedImageSearchRequest, BreedImageService_StreamSearchServer) error
+	// ListBreeds returns all the breeds with their sub-breeds.
+	ListBreeds(context.Context, *ListBreedsRequest) (*ListBreedsResponse, error)
+	// ListSubBreeds returns the sub-breeds of the given breed.
+	ListSubBreeds(context.Context, *ListSubBreedsRequest) (*ListSubBreedsResponse, error)
 	mustEmbedUnimplementedBreedImageServiceServer()
 }
 
@@ -57,6 +138,18 @@ type UnimplementedBreedImageServiceServer struct {
 func (UnimplementedBreedImageServiceServer) Search(context.Context, *BreedImageSearchRequest) (*BreedImageSearchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
 }
+func (UnimplementedBreedImageServiceServer) SearchMany(context.Context, *SearchManyRequest) (*SearchManyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchMany not implemented")
+}
+func (UnimplementedBreedImageServiceServer) StreamSearch(*BreedImageSearchRequest, BreedImageService_StreamSearchServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSearch not implemented")
+}
+func (UnimplementedBreedImageServiceServer) ListBreeds(context.Context, *ListBreedsRequest) (*ListBreedsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBreeds not implemented")
+}
+func (UnimplementedBreedImageServiceServer) ListSubBreeds(context.Context, *ListSubBreedsRequest) (*ListSubBreedsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSubBreeds not implemented")
+}
 func (UnimplementedBreedImageServiceServer) mustEmbedUnimplementedBreedImageServiceServer() {}
 
 // UnsafeBreedImageServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +181,81 @@ func _BreedImageService_Search_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BreedImageService_SearchMany_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchManyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BreedImageServiceServer).SearchMany(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/breed_image.BreedImageService/SearchMany",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BreedImageServiceServer).SearchMany(ctx, req.(*SearchManyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BreedImageService_StreamSearch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BreedImageSearchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BreedImageServiceServer).StreamSearch(m, &breedImageServiceStreamSearchServer{stream})
+}
+
+type BreedImageService_StreamSearchServer interface {
+	Send(*StreamSearchResponse) error
+	grpc.ServerStream
+}
+
+type breedImageServiceStreamSearchServer struct {
+	grpc.ServerStream
+}
+
+func (x *breedImageServiceStreamSearchServer) Send(m *StreamSearchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _BreedImageService_ListBreeds_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBreedsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BreedImageServiceServer).ListBreeds(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/breed_image.BreedImageService/ListBreeds",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BreedImageServiceServer).ListBreeds(ctx, req.(*ListBreedsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BreedImageService_ListSubBreeds_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSubBreedsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BreedImageServiceServer).ListSubBreeds(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/breed_image.BreedImageService/ListSubBreeds",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BreedImageServiceServer).ListSubBreeds(ctx, req.(*ListSubBreedsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BreedImageService_ServiceDesc is the grpc.ServiceDesc for BreedImageService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -99,7 +267,25 @@ var BreedImageService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Search",
 			Handler:    _BreedImageService_Search_Handler,
 		},
+		{
+			MethodName: "SearchMany",
+			Handler:    _BreedImageService_SearchMany_Handler,
+		},
+		{
+			MethodName: "ListBreeds",
+			Handler:    _BreedImageService_ListBreeds_Handler,
+		},
+		{
+			MethodName: "ListSubBreeds",
+			Handler:    _BreedImageService_ListSubBreeds_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSearch",
+			Handler:       _BreedImageService_StreamSearch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "breed_image.proto",
 }
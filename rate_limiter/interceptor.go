@@ -0,0 +1,98 @@
+package rate_limiter
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// These are the metadata keys of the rate limit feedback.
+// They are sent in the header of the allowed requests, and in the header and the trailer of the rejected requests.
+const (
+	// RemainingHeader is the number of the requests the client can make right now.
+	RemainingHeader = "ratelimit-remaining"
+
+	// RetryAfterHeader is the wait in milliseconds before the client should try again.
+	RetryAfterHeader = "ratelimit-retry-after-ms"
+)
+
+// TakeFunc takes a token for the given request and returns the decision.
+type TakeFunc func(ctx context.Context) Decision
+
+// Global returns a TakeFunc which takes the tokens of every request from the given bucket.
+func Global(tb *TokenBucket) TakeFunc {
+	return func(ctx context.Context) Decision {
+		return tb.Take()
+	}
+}
+
+// Keyed returns a TakeFunc which takes the tokens of a request from the bucket of its key.
+func Keyed(kl *KeyedLimiter, keyFunc KeyFunc) TakeFunc {
+	return func(ctx context.Context) Decision {
+		return kl.TakeKey(keyFunc(ctx))
+	}
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor which limits the requests.
+// It tells the client the remaining requests, and the wait before retrying when the request is rejected.
+func UnaryServerInterceptor(take TakeFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		decision := take(ctx)
+		md := feedback(decision)
+		if decision.Limited {
+			grpc.SetHeader(ctx, md)
+			grpc.SetTrailer(ctx, md)
+			return nil, rejectedError(info.FullMethod, decision)
+		}
+		grpc.SetHeader(ctx, md)
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a new stream server interceptor which limits the requests.
+// It tells the client the remaining requests, and the wait before retrying when the request is rejected.
+func StreamServerInterceptor(take TakeFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		decision := take(stream.Context())
+		md := feedback(decision)
+		if decision.Limited {
+			stream.SetHeader(md)
+			stream.SetTrailer(md)
+			return rejectedError(info.FullMethod, decision)
+		}
+		stream.SetHeader(md)
+		return handler(srv, stream)
+	}
+}
+
+// feedback returns the rate limit metadata of the given decision.
+func feedback(decision Decision) grpc_metadata.MD {
+	md := grpc_metadata.Pairs(RemainingHeader, strconv.Itoa(decision.Remaining))
+	if decision.Limited && decision.RetryAfter > 0 {
+		// rounded up, so the client never retries before the next token
+		ms := (decision.RetryAfter + time.Millisecond - 1) / time.Millisecond
+		md.Set(RetryAfterHeader, strconv.FormatInt(int64(ms), 10))
+	}
+	return md
+}
+
+// rejectedError returns the ResourceExhausted error of a rejected request.
+// It has a RetryInfo detail if the wait before retrying is known.
+func rejectedError(method string, decision Decision) error {
+	st := status.Newf(codes.ResourceExhausted, "%s is rejected by the rate limiter, please retry later.", method)
+	if decision.RetryAfter <= 0 {
+		return st.Err()
+	}
+	withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(decision.RetryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
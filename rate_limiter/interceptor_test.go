@@ -0,0 +1,153 @@
+package rate_limiter
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newLimitedHealthClient starts a health server behind the rate limiting interceptors and returns its client.
+func newLimitedHealthClient(t *testing.T, take TakeFunc) grpc_health_v1.HealthClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(take)),
+		grpc.StreamInterceptor(StreamServerInterceptor(take)),
+	)
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+// retryDelay returns the delay of the RetryInfo detail of the given error.
+func retryDelay(err error) (time.Duration, bool) {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+func TestUnaryServerInterceptorFeedback(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	bucket := NewTokenBucket(Settings{Rate: 4, Burst: 2, Now: clock.Now})
+	client := newLimitedHealthClient(t, Global(bucket))
+	ctx := context.Background()
+
+	for _, remaining := range []string{"1", "0"} {
+		var header grpc_metadata.MD
+		if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Header(&header)); err != nil {
+			t.Fatalf("request supposed to pass got %v", err)
+		}
+		if got := header.Get(RemainingHeader); len(got) != 1 || got[0] != remaining {
+			t.Fatalf("want %s remaining; got %v", remaining, got)
+		}
+	}
+
+	var header, trailer grpc_metadata.MD
+	_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Header(&header), grpc.Trailer(&trailer))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted; got %v", err)
+	}
+	if delay, ok := retryDelay(err); !ok || delay != time.Millisecond*250 {
+		t.Fatalf("want 250ms retry delay; got %v %t", delay, ok)
+	}
+	for name, md := range map[string]grpc_metadata.MD{"header": header, "trailer": trailer} {
+		if got := md.Get(RetryAfterHeader); len(got) != 1 || got[0] != "250" {
+			t.Fatalf("want 250 retry after in the %s; got %v", name, got)
+		}
+		if got := md.Get(RemainingHeader); len(got) != 1 || got[0] != "0" {
+			t.Fatalf("want 0 remaining in the %s; got %v", name, got)
+		}
+	}
+
+	clock.Advance(time.Millisecond * 250)
+	if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("request supposed to pass after the retry delay got %v", err)
+	}
+}
+
+func TestStreamServerInterceptorFeedback(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	limiter := NewKeyedLimiter(KeyedSettings{
+		Default: Settings{Rate: 0.5, Burst: 1},
+		MaxKeys: 10,
+		Now:     clock.Now,
+	})
+	defer limiter.Stop()
+	client := newLimitedHealthClient(t, Keyed(limiter, MetadataKey(APIKeyHeader, knownValues("first", "second"))))
+
+	ctx, cancel := context.WithCancel(grpc_metadata.AppendToOutgoingContext(context.Background(), APIKeyHeader, "first"))
+	defer cancel()
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("stream supposed to pass got %v", err)
+	}
+	header, err := stream.Header()
+	if err != nil || len(header.Get(RemainingHeader)) != 1 || header.Get(RemainingHeader)[0] != "0" {
+		t.Fatalf("want 0 remaining; got %v %v", header, err)
+	}
+
+	stream, err = client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted; got %v", err)
+	}
+	if delay, ok := retryDelay(err); !ok || delay != time.Second*2 {
+		t.Fatalf("want 2s retry delay; got %v %t", delay, ok)
+	}
+	if got := stream.Trailer().Get(RetryAfterHeader); len(got) != 1 || got[0] != "2000" {
+		t.Fatalf("want 2000 retry after in the trailer; got %v", got)
+	}
+
+	// another client has its own bucket
+	otherCtx, otherCancel := context.WithCancel(grpc_metadata.AppendToOutgoingContext(context.Background(), APIKeyHeader, "second"))
+	defer otherCancel()
+	stream, err = client.Watch(otherCtx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("stream of another client supposed to pass got %v", err)
+	}
+}
+
+func TestRejectedWithoutRefill(t *testing.T) {
+	err := rejectedError("/test/Method", Decision{Limited: true})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("want ResourceExhausted; got %v", err)
+	}
+	if _, ok := retryDelay(err); ok {
+		t.Fatalf("retry info supposed to be missing when the bucket is never refilled")
+	}
+	if md := feedback(Decision{Limited: true}); len(md.Get(RetryAfterHeader)) != 0 {
+		t.Fatalf("retry after supposed to be missing when the bucket is never refilled")
+	}
+}
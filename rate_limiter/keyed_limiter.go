@@ -0,0 +1,272 @@
+package rate_limiter
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// APIKeyHeader is the metadata key of the API key of a client.
+const APIKeyHeader = "x-api-key"
+
+// KeyFunc returns the key of the client of a request.
+// The requests with the same key share the same token bucket.
+type KeyFunc func(ctx context.Context) string
+
+// PeerKey returns the IP address of the client without the port.
+// If the address is not known, it returns "unknown".
+func PeerKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// MetadataKey returns a KeyFunc which uses the first value of the given metadata key if it is known.
+// The values are sent by the clients, so a client could get a new bucket on every request by changing it.
+// The requests without a known value are keyed by their peer address with the "peer:" prefix,
+// so they never share a bucket with a client which sends a known value.
+func MetadataKey(name string, known func(value string) bool) KeyFunc {
+	return func(ctx context.Context) string {
+		if md, ok := grpc_metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(name); len(values) > 0 && values[0] != "" && known(values[0]) {
+				return values[0]
+			}
+		}
+		return "peer:" + PeerKey(ctx)
+	}
+}
+
+// KeyedSettings holds the settings of a keyed limiter.
+type KeyedSettings struct {
+	// Default is the settings of the buckets of the keys which are not in a tier.
+	Default Settings
+
+	// Tiers holds the settings of the buckets of the given keys.
+	// The keys are the values returned by the KeyFunc, e.g. an API key or an IP address.
+	Tiers map[string]Settings
+
+	// MaxKeys is the maximum number of the buckets.
+	// When it is reached, the bucket of the least recently seen key is removed.
+	MaxKeys int
+
+	// IdleTimeout is the time a bucket is kept after the last request of its key.
+	// Zero keeps the buckets until they are removed by MaxKeys.
+	IdleTimeout time.Duration
+
+	// Now returns the current time. If it is nil, time.Now is used.
+	// It is passed to the buckets too.
+	Now func() time.Time
+}
+
+// keyedBucket is an item of the bucket list of a keyed limiter.
+type keyedBucket struct {
+	key      string
+	bucket   *TokenBucket
+	lastSeen time.Time
+}
+
+// KeyedLimiter holds the required variables to compose a rate limiter with a token bucket per key.
+// A removed bucket starts full when its key comes back.
+type KeyedLimiter struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the buckets
+	mu sync.Mutex
+
+	settings KeyedSettings
+
+	// ll holds the buckets from the most recently seen to the least recently seen.
+	ll    *list.List
+	items map[string]*list.Element
+
+	// quit stops the sweeper, it is nil if the sweeper is not running.
+	quit chan struct{}
+
+	stopped bool
+}
+
+// NewKeyedLimiter returns a new KeyedLimiter with the given settings.
+// The maximum number of the keys is at least 1.
+// If the idle timeout is set, a sweeper removes the idle buckets until the limiter is stopped.
+func NewKeyedLimiter(settings KeyedSettings) *KeyedLimiter {
+	if settings.MaxKeys < 1 {
+		settings.MaxKeys = 1
+	}
+	if settings.Now == nil {
+		settings.Now = time.Now
+	}
+
+	kl := &KeyedLimiter{
+		settings: settings,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+
+	if settings.IdleTimeout > 0 {
+		kl.quit = make(chan struct{})
+		go kl.sweeper(settings.IdleTimeout, kl.quit)
+	}
+	return kl
+}
+
+// LimitKey returns true if the limit of the given key is reached.
+// If the limit is not reached, it takes a token from the bucket of the key.
+func (kl *KeyedLimiter) LimitKey(key string) bool {
+	return kl.TakeKey(key).Limited
+}
+
+// TakeKey takes a token from the bucket of the given key if there is one and returns the decision.
+func (kl *KeyedLimiter) TakeKey(key string) Decision {
+	return kl.bucket(key).Take()
+}
+
+// HasTier returns true if the given key has its own tier.
+func (kl *KeyedLimiter) HasTier(key string) bool {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	_, ok := kl.settings.Tiers[key]
+	return ok
+}
+
+// Len returns the number of the buckets.
+func (kl *KeyedLimiter) Len() int {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	return kl.ll.Len()
+}
+
+// SetSettings changes the settings of the limiter without emptying the buckets.
+// The existing buckets get the rate and the burst of their tier or the default,
+// the least recently seen buckets are removed if there are more than the new maximum number of the keys,
+// and the sweeper is restarted if the idle timeout is changed.
+// The clock of the limiter is kept.
+func (kl *KeyedLimiter) SetSettings(settings KeyedSettings) {
+	if settings.MaxKeys < 1 {
+		settings.MaxKeys = 1
+	}
+
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	settings.Now = kl.settings.Now
+	idleTimeoutChanged := settings.IdleTimeout != kl.settings.IdleTimeout
+	kl.settings = settings
+
+	for elem := kl.ll.Front(); elem != nil; elem = elem.Next() {
+		kb := elem.Value.(*keyedBucket)
+		kb.bucket.SetSettings(kl.bucketSettings(kb.key))
+	}
+	for kl.ll.Len() > settings.MaxKeys {
+		kl.removeElement(kl.ll.Back())
+	}
+
+	if idleTimeoutChanged && !kl.stopped {
+		kl.stopSweeper()
+		if settings.IdleTimeout > 0 {
+			kl.quit = make(chan struct{})
+			go kl.sweeper(settings.IdleTimeout, kl.quit)
+		}
+	}
+}
+
+// Stop stops the sweeper. It is safe to call it more than once.
+func (kl *KeyedLimiter) Stop() {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	kl.stopped = true
+	kl.stopSweeper()
+}
+
+// stopSweeper stops the sweeper if it is running.
+// It must be called while holding the lock.
+func (kl *KeyedLimiter) stopSweeper() {
+	if kl.quit == nil {
+		return
+	}
+	close(kl.quit)
+	kl.quit = nil
+}
+
+// bucketSettings returns the settings of the bucket of the given key.
+// It must be called while holding the lock.
+func (kl *KeyedLimiter) bucketSettings(key string) Settings {
+	settings, ok := kl.settings.Tiers[key]
+	if !ok {
+		settings = kl.settings.Default
+	}
+	settings.Now = kl.settings.Now
+	return settings
+}
+
+// bucket returns the bucket of the given key, it creates the bucket if it does not exist.
+// It removes the least recently seen bucket if the maximum number of the keys is reached.
+func (kl *KeyedLimiter) bucket(key string) *TokenBucket {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	now := kl.settings.Now()
+	if elem, ok := kl.items[key]; ok {
+		kb := elem.Value.(*keyedBucket)
+		kb.lastSeen = now
+		kl.ll.MoveToFront(elem)
+		return kb.bucket
+	}
+
+	for kl.ll.Len() >= kl.settings.MaxKeys {
+		kl.removeElement(kl.ll.Back())
+	}
+
+	kb := &keyedBucket{key: key, bucket: NewTokenBucket(kl.bucketSettings(key)), lastSeen: now}
+	kl.items[key] = kl.ll.PushFront(kb)
+	return kb.bucket
+}
+
+// sweep removes the buckets which are not seen for the idle timeout.
+func (kl *KeyedLimiter) sweep() {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	now := kl.settings.Now()
+	for elem := kl.ll.Back(); elem != nil; elem = kl.ll.Back() {
+		if now.Sub(elem.Value.(*keyedBucket).lastSeen) < kl.settings.IdleTimeout {
+			return
+		}
+		kl.removeElement(elem)
+	}
+}
+
+// removeElement removes the given element from the bucket list.
+// It must be called while holding the lock.
+func (kl *KeyedLimiter) removeElement(elem *list.Element) {
+	kb := kl.ll.Remove(elem).(*keyedBucket)
+	delete(kl.items, kb.key)
+}
+
+// sweeper calls sweep every half of the idle timeout until the quit channel is closed,
+// so an idle bucket is removed at most one and a half idle timeouts after its last request.
+func (kl *KeyedLimiter) sweeper(idleTimeout time.Duration, quit chan struct{}) {
+	interval := idleTimeout / 2
+	if interval <= 0 {
+		interval = idleTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			kl.sweep()
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package rate_limiter
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// peerContext returns a context of an incoming request from the given address with the given metadata.
+func peerContext(addr string, pairs ...string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+	return grpc_metadata.NewIncomingContext(ctx, grpc_metadata.Pairs(pairs...))
+}
+
+// knownValues returns a function which accepts only the given values.
+func knownValues(values ...string) func(string) bool {
+	return func(value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	tests := map[string]struct {
+		Ctx      context.Context
+		KeyFunc  KeyFunc
+		Expected string
+	}{
+		"peer": {
+			Ctx:      peerContext("10.0.0.1:5000"),
+			KeyFunc:  PeerKey,
+			Expected: "10.0.0.1",
+		},
+		"peer ipv6": {
+			Ctx:      peerContext("[::1]:5000"),
+			KeyFunc:  PeerKey,
+			Expected: "::1",
+		},
+		"unknown peer": {
+			Ctx:      context.Background(),
+			KeyFunc:  PeerKey,
+			Expected: "unknown",
+		},
+		"known api key": {
+			Ctx:      peerContext("10.0.0.1:5000", APIKeyHeader, "secret"),
+			KeyFunc:  MetadataKey(APIKeyHeader, knownValues("secret")),
+			Expected: "secret",
+		},
+		"known custom header": {
+			Ctx:      peerContext("10.0.0.1:5000", "x-client-id", "mobile"),
+			KeyFunc:  MetadataKey("x-client-id", knownValues("mobile")),
+			Expected: "mobile",
+		},
+		"unknown header": {
+			Ctx:      peerContext("10.0.0.1:5000", "x-client-id", "rotated-1"),
+			KeyFunc:  MetadataKey("x-client-id", knownValues("mobile")),
+			Expected: "peer:10.0.0.1",
+		},
+		"missing header": {
+			Ctx:      peerContext("10.0.0.1:5000"),
+			KeyFunc:  MetadataKey(APIKeyHeader, knownValues("secret")),
+			Expected: "peer:10.0.0.1",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := test.KeyFunc(test.Ctx); got != test.Expected {
+				t.Fatalf("want %q; got %q", test.Expected, got)
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterIsolatesKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	kl := NewKeyedLimiter(KeyedSettings{
+		Default: Settings{Rate: 1, Burst: 2},
+		MaxKeys: 10,
+		Now:     clock.Now,
+	})
+	defer kl.Stop()
+
+	for i := 0; i < 2; i++ {
+		if kl.LimitKey("noisy") {
+			t.Fatalf("request %d of noisy supposed to pass", i+1)
+		}
+	}
+	if !kl.LimitKey("noisy") {
+		t.Fatalf("noisy supposed to be limited")
+	}
+	if kl.LimitKey("quiet") {
+		t.Fatalf("quiet supposed to pass while noisy is limited")
+	}
+
+	clock.Advance(time.Second)
+	if kl.LimitKey("noisy") {
+		t.Fatalf("noisy supposed to pass after the refill")
+	}
+}
+
+func TestKeyedLimiterTiers(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	kl := NewKeyedLimiter(KeyedSettings{
+		Default: Settings{Rate: 1, Burst: 1},
+		Tiers: map[string]Settings{
+			"gold": {Rate: 1, Burst: 5},
+		},
+		MaxKeys: 10,
+		Now:     clock.Now,
+	})
+	defer kl.Stop()
+
+	tests := map[string]int{
+		"gold":   5,
+		"bronze": 1,
+	}
+	for key, expected := range tests {
+		allowed := 0
+		for !kl.LimitKey(key) {
+			allowed++
+		}
+		if allowed != expected {
+			t.Errorf("%s: want %d allowed requests; got %d", key, expected, allowed)
+		}
+	}
+
+	if !kl.HasTier("gold") || kl.HasTier("bronze") {
+		t.Errorf("only gold supposed to have a tier")
+	}
+}
+
+func TestKeyedLimiterMaxKeys(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	kl := NewKeyedLimiter(KeyedSettings{
+		Default: Settings{Rate: 1, Burst: 1},
+		MaxKeys: 2,
+		Now:     clock.Now,
+	})
+	defer kl.Stop()
+
+	kl.LimitKey("a")
+	kl.LimitKey("b")
+	// a is seen again, so b is the least recently seen key
+	kl.LimitKey("a")
+	kl.LimitKey("c")
+
+	if got := kl.Len(); got != 2 {
+		t.Fatalf("want 2 buckets; got %d", got)
+	}
+	if !kl.LimitKey("a") {
+		t.Fatalf("bucket of a supposed to be kept")
+	}
+	// the bucket of b was removed, so it starts full again
+	if kl.LimitKey("b") {
+		t.Fatalf("bucket of b supposed to be removed")
+	}
+}
+
+func TestKeyedLimiterSetSettings(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	kl := NewKeyedLimiter(KeyedSettings{
+		Default: Settings{Rate: 1, Burst: 1},
+		MaxKeys: 10,
+		Now:     clock.Now,
+	})
+	defer kl.Stop()
+
+	for _, key := range []string{"a", "b", "gold"} {
+		kl.LimitKey(key)
+	}
+
+	kl.SetSettings(KeyedSettings{
+		Default: Settings{Rate: 1, Burst: 3},
+		Tiers:   map[string]Settings{"gold": {Rate: 1, Burst: 5}},
+		MaxKeys: 2,
+	})
+	if got := kl.Len(); got != 2 {
+		t.Fatalf("want 2 buckets; got %d", got)
+	}
+
+	// the existing buckets are kept, they are empty and refilled with their new settings
+	clock.Advance(time.Second * 10)
+	tests := map[string]int{
+		"gold": 5,
+		"b":    3,
+	}
+	for key, expected := range tests {
+		allowed := 0
+		for !kl.LimitKey(key) {
+			allowed++
+		}
+		if allowed != expected {
+			t.Errorf("%s: want %d allowed requests; got %d", key, expected, allowed)
+		}
+	}
+}
+
+func TestKeyedLimiterSetSettingsRestartsSweeper(t *testing.T) {
+	kl := NewKeyedLimiter(KeyedSettings{
+		Default: Settings{Rate: 1, Burst: 1},
+		MaxKeys: 10,
+	})
+	defer kl.Stop()
+	kl.LimitKey("a")
+
+	kl.SetSettings(KeyedSettings{
+		Default:     Settings{Rate: 1, Burst: 1},
+		MaxKeys:     10,
+		IdleTimeout: time.Millisecond * 20,
+	})
+
+	deadline := time.Now().Add(time.Second * 2)
+	for kl.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle bucket supposed to be removed by the new sweeper")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestKeyedLimiterIdleTimeout(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	kl := NewKeyedLimiter(KeyedSettings{
+		Default:     Settings{Rate: 1, Burst: 1},
+		MaxKeys:     10,
+		IdleTimeout: time.Hour,
+		Now:         clock.Now,
+	})
+	defer kl.Stop()
+
+	kl.LimitKey("old")
+	clock.Advance(time.Minute * 40)
+	kl.LimitKey("new")
+	clock.Advance(time.Minute * 30)
+
+	kl.sweep()
+	if got := kl.Len(); got != 1 {
+		t.Fatalf("want 1 bucket; got %d", got)
+	}
+
+	clock.Advance(time.Hour)
+	kl.sweep()
+	if got := kl.Len(); got != 0 {
+		t.Fatalf("want 0 buckets; got %d", got)
+	}
+}
+
+func TestKeyedLimiterSweeper(t *testing.T) {
+	kl := NewKeyedLimiter(KeyedSettings{
+		Default:     Settings{Rate: 1, Burst: 1},
+		MaxKeys:     10,
+		IdleTimeout: time.Millisecond * 20,
+	})
+	kl.LimitKey("a")
+
+	deadline := time.Now().Add(time.Second * 2)
+	for kl.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle bucket supposed to be removed by the sweeper")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	kl.Stop()
+	kl.Stop()
+}
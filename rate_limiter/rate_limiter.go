@@ -0,0 +1,202 @@
+// rate_limiter is a thread safe token bucket rate limiting for the gRPC server.
+// The limiters implement the ratelimit.Limiter interface of go-grpc-middleware,
+// so they can be used by its UnaryServerInterceptor and StreamServerInterceptor.
+package rate_limiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/ratelimit"
+)
+
+// ErrNoTokens is returned by Wait when the bucket is empty and it is never refilled,
+// because its rate is zero or it is stopped.
+var ErrNoTokens = errors.New("rate limiter has no tokens")
+
+// Limiter is a ratelimit.Limiter which can be stopped.
+// Stop releases the resources of the limiter, the limiter must not be used after it.
+type Limiter interface {
+	ratelimit.Limiter
+	Stop()
+}
+
+// Settings holds the settings of a token bucket.
+type Settings struct {
+	// Rate is the number of the tokens added to the bucket every second.
+	Rate float64
+
+	// Burst is the capacity of the bucket, it is the maximum number of the requests at once.
+	Burst int
+
+	// Now returns the current time. If it is nil, time.Now is used.
+	// It can be replaced to make the tests deterministic.
+	Now func() time.Time
+}
+
+// TokenBucket holds the required variables to compose a token bucket rate limiter.
+// The bucket starts full and it is refilled on every call by the elapsed time,
+// so it does not need a background goroutine.
+type TokenBucket struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the tokens
+	mu sync.Mutex
+
+	settings Settings
+
+	// tokens is the number of the available tokens, it can be a fraction.
+	tokens float64
+
+	// last is the last time the tokens were refilled.
+	last time.Time
+
+	stopped bool
+}
+
+// TokenBucket must implement the Limiter interface.
+var _ Limiter = (*TokenBucket)(nil)
+
+// NewTokenBucket returns a new full TokenBucket with the given settings.
+// The burst is at least 1 and a negative rate is treated as zero.
+func NewTokenBucket(settings Settings) *TokenBucket {
+	if settings.Burst < 1 {
+		settings.Burst = 1
+	}
+	if settings.Rate < 0 {
+		settings.Rate = 0
+	}
+	if settings.Now == nil {
+		settings.Now = time.Now
+	}
+	return &TokenBucket{
+		settings: settings,
+		tokens:   float64(settings.Burst),
+		last:     settings.Now(),
+	}
+}
+
+// Decision is the result of taking a token from a bucket.
+type Decision struct {
+	// Limited is true if the limit is reached.
+	Limited bool
+
+	// Remaining is the number of the whole tokens left in the bucket.
+	Remaining int
+
+	// RetryAfter is the wait until the next token when the limit is reached.
+	// It is zero if the bucket is never refilled.
+	RetryAfter time.Duration
+}
+
+// Limit returns true if the limit is reached.
+// If the limit is not reached, it takes a token from the bucket.
+// A stopped bucket rejects every request.
+func (tb *TokenBucket) Limit() bool {
+	return tb.Take().Limited
+}
+
+// Take takes a token from the bucket if there is one and returns the decision.
+// A stopped bucket rejects every request.
+func (tb *TokenBucket) Take() Decision {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.stopped {
+		return Decision{Limited: true}
+	}
+
+	tb.refill()
+	if tb.tokens < 1 {
+		decision := Decision{Limited: true}
+		if tb.settings.Rate > 0 {
+			seconds := (1 - tb.tokens) / tb.settings.Rate
+			decision.RetryAfter = time.Duration(math.Ceil(seconds * float64(time.Second)))
+		}
+		return decision
+	}
+	tb.tokens--
+	return Decision{Remaining: int(tb.tokens)}
+}
+
+// Wait takes a token from the bucket, it waits for the next token if there is none.
+// It returns the error of the context if the context is done before a token is taken.
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		decision := tb.Take()
+		if !decision.Limited {
+			return nil
+		}
+		if decision.RetryAfter <= 0 {
+			return ErrNoTokens
+		}
+
+		timer := time.NewTimer(decision.RetryAfter)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Tokens returns the number of the available tokens.
+func (tb *TokenBucket) Tokens() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill()
+	return tb.tokens
+}
+
+// SetSettings changes the rate and the burst of the bucket without emptying it.
+// The tokens of the elapsed time are added with the old rate first,
+// and the bucket never holds more tokens than the new burst.
+// The clock of the bucket is kept if the new settings have no Now.
+func (tb *TokenBucket) SetSettings(settings Settings) {
+	if settings.Burst < 1 {
+		settings.Burst = 1
+	}
+	if settings.Rate < 0 {
+		settings.Rate = 0
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if settings.Now == nil {
+		settings.Now = tb.settings.Now
+	}
+	tb.refill()
+	tb.settings = settings
+	if burst := float64(settings.Burst); tb.tokens > burst {
+		tb.tokens = burst
+	}
+}
+
+// Stop stops the bucket, the requests after it are rejected.
+// It is safe to call it more than once.
+func (tb *TokenBucket) Stop() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.stopped = true
+}
+
+// refill adds the tokens of the elapsed time since the last refill.
+// The bucket never holds more tokens than the burst.
+// It must be called while holding the lock.
+func (tb *TokenBucket) refill() {
+	now := tb.settings.Now()
+	elapsed := now.Sub(tb.last)
+	if elapsed <= 0 {
+		return
+	}
+	tb.last = now
+
+	tb.tokens += elapsed.Seconds() * tb.settings.Rate
+	if burst := float64(tb.settings.Burst); tb.tokens > burst {
+		tb.tokens = burst
+	}
+}
@@ -0,0 +1,218 @@
+package rate_limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock which moves only when it is told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Now returns the current time of the clock.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by the given duration.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestTokenBucket(t *testing.T) {
+	tests := map[string]struct {
+		Settings Settings
+		Advance  time.Duration
+		// Allowed is the number of the requests which pass after the burst is used and the clock is advanced.
+		Allowed int
+	}{
+		"no refill": {
+			Settings: Settings{Rate: 1, Burst: 3},
+			Advance:  0,
+			Allowed:  0,
+		},
+		"partial refill": {
+			Settings: Settings{Rate: 2, Burst: 5},
+			Advance:  time.Millisecond * 1500,
+			Allowed:  3,
+		},
+		"refill is capped by the burst": {
+			Settings: Settings{Rate: 10, Burst: 4},
+			Advance:  time.Minute,
+			Allowed:  4,
+		},
+		"fractional rate": {
+			Settings: Settings{Rate: 0.5, Burst: 2},
+			Advance:  time.Second * 3,
+			Allowed:  1,
+		},
+		"zero rate never refills": {
+			Settings: Settings{Rate: 0, Burst: 2},
+			Advance:  time.Hour,
+			Allowed:  0,
+		},
+		"zero burst is one": {
+			Settings: Settings{Rate: 1, Burst: 0},
+			Advance:  time.Second,
+			Allowed:  1,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			clock := &fakeClock{now: time.Unix(0, 0)}
+			settings := test.Settings
+			settings.Now = clock.Now
+			tb := NewTokenBucket(settings)
+
+			burst := settings.Burst
+			if burst < 1 {
+				burst = 1
+			}
+			for i := 0; i < burst; i++ {
+				if tb.Limit() {
+					t.Fatalf("request %d of the burst supposed to pass", i+1)
+				}
+			}
+			if !tb.Limit() {
+				t.Fatalf("request after the burst supposed to be limited")
+			}
+
+			clock.Advance(test.Advance)
+			allowed := 0
+			for !tb.Limit() {
+				allowed++
+			}
+			if allowed != test.Allowed {
+				t.Fatalf("want %d allowed requests; got %d", test.Allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestTokenBucketConcurrent(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	tb := NewTokenBucket(Settings{Rate: 1, Burst: 20, Now: clock.Now})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !tb.Limit() {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 20 {
+		t.Fatalf("want 20 allowed requests; got %d", allowed)
+	}
+}
+
+func TestTokenBucketStop(t *testing.T) {
+	tb := NewTokenBucket(Settings{Rate: 100, Burst: 100})
+	if tb.Limit() {
+		t.Fatalf("request supposed to pass before stop")
+	}
+
+	tb.Stop()
+	tb.Stop()
+	if !tb.Limit() {
+		t.Fatalf("request supposed to be limited after stop")
+	}
+}
+
+func TestTokenBucketTokens(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	tb := NewTokenBucket(Settings{Rate: 4, Burst: 8, Now: clock.Now})
+
+	for i := 0; i < 8; i++ {
+		tb.Limit()
+	}
+	if tokens := tb.Tokens(); tokens != 0 {
+		t.Fatalf("want 0 tokens; got %v", tokens)
+	}
+
+	clock.Advance(time.Millisecond * 500)
+	if tokens := tb.Tokens(); tokens != 2 {
+		t.Fatalf("want 2 tokens; got %v", tokens)
+	}
+
+	// the clock going backwards does not remove tokens
+	clock.Advance(-time.Second)
+	if tokens := tb.Tokens(); tokens != 2 {
+		t.Fatalf("want 2 tokens; got %v", tokens)
+	}
+}
+
+func TestTokenBucketSetSettings(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	tb := NewTokenBucket(Settings{Rate: 1, Burst: 10, Now: clock.Now})
+	for i := 0; i < 6; i++ {
+		tb.Limit()
+	}
+
+	// the elapsed second is refilled with the old rate before the new rate is applied
+	clock.Advance(time.Second)
+	tb.SetSettings(Settings{Rate: 10, Burst: 20})
+	if tokens := tb.Tokens(); tokens != 5 {
+		t.Fatalf("want 5 tokens; got %v", tokens)
+	}
+
+	clock.Advance(time.Millisecond * 500)
+	if tokens := tb.Tokens(); tokens != 10 {
+		t.Fatalf("want 10 tokens with the new rate; got %v", tokens)
+	}
+
+	// a smaller burst caps the tokens
+	tb.SetSettings(Settings{Rate: 10, Burst: 3})
+	if tokens := tb.Tokens(); tokens != 3 {
+		t.Fatalf("want 3 tokens with the new burst; got %v", tokens)
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	tb := NewTokenBucket(Settings{Rate: 50, Burst: 1})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := tb.Wait(context.Background()); err != nil {
+			t.Fatalf("error is not nil %v", err)
+		}
+	}
+	// the first token is in the bucket, the next two are refilled every 20ms
+	if elapsed := time.Since(start); elapsed < time.Millisecond*35 {
+		t.Fatalf("wait supposed to take about 40ms; took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	slow := NewTokenBucket(Settings{Rate: 0.1, Burst: 1})
+	slow.Take()
+	if err := slow.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded; got %v", err)
+	}
+
+	never := NewTokenBucket(Settings{Rate: 0, Burst: 1})
+	never.Take()
+	if err := never.Wait(context.Background()); !errors.Is(err, ErrNoTokens) {
+		t.Fatalf("want ErrNoTokens; got %v", err)
+	}
+}
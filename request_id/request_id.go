@@ -0,0 +1,105 @@
+// request_id gives every gRPC request an ID which is added to its log lines and returned to the client.
+// The ID of the client is kept if it sends a valid one, so the requests can be followed across the services.
+package request_id
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"google.golang.org/grpc"
+	grpc_metadata "google.golang.org/grpc/metadata"
+)
+
+// Header is the metadata key of the request ID.
+// It is read from the request metadata and sent back in the response header and trailer.
+const Header = "x-request-id"
+
+// LogField is the log field of the request ID.
+const LogField = "request_id"
+
+// isValidID checks the request IDs sent by the clients, the others are replaced with a new one.
+var isValidID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`).MatchString
+
+// ctxMarker is the context key of the request ID.
+type ctxMarker struct{}
+
+// FromContext returns the request ID of the given context.
+// It returns an empty string if the context has no request ID.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxMarker{}).(string)
+	return id
+}
+
+// NewID returns a new random request ID.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on the supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor which gives every request an ID.
+// It must be chained after the ctxtags interceptor, so the ID is added to the log fields.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, id := withRequestID(ctx)
+		md := grpc_metadata.Pairs(Header, id)
+		_ = grpc.SetHeader(ctx, md)
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			// the header may not reach the client with an error, the trailer always does
+			_ = grpc.SetTrailer(ctx, md)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a new stream server interceptor which gives every request an ID.
+// It must be chained after the ctxtags interceptor, so the ID is added to the log fields.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := withRequestID(stream.Context())
+		md := grpc_metadata.Pairs(Header, id)
+		_ = stream.SetHeader(md)
+
+		err := handler(srv, &requestIDStream{ServerStream: stream, ctx: ctx})
+		if err != nil {
+			stream.SetTrailer(md)
+		}
+		return err
+	}
+}
+
+// withRequestID returns the context with the request ID of the client or a new one.
+// The request ID is also added to the tags of the request.
+func withRequestID(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := grpc_metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(Header); len(values) > 0 && isValidID(values[0]) {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = NewID()
+	}
+
+	grpc_ctxtags.Extract(ctx).Set(LogField, id)
+	return context.WithValue(ctx, ctxMarker{}, id), id
+}
+
+// requestIDStream replaces the context of a server stream with the context which has the request ID.
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context which has the request ID.
+func (s *requestIDStream) Context() context.Context {
+	return s.ctx
+}
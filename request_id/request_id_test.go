@@ -0,0 +1,141 @@
+package request_id
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// recordingHealthServer records the request IDs and the tags of the requests.
+type recordingHealthServer struct {
+	*health.Server
+	ids  chan string
+	tags chan interface{}
+}
+
+// Check records the request ID and its tag of the request.
+func (s *recordingHealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	s.ids <- FromContext(ctx)
+	s.tags <- grpc_ctxtags.Extract(ctx).Values()[LogField]
+	return s.Server.Check(ctx, req)
+}
+
+// Watch records the request ID and its tag of the request.
+func (s *recordingHealthServer) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	s.ids <- FromContext(stream.Context())
+	s.tags <- grpc_ctxtags.Extract(stream.Context()).Values()[LogField]
+	return s.Server.Watch(req, stream)
+}
+
+// newHealthClient starts a health server behind the request ID interceptors and returns its client.
+func newHealthClient(t *testing.T) (grpc_health_v1.HealthClient, *recordingHealthServer) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc_middleware.WithUnaryServerChain(grpc_ctxtags.UnaryServerInterceptor(), UnaryServerInterceptor()),
+		grpc_middleware.WithStreamServerChain(grpc_ctxtags.StreamServerInterceptor(), StreamServerInterceptor()),
+	)
+	healthServer := &recordingHealthServer{Server: health.NewServer(), ids: make(chan string, 10), tags: make(chan interface{}, 10)}
+	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn), healthServer
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := map[string]struct {
+		ClientID string
+		Service  string
+		Kept     bool
+	}{
+		"generated":         {ClientID: "", Service: "", Kept: false},
+		"client id":         {ClientID: "client-42.a_b", Service: "", Kept: true},
+		"invalid client id": {ClientID: "bad id!", Service: "", Kept: false},
+		"too long":          {ClientID: strings.Repeat("a", 65), Service: "", Kept: false},
+		"failed request":    {ClientID: "", Service: "unknown", Kept: false},
+	}
+
+	client, server := newHealthClient(t)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.ClientID != "" {
+				ctx = grpc_metadata.AppendToOutgoingContext(ctx, Header, test.ClientID)
+			}
+
+			var header, trailer grpc_metadata.MD
+			_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: test.Service}, grpc.Header(&header), grpc.Trailer(&trailer))
+			if (err != nil) != (test.Service != "") {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			id, tag := <-server.ids, <-server.tags
+			if id == "" || tag != id {
+				t.Fatalf("request id %q and its tag %v should be set", id, tag)
+			}
+			if test.Kept && id != test.ClientID {
+				t.Errorf("request id = %q; want the client id %q", id, test.ClientID)
+			}
+			if !test.Kept && (id == test.ClientID || len(id) != 32) {
+				t.Errorf("request id %q should be generated", id)
+			}
+
+			got := header.Get(Header)
+			if err != nil {
+				got = trailer.Get(Header)
+			}
+			if len(got) != 1 || got[0] != id {
+				t.Errorf("response metadata = %v; want %q", got, id)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	client, server := newHealthClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watch, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch returned an error : %v", err)
+	}
+	header, err := watch.Header()
+	if err != nil {
+		t.Fatalf("Header returned an error : %v", err)
+	}
+
+	id, tag := <-server.ids, <-server.tags
+	if id == "" || tag != id {
+		t.Fatalf("request id %q and its tag %v should be set", id, tag)
+	}
+	if got := header.Get(Header); len(got) != 1 || got[0] != id {
+		t.Errorf("response header = %v; want %q", got, id)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	first, second := NewID(), NewID()
+	if first == second || !isValidID(first) {
+		t.Errorf("request ids should be unique and valid %q %q", first, second)
+	}
+}
@@ -0,0 +1,248 @@
+// tls_config builds the TLS configurations of the server and the client from certificate files.
+// The files are watched and reloaded when they change, so the certificates can be renewed without a restart.
+package tls_config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// http2Protocol is the ALPN protocol of gRPC.
+const http2Protocol = "h2"
+
+// Files holds the paths of the certificate files.
+type Files struct {
+	// CertFile is the PEM encoded certificate, it is required with the key file.
+	CertFile string
+
+	// KeyFile is the PEM encoded private key of the certificate.
+	KeyFile string
+
+	// CAFile is the PEM encoded certificate authorities which are used to verify the peer, it is optional.
+	// The server verifies the client certificates and the client verifies the server certificate with it.
+	CAFile string
+}
+
+// fileStamp is used to notice the changes of a file without reading it.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader holds the certificate and the certificate authorities loaded from the files.
+// They are replaced only if all the files are loaded successfully, so a half written renewal does not break the TLS handshakes.
+type Reloader struct {
+	// Mutex is used for handling the concurrent
+	// read/write requests for the certificates
+	mu sync.RWMutex
+
+	files Files
+
+	// cert is nil if there is no certificate file.
+	cert *tls.Certificate
+
+	// pool is nil if there is no CA file.
+	pool *x509.CertPool
+
+	// stamps holds the stamps of the files when they were loaded last time.
+	stamps map[string]fileStamp
+
+	// quit is used to stop the watcher.
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReloader loads the given files and returns a new Reloader instance.
+// The cert and key files must be given together.
+func NewReloader(files Files) (*Reloader, error) {
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, errors.New("certificate and key files must be given together")
+	}
+
+	r := &Reloader{files: files, quit: make(chan struct{})}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the files and replaces the certificates with them.
+// If loading fails, the previous certificates are kept.
+func (r *Reloader) Reload() error {
+	stamps, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	var cert *tls.Certificate
+	if r.files.CertFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load the certificate : %v", err)
+		}
+		cert = &loaded
+	}
+
+	var pool *x509.CertPool
+	if r.files.CAFile != "" {
+		pem, err := ioutil.ReadFile(r.files.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the CA file : %v", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA file has no valid certificates : %v", r.files.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = cert
+	r.pool = pool
+	r.stamps = stamps
+	return nil
+}
+
+// ReloadIfChanged reloads the files if any of them changed since the last successful reload.
+// It returns true if the certificates are replaced.
+func (r *Reloader) ReloadIfChanged() (bool, error) {
+	stamps, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := false
+	for name, stamp := range stamps {
+		if r.stamps[name] != stamp {
+			changed = true
+		}
+	}
+	r.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+	if err := r.Reload(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// StartWatcher checks the files every given interval in the background and reloads them if they changed.
+// The reloads are reported to onReload and the errors to onError, they can be nil.
+func (r *Reloader) StartWatcher(interval time.Duration, onReload func(), onError func(error)) {
+	ticker := time.NewTicker(interval)
+	go tickerToReload(ticker, r.quit, r, onReload, onError)
+}
+
+// Stop stops the watcher. It is safe to call Stop more than once.
+func (r *Reloader) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.quit)
+	})
+}
+
+// Certificate returns the current certificate, it is nil if there is no certificate file.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// CertPool returns the current certificate authorities, it is nil if there is no CA file.
+func (r *Reloader) CertPool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// ServerConfig returns the TLS configuration of the server.
+// Every handshake uses the current certificates, so the reloaded files are used by the new connections.
+// If requireClientCert is true, the clients must send a certificate signed by the certificate authorities of the CA file.
+func (r *Reloader) ServerConfig(requireClientCert bool) (*tls.Config, error) {
+	if r.Certificate() == nil {
+		return nil, errors.New("server requires a certificate")
+	}
+	if requireClientCert && r.CertPool() == nil {
+		return nil, errors.New("client certificate verification requires a CA file")
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{http2Protocol},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{http2Protocol},
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if requireClientCert {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = r.pool
+			}
+			return cfg, nil
+		},
+	}, nil
+}
+
+// ClientConfig returns the TLS configuration of the client.
+// The server certificate is verified with the CA file, or with the system certificate authorities if there is no CA file.
+// The certificate is sent to the server if the server asks for it and there is a certificate file.
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		RootCAs:    r.CertPool(),
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.Certificate(); cert != nil {
+				return cert, nil
+			}
+			// an empty certificate tells the server that the client has no certificate
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+// stat returns the stamps of the given files.
+func (r *Reloader) stat() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	for _, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat the file : %v", err)
+		}
+		stamps[name] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// tickerToReload reloads the files every given ticker if they changed.
+func tickerToReload(ticker *time.Ticker, quit chan struct{}, r *Reloader, onReload func(), onError func(error)) {
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := r.ReloadIfChanged()
+			if err != nil && onError != nil {
+				onError(err)
+			}
+			if reloaded && onReload != nil {
+				onReload()
+			}
+		case <-quit:
+			ticker.Stop()
+			return
+		}
+	}
+}
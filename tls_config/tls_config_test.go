@@ -0,0 +1,368 @@
+package tls_config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testCA is a self-signed certificate authority which signs the test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCA returns a new self-signed certificate authority.
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, der: der}
+}
+
+// writeCA writes the certificate of the certificate authority to the given path.
+func (ca *testCA) writeCA(t *testing.T, path string) {
+	writePEM(t, path, "CERTIFICATE", ca.der)
+}
+
+// writeCert writes a new certificate signed by the certificate authority and its key to the given paths.
+// The certificate is valid for localhost and can be used by both the server and the client.
+func (ca *testCA) writeCert(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+}
+
+// writePEM writes a single PEM block to the given path.
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFiles writes a CA, a server certificate and a client certificate to a temporary directory.
+func testFiles(t *testing.T) (server, client Files, ca *testCA) {
+	dir := t.TempDir()
+	ca = newTestCA(t, "test ca")
+	ca.writeCA(t, filepath.Join(dir, "ca.pem"))
+	ca.writeCert(t, filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"), "server")
+	ca.writeCert(t, filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem"), "client")
+
+	server = Files{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server-key.pem"), CAFile: filepath.Join(dir, "ca.pem")}
+	client = Files{CertFile: filepath.Join(dir, "client.pem"), KeyFile: filepath.Join(dir, "client-key.pem"), CAFile: filepath.Join(dir, "ca.pem")}
+	return server, client, ca
+}
+
+func TestNewReloader(t *testing.T) {
+	server, _, _ := testFiles(t)
+	invalidCA := filepath.Join(t.TempDir(), "invalid.pem")
+	if err := ioutil.WriteFile(invalidCA, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		Files Files
+		Valid bool
+	}{
+		"certificate and CA": {
+			Files: server,
+			Valid: true,
+		},
+		"only CA": {
+			Files: Files{CAFile: server.CAFile},
+			Valid: true,
+		},
+		"no files": {
+			Files: Files{},
+			Valid: true,
+		},
+		"certificate without key": {
+			Files: Files{CertFile: server.CertFile},
+			Valid: false,
+		},
+		"missing certificate file": {
+			Files: Files{CertFile: "missing.pem", KeyFile: server.KeyFile},
+			Valid: false,
+		},
+		"mismatched key": {
+			Files: Files{CertFile: server.CertFile, KeyFile: server.CertFile},
+			Valid: false,
+		},
+		"invalid CA file": {
+			Files: Files{CAFile: invalidCA},
+			Valid: false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r, err := NewReloader(test.Files)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if (r.Certificate() != nil) != (test.Files.CertFile != "") {
+				t.Errorf("certificate is not loaded correctly")
+			}
+			if (r.CertPool() != nil) != (test.Files.CAFile != "") {
+				t.Errorf("CA file is not loaded correctly")
+			}
+		})
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	server, _, _ := testFiles(t)
+
+	tests := map[string]struct {
+		Files             Files
+		RequireClientCert bool
+		Valid             bool
+	}{
+		"tls":                        {Files: Files{CertFile: server.CertFile, KeyFile: server.KeyFile}, RequireClientCert: false, Valid: true},
+		"mutual tls":                 {Files: server, RequireClientCert: true, Valid: true},
+		"no certificate":             {Files: Files{CAFile: server.CAFile}, RequireClientCert: false, Valid: false},
+		"mutual tls without CA file": {Files: Files{CertFile: server.CertFile, KeyFile: server.KeyFile}, RequireClientCert: true, Valid: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			r, err := NewReloader(test.Files)
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			_, err = r.ServerConfig(test.RequireClientCert)
+			if test.Valid != (err == nil) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+// serveHealth starts a health server with the given TLS configuration and returns its address.
+func serveHealth(t *testing.T, cfg *tls.Config) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(cfg)))
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	return lis.Addr().String()
+}
+
+// checkHealth calls the health server with the given TLS configuration.
+func checkHealth(addr string, cfg *tls.Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err
+}
+
+func TestMutualTLS(t *testing.T) {
+	serverFiles, clientFiles, _ := testFiles(t)
+	otherServer, _, _ := testFiles(t)
+
+	serverReloader, err := NewReloader(serverFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := serverReloader.ServerConfig(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveHealth(t, serverConfig)
+
+	tests := map[string]struct {
+		Files Files
+		Valid bool
+	}{
+		"client certificate": {
+			Files: clientFiles,
+			Valid: true,
+		},
+		"no client certificate": {
+			Files: Files{CAFile: clientFiles.CAFile},
+			Valid: false,
+		},
+		"client certificate of another CA": {
+			Files: Files{CertFile: otherServer.CertFile, KeyFile: otherServer.KeyFile, CAFile: clientFiles.CAFile},
+			Valid: false,
+		},
+		"server certificate of an unknown CA": {
+			Files: Files{CertFile: clientFiles.CertFile, KeyFile: clientFiles.KeyFile, CAFile: otherServer.CAFile},
+			Valid: false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			clientReloader, err := NewReloader(test.Files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = checkHealth(addr, clientReloader.ClientConfig("localhost"))
+			if test.Valid != (err == nil) {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+// serverCommonName returns the common name of the certificate the server at the given address sends.
+func serverCommonName(t *testing.T, addr string, cfg *tls.Config) string {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestReloadIfChanged(t *testing.T) {
+	serverFiles, clientFiles, ca := testFiles(t)
+	r, err := NewReloader(serverFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := r.ServerConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientReloader, err := NewReloader(Files{CAFile: clientFiles.CAFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveHealth(t, serverConfig)
+	clientConfig := clientReloader.ClientConfig("localhost")
+	clientConfig.NextProtos = []string{http2Protocol}
+
+	if reloaded, err := r.ReloadIfChanged(); reloaded || err != nil {
+		t.Fatalf("unchanged files should not be reloaded %v %v", reloaded, err)
+	}
+
+	ca.writeCert(t, serverFiles.CertFile, serverFiles.KeyFile, "renewed")
+	if reloaded, err := r.ReloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("changed files should be reloaded %v %v", reloaded, err)
+	}
+	if name := serverCommonName(t, addr, clientConfig); name != "renewed" {
+		t.Errorf("new connections should use the renewed certificate; got %q", name)
+	}
+
+	// a broken renewal keeps the previous certificate
+	if err := ioutil.WriteFile(serverFiles.KeyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := r.ReloadIfChanged(); reloaded || err == nil {
+		t.Fatalf("broken files should not be reloaded %v %v", reloaded, err)
+	}
+	if name := serverCommonName(t, addr, clientConfig); name != "renewed" {
+		t.Errorf("the previous certificate should be kept; got %q", name)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	serverFiles, _, ca := testFiles(t)
+	r, err := NewReloader(serverFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan struct{}, 1)
+	r.StartWatcher(time.Millisecond*10, func() { reloaded <- struct{}{} }, nil)
+	defer r.Stop()
+
+	ca.writeCert(t, serverFiles.CertFile, serverFiles.KeyFile, "renewed")
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("changed files are not reloaded")
+	}
+	leaf, err := x509.ParseCertificate(r.Certificate().Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "renewed" {
+		t.Errorf("certificate is not replaced %q", leaf.Subject.CommonName)
+	}
+
+	r.Stop()
+	r.Stop()
+}
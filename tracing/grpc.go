@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpc_metadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// instrumentationName is the name of the tracer of the gRPC interceptors.
+const instrumentationName = "github.com/canbo-x/dog-ceo/tracing"
+
+// metadataCarrier adapts the gRPC metadata to the carrier of the propagator.
+type metadataCarrier grpc_metadata.MD
+
+// Get returns the first value of the given key.
+func (c metadataCarrier) Get(key string) string {
+	values := grpc_metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Set replaces the values of the given key.
+func (c metadataCarrier) Set(key, value string) {
+	grpc_metadata.MD(c).Set(key, value)
+}
+
+// Keys returns the keys of the metadata.
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// UnaryServerInterceptor returns a new unary server interceptor which starts a span for every RPC.
+// The span continues the trace of the client if the client sent its trace context in the metadata.
+func UnaryServerInterceptor(tp trace.TracerProvider) grpc.UnaryServerInterceptor {
+	tracer := tp.Tracer(instrumentationName)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startServerSpan(ctx, tracer, info.FullMethod)
+		defer span.End()
+
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a new stream server interceptor which starts a span for every RPC.
+// The span continues the trace of the client if the client sent its trace context in the metadata.
+func StreamServerInterceptor(tp trace.TracerProvider) grpc.StreamServerInterceptor {
+	tracer := tp.Tracer(instrumentationName)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(stream.Context(), tracer, info.FullMethod)
+		defer span.End()
+
+		err := handler(srv, &tracedServerStream{ServerStream: stream, ctx: ctx})
+		endSpan(span, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns a new unary client interceptor which starts a span for every RPC
+// and sends its trace context to the server in the metadata.
+func UnaryClientInterceptor(tp trace.TracerProvider) grpc.UnaryClientInterceptor {
+	tracer := tp.Tracer(instrumentationName)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startClientSpan(ctx, tracer, method)
+		defer span.End()
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		endSpan(span, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a new stream client interceptor which starts a span for every RPC
+// and sends its trace context to the server in the metadata.
+// The span ends when the stream is created, the receiving of the messages is not traced.
+func StreamClientInterceptor(tp trace.TracerProvider) grpc.StreamClientInterceptor {
+	tracer := tp.Tracer(instrumentationName)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, tracer, method)
+		defer span.End()
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		endSpan(span, err)
+		return stream, err
+	}
+}
+
+// startServerSpan extracts the trace context of the client from the incoming metadata and starts a server span.
+func startServerSpan(ctx context.Context, tracer trace.Tracer, fullMethod string) (context.Context, trace.Span) {
+	md, ok := grpc_metadata.FromIncomingContext(ctx)
+	if ok {
+		ctx = Propagator.Extract(ctx, metadataCarrier(md.Copy()))
+	}
+	return tracer.Start(ctx, spanName(fullMethod),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(rpcAttributes(fullMethod)...),
+	)
+}
+
+// startClientSpan starts a client span and injects its trace context into the outgoing metadata.
+func startClientSpan(ctx context.Context, tracer trace.Tracer, fullMethod string) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, spanName(fullMethod),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(rpcAttributes(fullMethod)...),
+	)
+
+	md, ok := grpc_metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = grpc_metadata.MD{}
+	}
+	Propagator.Inject(ctx, metadataCarrier(md))
+	return grpc_metadata.NewOutgoingContext(ctx, md), span
+}
+
+// endSpan records the status code of the RPC on the span.
+// Only the failed RPCs change the status of the span.
+func endSpan(span trace.Span, err error) {
+	st := status.Convert(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int64(int64(st.Code())))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, st.Message())
+	}
+}
+
+// spanName returns the span name of the given full method name.
+// Example: "/breed_image.BreedImageService/Search" -> "breed_image.BreedImageService/Search"
+func spanName(fullMethod string) string {
+	return strings.TrimPrefix(fullMethod, "/")
+}
+
+// rpcAttributes returns the RPC attributes of the given full method name.
+func rpcAttributes(fullMethod string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("grpc")}
+	service, method, ok := strings.Cut(spanName(fullMethod), "/")
+	if ok {
+		attrs = append(attrs, semconv.RPCServiceKey.String(service), semconv.RPCMethodKey.String(method))
+	}
+	return attrs
+}
+
+// tracedServerStream replaces the context of a server stream with the context of its span.
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the span.
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
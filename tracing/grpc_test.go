@@ -0,0 +1,148 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTracedHealthClient starts a traced health server and returns a traced client of it.
+// The spans of the server and the client are recorded separately.
+func newTracedHealthClient(t *testing.T, serverSpans, clientSpans *tracetest.SpanRecorder) grpc_health_v1.HealthClient {
+	serverProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(serverSpans))
+	clientProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(clientSpans))
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(serverProvider)),
+		grpc.StreamInterceptor(StreamServerInterceptor(serverProvider)),
+	)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(clientProvider)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(clientProvider)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+func TestUnaryPropagation(t *testing.T) {
+	serverSpans, clientSpans := tracetest.NewSpanRecorder(), tracetest.NewSpanRecorder()
+	client := newTracedHealthClient(t, serverSpans, clientSpans)
+
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check returned an error : %v", err)
+	}
+	if _, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "unknown"}); err == nil {
+		t.Fatal("Check of an unknown service should return an error")
+	}
+
+	servers, clients := serverSpans.Ended(), clientSpans.Ended()
+	if len(servers) != 2 || len(clients) != 2 {
+		t.Fatalf("want 2 server and 2 client spans; got %d and %d", len(servers), len(clients))
+	}
+	for i := range servers {
+		assertChildOf(t, servers[i], clients[i])
+		if servers[i].Name() != "grpc.health.v1.Health/Check" {
+			t.Errorf("span name = %q", servers[i].Name())
+		}
+	}
+
+	if servers[0].Status().Code != 0 {
+		t.Errorf("successful RPC should not change the span status %v", servers[0].Status())
+	}
+	if servers[1].Status().Code == 0 {
+		t.Errorf("failed RPC should mark the span as failed")
+	}
+	if !hasStatusCode(servers[1], codes.NotFound) {
+		t.Errorf("span should have the NotFound status code %v", servers[1].Attributes())
+	}
+}
+
+func TestStreamPropagation(t *testing.T) {
+	serverSpans, clientSpans := tracetest.NewSpanRecorder(), tracetest.NewSpanRecorder()
+	client := newTracedHealthClient(t, serverSpans, clientSpans)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watch, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch returned an error : %v", err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatalf("Recv returned an error : %v", err)
+	}
+
+	// the server span ends when the client gives up the stream
+	started := serverSpans.Started()
+	cancel()
+
+	clients := clientSpans.Ended()
+	if len(started) != 1 || len(clients) != 1 {
+		t.Fatalf("want 1 server and 1 client span; got %d and %d", len(started), len(clients))
+	}
+	if started[0].SpanKind() != trace.SpanKindServer {
+		t.Errorf("span kind = %v; want server", started[0].SpanKind())
+	}
+	assertChildOf(t, started[0], clients[0])
+}
+
+// assertChildOf checks that the given server span continues the trace of the given client span.
+func assertChildOf(t *testing.T, server sdktrace.ReadOnlySpan, client sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if server.SpanContext().TraceID() != client.SpanContext().TraceID() {
+		t.Errorf("trace id = %v; want %v", server.SpanContext().TraceID(), client.SpanContext().TraceID())
+	}
+	if server.Parent().SpanID() != client.SpanContext().SpanID() || !server.Parent().IsRemote() {
+		t.Errorf("parent = %v; want the remote span %v", server.Parent().SpanID(), client.SpanContext().SpanID())
+	}
+}
+
+// hasStatusCode returns true if the given span has the given gRPC status code.
+func hasStatusCode(span sdktrace.ReadOnlySpan, code codes.Code) bool {
+	for _, attr := range span.Attributes() {
+		if attr.Key == "rpc.grpc.status_code" {
+			return attr.Value.AsInt64() == int64(code)
+		}
+	}
+	return false
+}
+
+func TestRPCAttributes(t *testing.T) {
+	tests := map[string]struct {
+		FullMethod string
+		Expected   int
+	}{
+		"full method": {FullMethod: "/breed_image.BreedImageService/Search", Expected: 3},
+		"no method":   {FullMethod: "Search", Expected: 1},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			if got := len(rpcAttributes(test.FullMethod)); got != test.Expected {
+				t.Errorf("rpcAttributes(%q) has %d attributes; want %d", test.FullMethod, got, test.Expected)
+			}
+		})
+	}
+}
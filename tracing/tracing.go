@@ -0,0 +1,190 @@
+// tracing sets up the OpenTelemetry tracing of the server and the client.
+// The spans are exported to an OTLP collector over HTTP or written to the standard output or a file as JSON,
+// so the traces can be read without a collector.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// These are the exporters which can be selected in the settings.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// DefaultOTLPEndpoint is the default traces endpoint of an OTLP collector over HTTP.
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// otlpTimeout is the time limit of a single export to the OTLP collector.
+const otlpTimeout = time.Second * 10
+
+// Propagator carries the trace context and the baggage in the gRPC metadata.
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Settings holds the settings of the tracer provider.
+type Settings struct {
+	// ServiceName is reported as the service.name of the spans.
+	ServiceName string
+
+	// Exporter is the exporter of the spans, one of the Exporter constants.
+	// With ExporterNone the spans are still created and propagated, but they are not exported.
+	Exporter string
+
+	// Endpoint is the traces endpoint of the OTLP collector, it is used with ExporterOTLP.
+	Endpoint string
+
+	// File is the file the spans are appended to, it is used with ExporterFile.
+	File string
+
+	// SampleRatio is the fraction of the new traces which are sampled between 0 and 1.
+	// The traces started by a caller follow the sampling decision of the caller.
+	SampleRatio float64
+}
+
+// NewProvider returns a new tracer provider with the given settings.
+// The provider must be shut down to flush the spans which are not exported yet.
+func NewProvider(settings Settings) (*sdktrace.TracerProvider, error) {
+	if settings.SampleRatio < 0 || settings.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio must be between 0 and 1 : %v", settings.SampleRatio)
+	}
+
+	exporter, err := newExporter(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(settings.ServiceName))
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(settings.SampleRatio))),
+	}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	} else {
+		// the provider fails to shut down without a span processor
+		options = append(options, sdktrace.WithSpanProcessor(discardProcessor{}))
+	}
+	return sdktrace.NewTracerProvider(options...), nil
+}
+
+// discardProcessor is a span processor which drops all the spans, it is used when the spans are not exported.
+type discardProcessor struct{}
+
+// OnStart does nothing.
+func (discardProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd does nothing.
+func (discardProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+// Shutdown does nothing.
+func (discardProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush does nothing.
+func (discardProcessor) ForceFlush(context.Context) error { return nil }
+
+// newExporter returns the exporter of the given settings.
+// It returns nil for ExporterNone.
+func newExporter(settings Settings) (sdktrace.SpanExporter, error) {
+	switch settings.Exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		return NewJSONExporter(os.Stdout, nil)
+	case ExporterFile:
+		if settings.File == "" {
+			return nil, fmt.Errorf("trace file must not be empty")
+		}
+		file, err := os.OpenFile(settings.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the trace file : %v", err)
+		}
+		exporter, err := NewJSONExporter(file, file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return exporter, nil
+	case ExporterOTLP:
+		endpoint := settings.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultOTLPEndpoint
+		}
+		return NewOTLPExporter(endpoint)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter : %s", settings.Exporter)
+	}
+}
+
+// Shutdown flushes the spans of the given provider and stops it.
+// It waits at most the given timeout.
+func Shutdown(tp *sdktrace.TracerProvider, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return tp.Shutdown(ctx)
+}
+
+// NewOTLPExporter returns a new exporter which sends the spans to the given traces endpoint of an OTLP collector
+// over HTTP with the protobuf encoding. The http endpoints are used without TLS.
+// Example endpoint: "http://localhost:4318/v1/traces"
+func NewOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint : %s", endpoint)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithTimeout(otlpTimeout)}
+	if u.Path != "" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	switch u.Scheme {
+	case "http":
+		options = append(options, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("OTLP endpoint must be http or https : %s", endpoint)
+	}
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// NewJSONExporter returns a new exporter which writes the spans to the given writer as JSON, one span per line.
+// The closer is closed when the exporter is shut down, it can be nil.
+func NewJSONExporter(w io.Writer, closer io.Closer) (sdktrace.SpanExporter, error) {
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, err
+	}
+	if closer == nil {
+		return exporter, nil
+	}
+	return &closingExporter{SpanExporter: exporter, closer: closer}, nil
+}
+
+// closingExporter closes its closer after its exporter is shut down, e.g. the file of the spans.
+type closingExporter struct {
+	sdktrace.SpanExporter
+	closer io.Closer
+}
+
+// Shutdown shuts the exporter down and closes the closer.
+func (e *closingExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if closeErr := e.closer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,292 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := map[string]struct {
+		Settings Settings
+		Valid    bool
+	}{
+		"none": {
+			Settings: Settings{Exporter: ExporterNone, SampleRatio: 1},
+			Valid:    true,
+		},
+		"stdout": {
+			Settings: Settings{Exporter: ExporterStdout, SampleRatio: 1},
+			Valid:    true,
+		},
+		"file": {
+			Settings: Settings{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "traces.json"), SampleRatio: 1},
+			Valid:    true,
+		},
+		"file without path": {
+			Settings: Settings{Exporter: ExporterFile, SampleRatio: 1},
+			Valid:    false,
+		},
+		"otlp": {
+			Settings: Settings{Exporter: ExporterOTLP, Endpoint: DefaultOTLPEndpoint, SampleRatio: 0.5},
+			Valid:    true,
+		},
+		"unknown exporter": {
+			Settings: Settings{Exporter: "jaeger", SampleRatio: 1},
+			Valid:    false,
+		},
+		"negative sample ratio": {
+			Settings: Settings{Exporter: ExporterNone, SampleRatio: -0.1},
+			Valid:    false,
+		},
+		"sample ratio over 1": {
+			Settings: Settings{Exporter: ExporterNone, SampleRatio: 1.1},
+			Valid:    false,
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			tp, err := NewProvider(test.Settings)
+			if !test.Valid {
+				if err == nil {
+					t.Fatalf("error supposed to be returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error is not nil %v", err)
+			}
+			if err := tp.Shutdown(context.Background()); err != nil {
+				t.Fatalf("shutdown returned an error %v", err)
+			}
+		})
+	}
+}
+
+// recordSpans starts a parent and a failed child span with the given exporter and flushes them.
+func recordSpans(t *testing.T, exporter sdktrace.SpanExporter) (parent, child sdktrace.ReadOnlySpan) {
+	recorder := &spanCollector{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSpanProcessor(recorder))
+	tracer := tp.Tracer("test")
+
+	ctx, parentSpan := tracer.Start(context.Background(), "parent")
+	_, childSpan := tracer.Start(ctx, "child")
+	childSpan.SetAttributes(attribute.Int("count", 3), attribute.StringSlice("names", []string{"a", "b"}))
+	childSpan.SetStatus(codes.Error, "failed")
+	childSpan.End()
+	parentSpan.End()
+
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown returned an error %v", err)
+	}
+	if len(recorder.spans) != 2 {
+		t.Fatalf("want 2 spans; got %d", len(recorder.spans))
+	}
+	return recorder.spans[1], recorder.spans[0]
+}
+
+// spanCollector keeps the ended spans in order.
+type spanCollector struct {
+	spans []sdktrace.ReadOnlySpan
+}
+
+// OnStart does nothing.
+func (c *spanCollector) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd keeps the ended span.
+func (c *spanCollector) OnEnd(s sdktrace.ReadOnlySpan) { c.spans = append(c.spans, s) }
+
+// Shutdown does nothing.
+func (c *spanCollector) Shutdown(context.Context) error { return nil }
+
+// ForceFlush does nothing.
+func (c *spanCollector) ForceFlush(context.Context) error { return nil }
+
+// jsonSpan is the part of a span written by the JSON exporter which is checked by the tests.
+type jsonSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	Status      struct{ Code, Description string }
+	Attributes  []struct {
+		Key   string
+		Value struct {
+			Type  string
+			Value interface{}
+		}
+	}
+	InstrumentationLibrary struct{ Name string }
+}
+
+// decodeSpans decodes the spans of the given lines by their names.
+func decodeSpans(t *testing.T, data []byte) map[string]jsonSpan {
+	spans := make(map[string]jsonSpan)
+	for _, line := range bytes.Split(bytes.TrimSpace(data), []byte("\n")) {
+		var span jsonSpan
+		if err := json.Unmarshal(line, &span); err != nil {
+			t.Fatalf("span is not valid JSON %v", err)
+		}
+		if span.InstrumentationLibrary.Name != "test" {
+			t.Errorf("scope name = %q; want test", span.InstrumentationLibrary.Name)
+		}
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestJSONExporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	exporter, err := NewJSONExporter(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, child := recordSpans(t, exporter)
+
+	spans := decodeSpans(t, buf.Bytes())
+	encodedParent, encodedChild := spans["parent"], spans["child"]
+
+	if encodedParent.SpanContext.TraceID != parent.SpanContext().TraceID().String() || encodedChild.SpanContext.TraceID != encodedParent.SpanContext.TraceID {
+		t.Errorf("trace ids are not correct %v %v", encodedParent.SpanContext.TraceID, encodedChild.SpanContext.TraceID)
+	}
+	if encodedChild.Parent.SpanID != parent.SpanContext().SpanID().String() {
+		t.Errorf("parent span id = %q; want %q", encodedChild.Parent.SpanID, parent.SpanContext().SpanID())
+	}
+	if encodedChild.SpanContext.SpanID != child.SpanContext().SpanID().String() {
+		t.Errorf("span id = %q; want %q", encodedChild.SpanContext.SpanID, child.SpanContext().SpanID())
+	}
+	if encodedChild.Status.Code != "Error" || encodedChild.Status.Description != "failed" {
+		t.Errorf("status = %v; want error", encodedChild.Status)
+	}
+	if len(encodedChild.Attributes) != 2 || encodedChild.Attributes[0].Key != "count" || encodedChild.Attributes[0].Value.Value != float64(3) {
+		t.Errorf("attributes are not correct %v", encodedChild.Attributes)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	tp, err := NewProvider(Settings{Exporter: ExporterFile, File: path, SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("error is not nil %v", err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), "span")
+	span.End()
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown returned an error %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decodeSpans(t, data)["span"]; !ok {
+		t.Errorf("span is not written to the file %s", data)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("request is not correct %s %s %s", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		req := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("export request is not valid %v", err)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					names = append(names, span.Name)
+				}
+			}
+		}
+	}))
+	defer ts.Close()
+
+	exporter, err := NewOTLPExporter(ts.URL + "/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSpans(t, exporter)
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(names)
+	if expected := []string{"child", "parent"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("exported spans = %v; want %v", names, expected)
+	}
+}
+
+func TestOTLPExporterFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	exporter, err := NewOTLPExporter(ts.URL + "/v1/traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := sdktrace.NewTracerProvider()
+	_, span := tp.Tracer("test").Start(context.Background(), "span")
+	span.End()
+
+	err = exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{span.(sdktrace.ReadOnlySpan)})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("error should tell the status code %v", err)
+	}
+}
+
+func TestNewOTLPExporter(t *testing.T) {
+	tests := map[string]struct {
+		Endpoint string
+		Valid    bool
+	}{
+		"http":           {Endpoint: "http://localhost:4318/v1/traces", Valid: true},
+		"https":          {Endpoint: "https://collector.example.com/v1/traces", Valid: true},
+		"unknown scheme": {Endpoint: "grpc://localhost:4317", Valid: false},
+		"without host":   {Endpoint: "/v1/traces", Valid: false},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			exporter, err := NewOTLPExporter(test.Endpoint)
+			if (err == nil) != test.Valid {
+				t.Fatalf("want err == nil => %t; got err %v", test.Valid, err)
+			}
+			if exporter != nil {
+				exporter.Shutdown(context.Background())
+			}
+		})
+	}
+}